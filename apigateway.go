@@ -140,6 +140,57 @@ func integrationResponses(api *API, userResponses map[int]*IntegrationResponse,
 	return &integrationResponses
 }
 
+// apiGatewayModels adds an AWS::ApiGateway::Model resource for each model
+// and returns the Content-Type to model name map
+func apiGatewayModels(models map[string]*Model,
+	restAPIID gocf.Stringable,
+	resourcePrefix string,
+	template *gocf.Template) (map[string]interface{}, error) {
+
+	modelRefs := make(map[string]interface{})
+	for eachContentType, eachModel := range models {
+		if eachModel == nil || eachModel.Schema == "" {
+			continue
+		}
+		var schema interface{}
+		unmarshalErr := json.Unmarshal([]byte(eachModel.Schema), &schema)
+		if unmarshalErr != nil {
+			return nil, fmt.Errorf("invalid JSON Schema for %s model: %s",
+				eachContentType,
+				unmarshalErr)
+		}
+		apiModel := &gocf.APIGatewayModel{
+			ContentType: gocf.String(eachContentType),
+			RestAPIID:   restAPIID.String(),
+			Schema:      schema,
+		}
+		if eachModel.Name != "" {
+			apiModel.Name = gocf.String(eachModel.Name)
+		}
+		if eachModel.Description != "" {
+			apiModel.Description = gocf.String(eachModel.Description)
+		}
+		modelResName := CloudFormationResourceName(resourcePrefix, eachContentType)
+		template.AddResource(modelResName, apiModel)
+		modelRefs[eachContentType] = gocf.Ref(modelResName)
+	}
+	return modelRefs, nil
+}
+
+// schemaModels returns the application/json model for the JSON Schema, if
+// any. The Method and IntegrationResponse Models values aren't published.
+func schemaModels(schema string, description string) map[string]*Model {
+	if schema == "" {
+		return nil
+	}
+	return map[string]*Model{
+		"application/json": {
+			Description: description,
+			Schema:      schema,
+		},
+	}
+}
+
 func methodRequestTemplates(method *Method) (map[string]string, error) {
 	supportedTemplates := map[string]string{
 		"application/json":                  _escFSMustString(false, "/resources/provision/apigateway/inputmapping_json.vtl"),
@@ -350,7 +401,8 @@ type APIGatewayLambdaJSONEvent struct {
 // Model proxies the AWS SDK's Model data.  See
 // http://docs.aws.amazon.com/sdk-for-go/api/service/apigateway.html#Model
 //
-// TODO: Support Dynamic Model creation
+// Models with a non-empty Schema are published as AWS::ApiGateway::Model
+// resources.
 type Model struct {
 	Description string `json:",omitempty"`
 	Name        string `json:",omitempty"`
@@ -694,6 +746,43 @@ func (api *API) Marshal(serviceName string,
 
 			prefix := fmt.Sprintf("%s%s", eachMethodDef.httpMethod, eachResourceMethodKey)
 			methodResourceName := CloudFormationResourceName(prefix, eachResourceMethodKey, serviceName)
+
+			// Publish the lambda function JSON Schemas as the application/json
+			// request and default response models
+			requestSchema := ""
+			responseSchema := ""
+			if eachResourceDef.parentLambda.Schemas != nil {
+				requestSchema = eachResourceDef.parentLambda.Schemas.Request
+				responseSchema = eachResourceDef.parentLambda.Schemas.Response
+			}
+			requestModels, requestModelsErr := apiGatewayModels(schemaModels(requestSchema,
+				fmt.Sprintf("%s %s request", eachMethodName, eachResourceDef.pathPart)),
+				apiGatewayRestAPIID,
+				fmt.Sprintf("%sRequestModel", methodResourceName),
+				template)
+			if requestModelsErr != nil {
+				return requestModelsErr
+			}
+			if len(requestModels) != 0 {
+				apiGatewayMethod.RequestModels = requestModels
+			}
+			for eachIndex, eachMethodResponse := range *apiGatewayMethod.MethodResponses {
+				statusCode, _ := strconv.Atoi(eachMethodResponse.StatusCode.Literal)
+				if statusCode != eachMethodDef.defaultHTTPResponseCode {
+					continue
+				}
+				responseModels, responseModelsErr := apiGatewayModels(schemaModels(responseSchema,
+					fmt.Sprintf("%s %s response", eachMethodName, eachResourceDef.pathPart)),
+					apiGatewayRestAPIID,
+					fmt.Sprintf("%sResponseModel%d", methodResourceName, statusCode),
+					template)
+				if responseModelsErr != nil {
+					return responseModelsErr
+				}
+				if len(responseModels) != 0 {
+					(*apiGatewayMethod.MethodResponses)[eachIndex].ResponseModels = responseModels
+				}
+			}
 			res := template.AddResource(methodResourceName, apiGatewayMethod)
 			res.DependsOn = append(res.DependsOn, apiGatewayPermissionResourceName)
 			apiMethodCloudFormationResources = append(apiMethodCloudFormationResources,
@@ -804,6 +893,7 @@ func (api *API) NewResource(pathPart string, parentLambda *LambdaAWSInfo) (*Reso
 		parentLambda: parentLambda,
 		Methods:      make(map[string]*Method),
 	}
+	parentLambda.apiGatewayTarget = true
 	api.resources[resourcesKey] = resource
 	return resource, nil
 }
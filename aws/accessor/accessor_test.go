@@ -4,9 +4,12 @@ import (
 	"context"
 	"math/rand"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	sparta "github.com/mweagle/Sparta"
 	"github.com/rs/zerolog"
 )
@@ -101,3 +104,32 @@ func testPutAll(t *testing.T, kvStore KevValueAccessor) {
 		t.Fatalf("%T failed to confirm all items deleted: %s", kvStore, getAll)
 	}
 }
+
+func TestExpiredValues(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	expiredItem := map[string]*dynamodb.AttributeValue{
+		DynamoAttributeExpiry: {N: aws.String(strconv.FormatInt(past.Unix(), 10))},
+	}
+	liveItem := map[string]*dynamodb.AttributeValue{
+		DynamoAttributeExpiry: {N: aws.String(strconv.FormatInt(future.Unix(), 10))},
+	}
+	if !dynamoItemExpired(expiredItem) ||
+		dynamoItemExpired(liveItem) ||
+		dynamoItemExpired(map[string]*dynamodb.AttributeValue{}) {
+		t.Fatalf("Unexpected DynamoDB item expiry result")
+	}
+	// S3 returns canonicalized user metadata keys
+	expiredMetadata := map[string]*string{
+		"Sparta-Expiry": aws.String(past.UTC().Format(time.RFC3339)),
+	}
+	liveMetadata := map[string]*string{
+		"sparta-expiry": aws.String(future.UTC().Format(time.RFC3339)),
+	}
+	if !s3ObjectExpired(expiredMetadata) ||
+		s3ObjectExpired(liveMetadata) ||
+		s3ObjectExpired(nil) {
+		t.Fatalf("Unexpected S3 object expiry result")
+	}
+}
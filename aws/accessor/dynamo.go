@@ -5,8 +5,11 @@ package accessor
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	sparta "github.com/mweagle/Sparta"
@@ -16,6 +19,11 @@ import (
 
 const (
 	attrID = "id"
+	// DynamoAttributeExpiry is the name of the numeric attribute that stores
+	// the expiry time (in epoch seconds) of items written by PutWithExpiry.
+	// Configure this attribute as the table's TimeToLiveSpecification
+	// AttributeName to have DynamoDB automatically delete expired items.
+	DynamoAttributeExpiry = "expiry"
 )
 
 // DynamoAccessor to make it a bit easier to work with Dynamo
@@ -55,6 +63,18 @@ func dynamoKeyValueAttrMap(keyPath string) map[string]*dynamodb.AttributeValue {
 		}}
 }
 
+func dynamoItemExpired(item map[string]*dynamodb.AttributeValue) bool {
+	expiryVal, expiryValOk := item[DynamoAttributeExpiry]
+	if !expiryValOk || expiryVal.N == nil {
+		return false
+	}
+	expiry, expiryErr := strconv.ParseInt(*expiryVal.N, 10, 64)
+	if expiryErr != nil {
+		return false
+	}
+	return time.Now().Unix() >= expiry
+}
+
 // Delete handles deleting the resource
 func (svc *DynamoAccessor) Delete(ctx context.Context, keyPath string) error {
 	deleteItemInput := &dynamodb.DeleteItemInput{
@@ -106,6 +126,36 @@ func (svc *DynamoAccessor) DeleteAll(ctx context.Context) error {
 
 // Put handles saving the item
 func (svc *DynamoAccessor) Put(ctx context.Context, keyPath string, object interface{}) error {
+	return svc.putItem(ctx, keyPath, object, nil, false)
+}
+
+// PutWithExpiry handles saving an item that expires at the given time
+func (svc *DynamoAccessor) PutWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+	return svc.putItem(ctx, keyPath, object, &expiry, false)
+}
+
+// CreateWithExpiry handles saving an item that expires at the given time
+// only if the key doesn't exist or the existing item has expired
+func (svc *DynamoAccessor) CreateWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+	putErr := svc.putItem(ctx, keyPath, object, &expiry, true)
+	awsErr, awsErrOk := putErr.(awserr.Error)
+	if awsErrOk && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrKeyExists
+	}
+	return putErr
+}
+
+func (svc *DynamoAccessor) putItem(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry *time.Time,
+	conditional bool) error {
 
 	// What's the type of the object?
 	if object == nil {
@@ -123,10 +173,29 @@ func (svc *DynamoAccessor) Put(ctx context.Context, keyPath string, object inter
 			S: aws.String(keyPath),
 		}
 	}
+	if expiry != nil {
+		marshal[DynamoAttributeExpiry] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(expiry.Unix(), 10)),
+		}
+	}
 	putItemInput := &dynamodb.PutItemInput{
 		TableName: aws.String(svc.dynamoTableName()),
 		Item:      marshal,
 	}
+	// Items without an expiry never expire. Items expire at the expiry
+	// time, consistent with dynamoItemExpired.
+	if conditional {
+		putItemInput.ConditionExpression = aws.String("attribute_not_exists(#id) OR #expiry <= :now")
+		putItemInput.ExpressionAttributeNames = map[string]*string{
+			"#id":     aws.String(attrID),
+			"#expiry": aws.String(DynamoAttributeExpiry),
+		}
+		putItemInput.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":now": {
+				N: aws.String(strconv.FormatInt(time.Now().Unix(), 10)),
+			},
+		}
+	}
 	_, putItemErr := svc.dynamoSvc(ctx).PutItemWithContext(ctx, putItemInput)
 	return putItemErr
 }
@@ -144,6 +213,11 @@ func (svc *DynamoAccessor) Get(ctx context.Context,
 	if getItemResultErr != nil {
 		return getItemResultErr
 	}
+	// DynamoDB TTL deletion is eventually consistent, so
+	// treat expired items as missing items
+	if dynamoItemExpired(getItemResult.Item) {
+		return nil
+	}
 	return dynamodbattribute.UnmarshalMap(getItemResult.Item, destObject)
 }
 
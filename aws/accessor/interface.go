@@ -2,7 +2,9 @@ package accessor
 
 import (
 	"context"
+	"errors"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-xray-sdk-go/xray"
@@ -28,3 +30,24 @@ type KevValueAccessor interface {
 	Get(ctx context.Context, keyPath string, object interface{}) error
 	GetAll(ctx context.Context, ctor NewObjectConstructor) ([]interface{}, error)
 }
+
+// ExpiringKeyValueAccessor represents a KV store that supports
+// values with an expiration time. Expired values are treated as
+// missing values by Get.
+type ExpiringKeyValueAccessor interface {
+	KevValueAccessor
+	PutWithExpiry(ctx context.Context,
+		keyPath string,
+		object interface{},
+		expiry time.Time) error
+	// CreateWithExpiry atomically saves the value only if there isn't
+	// an unexpired value for the key. It returns ErrKeyExists if there is.
+	CreateWithExpiry(ctx context.Context,
+		keyPath string,
+		object interface{},
+		expiry time.Time) error
+}
+
+// ErrKeyExists is the error returned by CreateWithExpiry when there is an
+// unexpired value for the key
+var ErrKeyExists = errors.New("Unexpired value already exists for key")
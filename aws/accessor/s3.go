@@ -5,8 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	sparta "github.com/mweagle/Sparta"
 	spartaAWS "github.com/mweagle/Sparta/aws"
@@ -15,6 +20,12 @@ import (
 	"github.com/rs/zerolog"
 )
 
+const (
+	// s3MetadataExpiry is the user metadata key that stores the expiry
+	// time of objects written by PutWithExpiry
+	s3MetadataExpiry = "Sparta-Expiry"
+)
+
 // S3Accessor to make it a bit easier to work with S3
 // as the backing store
 type S3Accessor struct {
@@ -61,6 +72,20 @@ func (svc *S3Accessor) s3BucketName() string {
 	return s3BucketRes.ResourceRef
 }
 
+func s3ObjectExpired(metadata map[string]*string) bool {
+	for eachKey, eachValue := range metadata {
+		if !strings.EqualFold(eachKey, s3MetadataExpiry) || eachValue == nil {
+			continue
+		}
+		expiry, expiryErr := time.Parse(time.RFC3339, *eachValue)
+		if expiryErr != nil {
+			return false
+		}
+		return !time.Now().Before(expiry)
+	}
+	return false
+}
+
 // Delete handles deleting the resource
 func (svc *S3Accessor) Delete(ctx context.Context, keyPath string) error {
 	deleteObjectInput := &s3.DeleteObjectInput{
@@ -100,6 +125,69 @@ func (svc *S3Accessor) DeleteAll(ctx context.Context) error {
 
 // Put handles saving the item
 func (svc *S3Accessor) Put(ctx context.Context, keyPath string, object interface{}) error {
+	return svc.putObject(ctx, keyPath, object, nil)
+}
+
+// PutWithExpiry handles saving an item that expires at the given time.
+// Expired objects are not deleted from the bucket. Use a bucket
+// lifecycle rule to remove stale objects.
+func (svc *S3Accessor) PutWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+	return svc.putObject(ctx, keyPath, object, &expiry)
+}
+
+// CreateWithExpiry handles saving an item that expires at the given time
+// only if the key doesn't exist or the existing object has expired. The
+// object is written with an S3 conditional PutObject request so that
+// concurrent writers can't both succeed.
+func (svc *S3Accessor) CreateWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+
+	precondition := request.WithSetRequestHeaders(map[string]string{
+		"If-None-Match": "*",
+	})
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket: aws.String(svc.s3BucketName()),
+		Key:    aws.String(keyPath),
+	}
+	headObjectResult, headObjectResultErr := svc.
+		s3Svc(ctx).
+		HeadObjectWithContext(ctx, headObjectInput)
+	if headObjectResultErr == nil {
+		if !s3ObjectExpired(headObjectResult.Metadata) {
+			return ErrKeyExists
+		}
+		// Only replace the expired object that was just read
+		precondition = request.WithSetRequestHeaders(map[string]string{
+			"If-Match": aws.StringValue(headObjectResult.ETag),
+		})
+	} else if !s3RequestFailed(headObjectResultErr, http.StatusNotFound) {
+		return headObjectResultErr
+	}
+	putErr := svc.putObject(ctx, keyPath, object, &expiry, precondition)
+	if s3RequestFailed(putErr, http.StatusPreconditionFailed) ||
+		s3RequestFailed(putErr, http.StatusConflict) {
+		return ErrKeyExists
+	}
+	return putErr
+}
+
+// s3RequestFailed returns true if the error is an S3 request failure with
+// the HTTP status code
+func s3RequestFailed(err error, statusCode int) bool {
+	requestFailure, requestFailureOk := err.(awserr.RequestFailure)
+	return requestFailureOk && requestFailure.StatusCode() == statusCode
+}
+
+func (svc *S3Accessor) putObject(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry *time.Time,
+	options ...request.Option) error {
 	jsonBytes, jsonBytesErr := json.Marshal(object)
 	if jsonBytesErr != nil {
 		return jsonBytesErr
@@ -117,9 +205,15 @@ func (svc *S3Accessor) Put(ctx context.Context, keyPath string, object interface
 		Key:    aws.String(keyPath),
 		Body:   bytesReader,
 	}
+	if expiry != nil {
+		putObjectInput.Expires = aws.Time(*expiry)
+		putObjectInput.Metadata = map[string]*string{
+			s3MetadataExpiry: aws.String(expiry.UTC().Format(time.RFC3339)),
+		}
+	}
 	putObjectResponse, putObjectRespErr := svc.
 		s3Svc(ctx).
-		PutObjectWithContext(ctx, putObjectInput)
+		PutObjectWithContext(ctx, putObjectInput, options...)
 
 	logger.Debug().
 		Err(putObjectRespErr).
@@ -144,6 +238,11 @@ func (svc *S3Accessor) Get(ctx context.Context,
 	if getObjectResultErr != nil {
 		return getObjectResultErr
 	}
+	defer getObjectResult.Body.Close()
+	// Expired objects are treated as missing items
+	if s3ObjectExpired(getObjectResult.Metadata) {
+		return nil
+	}
 	jsonBytes, jsonBytesErr := ioutil.ReadAll(getObjectResult.Body)
 	if jsonBytesErr != nil {
 		return jsonBytesErr
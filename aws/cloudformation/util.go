@@ -625,6 +625,69 @@ func StackExists(stackNameOrID string, awsSession *session.Session, logger *zero
 	return exists, nil
 }
 
+// stackResourcesLister is the signature of the
+// CloudFormation.ListStackResourcesPages function
+type stackResourcesLister func(*cloudformation.ListStackResourcesInput,
+	func(*cloudformation.ListStackResourcesOutput, bool) bool) error
+
+// stackResources returns the resources of the stackID and its nested stacks
+func stackResources(stackID string,
+	listPages stackResourcesLister) ([]*cloudformation.StackResource, error) {
+	resources := []*cloudformation.StackResource{}
+	nestedStackIDs := []string{}
+	listErr := listPages(&cloudformation.ListStackResourcesInput{
+		StackName: aws.String(stackID),
+	}, func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+		for _, eachSummary := range page.StackResourceSummaries {
+			resources = append(resources, &cloudformation.StackResource{
+				StackId:              aws.String(stackID),
+				LogicalResourceId:    eachSummary.LogicalResourceId,
+				PhysicalResourceId:   eachSummary.PhysicalResourceId,
+				ResourceType:         eachSummary.ResourceType,
+				ResourceStatus:       eachSummary.ResourceStatus,
+				ResourceStatusReason: eachSummary.ResourceStatusReason,
+				Timestamp:            eachSummary.LastUpdatedTimestamp,
+			})
+			// The physical ID of a nested stack is its stack ID
+			if aws.StringValue(eachSummary.ResourceType) == "AWS::CloudFormation::Stack" &&
+				aws.StringValue(eachSummary.PhysicalResourceId) != "" {
+				nestedStackIDs = append(nestedStackIDs, aws.StringValue(eachSummary.PhysicalResourceId))
+			}
+		}
+		return true
+	})
+	if listErr != nil {
+		return nil, errors.Wrapf(listErr, "Failed to list resources for stack: %s", stackID)
+	}
+	for _, eachStackID := range nestedStackIDs {
+		nestedResources, nestedResourcesErr := stackResources(eachStackID, listPages)
+		if nestedResourcesErr != nil {
+			return nil, nestedResourcesErr
+		}
+		resources = append(resources, nestedResources...)
+	}
+	return resources, nil
+}
+
+// StackResources returns the resources of the given stackName or stackID
+// and, recursively, of its nested stacks. Each resource's StackId is the
+// ID of the stack that contains it. Unlike DescribeStackResources, the
+// resources aren't limited to the first 100.
+func StackResources(stackNameOrID string, awsSession *session.Session) ([]*cloudformation.StackResource, error) {
+	cf := cloudformation.New(awsSession)
+	describeStacksOutput, describeStacksOutputErr := cf.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackNameOrID),
+	})
+	if describeStacksOutputErr != nil {
+		return nil, describeStacksOutputErr
+	}
+	if len(describeStacksOutput.Stacks) == 0 {
+		return nil, errors.Errorf("Stack does not exist: %s", stackNameOrID)
+	}
+	return stackResources(aws.StringValue(describeStacksOutput.Stacks[0].StackId),
+		cf.ListStackResourcesPages)
+}
+
 // CreateStackChangeSet returns the DescribeChangeSetOutput
 // for a given stack transformation
 func CreateStackChangeSet(changeSetRequestName string,
@@ -635,6 +698,49 @@ func CreateStackChangeSet(changeSetRequestName string,
 	stackTags map[string]string,
 	awsCloudFormation *cloudformation.CloudFormation,
 	logger *zerolog.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	return createStackChangeSet(changeSetRequestName,
+		serviceName,
+		cfTemplate,
+		templateURL,
+		stackParameters,
+		stackTags,
+		false,
+		awsCloudFormation,
+		logger)
+}
+
+// CreateStackHierarchyChangeSet returns the DescribeChangeSetOutput for a
+// given stack transformation that also includes the nested stacks'
+// changes. Each AWS::CloudFormation::Stack change's ChangeSetId is the
+// nested stack's change set.
+func CreateStackHierarchyChangeSet(changeSetRequestName string,
+	serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	stackParameters map[string]string,
+	stackTags map[string]string,
+	awsCloudFormation *cloudformation.CloudFormation,
+	logger *zerolog.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	return createStackChangeSet(changeSetRequestName,
+		serviceName,
+		cfTemplate,
+		templateURL,
+		stackParameters,
+		stackTags,
+		true,
+		awsCloudFormation,
+		logger)
+}
+
+func createStackChangeSet(changeSetRequestName string,
+	serviceName string,
+	cfTemplate *gocf.Template,
+	templateURL string,
+	stackParameters map[string]string,
+	stackTags map[string]string,
+	includeNestedStacks bool,
+	awsCloudFormation *cloudformation.CloudFormation,
+	logger *zerolog.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
 
 	cloudFormationParameters := make([]*cloudformation.Parameter,
 		0,
@@ -656,6 +762,9 @@ func CreateStackChangeSet(changeSetRequestName string,
 		TemplateURL:   aws.String(templateURL),
 		Parameters:    cloudFormationParameters,
 	}
+	if includeNestedStacks {
+		changeSetInput.IncludeNestedStacks = aws.Bool(true)
+	}
 	if len(stackTags) != 0 {
 		awsTags := []*cloudformation.Tag{}
 		for eachKey, eachValue := range stackTags {
@@ -709,6 +818,12 @@ func CreateStackChangeSet(changeSetRequestName string,
 			case "CREATE_COMPLETE":
 				changeSetStabilized = true
 			case "FAILED":
+				// Change sets without changes are reported as failures
+				if isEmptyChangeSetStatus(describeChangeSetOutput) {
+					describeChangeSetOutput.Changes = nil
+					changeSetStabilized = true
+					break
+				}
 				return nil, fmt.Errorf("failed to create ChangeSet: %#v", *describeChangeSetOutput)
 			}
 		}
@@ -735,6 +850,16 @@ func CreateStackChangeSet(changeSetRequestName string,
 	return describeChangeSetOutput, nil
 }
 
+// isEmptyChangeSetStatus returns true if the change set failed because
+// the update didn't include any changes
+func isEmptyChangeSetStatus(changeSet *cloudformation.DescribeChangeSetOutput) bool {
+	if changeSet.StatusReason == nil {
+		return false
+	}
+	return strings.Contains(*changeSet.StatusReason, "didn't contain changes") ||
+		strings.Contains(*changeSet.StatusReason, "No updates are to be performed")
+}
+
 // DeleteChangeSet is a utility function that attempts to delete
 // an existing CloudFormation change set, with a bit of retry
 // logic in case of EC
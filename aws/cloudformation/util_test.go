@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	"github.com/rs/zerolog"
 )
@@ -164,3 +166,60 @@ func TestPlatformScopedName(t *testing.T) {
 		t.Fatalf("Failed to get `user` AWS account name for Stack")
 	}
 }
+
+func TestStackResources(t *testing.T) {
+	summary := func(logicalID string, resourceType string, physicalID string) *cloudformation.StackResourceSummary {
+		return &cloudformation.StackResourceSummary{
+			LogicalResourceId:  aws.String(logicalID),
+			ResourceType:       aws.String(resourceType),
+			PhysicalResourceId: aws.String(physicalID),
+		}
+	}
+	pages := map[string][][]*cloudformation.StackResourceSummary{
+		"root": {
+			{summary("Role", "AWS::IAM::Role", "role")},
+			{summary("Nested1", "AWS::CloudFormation::Stack", "nested1")},
+		},
+		"nested1": {
+			{summary("Hello", "AWS::Lambda::Function", "hello"),
+				summary("Nested2", "AWS::CloudFormation::Stack", "nested2")},
+		},
+		"nested2": {
+			{summary("World", "AWS::Lambda::Function", "world")},
+		},
+	}
+	lister := func(input *cloudformation.ListStackResourcesInput,
+		fn func(*cloudformation.ListStackResourcesOutput, bool) bool) error {
+		stackPages := pages[aws.StringValue(input.StackName)]
+		for eachIndex, eachPage := range stackPages {
+			if !fn(&cloudformation.ListStackResourcesOutput{StackResourceSummaries: eachPage},
+				eachIndex == len(stackPages)-1) {
+				break
+			}
+		}
+		return nil
+	}
+	resources, resourcesErr := stackResources("root", lister)
+	if resourcesErr != nil {
+		t.Fatal(resourcesErr)
+	}
+	stackIDs := map[string]string{}
+	for _, eachResource := range resources {
+		stackIDs[aws.StringValue(eachResource.LogicalResourceId)] = aws.StringValue(eachResource.StackId)
+	}
+	expected := map[string]string{
+		"Role":    "root",
+		"Nested1": "root",
+		"Hello":   "nested1",
+		"Nested2": "nested1",
+		"World":   "nested2",
+	}
+	if len(resources) != len(expected) {
+		t.Fatalf("Unexpected resources: %#v", stackIDs)
+	}
+	for eachLogicalID, eachStackID := range expected {
+		if stackIDs[eachLogicalID] != eachStackID {
+			t.Fatalf("Expected %s in stack %s. Found: %#v", eachLogicalID, eachStackID, stackIDs)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package cloudwatchlogs
 import (
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
@@ -22,6 +24,19 @@ func tailParams(logGroupName string, filter string, lastEvent int64) *cloudwatch
 	return params
 }
 
+// TailOptions are the options for TailWithOptions
+type TailOptions struct {
+	// FilterPattern is the optional CloudWatch Logs filter pattern
+	FilterPattern string
+	// StartTime is the time of the first event to return. The
+	// default value is the current time.
+	StartTime time.Time
+	// EndTime is the optional time of the last event to return. If
+	// nonzero, the output channel is closed after the matching events
+	// are returned rather than polling for new events.
+	EndTime time.Time
+}
+
 // TailWithContext is a utility function that support tailing the given log stream
 // name using the optional filter. It returns a channel for log messages
 func TailWithContext(reqContext aws.Context,
@@ -30,9 +45,28 @@ func TailWithContext(reqContext aws.Context,
 	logGroupName string,
 	filter string,
 	logger *zerolog.Logger) <-chan *cloudwatchlogs.FilteredLogEvent {
+	return TailWithOptions(reqContext,
+		closeChan,
+		awsSession,
+		logGroupName,
+		TailOptions{FilterPattern: filter},
+		logger)
+}
+
+// TailWithOptions is a utility function that supports tailing the given log
+// group name. It returns a channel for log messages.
+func TailWithOptions(reqContext aws.Context,
+	closeChan chan bool,
+	awsSession *session.Session,
+	logGroupName string,
+	options TailOptions,
+	logger *zerolog.Logger) <-chan *cloudwatchlogs.FilteredLogEvent {
 
 	// Milliseconds...
 	lastSeenTimestamp := time.Now().Add(0).Unix() * 1000
+	if !options.StartTime.IsZero() {
+		lastSeenTimestamp = options.StartTime.UnixNano() / int64(time.Millisecond)
+	}
 	logger.Debug().
 		Int64("TS", lastSeenTimestamp).
 		Msg("Started polling")
@@ -52,8 +86,30 @@ func TailWithContext(reqContext aws.Context,
 		}
 		return !lastPage
 	}
+	errorEvent := func(err error) *cloudwatchlogs.FilteredLogEvent {
+		return &cloudwatchlogs.FilteredLogEvent{
+			EventId:   aws.String("N/A"),
+			Message:   aws.String(err.Error()),
+			Timestamp: aws.Int64(time.Now().Unix() * 1000),
+		}
+	}
 
 	cwlogsSvc := cloudwatchlogs.New(awsSession)
+
+	// Bounded queries return the matching events and close the channel
+	if !options.EndTime.IsZero() {
+		go func() {
+			defer close(outputChannel)
+			logParam := tailParams(logGroupName, options.FilterPattern, lastSeenTimestamp)
+			logParam.EndTime = aws.Int64(options.EndTime.UnixNano() / int64(time.Millisecond))
+			error := cwlogsSvc.FilterLogEventsPagesWithContext(reqContext, logParam, tailHandler)
+			if error != nil {
+				outputChannel <- errorEvent(error)
+			}
+		}()
+		return outputChannel
+	}
+
 	tickerChan := time.NewTicker(time.Millisecond * 333).C //AWS cloudwatch logs limit is 5tx/sec
 	go func() {
 		for {
@@ -62,19 +118,70 @@ func TailWithContext(reqContext aws.Context,
 				logger.Debug().Msg("Exiting polling loop")
 				return
 			case <-tickerChan:
-				logParam := tailParams(logGroupName, filter, lastSeenTimestamp)
+				logParam := tailParams(logGroupName, options.FilterPattern, lastSeenTimestamp)
 				error := cwlogsSvc.FilterLogEventsPagesWithContext(reqContext, logParam, tailHandler)
 				if error != nil {
 					// Just pump the thing back through the channel...
-					errorEvent := &cloudwatchlogs.FilteredLogEvent{
-						EventId:   aws.String("N/A"),
-						Message:   aws.String(error.Error()),
-						Timestamp: aws.Int64(time.Now().Unix() * 1000),
-					}
-					outputChannel <- errorEvent
+					outputChannel <- errorEvent(error)
 				}
 			}
 		}
 	}()
 	return outputChannel
 }
+
+// QueryWithContext runs the CloudWatch Logs Insights query across the log
+// groups and returns the result rows once the query is complete
+func QueryWithContext(reqContext aws.Context,
+	awsSession *session.Session,
+	logGroupNames []string,
+	queryString string,
+	startTime time.Time,
+	endTime time.Time,
+	logger *zerolog.Logger) ([][]*cloudwatchlogs.ResultField, error) {
+
+	cwlogsSvc := cloudwatchlogs.New(awsSession)
+	startQueryInput := &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: aws.StringSlice(logGroupNames),
+		QueryString:   aws.String(queryString),
+		StartTime:     aws.Int64(startTime.Unix()),
+		EndTime:       aws.Int64(endTime.Unix()),
+	}
+	startQueryOutput, startQueryErr := cwlogsSvc.StartQueryWithContext(reqContext, startQueryInput)
+	if startQueryErr != nil {
+		return nil, errors.Wrapf(startQueryErr, "Failed to start query")
+	}
+	logger.Debug().
+		Str("QueryID", *startQueryOutput.QueryId).
+		Strs("LogGroups", logGroupNames).
+		Msg("Started CloudWatch Logs Insights query")
+
+	getResultsInput := &cloudwatchlogs.GetQueryResultsInput{
+		QueryId: startQueryOutput.QueryId,
+	}
+	for {
+		select {
+		case <-reqContext.Done():
+			return nil, reqContext.Err()
+		case <-time.After(time.Second):
+		}
+		getResultsOutput, getResultsErr := cwlogsSvc.GetQueryResultsWithContext(reqContext,
+			getResultsInput)
+		if getResultsErr != nil {
+			return nil, errors.Wrapf(getResultsErr, "Failed to get query results")
+		}
+		status := aws.StringValue(getResultsOutput.Status)
+		logger.Debug().
+			Str("Status", status).
+			Msg("CloudWatch Logs Insights query status")
+		switch status {
+		case cloudwatchlogs.QueryStatusComplete:
+			return getResultsOutput.Results, nil
+		case cloudwatchlogs.QueryStatusFailed,
+			cloudwatchlogs.QueryStatusCancelled:
+			return nil, errors.Errorf("CloudWatch Logs Insights query %s: %s",
+				*startQueryOutput.QueryId,
+				status)
+		}
+	}
+}
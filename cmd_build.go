@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -93,12 +94,18 @@ type buildContext struct {
 	templateWriter io.Writer
 	// CloudFormation Template
 	cfTemplate *gocf.Template
-	// name of the binary inside the ZIP archive
-	compiledBinaryOutput string
+	// Runtime and architectures of the code package
+	lambdaPackage *lambdaPackage
 	// Context to pass between workflow operations
 	workflowHooksContext context.Context
 }
 
+// compiledBinaryOutput returns the local path of the binary compiled
+// for the architecture
+func (bc *buildContext) compiledBinaryOutput(arch AWSLambdaArchitecture) string {
+	return filepath.Join(bc.outputDirectory, lambdaBinaryName(arch.goArch()))
+}
+
 // relativePath returns the relative path of inputPath if it's relative to the current
 // workint directory
 func relativePath(inputPath string) string {
@@ -288,47 +295,52 @@ type verifyAWSPreconditionsOp struct {
 	userdata *userdata
 }
 
-func (vapo *verifyAWSPreconditionsOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
-	// If there are codePipeline environments defined, warn if they don't include
-	// the same keysets
-	if nil != codePipelineEnvironments {
-		mapKeys := func(inboundMap map[string]string) []string {
-			keys := make([]string, len(inboundMap))
-			i := 0
-			for k := range inboundMap {
-				keys[i] = k
-				i++
-			}
-			return keys
-		}
-		aggregatedKeys := make([][]string, len(codePipelineEnvironments))
+// codePipelineEnvironmentsEquivalent returns true if every CodePipeline
+// environment defines the same set of keys
+func codePipelineEnvironmentsEquivalent() bool {
+	mapKeys := func(inboundMap map[string]string) []string {
+		keys := make([]string, len(inboundMap))
 		i := 0
-		for _, eachEnvMap := range codePipelineEnvironments {
-			aggregatedKeys[i] = mapKeys(eachEnvMap)
+		for k := range inboundMap {
+			keys[i] = k
 			i++
 		}
-		i = 0
-		keysEqual := true
-		for _, eachKeySet := range aggregatedKeys {
-			j := 0
-			for _, eachKeySetTest := range aggregatedKeys {
-				if j != i {
-					if !reflect.DeepEqual(eachKeySet, eachKeySetTest) {
-						keysEqual = false
-					}
+		sort.Strings(keys)
+		return keys
+	}
+	aggregatedKeys := make([][]string, len(codePipelineEnvironments))
+	i := 0
+	for _, eachEnvMap := range codePipelineEnvironments {
+		aggregatedKeys[i] = mapKeys(eachEnvMap)
+		i++
+	}
+	i = 0
+	keysEqual := true
+	for _, eachKeySet := range aggregatedKeys {
+		j := 0
+		for _, eachKeySetTest := range aggregatedKeys {
+			if j != i {
+				if !reflect.DeepEqual(eachKeySet, eachKeySetTest) {
+					keysEqual = false
 				}
-				j++
 			}
-			i++
+			j++
 		}
-		if !keysEqual {
-			// Setup an interface with the fields so that the log message
-			logEntry := logger.Warn()
-			for eachEnv, eachEnvMap := range codePipelineEnvironments {
-				logEntry = logEntry.Interface(eachEnv, eachEnvMap)
-			}
-			logEntry.Msg("CodePipeline environments do not define equivalent environment keys")
+		i++
+	}
+	return keysEqual
+}
+
+func (vapo *verifyAWSPreconditionsOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
+	// If there are codePipeline environments defined, warn if they don't include
+	// the same keysets
+	if nil != codePipelineEnvironments && !codePipelineEnvironmentsEquivalent() {
+		// Setup an interface with the fields so that the log message
+		logEntry := logger.Warn()
+		for eachEnv, eachEnvMap := range codePipelineEnvironments {
+			logEntry = logEntry.Interface(eachEnv, eachEnvMap)
 		}
+		logEntry.Msg("CodePipeline environments do not define equivalent environment keys")
 	}
 	return nil
 }
@@ -566,14 +578,40 @@ func (cpo *createPackageOp) buildZIPArchive(sanitizedServiceName string,
 		return header, nil
 	}
 
-	// File info for the binary executable
-	readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
-		cpo.buildContext.compiledBinaryOutput,
-		"",
-		fileHeaderAnnotator,
-		logger)
-	if nil != readerErr {
-		return readerErr
+	// File info for the binary executables
+	lambdaPackage := cpo.buildContext.lambdaPackage
+	for _, eachArch := range lambdaPackage.architectures {
+		executableName := lambdaPackage.executableName(eachArch)
+		readerErr := spartaZip.AnnotateAddToZip(lambdaArchive,
+			cpo.buildContext.compiledBinaryOutput(eachArch),
+			"",
+			func(header *zip.FileHeader) (*zip.FileHeader, error) {
+				header.Name = executableName
+				return fileHeaderAnnotator(header)
+			},
+			logger)
+		if nil != readerErr {
+			return readerErr
+		}
+	}
+	// If there is more than one provided.al2 binary, the bootstrap
+	// executable runs the one named by the function Handler
+	if lambdaPackage.requiresLauncher() {
+		launcherHeader, launcherHeaderErr := fileHeaderAnnotator(&zip.FileHeader{
+			Name:   ProvidedRuntimeBootstrapName,
+			Method: zip.Deflate,
+		})
+		if launcherHeaderErr != nil {
+			return launcherHeaderErr
+		}
+		launcherWriter, launcherWriterErr := lambdaArchive.CreateHeader(launcherHeader)
+		if launcherWriterErr != nil {
+			return errors.Wrapf(launcherWriterErr, "Failed to create bootstrap ZIP entry")
+		}
+		_, launcherErr := launcherWriter.Write([]byte(providedRuntimeLauncher))
+		if launcherErr != nil {
+			return errors.Wrapf(launcherErr, "Failed to write bootstrap ZIP entry")
+		}
 	}
 	// Flush it...
 	archiveCloseErr := lambdaArchive.Close()
@@ -622,10 +660,13 @@ func (cpo *createPackageOp) buildDockerImage(sanitizedServiceName string,
 	dockerDir := filepath.Dir(cpo.userdata.dockerFile)
 
 	// Path to binary is relative to Dockerfile
-	binaryRelPath := strings.TrimPrefix(cpo.buildContext.compiledBinaryOutput, dockerDir)
+	imageArch := cpo.buildContext.lambdaPackage.defaultArchitecture
+	binaryRelPath := strings.TrimPrefix(cpo.buildContext.compiledBinaryOutput(imageArch), dockerDir)
 	binaryRelPath = strings.TrimPrefix(binaryRelPath, string(filepath.Separator))
 	dockerBuildCommands := []string{
 		"build",
+		"--platform",
+		fmt.Sprintf("linux/%s", imageArch.goArch()),
 		"--tag",
 		imageTag,
 		"--build-arg",
@@ -702,18 +743,26 @@ func (cpo *createPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 	}
 	sanitizedServiceName := sanitizedName(cpo.userdata.serviceName)
 
+	// Docker images are single architecture
+	isDockerBuild := (cpo.userdata.dockerFile != "")
+	if isDockerBuild && len(cpo.buildContext.lambdaPackage.architectures) > 1 {
+		return errors.Errorf("Docker builds do not support multiple architectures: %v",
+			cpo.buildContext.lambdaPackage.architectures)
+	}
 	// Output location
-	// TODO - here...
-	buildErr := system.BuildGoBinary(cpo.userdata.serviceName,
-		cpo.buildContext.compiledBinaryOutput,
-		cpo.userdata.useCGO,
-		cpo.userdata.buildID,
-		cpo.userdata.buildTags,
-		cpo.userdata.linkFlags,
-		cpo.userdata.noop,
-		logger)
-	if nil != buildErr {
-		return buildErr
+	for _, eachArch := range cpo.buildContext.lambdaPackage.architectures {
+		buildErr := system.BuildGoBinaryForArchitecture(cpo.userdata.serviceName,
+			cpo.buildContext.compiledBinaryOutput(eachArch),
+			eachArch.goArch(),
+			cpo.userdata.useCGO,
+			cpo.userdata.buildID,
+			cpo.userdata.buildTags,
+			cpo.userdata.linkFlags,
+			cpo.userdata.noop,
+			logger)
+		if nil != buildErr {
+			return buildErr
+		}
 	}
 
 	//////////////////////////////////////////////////////////////////////////////
@@ -803,7 +852,6 @@ func (cpo *createPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 	//////////////////////////////////////////////////////////////////////////////
 	// Next up we either need to pass the ZIP archive or the ECR information
 	//////////////////////////////////////////////////////////////////////////////
-	isDockerBuild := (cpo.userdata.dockerFile != "")
 	if isDockerBuild {
 		// If we are building Docker, make sure there are no archive hooks
 		if cpo.userdata.workflowHooks != nil &&
@@ -919,6 +967,12 @@ func (cto *createTemplateOp) insertTemplateParameters(ctx context.Context,
 		Description: "BuildID",
 		Value:       gocf.String(cto.userdata.buildID),
 	}
+	if OptionsGlobal.Stage != "" {
+		cto.buildContext.cfTemplate.Outputs[StackOutputStage] = &gocf.Output{
+			Description: "Stage",
+			Value:       gocf.String(OptionsGlobal.Stage),
+		}
+	}
 	return paramRefMap, nil
 }
 
@@ -1124,6 +1178,10 @@ func (cto *createTemplateOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 		return errors.Wrapf(annotateErr,
 			"Failed to perform final template annotations")
 	}
+	// Set the runtime and handler for every function that
+	// uses the code package
+	cto.buildContext.lambdaPackage.applyToTemplate(cto.buildContext.cfTemplate,
+		s3CodeResource)
 
 	// validations?
 	if cto.userdata.workflowHooks != nil {
@@ -1144,6 +1202,11 @@ func (cto *createTemplateOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 		return discoveryInfoErr
 	}
 
+	// Architectures aren't supported by gocf.LambdaFunction, so they're
+	// applied after the validation hooks and discovery checks
+	cto.buildContext.lambdaPackage.applyArchitectures(cto.buildContext.cfTemplate,
+		s3CodeResource)
+
 	// Generate it & write it out...
 	cfTemplateJSON, cfTemplateJSONErr := json.Marshal(cto.buildContext.cfTemplate)
 	if cfTemplateJSONErr != nil {
@@ -1152,6 +1215,13 @@ func (cto *createTemplateOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 			Msg("Failed to Marshal CloudFormation template")
 		return cfTemplateJSONErr
 	}
+	// Large services are split into nested stacks
+	cfTemplateJSON, cfTemplateJSONErr = cto.ensureTemplateLimits(cfTemplateJSON,
+		cloudFormationTemplateLimits,
+		logger)
+	if cfTemplateJSONErr != nil {
+		return cfTemplateJSONErr
+	}
 
 	// Write out the template to the templateWriter
 	if nil != cto.buildContext.templateWriter {
@@ -1181,12 +1251,14 @@ func (cto *createTemplateOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 // identify and is used to determine create vs update operations.  The compilation options/flags are:
 //
 // 	TAGS:         -tags lambdabinary
-// 	ENVIRONMENT:  GOOS=linux GOARCH=amd64
+// 	ENVIRONMENT:  GOOS=linux GOARCH=amd64|arm64
 //
-// The compiled binary is packaged with a NodeJS proxy shim to manage AWS Lambda setup & invocation per
-// http://docs.aws.amazon.com/lambda/latest/dg/authoring-function-in-nodejs.html
+// The runtime is either go1.x or provided.al2, and the architecture is either
+// x86_64 or arm64. Empty values select the go1.x runtime and the x86_64
+// architecture. Lambda functions can override the architecture with
+// LambdaFunctionOptions.Architecture.
 //
-// The two files are ZIP'd, posted to S3 and used as an input to a dynamically generated CloudFormation
+// The files are ZIP'd, posted to S3 and used as an input to a dynamically generated CloudFormation
 // template (http://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/Welcome.html)
 // which creates or updates the service state.
 //
@@ -1199,6 +1271,8 @@ func Build(noop bool,
 	useCGO bool,
 	buildID string,
 	dockerFile string,
+	runtime AWSLambdaRuntimeName,
+	architecture AWSLambdaArchitecture,
 	outputDirectory string,
 	buildTags string,
 	linkerFlags string,
@@ -1244,8 +1318,14 @@ func Build(noop bool,
 		outputDirectory:      absOutputDirectory,
 		workflowHooksContext: nil,
 		templateWriter:       templateWriter,
-		compiledBinaryOutput: filepath.Join(absOutputDirectory, SpartaBinaryName),
 	}
+	lambdaPackage, lambdaPackageErr := newLambdaPackage(runtime,
+		architecture,
+		lambdaAWSInfos)
+	if lambdaPackageErr != nil {
+		return lambdaPackageErr
+	}
+	buildContext.lambdaPackage = lambdaPackage
 	if workflowHooks != nil && workflowHooks.Context != nil {
 		buildContext.workflowHooksContext = workflowHooks.Context
 	} else {
@@ -1268,6 +1348,8 @@ func Build(noop bool,
 		Str("BuildID", buildID).
 		Bool("noop", noop).
 		Str("Tags", userdata.buildTags).
+		Str("Runtime", string(lambdaPackage.runtime)).
+		Interface("Architectures", lambdaPackage.architectures).
 		Str("CodePipelineTrigger", userdata.codePipelineTrigger).
 		Msg("Building service")
 
@@ -0,0 +1,937 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// CloudFormation template limits
+// Ref: https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/cloudformation-limits.html
+const (
+	cloudFormationMaxResources    = 500
+	cloudFormationMaxTemplateSize = 1000000
+	cloudFormationMaxParameters   = 200
+	cloudFormationMaxOutputs      = 200
+)
+
+const (
+	// nestedStackResourcePrefix is the logical ID prefix of each nested
+	// AWS::CloudFormation::Stack resource
+	nestedStackResourcePrefix = "SpartaNestedStack"
+	// nestedStackTemplateURLSuffix is the suffix of the parent stack parameter
+	// that supplies the nested stack TemplateURL
+	nestedStackTemplateURLSuffix = "TemplateURL"
+	// nestedStackParentStackName is the nested stack parameter that replaces
+	// AWS::StackName s.t. moved resources resolve the service's stack
+	nestedStackParentStackName = "SpartaParentStackName"
+	// nestedStackParentStackID is the nested stack parameter that replaces
+	// AWS::StackId
+	nestedStackParentStackID = "SpartaParentStackId"
+	// nestedStackSizeReserve is the fraction of the template size limit that's
+	// reserved for the parameters and outputs added to each nested stack
+	nestedStackSizeReserve = 10
+)
+
+var reTemplateSubVariable = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+var reTemplateNameSanitize = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// templateLimits are the CloudFormation limits for a single template
+type templateLimits struct {
+	resources  int
+	size       int
+	parameters int
+	outputs    int
+}
+
+var cloudFormationTemplateLimits = templateLimits{
+	resources:  cloudFormationMaxResources,
+	size:       cloudFormationMaxTemplateSize,
+	parameters: cloudFormationMaxParameters,
+	outputs:    cloudFormationMaxOutputs,
+}
+
+// validate returns an error if the named template exceeds the limits
+func (limits templateLimits) validate(name string, template map[string]interface{}) error {
+	templateBytes, templateBytesErr := json.Marshal(template)
+	if templateBytesErr != nil {
+		return errors.Wrapf(templateBytesErr, "Failed to marshal template: %s", name)
+	}
+	counts := []struct {
+		section string
+		count   int
+		limit   int
+	}{
+		{"Resources", len(templateSection(template, "Resources")), limits.resources},
+		{"Parameters", len(templateSection(template, "Parameters")), limits.parameters},
+		{"Outputs", len(templateSection(template, "Outputs")), limits.outputs},
+		{"Size", len(templateBytes), limits.size},
+	}
+	for _, eachCount := range counts {
+		if eachCount.count > eachCount.limit {
+			return errors.Errorf("Template %s exceeds the CloudFormation %s limit (%d > %d)",
+				name,
+				eachCount.section,
+				eachCount.count,
+				eachCount.limit)
+		}
+	}
+	return nil
+}
+
+// templateSection returns the named top level template section
+func templateSection(template map[string]interface{}, sectionName string) map[string]interface{} {
+	section, _ := template[sectionName].(map[string]interface{})
+	return section
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// References
+////////////////////////////////////////////////////////////////////////////////
+
+// templateReference is a Ref, Fn::GetAtt or Fn::Sub reference to a logical ID
+type templateReference struct {
+	logicalID string
+	attribute string
+}
+
+// name is the parameter and output name for the reference in a nested stack
+func (ref templateReference) name() string {
+	if ref.attribute == "" {
+		return ref.logicalID
+	}
+	return ref.logicalID + reTemplateNameSanitize.ReplaceAllString(ref.attribute, "")
+}
+
+// expr returns the intrinsic function for the reference
+func (ref templateReference) expr() interface{} {
+	if ref.attribute == "" {
+		return map[string]interface{}{"Ref": ref.logicalID}
+	}
+	return map[string]interface{}{
+		"Fn::GetAtt": []interface{}{ref.logicalID, ref.attribute},
+	}
+}
+
+// templateReferenceReplacement is the replacement for a reference. The name
+// is the Fn::Sub variable name for the replacement expression.
+type templateReferenceReplacement struct {
+	expr interface{}
+	name string
+}
+
+// templateReferenceRewriter returns the replacement for the reference or nil
+// if the reference is unchanged
+type templateReferenceRewriter func(ref templateReference) *templateReferenceReplacement
+
+// parseGetAtt returns the reference for either the list or the dotted string
+// form of Fn::GetAtt
+func parseGetAtt(getAtt interface{}) (templateReference, bool) {
+	switch typedGetAtt := getAtt.(type) {
+	case string:
+		parts := strings.SplitN(typedGetAtt, ".", 2)
+		if len(parts) == 2 {
+			return templateReference{logicalID: parts[0], attribute: parts[1]}, true
+		}
+	case []interface{}:
+		if len(typedGetAtt) == 2 {
+			logicalID, logicalIDOk := typedGetAtt[0].(string)
+			attribute, attributeOk := typedGetAtt[1].(string)
+			if logicalIDOk && attributeOk {
+				return templateReference{logicalID: logicalID, attribute: attribute}, true
+			}
+		}
+	}
+	return templateReference{}, false
+}
+
+// rewriteTemplateReferences returns a copy of the value with each reference
+// replaced by the rewriter's value
+func rewriteTemplateReferences(value interface{}, rewriter templateReferenceRewriter) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if len(typedValue) == 1 {
+			if refName, refNameOk := typedValue["Ref"].(string); refNameOk {
+				replacement := rewriter(templateReference{logicalID: refName})
+				if replacement != nil {
+					return replacement.expr
+				}
+				return typedValue
+			}
+			if getAtt, getAttExists := typedValue["Fn::GetAtt"]; getAttExists {
+				ref, refOk := parseGetAtt(getAtt)
+				if refOk {
+					replacement := rewriter(ref)
+					if replacement != nil {
+						return replacement.expr
+					}
+					return typedValue
+				}
+			}
+			if sub, subExists := typedValue["Fn::Sub"]; subExists {
+				return map[string]interface{}{
+					"Fn::Sub": rewriteSubReferences(sub, rewriter),
+				}
+			}
+		}
+		rewritten := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			rewritten[eachKey] = rewriteTemplateReferences(eachValue, rewriter)
+		}
+		return rewritten
+	case []interface{}:
+		rewritten := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			rewritten[eachIndex] = rewriteTemplateReferences(eachValue, rewriter)
+		}
+		return rewritten
+	}
+	return value
+}
+
+// rewriteSubReferences rewrites the ${Name} and ${Name.Attribute} variables
+// of an Fn::Sub value. Replacements that aren't a Ref to the variable name
+// are bound in the Fn::Sub variable map.
+func rewriteSubReferences(sub interface{}, rewriter templateReferenceRewriter) interface{} {
+	format := ""
+	variables := make(map[string]interface{})
+	switch typedSub := sub.(type) {
+	case string:
+		format = typedSub
+	case []interface{}:
+		typedFormat, typedFormatOk := "", false
+		typedVariables, typedVariablesOk := map[string]interface{}{}, true
+		if len(typedSub) != 0 {
+			typedFormat, typedFormatOk = typedSub[0].(string)
+		}
+		if len(typedSub) == 2 {
+			typedVariables, typedVariablesOk = typedSub[1].(map[string]interface{})
+		}
+		if !typedFormatOk || !typedVariablesOk || len(typedSub) > 2 {
+			return rewriteTemplateReferences(sub, rewriter)
+		}
+		format = typedFormat
+		for eachKey, eachValue := range typedVariables {
+			variables[eachKey] = rewriteTemplateReferences(eachValue, rewriter)
+		}
+	default:
+		return rewriteTemplateReferences(sub, rewriter)
+	}
+	localVariables := make(map[string]bool, len(variables))
+	for eachKey := range variables {
+		localVariables[eachKey] = true
+	}
+	format = reTemplateSubVariable.ReplaceAllStringFunc(format, func(match string) string {
+		token := match[2 : len(match)-1]
+		if localVariables[token] {
+			return match
+		}
+		ref := templateReference{logicalID: token}
+		if dotIndex := strings.Index(token, "."); dotIndex > 0 {
+			ref = templateReference{logicalID: token[:dotIndex], attribute: token[dotIndex+1:]}
+		}
+		replacement := rewriter(ref)
+		if replacement == nil {
+			return match
+		}
+		replacementExpr, _ := replacement.expr.(map[string]interface{})
+		if replacementExpr["Ref"] != replacement.name {
+			variables[replacement.name] = replacement.expr
+		}
+		return fmt.Sprintf("${%s}", replacement.name)
+	})
+	if len(variables) == 0 {
+		return format
+	}
+	return []interface{}{format, variables}
+}
+
+// resourceDependsOn returns the resource's DependsOn logical IDs
+func resourceDependsOn(resource map[string]interface{}) []string {
+	switch typedDependsOn := resource["DependsOn"].(type) {
+	case string:
+		return []string{typedDependsOn}
+	case []interface{}:
+		dependsOn := make([]string, 0, len(typedDependsOn))
+		for _, eachDependency := range typedDependsOn {
+			if dependency, dependencyOk := eachDependency.(string); dependencyOk {
+				dependsOn = append(dependsOn, dependency)
+			}
+		}
+		return dependsOn
+	}
+	return nil
+}
+
+// setResourceDependsOn sets the sorted, unique DependsOn logical IDs
+func setResourceDependsOn(resource map[string]interface{}, dependsOn map[string]bool) {
+	delete(resource, "DependsOn")
+	if len(dependsOn) == 0 {
+		return
+	}
+	sortedDependsOn := make([]string, 0, len(dependsOn))
+	for eachDependency := range dependsOn {
+		sortedDependsOn = append(sortedDependsOn, eachDependency)
+	}
+	sort.Strings(sortedDependsOn)
+	resourceDependsOn := make([]interface{}, len(sortedDependsOn))
+	for eachIndex, eachDependency := range sortedDependsOn {
+		resourceDependsOn[eachIndex] = eachDependency
+	}
+	resource["DependsOn"] = resourceDependsOn
+}
+
+// sortedKeys returns the sorted map keys
+func sortedKeys(value map[string]interface{}) []string {
+	keys := make([]string, 0, len(value))
+	for eachKey := range value {
+		keys = append(keys, eachKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Splitter
+////////////////////////////////////////////////////////////////////////////////
+
+// nestedStack is a nested stack and the logical IDs of the moved resources
+type nestedStack struct {
+	logicalID string
+	resources map[string]bool
+	size      int
+}
+
+// nestedTemplateSplitter moves a template's resources into nested stacks.
+// Each lambda function is grouped with the resources that only depend on it,
+// such as its permissions, event source mappings and decorator resources,
+// and the resources that only it depends on, such as a dedicated IAM role.
+// Shared resources stay in the parent template. References between stacks
+// are rewritten to nested stack parameters and outputs.
+type nestedTemplateSplitter struct {
+	limits     templateLimits
+	template   map[string]interface{}
+	resources  map[string]interface{}
+	references map[string]map[string]bool
+	referrers  map[string]map[string]bool
+	assignment map[string]string
+}
+
+func newNestedTemplateSplitter(template map[string]interface{}, limits templateLimits) *nestedTemplateSplitter {
+	splitter := &nestedTemplateSplitter{
+		limits:     limits,
+		template:   template,
+		resources:  templateSection(template, "Resources"),
+		references: make(map[string]map[string]bool),
+		referrers:  make(map[string]map[string]bool),
+		assignment: make(map[string]string),
+	}
+	for eachID := range splitter.resources {
+		splitter.references[eachID] = make(map[string]bool)
+		splitter.referrers[eachID] = make(map[string]bool)
+	}
+	for eachID, eachResource := range splitter.resources {
+		addReference := func(logicalID string) {
+			_, isResource := splitter.resources[logicalID]
+			if isResource && logicalID != eachID {
+				splitter.references[eachID][logicalID] = true
+				splitter.referrers[logicalID][eachID] = true
+			}
+		}
+		rewriteTemplateReferences(eachResource, func(ref templateReference) *templateReferenceReplacement {
+			addReference(ref.logicalID)
+			return nil
+		})
+		typedResource, _ := eachResource.(map[string]interface{})
+		for _, eachDependency := range resourceDependsOn(typedResource) {
+			addReference(eachDependency)
+		}
+	}
+	return splitter
+}
+
+// resourceType returns the resource's CloudFormation type
+func (splitter *nestedTemplateSplitter) resourceType(logicalID string) string {
+	resource, _ := splitter.resources[logicalID].(map[string]interface{})
+	resourceType, _ := resource["Type"].(string)
+	return resourceType
+}
+
+// functionDependencies returns the functions the resource depends on,
+// directly or through other resources that aren't functions
+func (splitter *nestedTemplateSplitter) functionDependencies(logicalID string) map[string]bool {
+	functions := make(map[string]bool)
+	visited := map[string]bool{logicalID: true}
+	pending := []string{logicalID}
+	for len(pending) != 0 {
+		current := pending[0]
+		pending = pending[1:]
+		for eachReference := range splitter.references[current] {
+			if visited[eachReference] {
+				continue
+			}
+			visited[eachReference] = true
+			if splitter.resourceType(eachReference) == "AWS::Lambda::Function" {
+				functions[eachReference] = true
+			} else {
+				pending = append(pending, eachReference)
+			}
+		}
+	}
+	return functions
+}
+
+// functionGroups returns the resources grouped with each function
+func (splitter *nestedTemplateSplitter) functionGroups() map[string][]string {
+	owners := make(map[string]string)
+	shared := make(map[string]bool)
+	resourceIDs := sortedKeys(splitter.resources)
+	for _, eachID := range resourceIDs {
+		if splitter.resourceType(eachID) == "AWS::Lambda::Function" {
+			owners[eachID] = eachID
+		}
+	}
+	for _, eachID := range resourceIDs {
+		if owners[eachID] != "" {
+			continue
+		}
+		functions := splitter.functionDependencies(eachID)
+		switch len(functions) {
+		case 0:
+			// Resolved below
+		case 1:
+			for eachFunction := range functions {
+				owners[eachID] = eachFunction
+			}
+		default:
+			shared[eachID] = true
+		}
+	}
+	// Resources that don't depend on a function join the group of their
+	// neighbors iff they're all in the same group
+	for changed := true; changed; {
+		changed = false
+		for _, eachID := range resourceIDs {
+			if owners[eachID] != "" || shared[eachID] {
+				continue
+			}
+			owner := ""
+			grouped := len(splitter.references[eachID])+len(splitter.referrers[eachID]) != 0
+			for _, eachNeighbors := range []map[string]bool{splitter.references[eachID],
+				splitter.referrers[eachID]} {
+				for eachNeighbor := range eachNeighbors {
+					neighborOwner := owners[eachNeighbor]
+					if neighborOwner == "" || (owner != "" && owner != neighborOwner) {
+						grouped = false
+					}
+					owner = neighborOwner
+				}
+			}
+			if grouped {
+				owners[eachID] = owner
+				changed = true
+			}
+		}
+	}
+	groups := make(map[string][]string)
+	for _, eachID := range resourceIDs {
+		if owner := owners[eachID]; owner != "" {
+			groups[owner] = append(groups[owner], eachID)
+		}
+	}
+	return groups
+}
+
+// hasCycle returns true if the current assignment introduces a dependency
+// cycle between the parent template and the nested stacks
+func (splitter *nestedTemplateSplitter) hasCycle() bool {
+	node := func(logicalID string) string {
+		if stackID := splitter.assignment[logicalID]; stackID != "" {
+			return stackID
+		}
+		return logicalID
+	}
+	edges := make(map[string]map[string]bool)
+	for eachID, eachReferences := range splitter.references {
+		from := node(eachID)
+		for eachReference := range eachReferences {
+			to := node(eachReference)
+			if from == to {
+				continue
+			}
+			if edges[from] == nil {
+				edges[from] = make(map[string]bool)
+			}
+			edges[from][to] = true
+		}
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		state[current] = visiting
+		for eachNext := range edges[current] {
+			switch state[eachNext] {
+			case visiting:
+				return true
+			case 0:
+				if visit(eachNext) {
+					return true
+				}
+			}
+		}
+		state[current] = visited
+		return false
+	}
+	for eachNode := range edges {
+		if state[eachNode] == 0 && visit(eachNode) {
+			return true
+		}
+	}
+	return false
+}
+
+// resourcesSize returns the marshaled size of the resources
+func (splitter *nestedTemplateSplitter) resourcesSize(logicalIDs []string) int {
+	size := 0
+	for _, eachID := range logicalIDs {
+		resourceBytes, _ := json.Marshal(splitter.resources[eachID])
+		size += len(eachID) + len(resourceBytes)
+	}
+	return size
+}
+
+// assign packs the function groups into nested stacks
+func (splitter *nestedTemplateSplitter) assign(logger *zerolog.Logger) ([]*nestedStack, error) {
+	groups := splitter.functionGroups()
+	functionIDs := make([]string, 0, len(groups))
+	for eachFunction := range groups {
+		functionIDs = append(functionIDs, eachFunction)
+	}
+	sort.Strings(functionIDs)
+
+	stacks := make([]*nestedStack, 0)
+	sizeLimit := splitter.limits.size - splitter.limits.size/nestedStackSizeReserve
+	setAssignment := func(logicalIDs []string, stackID string) {
+		for _, eachID := range logicalIDs {
+			if stackID == "" {
+				delete(splitter.assignment, eachID)
+			} else {
+				splitter.assignment[eachID] = stackID
+			}
+		}
+	}
+	for _, eachFunction := range functionIDs {
+		group := groups[eachFunction]
+		groupSize := splitter.resourcesSize(group)
+		if len(group) > splitter.limits.resources || groupSize > sizeLimit {
+			return nil, errors.Errorf("Function %s and its %d related resources exceed the nested stack limits",
+				eachFunction,
+				len(group)-1)
+		}
+		placed := false
+		for _, eachStack := range stacks {
+			if len(eachStack.resources)+len(group) > splitter.limits.resources ||
+				eachStack.size+groupSize > sizeLimit {
+				continue
+			}
+			setAssignment(group, eachStack.logicalID)
+			if !splitter.hasCycle() {
+				for _, eachID := range group {
+					eachStack.resources[eachID] = true
+				}
+				eachStack.size += groupSize
+				placed = true
+				break
+			}
+			setAssignment(group, "")
+		}
+		if placed {
+			continue
+		}
+		stackID := fmt.Sprintf("%s%d", nestedStackResourcePrefix, len(stacks))
+		if _, exists := splitter.resources[stackID]; exists {
+			return nil, errors.Errorf("Nested stack logical ID %s already exists", stackID)
+		}
+		setAssignment(group, stackID)
+		if splitter.hasCycle() {
+			setAssignment(group, "")
+			logger.Debug().
+				Str("Function", eachFunction).
+				Msg("Function remains in the parent template to avoid a dependency cycle")
+			continue
+		}
+		stack := &nestedStack{
+			logicalID: stackID,
+			resources: make(map[string]bool),
+			size:      groupSize,
+		}
+		for _, eachID := range group {
+			stack.resources[eachID] = true
+		}
+		stacks = append(stacks, stack)
+	}
+	return stacks, nil
+}
+
+// nestedParameter returns the nested stack parameter definition and the
+// parent's value for a parent template parameter
+func nestedParameter(logicalID string, definition interface{}) (interface{}, interface{}) {
+	typedDefinition, _ := definition.(map[string]interface{})
+	nestedDefinition := make(map[string]interface{}, len(typedDefinition))
+	for eachKey, eachValue := range typedDefinition {
+		nestedDefinition[eachKey] = eachValue
+	}
+	parameterType, _ := typedDefinition["Type"].(string)
+	// SSM parameters are resolved by the parent stack
+	if strings.HasPrefix(parameterType, "AWS::SSM::Parameter::Value<") {
+		parameterType = strings.TrimSuffix(strings.TrimPrefix(parameterType, "AWS::SSM::Parameter::Value<"), ">")
+		if strings.HasPrefix(parameterType, "List<") {
+			parameterType = "CommaDelimitedList"
+		}
+		nestedDefinition["Type"] = parameterType
+	}
+	var value interface{} = map[string]interface{}{"Ref": logicalID}
+	if strings.HasPrefix(parameterType, "List<") || parameterType == "CommaDelimitedList" {
+		value = map[string]interface{}{
+			"Fn::Join": []interface{}{",", value},
+		}
+	}
+	return nestedDefinition, value
+}
+
+// split moves the function groups into nested stacks. The parent template is
+// updated in place and the nested stack templates are returned by logical ID.
+func (splitter *nestedTemplateSplitter) split(logger *zerolog.Logger) (map[string]map[string]interface{}, error) {
+	stacks, stacksErr := splitter.assign(logger)
+	if stacksErr != nil {
+		return nil, stacksErr
+	}
+	if len(stacks) == 0 {
+		return nil, errors.Errorf("Template doesn't include resources that can be moved to nested stacks")
+	}
+	parameters := templateSection(splitter.template, "Parameters")
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+		splitter.template["Parameters"] = parameters
+	}
+	nameErrors := make([]string, 0)
+	checkName := func(ref templateReference) {
+		if ref.attribute == "" {
+			return
+		}
+		name := ref.name()
+		_, isResource := splitter.resources[name]
+		_, isParameter := parameters[name]
+		if isResource || isParameter {
+			nameErrors = append(nameErrors, name)
+		}
+	}
+
+	// Outputs requested from each nested stack
+	stackOutputs := make(map[string]map[string]interface{})
+	for _, eachStack := range stacks {
+		stackOutputs[eachStack.logicalID] = make(map[string]interface{})
+	}
+	stackOutput := func(ref templateReference) *templateReferenceReplacement {
+		stackID := splitter.assignment[ref.logicalID]
+		checkName(ref)
+		stackOutputs[stackID][ref.name()] = ref.expr()
+		return &templateReferenceReplacement{
+			expr: map[string]interface{}{
+				"Fn::GetAtt": []interface{}{stackID, fmt.Sprintf("Outputs.%s", ref.name())},
+			},
+			name: ref.name(),
+		}
+	}
+
+	// Parent template
+	parentResources := make(map[string]interface{})
+	parentRewriter := func(ref templateReference) *templateReferenceReplacement {
+		if splitter.assignment[ref.logicalID] == "" {
+			return nil
+		}
+		return stackOutput(ref)
+	}
+	for eachID, eachResource := range splitter.resources {
+		if splitter.assignment[eachID] != "" {
+			continue
+		}
+		typedResource, _ := eachResource.(map[string]interface{})
+		dependsOn := make(map[string]bool)
+		for _, eachDependency := range resourceDependsOn(typedResource) {
+			if stackID := splitter.assignment[eachDependency]; stackID != "" {
+				dependsOn[stackID] = true
+			} else {
+				dependsOn[eachDependency] = true
+			}
+		}
+		rewritten, _ := rewriteTemplateReferences(typedResource, parentRewriter).(map[string]interface{})
+		setResourceDependsOn(rewritten, dependsOn)
+		parentResources[eachID] = rewritten
+	}
+	if outputs := templateSection(splitter.template, "Outputs"); outputs != nil {
+		splitter.template["Outputs"] = rewriteTemplateReferences(outputs, parentRewriter)
+	}
+
+	// Nested stack templates
+	nestedTemplates := make(map[string]map[string]interface{})
+	stackResources := make(map[string]map[string]interface{})
+	for _, eachStack := range stacks {
+		stackID := eachStack.logicalID
+		nestedParameters := make(map[string]interface{})
+		parameterValues := make(map[string]interface{})
+		stackDependsOn := make(map[string]bool)
+		nestedRewriter := func(ref templateReference) *templateReferenceReplacement {
+			switch ref.logicalID {
+			case "AWS::StackName", "AWS::StackId":
+				name := nestedStackParentStackName
+				if ref.logicalID == "AWS::StackId" {
+					name = nestedStackParentStackID
+				}
+				nestedParameters[name] = map[string]interface{}{"Type": "String"}
+				parameterValues[name] = map[string]interface{}{"Ref": ref.logicalID}
+				return &templateReferenceReplacement{
+					expr: map[string]interface{}{"Ref": name},
+					name: name,
+				}
+			}
+			if definition, isParameter := parameters[ref.logicalID]; isParameter {
+				nestedParameters[ref.logicalID], parameterValues[ref.logicalID] = nestedParameter(ref.logicalID,
+					definition)
+				return nil
+			}
+			_, isResource := splitter.resources[ref.logicalID]
+			resourceStackID := splitter.assignment[ref.logicalID]
+			if !isResource || resourceStackID == stackID {
+				return nil
+			}
+			checkName(ref)
+			name := ref.name()
+			nestedParameters[name] = map[string]interface{}{"Type": "String"}
+			if resourceStackID != "" {
+				parameterValues[name] = stackOutput(ref).expr
+			} else {
+				parameterValues[name] = ref.expr()
+			}
+			return &templateReferenceReplacement{
+				expr: map[string]interface{}{"Ref": name},
+				name: name,
+			}
+		}
+		nestedResources := make(map[string]interface{})
+		for eachID := range eachStack.resources {
+			typedResource, _ := splitter.resources[eachID].(map[string]interface{})
+			dependsOn := make(map[string]bool)
+			for _, eachDependency := range resourceDependsOn(typedResource) {
+				dependencyStackID := splitter.assignment[eachDependency]
+				switch dependencyStackID {
+				case stackID:
+					dependsOn[eachDependency] = true
+				case "":
+					stackDependsOn[eachDependency] = true
+				default:
+					stackDependsOn[dependencyStackID] = true
+				}
+			}
+			rewritten, _ := rewriteTemplateReferences(typedResource, nestedRewriter).(map[string]interface{})
+			setResourceDependsOn(rewritten, dependsOn)
+			nestedResources[eachID] = rewritten
+		}
+		nestedTemplate := map[string]interface{}{
+			"AWSTemplateFormatVersion": "2010-09-09",
+			"Description":              fmt.Sprintf("Nested stack %s", stackID),
+			"Resources":                nestedResources,
+			"Parameters":               nestedParameters,
+		}
+		if description, _ := splitter.template["Description"].(string); description != "" {
+			nestedTemplate["Description"] = fmt.Sprintf("%s (%s)", description, stackID)
+		}
+		if mappings := templateSection(splitter.template, "Mappings"); mappings != nil {
+			nestedTemplate["Mappings"] = mappings
+		}
+		if conditions := templateSection(splitter.template, "Conditions"); conditions != nil {
+			nestedTemplate["Conditions"] = rewriteTemplateReferences(conditions, nestedRewriter)
+		}
+		nestedTemplates[stackID] = nestedTemplate
+
+		templateURLParameter := stackID + nestedStackTemplateURLSuffix
+		parameters[templateURLParameter] = map[string]interface{}{
+			"Type":        "String",
+			"Description": fmt.Sprintf("S3 URL of the %s template", stackID),
+		}
+		stackResource := map[string]interface{}{
+			"Type": "AWS::CloudFormation::Stack",
+			"Properties": map[string]interface{}{
+				"TemplateURL": map[string]interface{}{"Ref": templateURLParameter},
+				"Parameters":  parameterValues,
+			},
+		}
+		setResourceDependsOn(stackResource, stackDependsOn)
+		stackResources[stackID] = stackResource
+	}
+	if len(nameErrors) != 0 {
+		sort.Strings(nameErrors)
+		return nil, errors.Errorf("Nested stack parameter names conflict with existing logical IDs: %s",
+			strings.Join(nameErrors, ", "))
+	}
+	for eachStackID, eachOutputs := range stackOutputs {
+		outputs := make(map[string]interface{}, len(eachOutputs))
+		for eachName, eachValue := range eachOutputs {
+			outputs[eachName] = map[string]interface{}{"Value": eachValue}
+		}
+		if len(outputs) != 0 {
+			nestedTemplates[eachStackID]["Outputs"] = outputs
+		}
+	}
+	for eachStackID, eachResource := range stackResources {
+		parentResources[eachStackID] = eachResource
+	}
+	splitter.template["Resources"] = parentResources
+
+	// Everything must fit
+	for eachStackID, eachTemplate := range nestedTemplates {
+		limitsErr := splitter.limits.validate(eachStackID, eachTemplate)
+		if limitsErr != nil {
+			return nil, limitsErr
+		}
+	}
+	limitsErr := splitter.limits.validate("parent", splitter.template)
+	if limitsErr != nil {
+		return nil, errors.Wrapf(limitsErr, "Template exceeds the CloudFormation limits after moving %d resources to nested stacks",
+			len(splitter.assignment))
+	}
+	return nestedTemplates, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Build
+////////////////////////////////////////////////////////////////////////////////
+
+// nestedTemplatePath returns the path of the nested stack template
+func nestedTemplatePath(outputDirectory string, serviceName string, stackID string) string {
+	return filepath.Join(outputDirectory,
+		fmt.Sprintf("%s-%s.json", sanitizedName(serviceName), stackID))
+}
+
+// ensureTemplateLimits returns the template JSON to write. Templates that
+// exceed the CloudFormation resource or size limits are split into nested
+// stacks. The nested stack templates are written to the output directory
+// and uploaded during provisioning.
+func (cto *createTemplateOp) ensureTemplateLimits(cfTemplateJSON []byte,
+	limits templateLimits,
+	logger *zerolog.Logger) ([]byte, error) {
+
+	if len(cto.buildContext.cfTemplate.Resources) <= limits.resources &&
+		len(cfTemplateJSON) <= limits.size {
+		return cfTemplateJSON, nil
+	}
+	// Generic values preserve every template attribute
+	var template map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(cfTemplateJSON))
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(&template)
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "Failed to unmarshal template for nested stacks")
+	}
+	logger.Info().
+		Int("Resources", len(templateSection(template, "Resources"))).
+		Int("Size", len(cfTemplateJSON)).
+		Msg("Template exceeds CloudFormation limits. Creating nested stacks")
+
+	splitter := newNestedTemplateSplitter(template, limits)
+	nestedTemplates, splitErr := splitter.split(logger)
+	if splitErr != nil {
+		return nil, errors.Wrapf(splitErr, "Failed to create nested stacks")
+	}
+	nestedTemplatePaths := make(map[string]interface{}, len(nestedTemplates))
+	for eachStackID, eachTemplate := range nestedTemplates {
+		nestedBytes, nestedBytesErr := json.Marshal(eachTemplate)
+		if nestedBytesErr != nil {
+			return nil, errors.Wrapf(nestedBytesErr, "Failed to marshal nested stack: %s", eachStackID)
+		}
+		outputPath := nestedTemplatePath(cto.buildContext.outputDirectory,
+			cto.userdata.serviceName,
+			eachStackID)
+		writeErr := ioutil.WriteFile(outputPath, nestedBytes, 0644)
+		if writeErr != nil {
+			return nil, errors.Wrapf(writeErr, "Failed to write nested stack template: %s", outputPath)
+		}
+		nestedTemplatePaths[eachStackID] = outputPath
+		logger.Info().
+			Str("Stack", eachStackID).
+			Int("Resources", len(templateSection(eachTemplate, "Resources"))).
+			Str("Path", relativePath(outputPath)).
+			Msg("Nested stack template")
+	}
+	metadata := templateSection(template, "Metadata")
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		template["Metadata"] = metadata
+	}
+	metadata[MetadataParamNestedTemplates] = nestedTemplatePaths
+	return json.Marshal(template)
+}
+
+// readTemplateWithNestedResources returns the template with the resources
+// of its nested stack templates (see ensureTemplateLimits) merged into the
+// Resources section s.t. commands that inspect the template see every
+// resource in the service. Nested templates that aren't found at the
+// recorded path are loaded from the template's directory.
+func readTemplateWithNestedResources(templatePath string) (map[string]interface{}, error) {
+	readTemplate := func(path string) (map[string]interface{}, error) {
+		/* #nosec G304 */
+		templateBytes, templateBytesErr := ioutil.ReadFile(path)
+		if templateBytesErr != nil {
+			return nil, errors.Wrapf(templateBytesErr, "Failed to read template: %s", path)
+		}
+		var template map[string]interface{}
+		unmarshalErr := json.Unmarshal(templateBytes, &template)
+		if unmarshalErr != nil {
+			return nil, errors.Wrapf(unmarshalErr, "Failed to parse template: %s", path)
+		}
+		return template, nil
+	}
+	template, templateErr := readTemplate(templatePath)
+	if templateErr != nil {
+		return nil, templateErr
+	}
+	nestedTemplatePaths, _ := templateSection(template, "Metadata")[MetadataParamNestedTemplates].(map[string]interface{})
+	if len(nestedTemplatePaths) == 0 {
+		return template, nil
+	}
+	resources := templateSection(template, "Resources")
+	if resources == nil {
+		resources = make(map[string]interface{})
+		template["Resources"] = resources
+	}
+	for _, eachStackID := range sortedKeys(nestedTemplatePaths) {
+		nestedPath, _ := nestedTemplatePaths[eachStackID].(string)
+		_, statErr := os.Stat(nestedPath)
+		if statErr != nil {
+			nestedPath = filepath.Join(filepath.Dir(templatePath), filepath.Base(nestedPath))
+		}
+		nestedTemplate, nestedTemplateErr := readTemplate(nestedPath)
+		if nestedTemplateErr != nil {
+			return nil, errors.Wrapf(nestedTemplateErr, "Failed to load nested stack: %s", eachStackID)
+		}
+		for eachLogicalID, eachResource := range templateSection(nestedTemplate, "Resources") {
+			resources[eachLogicalID] = eachResource
+		}
+	}
+	return template, nil
+}
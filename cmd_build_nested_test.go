@@ -0,0 +1,292 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const nestedTestTemplate = `{
+  "Description": "Nested service",
+  "Parameters": {
+    "ArtifactS3Bucket": {"Type": "String"},
+    "Subnets": {"Type": "List<AWS::EC2::Subnet::Id>"}
+  },
+  "Resources": {
+    "SharedRole": {"Type": "AWS::IAM::Role", "Properties": {}},
+    "FnA": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {
+        "Code": {"S3Bucket": {"Ref": "ArtifactS3Bucket"}},
+        "Role": {"Fn::GetAtt": ["SharedRole", "Arn"]},
+        "VpcConfig": {"SubnetIds": {"Ref": "Subnets"}},
+        "Environment": {"Variables": {"STACK": {"Fn::Sub": "${AWS::StackName}"}}}
+      }
+    },
+    "FnAPermission": {
+      "Type": "AWS::Lambda::Permission",
+      "Properties": {
+        "FunctionName": {"Fn::GetAtt": ["FnA", "Arn"]},
+        "SourceArn": {"Fn::Sub": "arn:aws:execute-api:${AWS::Region}:${AWS::AccountId}:${RestAPI}/*"}
+      }
+    },
+    "FnALogGroup": {
+      "Type": "AWS::Logs::LogGroup",
+      "Properties": {"LogGroupName": {"Fn::Sub": "/aws/lambda/${FnA}"}}
+    },
+    "FnB": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {
+        "Code": {"S3Bucket": {"Ref": "ArtifactS3Bucket"}},
+        "Role": {"Fn::GetAtt": ["SharedRole", "Arn"]},
+        "DeadLetterConfig": {"TargetArn": {"Fn::GetAtt": "FnBQueue.Arn"}}
+      }
+    },
+    "FnBQueue": {"Type": "AWS::SQS::Queue", "Properties": {}},
+    "FnBAlarm": {
+      "Type": "AWS::CloudWatch::Alarm",
+      "Properties": {"Dimensions": [{"Name": "FunctionName", "Value": {"Ref": "FnB"}}]}
+    },
+    "RestAPI": {"Type": "AWS::ApiGateway::RestApi", "Properties": {}},
+    "MethodA": {
+      "Type": "AWS::ApiGateway::Method",
+      "Properties": {
+        "RestApiId": {"Ref": "RestAPI"},
+        "Integration": {"Uri": {"Fn::Sub": "arn:aws:apigateway:${AWS::Region}:lambda:path/functions/${FnA.Arn}/invocations"}}
+      }
+    },
+    "MethodB": {
+      "Type": "AWS::ApiGateway::Method",
+      "Properties": {
+        "RestApiId": {"Ref": "RestAPI"},
+        "Integration": {"Uri": {"Fn::GetAtt": ["FnB", "Arn"]}}
+      }
+    },
+    "Deployment": {
+      "Type": "AWS::ApiGateway::Deployment",
+      "DependsOn": ["MethodA", "MethodB"],
+      "Properties": {"RestApiId": {"Ref": "RestAPI"}}
+    }
+  },
+  "Outputs": {
+    "FnAArn": {"Value": {"Fn::GetAtt": ["FnA", "Arn"]}},
+    "URL": {"Value": {"Fn::Sub": "https://${RestAPI}.execute-api.${AWS::Region}.amazonaws.com/${FnB}"}}
+  }
+}`
+
+const nestedCycleTestTemplate = `{
+  "Resources": {
+    "FnA": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {"Environment": {"Variables": {"TOPIC": {"Ref": "Hub"}}}}
+    },
+    "FnAPermission": {
+      "Type": "AWS::Lambda::Permission",
+      "Properties": {"FunctionName": {"Ref": "FnA"}}
+    },
+    "FnB": {"Type": "AWS::Lambda::Function", "Properties": {}},
+    "FnC": {"Type": "AWS::Lambda::Function", "Properties": {}},
+    "Hub": {
+      "Type": "AWS::SNS::Topic",
+      "Properties": {"Subscription": [{"Endpoint": {"Ref": "FnB"}}, {"Endpoint": {"Ref": "FnC"}}]}
+    }
+  }
+}`
+
+func parseNestedTestTemplate(t *testing.T, templateBody string) map[string]interface{} {
+	var template map[string]interface{}
+	unmarshalErr := json.Unmarshal([]byte(templateBody), &template)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	return template
+}
+
+// verifyNestedReferences ensures that every reference in the template
+// resolves to a resource, parameter or nested stack output
+func verifyNestedReferences(t *testing.T,
+	name string,
+	template map[string]interface{},
+	nestedTemplates map[string]map[string]interface{}) {
+	resources := templateSection(template, "Resources")
+	parameters := templateSection(template, "Parameters")
+	verify := func(ref templateReference) *templateReferenceReplacement {
+		_, isResource := resources[ref.logicalID]
+		_, isParameter := parameters[ref.logicalID]
+		switch {
+		case strings.HasPrefix(ref.logicalID, "AWS::"):
+		case isParameter && ref.attribute == "":
+		case isResource && strings.HasPrefix(ref.attribute, "Outputs."):
+			outputs := templateSection(nestedTemplates[ref.logicalID], "Outputs")
+			if _, outputExists := outputs[strings.TrimPrefix(ref.attribute, "Outputs.")]; !outputExists {
+				t.Fatalf("Template %s references missing output: %#v", name, ref)
+			}
+		case isResource:
+		default:
+			t.Fatalf("Template %s includes unresolved reference: %#v", name, ref)
+		}
+		return nil
+	}
+	for eachID, eachResource := range resources {
+		rewriteTemplateReferences(eachResource, verify)
+		typedResource, _ := eachResource.(map[string]interface{})
+		for _, eachDependency := range resourceDependsOn(typedResource) {
+			if _, exists := resources[eachDependency]; !exists {
+				t.Fatalf("Template %s resource %s depends on missing resource: %s", name, eachID, eachDependency)
+			}
+		}
+	}
+	rewriteTemplateReferences(template["Outputs"], verify)
+	rewriteTemplateReferences(template["Conditions"], verify)
+}
+
+func TestNestedTemplateSplit(t *testing.T) {
+	logger := zerolog.New(ioutil.Discard)
+	template := parseNestedTestTemplate(t, nestedTestTemplate)
+	limits := templateLimits{
+		resources:  6,
+		size:       cloudFormationMaxTemplateSize,
+		parameters: cloudFormationMaxParameters,
+		outputs:    cloudFormationMaxOutputs,
+	}
+	nestedTemplates, splitErr := newNestedTemplateSplitter(template, limits).split(&logger)
+	if splitErr != nil {
+		t.Fatal(splitErr)
+	}
+	expectedResources := map[string][]string{
+		"parent":             {"Deployment", "RestAPI", "SharedRole", "SpartaNestedStack0", "SpartaNestedStack1"},
+		"SpartaNestedStack0": {"FnA", "FnALogGroup", "FnAPermission", "MethodA"},
+		"SpartaNestedStack1": {"FnB", "FnBAlarm", "FnBQueue", "MethodB"},
+	}
+	allTemplates := map[string]map[string]interface{}{"parent": template}
+	for eachStackID, eachTemplate := range nestedTemplates {
+		allTemplates[eachStackID] = eachTemplate
+	}
+	if len(allTemplates) != len(expectedResources) {
+		t.Fatalf("Unexpected nested templates: %#v", nestedTemplates)
+	}
+	for eachName, eachTemplate := range allTemplates {
+		resourceIDs := sortedKeys(templateSection(eachTemplate, "Resources"))
+		if !reflect.DeepEqual(resourceIDs, expectedResources[eachName]) {
+			t.Fatalf("Unexpected %s resources: %v", eachName, resourceIDs)
+		}
+		verifyNestedReferences(t, eachName, eachTemplate, nestedTemplates)
+	}
+
+	// Parent references
+	parentResources := templateSection(template, "Resources")
+	deployment, _ := parentResources["Deployment"].(map[string]interface{})
+	if !reflect.DeepEqual(resourceDependsOn(deployment), []string{"SpartaNestedStack0", "SpartaNestedStack1"}) {
+		t.Fatalf("Unexpected Deployment dependencies: %#v", deployment)
+	}
+	outputs := templateSection(template, "Outputs")
+	expectedOutput := map[string]interface{}{
+		"Value": map[string]interface{}{
+			"Fn::GetAtt": []interface{}{"SpartaNestedStack0", "Outputs.FnAArn"},
+		},
+	}
+	if !reflect.DeepEqual(outputs["FnAArn"], expectedOutput) {
+		t.Fatalf("Unexpected parent output: %#v", outputs["FnAArn"])
+	}
+	urlOutput, _ := outputs["URL"].(map[string]interface{})
+	urlSub, _ := urlOutput["Value"].(map[string]interface{})["Fn::Sub"].([]interface{})
+	if len(urlSub) != 2 {
+		t.Fatalf("Expected Fn::Sub variable for nested reference: %#v", urlOutput)
+	}
+	if _, templateURLExists := templateSection(template, "Parameters")["SpartaNestedStack0TemplateURL"]; !templateURLExists {
+		t.Fatalf("Expected nested stack TemplateURL parameter")
+	}
+
+	// Nested stack parameters
+	stackResource, _ := parentResources["SpartaNestedStack0"].(map[string]interface{})
+	stackParameters, _ := stackResource["Properties"].(map[string]interface{})["Parameters"].(map[string]interface{})
+	expectedParameters := map[string]interface{}{
+		"ArtifactS3Bucket":         map[string]interface{}{"Ref": "ArtifactS3Bucket"},
+		"Subnets":                  map[string]interface{}{"Fn::Join": []interface{}{",", map[string]interface{}{"Ref": "Subnets"}}},
+		"SharedRoleArn":            map[string]interface{}{"Fn::GetAtt": []interface{}{"SharedRole", "Arn"}},
+		"RestAPI":                  map[string]interface{}{"Ref": "RestAPI"},
+		nestedStackParentStackName: map[string]interface{}{"Ref": "AWS::StackName"},
+	}
+	if !reflect.DeepEqual(stackParameters, expectedParameters) {
+		t.Fatalf("Unexpected nested stack parameters: %#v", stackParameters)
+	}
+	nestedResources := templateSection(nestedTemplates["SpartaNestedStack0"], "Resources")
+	fnA, _ := json.Marshal(nestedResources["FnA"])
+	if !strings.Contains(string(fnA), `"${SpartaParentStackName}"`) ||
+		!strings.Contains(string(fnA), `{"Ref":"SharedRoleArn"}`) {
+		t.Fatalf("Unexpected nested function: %s", string(fnA))
+	}
+}
+
+func TestNestedTemplateSplitCycles(t *testing.T) {
+	logger := zerolog.New(ioutil.Discard)
+	template := parseNestedTestTemplate(t, nestedCycleTestTemplate)
+	nestedTemplates, splitErr := newNestedTemplateSplitter(template, cloudFormationTemplateLimits).split(&logger)
+	if splitErr != nil {
+		t.Fatal(splitErr)
+	}
+	// FnB and FnC can't share a stack with FnA, which depends on Hub
+	stack0 := sortedKeys(templateSection(nestedTemplates["SpartaNestedStack0"], "Resources"))
+	stack1 := sortedKeys(templateSection(nestedTemplates["SpartaNestedStack1"], "Resources"))
+	if !reflect.DeepEqual(stack0, []string{"FnA", "FnAPermission"}) ||
+		!reflect.DeepEqual(stack1, []string{"FnB", "FnC"}) {
+		t.Fatalf("Unexpected nested stacks: %v, %v", stack0, stack1)
+	}
+	verifyNestedReferences(t, "parent", template, nestedTemplates)
+
+	// Templates that can't be split are an error
+	_, splitErr = newNestedTemplateSplitter(parseNestedTestTemplate(t, `{"Resources": {"Topic": {"Type": "AWS::SNS::Topic"}}}`),
+		cloudFormationTemplateLimits).split(&logger)
+	if splitErr == nil {
+		t.Fatalf("Expected error for template without functions")
+	}
+}
+
+func TestReadTemplateWithNestedResources(t *testing.T) {
+	tempDir, tempDirErr := ioutil.TempDir("", "sparta-nested")
+	if tempDirErr != nil {
+		t.Fatal(tempDirErr)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// The recorded path is from another machine's output directory
+	nestedPath := nestedTemplatePath(tempDir, "MyService", "SpartaNestedStack0")
+	nestedWriteErr := ioutil.WriteFile(nestedPath,
+		[]byte(`{"Resources":{"FnA":{"Type":"AWS::Lambda::Function","Properties":{"MemorySize":256}}}}`),
+		0644)
+	if nestedWriteErr != nil {
+		t.Fatal(nestedWriteErr)
+	}
+	parentTemplate := map[string]interface{}{
+		"Resources": map[string]interface{}{
+			"SpartaNestedStack0": map[string]interface{}{"Type": "AWS::CloudFormation::Stack"},
+		},
+		"Metadata": map[string]interface{}{
+			MetadataParamNestedTemplates: map[string]interface{}{
+				"SpartaNestedStack0": filepath.Join("/ci/output", filepath.Base(nestedPath)),
+			},
+		},
+	}
+	parentBytes, _ := json.Marshal(parentTemplate)
+	parentPath := filepath.Join(tempDir, "MyService.json")
+	parentWriteErr := ioutil.WriteFile(parentPath, parentBytes, 0644)
+	if parentWriteErr != nil {
+		t.Fatal(parentWriteErr)
+	}
+	template, templateErr := readTemplateWithNestedResources(parentPath)
+	if templateErr != nil {
+		t.Fatal(templateErr)
+	}
+	resources := templateSection(template, "Resources")
+	if len(resources) != 2 || resources["FnA"] == nil {
+		t.Fatalf("Expected nested resources to be merged: %#v", resources)
+	}
+}
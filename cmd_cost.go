@@ -0,0 +1,413 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// costHoursPerMonth is the number of hours in the estimated month
+	costHoursPerMonth = 730
+	// costDefaultMemorySize is the Lambda MemorySize if the template
+	// doesn't define one
+	costDefaultMemorySize = 128
+)
+
+// costPrices is the on-demand price table in USD that's used for the
+// estimate. Free tier allowances aren't included.
+type costPrices struct {
+	Region                           string
+	LambdaRequestsPerMillion         float64
+	LambdaGBSecond                   map[AWSLambdaArchitecture]float64
+	LambdaProvisionedGBSecond        map[AWSLambdaArchitecture]float64
+	LambdaProvisionedDurationGBSec   map[AWSLambdaArchitecture]float64
+	APIGatewayRESTPerMillion         float64
+	APIGatewayHTTPPerMillion         float64
+	APIGatewayWebSocketPerMillion    float64
+	KinesisShardHour                 float64
+	KinesisPutPayloadUnitsPerMillion float64
+	DynamoDBWriteCapacityUnitHour    float64
+	DynamoDBReadCapacityUnitHour     float64
+	CloudWatchAlarmMonth             float64
+	CloudWatchDashboardMonth         float64
+}
+
+// costPriceTable is the bundled us-east-1 price table, so that estimates
+// can be made offline. See https://aws.amazon.com/pricing/ for the
+// current prices.
+var costPriceTable = costPrices{
+	Region:                   "us-east-1",
+	LambdaRequestsPerMillion: 0.20,
+	LambdaGBSecond: map[AWSLambdaArchitecture]float64{
+		ArchitectureX8664: 0.0000166667,
+		ArchitectureARM64: 0.0000133334,
+	},
+	LambdaProvisionedGBSecond: map[AWSLambdaArchitecture]float64{
+		ArchitectureX8664: 0.0000041667,
+		ArchitectureARM64: 0.0000033334,
+	},
+	LambdaProvisionedDurationGBSec: map[AWSLambdaArchitecture]float64{
+		ArchitectureX8664: 0.0000097222,
+		ArchitectureARM64: 0.0000077778,
+	},
+	APIGatewayRESTPerMillion:         3.50,
+	APIGatewayHTTPPerMillion:         1.00,
+	APIGatewayWebSocketPerMillion:    1.00,
+	KinesisShardHour:                 0.015,
+	KinesisPutPayloadUnitsPerMillion: 0.014,
+	DynamoDBWriteCapacityUnitHour:    0.00065,
+	DynamoDBReadCapacityUnitHour:     0.00013,
+	CloudWatchAlarmMonth:             0.10,
+	CloudWatchDashboardMonth:         3.00,
+}
+
+// CostFunctionUsage is the monthly usage of a single Lambda function. Zero
+// values use the CostUsageProfile value.
+type CostFunctionUsage struct {
+	Invocations       int64   `json:"invocations,omitempty" yaml:"invocations,omitempty"`
+	AverageDurationMS float64 `json:"averageDurationMS,omitempty" yaml:"averageDurationMS,omitempty"`
+}
+
+// CostUsageProfile is the monthly usage that's combined with the service
+// template to estimate the cost
+type CostUsageProfile struct {
+	// Invocations is the number of invocations of each Lambda function
+	Invocations int64 `json:"invocations" yaml:"invocations"`
+	// AverageDurationMS is the average Lambda function duration
+	AverageDurationMS float64 `json:"averageDurationMS" yaml:"averageDurationMS"`
+	// APIRequests is the number of requests (or WebSocket messages) to
+	// each API Gateway API
+	APIRequests int64 `json:"apiRequests" yaml:"apiRequests"`
+	// KinesisRecords is the number of records, up to 25KB each, put to
+	// each Kinesis stream
+	KinesisRecords int64 `json:"kinesisRecords" yaml:"kinesisRecords"`
+	// Functions is the usage of specific functions, keyed by either the
+	// Go function name (eg, main.helloWorld) or the logical resource name
+	Functions map[string]*CostFunctionUsage `json:"functions,omitempty" yaml:"functions,omitempty"`
+}
+
+// NewCostUsageProfile returns the default usage profile of one million
+// 100ms invocations and API requests a month
+func NewCostUsageProfile() *CostUsageProfile {
+	return &CostUsageProfile{
+		Invocations:       1000000,
+		AverageDurationMS: 100,
+		APIRequests:       1000000,
+		KinesisRecords:    0,
+	}
+}
+
+// functionUsage returns the usage for the Lambda function
+func (profile *CostUsageProfile) functionUsage(logicalName string,
+	goFunctionName string) *CostFunctionUsage {
+	usage := &CostFunctionUsage{
+		Invocations:       profile.Invocations,
+		AverageDurationMS: profile.AverageDurationMS,
+	}
+	for _, eachKey := range []string{goFunctionName, logicalName} {
+		functionUsage, functionUsageExists := profile.Functions[eachKey]
+		if eachKey == "" || !functionUsageExists || functionUsage == nil {
+			continue
+		}
+		if functionUsage.Invocations != 0 {
+			usage.Invocations = functionUsage.Invocations
+		}
+		if functionUsage.AverageDurationMS != 0 {
+			usage.AverageDurationMS = functionUsage.AverageDurationMS
+		}
+		break
+	}
+	return usage
+}
+
+// CostEstimateItem is the estimated monthly cost of a template resource
+type CostEstimateItem struct {
+	Resource string  `json:"resource"`
+	Type     string  `json:"type"`
+	Monthly  float64 `json:"monthly"`
+	Details  string  `json:"details"`
+}
+
+// CostEstimate is the estimated monthly cost of a service in USD
+type CostEstimate struct {
+	Service string              `json:"service"`
+	Region  string              `json:"region"`
+	Items   []*CostEstimateItem `json:"items"`
+	Total   float64             `json:"total"`
+}
+
+// costNumber returns the numeric value of a template property, or the
+// default value if it's undefined or not a literal
+func costNumber(value interface{}, defaultValue float64) float64 {
+	switch typedValue := value.(type) {
+	case float64:
+		return typedValue
+	case string:
+		var parsed float64
+		_, scanErr := fmt.Sscanf(typedValue, "%g", &parsed)
+		if scanErr == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// costLambdaArchitecture returns the architecture of the Lambda function
+func costLambdaArchitecture(properties map[string]interface{}) AWSLambdaArchitecture {
+	architectures, _ := properties["Architectures"].([]interface{})
+	if len(architectures) != 0 && architectures[0] == string(ArchitectureARM64) {
+		return ArchitectureARM64
+	}
+	return ArchitectureX8664
+}
+
+// costGoFunctionName returns the Go function name of the Lambda function.
+// Sparta records the name in the resource Metadata keyed by the runtime.
+func costGoFunctionName(function *samResource) string {
+	metadata, _ := function.resource["Metadata"].(map[string]interface{})
+	for _, eachRuntime := range []AWSLambdaRuntimeName{Go1LambdaRuntime, ProvidedAL2LambdaRuntime} {
+		goFunctionName, goFunctionNameOk := metadata[string(eachRuntime)].(string)
+		if goFunctionNameOk {
+			return goFunctionName
+		}
+	}
+	return ""
+}
+
+// costProvisionedConcurrency returns the provisioned concurrency of the
+// Lambda function that's configured by its aliases and versions
+func costProvisionedConcurrency(resources map[string]interface{}, logicalName string) float64 {
+	provisioned := 0.0
+	for _, eachType := range []string{"AWS::Lambda::Alias", "AWS::Lambda::Version"} {
+		for _, eachResource := range samResourcesOfType(resources, eachType) {
+			if !samRefersTo(eachResource.properties["FunctionName"], logicalName) {
+				continue
+			}
+			config, _ := eachResource.properties["ProvisionedConcurrencyConfig"].(map[string]interface{})
+			provisioned += costNumber(config["ProvisionedConcurrentExecutions"], 0)
+		}
+	}
+	return provisioned
+}
+
+// NewCostEstimate returns the monthly cost estimate for the resources in
+// the CloudFormation template and the usage profile
+func NewCostEstimate(serviceName string,
+	template map[string]interface{},
+	usage *CostUsageProfile) *CostEstimate {
+
+	prices := costPriceTable
+	resources, _ := template["Resources"].(map[string]interface{})
+	estimate := &CostEstimate{
+		Service: serviceName,
+		Region:  prices.Region,
+		Items:   make([]*CostEstimateItem, 0),
+	}
+	addItem := func(resource *samResource, resourceType string, monthly float64, details string) {
+		estimate.Items = append(estimate.Items, &CostEstimateItem{
+			Resource: resource.name,
+			Type:     resourceType,
+			Monthly:  monthly,
+			Details:  details,
+		})
+		estimate.Total += monthly
+	}
+
+	// Lambda functions
+	for _, eachFunction := range samResourcesOfType(resources, "AWS::Lambda::Function") {
+		functionUsage := usage.functionUsage(eachFunction.name,
+			costGoFunctionName(eachFunction))
+		memoryGB := costNumber(eachFunction.properties["MemorySize"], costDefaultMemorySize) / 1024
+		arch := costLambdaArchitecture(eachFunction.properties)
+		provisioned := costProvisionedConcurrency(resources, eachFunction.name)
+
+		gbSeconds := float64(functionUsage.Invocations) * functionUsage.AverageDurationMS / 1000 * memoryGB
+		durationPrice := prices.LambdaGBSecond[arch]
+		if provisioned != 0 {
+			durationPrice = prices.LambdaProvisionedDurationGBSec[arch]
+		}
+		monthly := float64(functionUsage.Invocations)/1000000*prices.LambdaRequestsPerMillion +
+			gbSeconds*durationPrice
+		details := fmt.Sprintf("%d invocations x %gms x %gMB (%s)",
+			functionUsage.Invocations,
+			functionUsage.AverageDurationMS,
+			memoryGB*1024,
+			arch)
+		if provisioned != 0 {
+			monthly += provisioned * memoryGB * costHoursPerMonth * 3600 * prices.LambdaProvisionedGBSecond[arch]
+			details += fmt.Sprintf(", %g provisioned concurrency", provisioned)
+		}
+		addItem(eachFunction, "AWS::Lambda::Function", monthly, details)
+	}
+
+	// API Gateway
+	for _, eachAPI := range samResourcesOfType(resources, "AWS::ApiGateway::RestApi") {
+		addItem(eachAPI,
+			"AWS::ApiGateway::RestApi",
+			float64(usage.APIRequests)/1000000*prices.APIGatewayRESTPerMillion,
+			fmt.Sprintf("%d REST API requests", usage.APIRequests))
+	}
+	for _, eachAPI := range samResourcesOfType(resources, "AWS::ApiGatewayV2::Api") {
+		pricePerMillion := prices.APIGatewayHTTPPerMillion
+		requestType := "HTTP API requests"
+		if eachAPI.properties["ProtocolType"] == "WEBSOCKET" {
+			pricePerMillion = prices.APIGatewayWebSocketPerMillion
+			requestType = "WebSocket messages"
+		}
+		addItem(eachAPI,
+			"AWS::ApiGatewayV2::Api",
+			float64(usage.APIRequests)/1000000*pricePerMillion,
+			fmt.Sprintf("%d %s", usage.APIRequests, requestType))
+	}
+
+	// Kinesis
+	for _, eachStream := range samResourcesOfType(resources, "AWS::Kinesis::Stream") {
+		shards := costNumber(eachStream.properties["ShardCount"], 1)
+		addItem(eachStream,
+			"AWS::Kinesis::Stream",
+			shards*costHoursPerMonth*prices.KinesisShardHour+
+				float64(usage.KinesisRecords)/1000000*prices.KinesisPutPayloadUnitsPerMillion,
+			fmt.Sprintf("%g shard(s), %d records", shards, usage.KinesisRecords))
+	}
+
+	// DynamoDB
+	for _, eachTable := range samResourcesOfType(resources, "AWS::DynamoDB::Table") {
+		if eachTable.properties["BillingMode"] == "PAY_PER_REQUEST" {
+			addItem(eachTable,
+				"AWS::DynamoDB::Table",
+				0,
+				"On-demand capacity usage isn't estimated")
+			continue
+		}
+		throughput, _ := eachTable.properties["ProvisionedThroughput"].(map[string]interface{})
+		readCapacity := costNumber(throughput["ReadCapacityUnits"], 0)
+		writeCapacity := costNumber(throughput["WriteCapacityUnits"], 0)
+		addItem(eachTable,
+			"AWS::DynamoDB::Table",
+			(readCapacity*prices.DynamoDBReadCapacityUnitHour+
+				writeCapacity*prices.DynamoDBWriteCapacityUnitHour)*costHoursPerMonth,
+			fmt.Sprintf("%g RCU, %g WCU provisioned", readCapacity, writeCapacity))
+	}
+
+	// CloudWatch
+	for _, eachAlarm := range samResourcesOfType(resources, "AWS::CloudWatch::Alarm") {
+		addItem(eachAlarm,
+			"AWS::CloudWatch::Alarm",
+			prices.CloudWatchAlarmMonth,
+			"Standard resolution alarm")
+	}
+	for _, eachDashboard := range samResourcesOfType(resources, "AWS::CloudWatch::Dashboard") {
+		addItem(eachDashboard,
+			"AWS::CloudWatch::Dashboard",
+			prices.CloudWatchDashboardMonth,
+			"Dashboard")
+	}
+	// Most expensive first
+	sort.SliceStable(estimate.Items, func(i, j int) bool {
+		return estimate.Items[i].Monthly > estimate.Items[j].Monthly
+	})
+	return estimate
+}
+
+// Write writes the estimate to the writer in the text or json format
+func (estimate *CostEstimate) Write(format string, writer io.Writer) error {
+	switch format {
+	case StatusFormatText:
+		tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tabWriter, "RESOURCE\tTYPE\tMONTHLY (USD)\tDETAILS")
+		for _, eachItem := range estimate.Items {
+			fmt.Fprintf(tabWriter, "%s\t%s\t%.2f\t%s\n",
+				eachItem.Resource,
+				eachItem.Type,
+				eachItem.Monthly,
+				eachItem.Details)
+		}
+		fmt.Fprintf(tabWriter, "TOTAL\t\t%.2f\t%s on-demand prices, excluding free tier\n",
+			estimate.Total,
+			estimate.Region)
+		return tabWriter.Flush()
+	case StatusFormatJSON:
+		estimateBytes, estimateBytesErr := json.MarshalIndent(estimate, "", "  ")
+		if estimateBytesErr != nil {
+			return errors.Wrapf(estimateBytesErr, "Failed to marshal cost estimate")
+		}
+		_, writeErr := fmt.Fprintf(writer, "%s\n", estimateBytes)
+		return writeErr
+	default:
+		return errors.Errorf("Unsupported cost format: %s", format)
+	}
+}
+
+// readCostUsageProfile returns the usage profile in the JSON or YAML file.
+// Undefined values use the NewCostUsageProfile defaults.
+func readCostUsageProfile(usagePath string) (*CostUsageProfile, error) {
+	usage := NewCostUsageProfile()
+	if usagePath == "" {
+		return usage, nil
+	}
+	/* #nosec */
+	usageBytes, usageBytesErr := ioutil.ReadFile(usagePath)
+	if usageBytesErr != nil {
+		return nil, errors.Wrapf(usageBytesErr, "Failed to read usage profile: %s", usagePath)
+	}
+	// YAML is a superset of JSON
+	unmarshalErr := yaml.Unmarshal(usageBytes, usage)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse usage profile: %s", usagePath)
+	}
+	return usage, nil
+}
+
+// Cost is the command that estimates the monthly cost of the service from
+// its CloudFormation template, including any nested stack templates, the
+// usage profile and the bundled price table
+func Cost(serviceName string,
+	templatePath string,
+	usagePath string,
+	format string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+
+	usage, usageErr := readCostUsageProfile(usagePath)
+	if usageErr != nil {
+		return usageErr
+	}
+	template, templateErr := readTemplateWithNestedResources(templatePath)
+	if templateErr != nil {
+		return templateErr
+	}
+	estimate := NewCostEstimate(serviceName, template, usage)
+
+	// Warn about function usage that doesn't apply to any function
+	resources, _ := template["Resources"].(map[string]interface{})
+	functionNames := make(map[string]bool)
+	for _, eachFunction := range samResourcesOfType(resources, "AWS::Lambda::Function") {
+		functionNames[eachFunction.name] = true
+		functionNames[costGoFunctionName(eachFunction)] = true
+	}
+	for eachName := range usage.Functions {
+		if !functionNames[eachName] {
+			logger.Warn().
+				Str("Function", eachName).
+				Msg("Usage profile function doesn't match a Lambda function")
+		}
+	}
+	logger.Info().
+		Str("Region", estimate.Region).
+		Int64("Invocations", usage.Invocations).
+		Float64("AverageDurationMS", usage.AverageDurationMS).
+		Int64("APIRequests", usage.APIRequests).
+		Str("Total", fmt.Sprintf("$%.2f", estimate.Total)).
+		Msg("Monthly cost estimate")
+	return estimate.Write(format, outputWriter)
+}
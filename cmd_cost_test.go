@@ -0,0 +1,141 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const costTestTemplate = `{
+  "Resources": {
+    "HelloLambda": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {"MemorySize": 512},
+      "Metadata": {"go1.x": "main.helloWorld"}
+    },
+    "WorkerLambda": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {"MemorySize": 1024, "Architectures": ["arm64"]}
+    },
+    "WorkerAlias": {
+      "Type": "AWS::Lambda::Alias",
+      "Properties": {
+        "FunctionName": {"Ref": "WorkerLambda"},
+        "ProvisionedConcurrencyConfig": {"ProvisionedConcurrentExecutions": 2}
+      }
+    },
+    "API": {"Type": "AWS::ApiGateway::RestApi"},
+    "LogStream": {"Type": "AWS::Kinesis::Stream", "Properties": {"ShardCount": 2}},
+    "ConnectionTable": {
+      "Type": "AWS::DynamoDB::Table",
+      "Properties": {"ProvisionedThroughput": {"ReadCapacityUnits": 5, "WriteCapacityUnits": 5}}
+    },
+    "ErrorAlarm": {"Type": "AWS::CloudWatch::Alarm"},
+    "Dashboard": {"Type": "AWS::CloudWatch::Dashboard"},
+    "Role": {"Type": "AWS::IAM::Role"}
+  }
+}`
+
+func TestCostEstimate(t *testing.T) {
+	var template map[string]interface{}
+	unmarshalErr := json.Unmarshal([]byte(costTestTemplate), &template)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	usage := NewCostUsageProfile()
+	usage.Functions = map[string]*CostFunctionUsage{
+		"main.helloWorld": {
+			Invocations: 2000000,
+		},
+	}
+	estimate := NewCostEstimate("CostTest", template, usage)
+
+	prices := costPriceTable
+	expected := map[string]float64{
+		// 2M requests + 2M x 0.1s x 0.5GB
+		"HelloLambda": 2*prices.LambdaRequestsPerMillion +
+			100000*prices.LambdaGBSecond[ArchitectureX8664],
+		// 1M requests + 1M x 0.1s x 1GB + 2 x 1GB x 730h provisioned
+		"WorkerLambda": prices.LambdaRequestsPerMillion +
+			100000*prices.LambdaProvisionedDurationGBSec[ArchitectureARM64] +
+			2*costHoursPerMonth*3600*prices.LambdaProvisionedGBSecond[ArchitectureARM64],
+		"API":             prices.APIGatewayRESTPerMillion,
+		"LogStream":       2 * costHoursPerMonth * prices.KinesisShardHour,
+		"ConnectionTable": 5 * costHoursPerMonth * (prices.DynamoDBReadCapacityUnitHour + prices.DynamoDBWriteCapacityUnitHour),
+		"ErrorAlarm":      prices.CloudWatchAlarmMonth,
+		"Dashboard":       prices.CloudWatchDashboardMonth,
+	}
+	if len(estimate.Items) != len(expected) {
+		t.Fatalf("Expected %d items. Found: %d", len(expected), len(estimate.Items))
+	}
+	total := 0.0
+	for index, eachItem := range estimate.Items {
+		expectedMonthly, expectedMonthlyExists := expected[eachItem.Resource]
+		if !expectedMonthlyExists {
+			t.Fatalf("Unexpected cost item: %#v", eachItem)
+		}
+		if math.Abs(expectedMonthly-eachItem.Monthly) > 0.0001 {
+			t.Fatalf("Expected %s monthly cost %f. Found: %f", eachItem.Resource, expectedMonthly, eachItem.Monthly)
+		}
+		if index != 0 && eachItem.Monthly > estimate.Items[index-1].Monthly {
+			t.Fatalf("Expected items to be sorted by cost")
+		}
+		total += expectedMonthly
+	}
+	if math.Abs(total-estimate.Total) > 0.0001 {
+		t.Fatalf("Expected total %f. Found: %f", total, estimate.Total)
+	}
+}
+
+func TestCost(t *testing.T) {
+	outputDir, outputDirErr := ioutil.TempDir("", "sparta-cost")
+	if outputDirErr != nil {
+		t.Fatal(outputDirErr)
+	}
+	defer os.RemoveAll(outputDir)
+
+	templatePath := filepath.Join(outputDir, "template.json")
+	usagePath := filepath.Join(outputDir, "usage.yaml")
+	writeErr := ioutil.WriteFile(templatePath, []byte(costTestTemplate), 0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	writeErr = ioutil.WriteFile(usagePath, []byte("invocations: 5000000\nfunctions:\n  WorkerLambda:\n    averageDurationMS: 250\n"), 0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	logger := zerolog.New(ioutil.Discard)
+
+	var textOutput bytes.Buffer
+	costErr := Cost("CostTest", templatePath, usagePath, StatusFormatText, &textOutput, &logger)
+	if costErr != nil {
+		t.Fatal(costErr)
+	}
+	if !strings.Contains(textOutput.String(), "5000000 invocations x 250ms x 1024MB (arm64)") ||
+		!strings.Contains(textOutput.String(), "TOTAL") {
+		t.Fatalf("Unexpected text estimate:\n%s", textOutput.String())
+	}
+
+	var jsonOutput bytes.Buffer
+	costErr = Cost("CostTest", templatePath, usagePath, StatusFormatJSON, &jsonOutput, &logger)
+	if costErr != nil {
+		t.Fatal(costErr)
+	}
+	var estimate CostEstimate
+	unmarshalErr := json.Unmarshal(jsonOutput.Bytes(), &estimate)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	if estimate.Service != "CostTest" || estimate.Total <= 0 {
+		t.Fatalf("Unexpected JSON estimate: %s", jsonOutput.String())
+	}
+}
@@ -3,10 +3,16 @@
 package sparta
 
 import (
+	"fmt"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
 	spartaAWS "github.com/mweagle/Sparta/aws"
 	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
 
@@ -41,3 +47,150 @@ func Delete(serviceName string, logger *zerolog.Logger) error {
 	logger.Info().Msg("Stack does not exist")
 	return nil
 }
+
+// stageArtifactsPrefix returns the S3 key prefix of the artifacts uploaded
+// for the service
+func stageArtifactsPrefix(serviceName string) string {
+	return fmt.Sprintf("%s/", serviceName)
+}
+
+// stageLogGroupPrefix returns the CloudWatch Logs group prefix of the
+// service's lambda functions
+func stageLogGroupPrefix(serviceName string) string {
+	return fmt.Sprintf("/aws/lambda/%s%s", serviceName, functionNameDelimiter)
+}
+
+// deleteStageArtifacts deletes all versions of the service's artifacts
+// from the S3 bucket
+func deleteStageArtifacts(serviceName string,
+	s3Bucket string,
+	awsSession *session.Session,
+	logger *zerolog.Logger) error {
+	s3Svc := s3.New(awsSession)
+	totalItemsDeleted := 0
+	var deleteErr error
+	deleteItemsHandler := func(versionsOutput *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		params := &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3Bucket),
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{},
+				Quiet:   aws.Bool(true),
+			},
+		}
+		for _, eachVersion := range versionsOutput.Versions {
+			params.Delete.Objects = append(params.Delete.Objects, &s3.ObjectIdentifier{
+				Key:       eachVersion.Key,
+				VersionId: eachVersion.VersionId,
+			})
+		}
+		for _, eachMarker := range versionsOutput.DeleteMarkers {
+			params.Delete.Objects = append(params.Delete.Objects, &s3.ObjectIdentifier{
+				Key:       eachMarker.Key,
+				VersionId: eachMarker.VersionId,
+			})
+		}
+		if len(params.Delete.Objects) == 0 {
+			return true
+		}
+		deleteOutput, deleteOutputErr := s3Svc.DeleteObjects(params)
+		if deleteOutputErr != nil {
+			deleteErr = deleteOutputErr
+			return false
+		}
+		// Quiet mode only reports the objects that weren't deleted
+		if len(deleteOutput.Errors) != 0 {
+			firstErr := deleteOutput.Errors[0]
+			deleteErr = errors.Errorf("%d artifacts weren't deleted. First error: %s (%s: %s)",
+				len(deleteOutput.Errors),
+				aws.StringValue(firstErr.Key),
+				aws.StringValue(firstErr.Code),
+				aws.StringValue(firstErr.Message))
+			return false
+		}
+		totalItemsDeleted += len(params.Delete.Objects)
+		return true
+	}
+	params := &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(s3Bucket),
+		Prefix:  aws.String(stageArtifactsPrefix(serviceName)),
+		MaxKeys: aws.Int64(1000),
+	}
+	listErr := s3Svc.ListObjectVersionsPages(params, deleteItemsHandler)
+	if listErr != nil {
+		return errors.Wrapf(listErr, "Failed to list artifacts in bucket: %s", s3Bucket)
+	}
+	if deleteErr != nil {
+		return errors.Wrapf(deleteErr, "Failed to delete artifacts in bucket: %s", s3Bucket)
+	}
+	logger.Info().
+		Str("Bucket", s3Bucket).
+		Str("Prefix", aws.StringValue(params.Prefix)).
+		Int("Count", totalItemsDeleted).
+		Msg("Deleted stage artifacts")
+	return nil
+}
+
+// deleteStageLogGroups deletes the log groups created by the service's
+// lambda functions
+func deleteStageLogGroups(serviceName string,
+	awsSession *session.Session,
+	logger *zerolog.Logger) error {
+	logsSvc := cloudwatchlogs.New(awsSession)
+	logGroupNames := make([]string, 0)
+	params := &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(stageLogGroupPrefix(serviceName)),
+	}
+	describeErr := logsSvc.DescribeLogGroupsPages(params,
+		func(groupsOutput *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+			for _, eachGroup := range groupsOutput.LogGroups {
+				logGroupNames = append(logGroupNames, aws.StringValue(eachGroup.LogGroupName))
+			}
+			return true
+		})
+	if describeErr != nil {
+		return errors.Wrapf(describeErr, "Failed to describe log groups")
+	}
+	for _, eachName := range logGroupNames {
+		_, deleteErr := logsSvc.DeleteLogGroup(&cloudwatchlogs.DeleteLogGroupInput{
+			LogGroupName: aws.String(eachName),
+		})
+		if deleteErr != nil {
+			return errors.Wrapf(deleteErr, "Failed to delete log group: %s", eachName)
+		}
+		logger.Info().
+			Str("LogGroup", eachName).
+			Msg("Deleted stage log group")
+	}
+	return nil
+}
+
+// DeleteStage deletes the stack for a stage scoped service (see
+// StageScopedServiceName) and, after the stack is deleted, the resources
+// that aren't managed by CloudFormation: the artifacts uploaded to the
+// optional s3Bucket, including the build records, and the lambda function
+// log groups. It's only used for ephemeral stages (see
+// StageConfiguration.Ephemeral) s.t. deleting a stage that's defined in the
+// configuration file retains its artifacts.
+func DeleteStage(serviceName string, s3Bucket string, logger *zerolog.Logger) error {
+	deleteErr := Delete(serviceName, logger)
+	if deleteErr != nil {
+		return deleteErr
+	}
+	awsSession := spartaAWS.NewSession(logger)
+	logger.Info().
+		Str("Name", serviceName).
+		Msg("Waiting for stack deletion to complete")
+	waitErr := cloudformation.New(awsSession).WaitUntilStackDeleteComplete(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if waitErr != nil {
+		return errors.Wrapf(waitErr, "Failed to delete stack: %s", serviceName)
+	}
+	if s3Bucket != "" {
+		artifactsErr := deleteStageArtifacts(serviceName, s3Bucket, awsSession, logger)
+		if artifactsErr != nil {
+			return artifactsErr
+		}
+	}
+	return deleteStageLogGroups(serviceName, awsSession, logger)
+}
@@ -33,92 +33,32 @@ func workflowHooksDescriptionNodes(serviceName string, hooks *WorkflowHooks) ([]
 	return workflowDescInfo, nil
 }
 
-// Describe produces a graphical representation of a service's Lambda and data sources.  Typically
-// automatically called as part of a compiled golang binary via the `describe` command
-// line option.
-func Describe(serviceName string,
-	serviceDescription string,
+// serviceDescriptionWriter is the node and edge sink for the service
+// description graph
+type serviceDescriptionWriter interface {
+	writeNodeWithParent(nodeName string,
+		nodeColor string,
+		nodeImage string,
+		nodeParent string,
+		labelWeight string) error
+	writeEdge(fromNode string,
+		toNode string,
+		label string) error
+}
+
+// writeServiceDescription writes the nodes and edges of the service's
+// Lambda functions, API and workflow hooks to the describer
+func writeServiceDescription(serviceName string,
 	lambdaAWSInfos []*LambdaAWSInfo,
 	api APIGateway,
-	site *S3Site,
-	s3BucketName string,
-	buildTags string,
-	linkerFlags string,
-	outputWriter io.Writer,
 	workflowHooks *WorkflowHooks,
-	logger *zerolog.Logger) error {
-
-	// Multiwriter
-	templateFile, templateFileErr := templateOutputFile(optionsProvision.OutputDir,
-		serviceName)
-	if templateFileErr != nil {
-		return templateFileErr
-	}
-
-	var cloudFormationTemplate bytes.Buffer
-	multiWriter := io.MultiWriter(templateFile, &cloudFormationTemplate)
-
-	buildErr := Build(true,
-		serviceName,
-		serviceDescription,
-		lambdaAWSInfos,
-		api,
-		site,
-		false,
-		"BUILD_ID",
-		"",
-		ScratchDirectory,
-		buildTags,
-		linkerFlags,
-		multiWriter,
-		workflowHooks,
-		logger)
-	closeErr := templateFile.Close()
-	if closeErr != nil {
-		logger.Warn().
-			Err(closeErr).
-			Msg("Failed to close template file handle")
-	}
-	if buildErr != nil {
-		return buildErr
-	}
-
-	tmpl, err := template.New("description").Parse(_escFSMustString(false, "/resources/describe/template.html"))
-	if err != nil {
-		return errors.New(err.Error())
-	}
-
-	// Setup the describer
-	describer := descriptionWriter{
-		nodes:  make([]*cytoscapeNode, 0),
-		logger: logger,
-	}
-
-	// Instead of inline mermaid stuff, we're going to stuff raw
-	// json through. We can also include AWS images in the icon
-	// using base64/encoded:
-	// Example: https://cytoscape.github.io/cytoscape.js-tutorial-demo/datasets/social.json
-	// Use the "fancy" CSS:
-	// https://github.com/cytoscape/cytoscape.js-tutorial-demo/blob/gh-pages/stylesheets/fancy.json
-	// Which is dynamically updated at: https://cytoscape.github.io/cytoscape.js-tutorial-demo/
-
-	fullIconPath := func(descriptionNode *DescriptionIcon) string {
-		// Use an empty PNG if we don't have an image
-		if descriptionNode == nil {
-			// Because the style uses data(image) we need to ensure that
-			// empty nodes have some sort of image, else the Cytoscape JS
-			// won't render
-			return "AWS-Architecture-Assets/Default/empty-image.png"
-		}
-		return fmt.Sprintf("AWS-Architecture-Assets/%s/%s",
-			descriptionNode.Category,
-			descriptionNode.Name)
-	}
+	describer serviceDescriptionWriter,
+	iconPath func(descriptionNode *DescriptionIcon) string) error {
 
 	// Setup the root object
 	writeErr := describer.writeNodeWithParent(serviceName,
 		nodeColorService,
-		fullIconPath(&DescriptionIcon{
+		iconPath(&DescriptionIcon{
 			Category: "Res_Management-Governance",
 			Name:     "Res_48_Light/Res_AWS-CloudFormation_Stack_48_Light.png",
 		}),
@@ -135,7 +75,7 @@ func Describe(serviceName string,
 			if !exists {
 				writeErr = describer.writeNodeWithParent(parent,
 					"#FF0000",
-					fullIconPath(nil),
+					iconPath(nil),
 					"",
 					labelWeightBold)
 				if writeErr != nil {
@@ -152,7 +92,7 @@ func Describe(serviceName string,
 			}
 			writeErr = describer.writeNodeWithParent(eachDescNode.SourceNodeName,
 				descDisplayInfo.SourceNodeColor,
-				fullIconPath(descDisplayInfo.SourceIcon),
+				iconPath(descDisplayInfo.SourceIcon),
 				parent,
 				labelWeightNormal)
 			if writeErr != nil {
@@ -208,6 +148,102 @@ func Describe(serviceName string,
 			return workflowDescriptionErr
 		}
 	}
+	return nil
+}
+
+// Describe produces a graphical representation of a service's Lambda and data sources.  Typically
+// automatically called as part of a compiled golang binary via the `describe` command
+// line option.
+func Describe(serviceName string,
+	serviceDescription string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	site *S3Site,
+	s3BucketName string,
+	buildTags string,
+	linkerFlags string,
+	outputWriter io.Writer,
+	workflowHooks *WorkflowHooks,
+	logger *zerolog.Logger) error {
+
+	// Multiwriter
+	templateFile, templateFileErr := templateOutputFile(optionsProvision.OutputDir,
+		serviceName)
+	if templateFileErr != nil {
+		return templateFileErr
+	}
+
+	var cloudFormationTemplate bytes.Buffer
+	multiWriter := io.MultiWriter(templateFile, &cloudFormationTemplate)
+
+	buildErr := Build(true,
+		serviceName,
+		serviceDescription,
+		lambdaAWSInfos,
+		api,
+		site,
+		false,
+		"BUILD_ID",
+		"",
+		"",
+		"",
+		ScratchDirectory,
+		buildTags,
+		linkerFlags,
+		multiWriter,
+		workflowHooks,
+		logger)
+	closeErr := templateFile.Close()
+	if closeErr != nil {
+		logger.Warn().
+			Err(closeErr).
+			Msg("Failed to close template file handle")
+	}
+	if buildErr != nil {
+		return buildErr
+	}
+
+	tmpl, err := template.New("description").Parse(_escFSMustString(false, "/resources/describe/template.html"))
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	// Setup the describer
+	describer := descriptionWriter{
+		nodes:  make([]*cytoscapeNode, 0),
+		logger: logger,
+	}
+
+	// Instead of inline mermaid stuff, we're going to stuff raw
+	// json through. We can also include AWS images in the icon
+	// using base64/encoded:
+	// Example: https://cytoscape.github.io/cytoscape.js-tutorial-demo/datasets/social.json
+	// Use the "fancy" CSS:
+	// https://github.com/cytoscape/cytoscape.js-tutorial-demo/blob/gh-pages/stylesheets/fancy.json
+	// Which is dynamically updated at: https://cytoscape.github.io/cytoscape.js-tutorial-demo/
+
+	fullIconPath := func(descriptionNode *DescriptionIcon) string {
+		// Use an empty PNG if we don't have an image
+		if descriptionNode == nil {
+			// Because the style uses data(image) we need to ensure that
+			// empty nodes have some sort of image, else the Cytoscape JS
+			// won't render
+			return "AWS-Architecture-Assets/Default/empty-image.png"
+		}
+		return fmt.Sprintf("AWS-Architecture-Assets/%s/%s",
+			descriptionNode.Category,
+			descriptionNode.Name)
+	}
+
+	writeErr := writeServiceDescription(serviceName,
+		lambdaAWSInfos,
+		api,
+		workflowHooks,
+		&describer,
+		fullIconPath)
+	if writeErr != nil {
+		return writeErr
+	}
 
 	// Write it out...
 	cytoscapeBytes, cytoscapeBytesErr := json.MarshalIndent(describer.nodes, "", " ")
@@ -0,0 +1,553 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	templateDiffAdd    = "+"
+	templateDiffRemove = "-"
+	templateDiffModify = "~"
+)
+
+// changeSetActionOrder is the order in which change set actions are reported
+var changeSetActionOrder = []string{
+	cloudformation.ChangeActionAdd,
+	cloudformation.ChangeActionModify,
+	cloudformation.ChangeActionRemove,
+	cloudformation.ChangeActionImport,
+	cloudformation.ChangeActionDynamic,
+}
+
+// iamResourceTypes are the resource types whose property changes
+// are reported as IAM policy changes
+var iamResourceTypes = map[string]bool{
+	"AWS::IAM::Role":          true,
+	"AWS::IAM::Policy":        true,
+	"AWS::IAM::ManagedPolicy": true,
+}
+
+// StackChangesError is the error returned by Diff when provisioning the
+// template would change the stack's resources
+type StackChangesError struct {
+	// StackName is the name of the stack
+	StackName string
+	// ChangeCount is the number of resource changes
+	ChangeCount int
+}
+
+func (sce *StackChangesError) Error() string {
+	return fmt.Sprintf("%d resource change(s) detected for stack %s",
+		sce.ChangeCount,
+		sce.StackName)
+}
+
+// templateDiffEntry is a single difference between the deployed and the
+// local template
+type templateDiffEntry struct {
+	Path   string
+	Op     string
+	Before interface{}
+	After  interface{}
+}
+
+func templateDiffPath(parentPath string, key string) string {
+	if parentPath == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", parentPath, key)
+}
+
+// diffTemplateValues appends the differences between the two unmarshalled
+// JSON values to entries. Objects are compared by key and arrays
+// are compared element-wise.
+func diffTemplateValues(path string,
+	before interface{},
+	after interface{},
+	entries []*templateDiffEntry) []*templateDiffEntry {
+
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := make([]string, 0, len(beforeMap)+len(afterMap))
+		for eachKey := range beforeMap {
+			keys = append(keys, eachKey)
+		}
+		for eachKey := range afterMap {
+			if _, exists := beforeMap[eachKey]; !exists {
+				keys = append(keys, eachKey)
+			}
+		}
+		sort.Strings(keys)
+		for _, eachKey := range keys {
+			keyPath := templateDiffPath(path, eachKey)
+			beforeValue, beforeExists := beforeMap[eachKey]
+			afterValue, afterExists := afterMap[eachKey]
+			switch {
+			case !beforeExists:
+				entries = append(entries, &templateDiffEntry{
+					Path:  keyPath,
+					Op:    templateDiffAdd,
+					After: afterValue,
+				})
+			case !afterExists:
+				entries = append(entries, &templateDiffEntry{
+					Path:   keyPath,
+					Op:     templateDiffRemove,
+					Before: beforeValue,
+				})
+			default:
+				entries = diffTemplateValues(keyPath, beforeValue, afterValue, entries)
+			}
+		}
+		return entries
+	}
+	beforeSlice, beforeIsSlice := before.([]interface{})
+	afterSlice, afterIsSlice := after.([]interface{})
+	if beforeIsSlice && afterIsSlice {
+		for eachIndex := 0; eachIndex < len(beforeSlice) || eachIndex < len(afterSlice); eachIndex++ {
+			indexPath := fmt.Sprintf("%s[%d]", path, eachIndex)
+			switch {
+			case eachIndex >= len(beforeSlice):
+				entries = append(entries, &templateDiffEntry{
+					Path:  indexPath,
+					Op:    templateDiffAdd,
+					After: afterSlice[eachIndex],
+				})
+			case eachIndex >= len(afterSlice):
+				entries = append(entries, &templateDiffEntry{
+					Path:   indexPath,
+					Op:     templateDiffRemove,
+					Before: beforeSlice[eachIndex],
+				})
+			default:
+				entries = diffTemplateValues(indexPath,
+					beforeSlice[eachIndex],
+					afterSlice[eachIndex],
+					entries)
+			}
+		}
+		return entries
+	}
+	if !reflect.DeepEqual(before, after) {
+		entries = append(entries, &templateDiffEntry{
+			Path:   path,
+			Op:     templateDiffModify,
+			Before: before,
+			After:  after,
+		})
+	}
+	return entries
+}
+
+// templateResourceTypes returns the map of logical resource name to type
+// for the unmarshalled template
+func templateResourceTypes(template interface{}) map[string]string {
+	resourceTypes := make(map[string]string)
+	templateMap, _ := template.(map[string]interface{})
+	resources, _ := templateMap["Resources"].(map[string]interface{})
+	for eachName, eachResource := range resources {
+		resourceMap, _ := eachResource.(map[string]interface{})
+		resourceType, _ := resourceMap["Type"].(string)
+		resourceTypes[eachName] = resourceType
+	}
+	return resourceTypes
+}
+
+// iamTemplateDiffEntries returns the template differences that apply
+// to IAM resources in either template
+func iamTemplateDiffEntries(deployedTemplate interface{},
+	localTemplate interface{},
+	entries []*templateDiffEntry) []*templateDiffEntry {
+	iamResources := make(map[string]bool)
+	for _, eachTemplate := range []interface{}{deployedTemplate, localTemplate} {
+		for eachName, eachType := range templateResourceTypes(eachTemplate) {
+			if iamResourceTypes[eachType] {
+				iamResources[eachName] = true
+			}
+		}
+	}
+	iamEntries := []*templateDiffEntry{}
+	for _, eachEntry := range entries {
+		pathParts := strings.SplitN(eachEntry.Path, ".", 3)
+		if len(pathParts) >= 2 &&
+			pathParts[0] == "Resources" &&
+			iamResources[pathParts[1]] {
+			iamEntries = append(iamEntries, eachEntry)
+		}
+	}
+	return iamEntries
+}
+
+// groupResourceChanges returns the change set resource changes grouped
+// by action
+func groupResourceChanges(changes []*cloudformation.Change) map[string][]*cloudformation.ResourceChange {
+	groups := make(map[string][]*cloudformation.ResourceChange)
+	for _, eachChange := range changes {
+		if eachChange.ResourceChange == nil {
+			continue
+		}
+		action := aws.StringValue(eachChange.ResourceChange.Action)
+		groups[action] = append(groups[action], eachChange.ResourceChange)
+	}
+	for _, eachGroup := range groups {
+		sort.Slice(eachGroup, func(i, j int) bool {
+			return aws.StringValue(eachGroup[i].LogicalResourceId) <
+				aws.StringValue(eachGroup[j].LogicalResourceId)
+		})
+	}
+	return groups
+}
+
+// changeSetDescriber is the signature of the CloudFormation.DescribeChangeSet
+// function
+type changeSetDescriber func(*cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error)
+
+// withNestedStackChanges returns the changes followed by the changes of
+// each nested stack's change set, recursively
+func withNestedStackChanges(changes []*cloudformation.Change,
+	describeChangeSet changeSetDescriber) ([]*cloudformation.Change, error) {
+	allChanges := append([]*cloudformation.Change{}, changes...)
+	for _, eachChange := range changes {
+		resourceChange := eachChange.ResourceChange
+		if resourceChange == nil ||
+			aws.StringValue(resourceChange.ResourceType) != "AWS::CloudFormation::Stack" ||
+			aws.StringValue(resourceChange.ChangeSetId) == "" {
+			continue
+		}
+		nestedChanges := []*cloudformation.Change{}
+		describeInput := &cloudformation.DescribeChangeSetInput{
+			ChangeSetName: resourceChange.ChangeSetId,
+		}
+		for {
+			describeOutput, describeOutputErr := describeChangeSet(describeInput)
+			if describeOutputErr != nil {
+				return nil, errors.Wrapf(describeOutputErr,
+					"Failed to describe nested stack change set: %s",
+					aws.StringValue(resourceChange.LogicalResourceId))
+			}
+			nestedChanges = append(nestedChanges, describeOutput.Changes...)
+			if aws.StringValue(describeOutput.NextToken) == "" {
+				break
+			}
+			describeInput.NextToken = describeOutput.NextToken
+		}
+		expandedChanges, expandedChangesErr := withNestedStackChanges(nestedChanges, describeChangeSet)
+		if expandedChangesErr != nil {
+			return nil, expandedChangesErr
+		}
+		allChanges = append(allChanges, expandedChanges...)
+	}
+	return allChanges, nil
+}
+
+// replacementProperties returns the names of the changed properties that
+// may cause the resource to be replaced
+func replacementProperties(resourceChange *cloudformation.ResourceChange) []string {
+	properties := []string{}
+	for _, eachDetail := range resourceChange.Details {
+		if eachDetail.Target == nil {
+			continue
+		}
+		recreation := aws.StringValue(eachDetail.Target.RequiresRecreation)
+		if recreation == "" || recreation == cloudformation.RequiresRecreationNever {
+			continue
+		}
+		name := aws.StringValue(eachDetail.Target.Name)
+		if name == "" {
+			name = aws.StringValue(eachDetail.Target.Attribute)
+		}
+		properties = append(properties, fmt.Sprintf("%s (%s)", name, recreation))
+	}
+	sort.Strings(properties)
+	return properties
+}
+
+// newStackAddChanges returns the Add changes for each resource in the
+// template of a stack that doesn't exist
+func newStackAddChanges(template interface{}) []*cloudformation.Change {
+	changes := []*cloudformation.Change{}
+	for eachName, eachType := range templateResourceTypes(template) {
+		changes = append(changes, &cloudformation.Change{
+			Type: aws.String(cloudformation.ChangeTypeResource),
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String(eachName),
+				ResourceType:      aws.String(eachType),
+			},
+		})
+	}
+	return changes
+}
+
+func templateDiffValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	jsonBytes, jsonBytesErr := json.Marshal(value)
+	if jsonBytesErr != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(jsonBytes)
+}
+
+func logTemplateDiffEntries(entries []*templateDiffEntry, logger *zerolog.Logger) {
+	for _, eachEntry := range entries {
+		logEvent := logger.Info().Str("Op", eachEntry.Op)
+		if eachEntry.Op != templateDiffAdd {
+			logEvent = logEvent.Str("Before", templateDiffValue(eachEntry.Before))
+		}
+		if eachEntry.Op != templateDiffRemove {
+			logEvent = logEvent.Str("After", templateDiffValue(eachEntry.After))
+		}
+		logEvent.Msg(eachEntry.Path)
+	}
+}
+
+// //////////////////////////////////////////////////////////////////////////////
+// diffStackOp
+// report the changes between the local template and the provisioned stack
+type diffStackOp struct {
+	provisionWorkflowOp
+	// The number of resource changes
+	changeCount int
+}
+
+func (dso *diffStackOp) Rollback(ctx context.Context, logger *zerolog.Logger) error {
+	return nil
+}
+
+func (dso *diffStackOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
+	if dso.provisionContext.noop {
+		logger.Info().
+			Msg(noopMessage("Stack diff"))
+		return nil
+	}
+	serviceName := dso.provisionContext.serviceName
+
+	/* #nosec G304 */
+	localTemplateBytes, localTemplateBytesErr := ioutil.ReadFile(dso.provisionContext.cfTemplatePath)
+	if localTemplateBytesErr != nil {
+		return localTemplateBytesErr
+	}
+	var localTemplate interface{}
+	unmarshalErr := json.Unmarshal(localTemplateBytes, &localTemplate)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal template")
+	}
+
+	stackExists, stackExistsErr := spartaCF.StackExists(serviceName,
+		dso.provisionContext.awsSession,
+		logger)
+	if stackExistsErr != nil {
+		return stackExistsErr
+	}
+
+	var changes []*cloudformation.Change
+	var deployedTemplate interface{}
+	if !stackExists {
+		logger.Info().
+			Str("StackName", serviceName).
+			Msg("Stack does not exist. All resources will be added")
+		changes = newStackAddChanges(localTemplate)
+	} else {
+		awsCloudFormation := cloudformation.New(dso.provisionContext.awsSession)
+		getTemplateOutput, getTemplateOutputErr := awsCloudFormation.GetTemplate(&cloudformation.GetTemplateInput{
+			StackName:     aws.String(serviceName),
+			TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+		})
+		if getTemplateOutputErr != nil {
+			return errors.Wrapf(getTemplateOutputErr, "Failed to get deployed template")
+		}
+		unmarshalErr = json.Unmarshal([]byte(aws.StringValue(getTemplateOutput.TemplateBody)),
+			&deployedTemplate)
+		if unmarshalErr != nil {
+			logger.Warn().
+				Err(unmarshalErr).
+				Msg("Failed to unmarshal deployed template. Template differences will not be reported")
+			deployedTemplate = nil
+		}
+
+		changeSetRequestName := CloudFormationResourceName(fmt.Sprintf("%sDiffChangeSet",
+			serviceName))
+		changeSet, changeSetErr := spartaCF.CreateStackHierarchyChangeSet(changeSetRequestName,
+			serviceName,
+			dso.provisionContext.cfTemplate,
+			dso.provisionContext.s3Uploads[s3UploadCloudFormationStackKey].location,
+			dso.stackParameters(),
+			dso.provisionContext.stackTags,
+			awsCloudFormation,
+			logger)
+		if changeSet != nil && changeSetErr == nil {
+			changes, changeSetErr = withNestedStackChanges(changeSet.Changes,
+				awsCloudFormation.DescribeChangeSet)
+		}
+		// Empty change sets are deleted by CreateStackChangeSet. Deleting
+		// the root change set deletes the nested stack change sets.
+		if changeSet != nil {
+			_, deleteErr := spartaCF.DeleteChangeSet(serviceName,
+				changeSetRequestName,
+				awsCloudFormation)
+			if deleteErr != nil {
+				logger.Warn().
+					Err(deleteErr).
+					Str("ChangeSet", changeSetRequestName).
+					Msg("Failed to delete change set")
+			}
+		}
+		if changeSetErr != nil {
+			return changeSetErr
+		}
+	}
+
+	// Resource changes
+	groups := groupResourceChanges(changes)
+	for _, eachAction := range changeSetActionOrder {
+		resourceChanges := groups[eachAction]
+		if len(resourceChanges) == 0 {
+			continue
+		}
+		logSectionHeader(eachAction, dividerLength, logger)
+		for _, eachResourceChange := range resourceChanges {
+			logEvent := logger.Info().
+				Str("ResourceType", aws.StringValue(eachResourceChange.ResourceType))
+			if eachResourceChange.Replacement != nil {
+				logEvent = logEvent.Str("Replacement", *eachResourceChange.Replacement)
+			}
+			replacements := replacementProperties(eachResourceChange)
+			if len(replacements) != 0 {
+				logEvent = logEvent.Strs("ReplacementProperties", replacements)
+			}
+			logEvent.Msg(aws.StringValue(eachResourceChange.LogicalResourceId))
+		}
+		logger.Info().Msg("")
+		dso.changeCount += len(resourceChanges)
+	}
+
+	// Template changes
+	if deployedTemplate != nil {
+		templateEntries := diffTemplateValues("", deployedTemplate, localTemplate, nil)
+		iamEntries := iamTemplateDiffEntries(deployedTemplate, localTemplate, templateEntries)
+		if len(iamEntries) != 0 {
+			logSectionHeader("IAM Policy Changes", dividerLength, logger)
+			logTemplateDiffEntries(iamEntries, logger)
+			logger.Info().Msg("")
+		}
+		if len(templateEntries) != 0 {
+			logSectionHeader("Template Changes", dividerLength, logger)
+			logTemplateDiffEntries(templateEntries, logger)
+			logger.Info().Msg("")
+		}
+	}
+	logger.Info().
+		Str("StackName", serviceName).
+		Int("ChangeCount", dso.changeCount).
+		Msg("Stack diff complete")
+	return nil
+}
+
+// Diff reports the changes that provisioning the template would apply
+// to the provisioned stack. The report includes the change set resource
+// changes grouped by action, IAM policy changes, and the differences
+// between the deployed and the local template. The change set and
+// uploaded artifacts are deleted after the report is produced. Diff
+// returns a *StackChangesError if the stack resources would change.
+func Diff(noop bool,
+	templatePath string,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	logger *zerolog.Logger) error {
+
+	logger.Info().
+		Bool("NOOP", noop).
+		Str("Template", templatePath).
+		Interface("Params", stackParamValues).
+		Interface("Tags", stackTags).
+		Msg("Diffing service")
+
+	pc := &provisionContext{
+		awsSession:           spartaAWS.NewSession(logger),
+		cfTemplatePath:       templatePath,
+		cfTemplate:           gocf.NewTemplate(),
+		stackParameterValues: stackParamValues,
+		stackTags:            stackTags,
+		s3Uploads:            map[string]*s3UploadURL{},
+		noop:                 noop,
+	}
+	/* #nosec G304 */
+	templateBytes, templateBytesErr := ioutil.ReadFile(templatePath)
+	if templateBytesErr != nil {
+		return templateBytesErr
+	}
+	unmarshalErr := json.Unmarshal(templateBytes, &pc.cfTemplate)
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Workflow
+	//////////////////////////////////////////////////////////////////////////////
+	diffPipeline := pipeline{}
+
+	stagePreconditions := &pipelineStage{}
+	stagePreconditions.Append("validatePreconditions", &ensureProvisionPreconditionsOp{
+		provisionWorkflowOp: provisionWorkflowOp{
+			provisionContext: pc,
+		}})
+	diffPipeline.Append("preconditions", stagePreconditions)
+
+	uploadOp := &uploadPackageOp{
+		provisionWorkflowOp: provisionWorkflowOp{
+			provisionContext: pc,
+		},
+		preview: true,
+	}
+	stageUpload := &pipelineStage{}
+	stageUpload.Append("uploadPackages", uploadOp)
+	diffPipeline.Append("upload", stageUpload)
+
+	diffOp := &diffStackOp{
+		provisionWorkflowOp: provisionWorkflowOp{
+			provisionContext: pc,
+		},
+	}
+	stageDiff := &pipelineStage{}
+	stageDiff.Append("diffStack", diffOp)
+	diffPipeline.Append("diff", stageDiff)
+
+	// Run. Failures rollback the uploads, otherwise clean them up here.
+	pipelineContext := context.Background()
+	diffErr := diffPipeline.Run(pipelineContext, "Diff", logger)
+	if diffErr != nil {
+		return diffErr
+	}
+	cleanupErr := uploadOp.Rollback(pipelineContext, logger)
+	if cleanupErr != nil {
+		logger.Warn().
+			Err(cleanupErr).
+			Msg("Failed to delete uploaded artifacts")
+	}
+	if diffOp.changeCount != 0 {
+		return &StackChangesError{
+			StackName:   pc.serviceName,
+			ChangeCount: diffOp.changeCount,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const diffDeployedTemplate = `{
+	"Resources": {
+		"LambdaRole": {
+			"Type": "AWS::IAM::Role",
+			"Properties": {
+				"Policies": [{"PolicyName": "Logs", "PolicyDocument": {"Statement": [{"Action": ["logs:PutLogEvents"]}]}}]
+			}
+		},
+		"Function": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {"MemorySize": 128, "Timeout": 3}
+		},
+		"Queue": {
+			"Type": "AWS::SQS::Queue"
+		}
+	}
+}`
+
+const diffLocalTemplate = `{
+	"Resources": {
+		"LambdaRole": {
+			"Type": "AWS::IAM::Role",
+			"Properties": {
+				"Policies": [{"PolicyName": "Logs", "PolicyDocument": {"Statement": [{"Action": ["logs:PutLogEvents", "s3:GetObject"]}]}}]
+			}
+		},
+		"Function": {
+			"Type": "AWS::Lambda::Function",
+			"Properties": {"MemorySize": 256, "Timeout": 3, "Description": "Updated"}
+		}
+	}
+}`
+
+func TestDiffTemplateValues(t *testing.T) {
+	var deployed, local interface{}
+	if err := json.Unmarshal([]byte(diffDeployedTemplate), &deployed); err != nil {
+		t.Fatalf("Failed to unmarshal deployed template: %s", err)
+	}
+	if err := json.Unmarshal([]byte(diffLocalTemplate), &local); err != nil {
+		t.Fatalf("Failed to unmarshal local template: %s", err)
+	}
+	entries := diffTemplateValues("", deployed, local, nil)
+	expected := map[string]string{
+		"Resources.Function.Properties.Description":                                         templateDiffAdd,
+		"Resources.Function.Properties.MemorySize":                                          templateDiffModify,
+		"Resources.LambdaRole.Properties.Policies[0].PolicyDocument.Statement[0].Action[1]": templateDiffAdd,
+		"Resources.Queue": templateDiffRemove,
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Unexpected template diff: %#v", entries)
+	}
+	for _, eachEntry := range entries {
+		if expected[eachEntry.Path] != eachEntry.Op {
+			t.Fatalf("Unexpected template diff entry: %#v", eachEntry)
+		}
+	}
+	iamEntries := iamTemplateDiffEntries(deployed, local, entries)
+	if len(iamEntries) != 1 ||
+		iamEntries[0].Path != "Resources.LambdaRole.Properties.Policies[0].PolicyDocument.Statement[0].Action[1]" {
+		t.Fatalf("Unexpected IAM diff: %#v", iamEntries)
+	}
+	if len(diffTemplateValues("", deployed, deployed, nil)) != 0 {
+		t.Fatalf("Expected no differences for identical templates")
+	}
+	if len(newStackAddChanges(local)) != 2 {
+		t.Fatalf("Expected an Add change for each resource")
+	}
+}
+
+func TestDiffResourceChanges(t *testing.T) {
+	changes := []*cloudformation.Change{
+		{
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionModify),
+				LogicalResourceId: aws.String("Table"),
+				ResourceType:      aws.String("AWS::DynamoDB::Table"),
+				Replacement:       aws.String(cloudformation.ReplacementTrue),
+				Details: []*cloudformation.ResourceChangeDetail{
+					{
+						Target: &cloudformation.ResourceTargetDefinition{
+							Attribute:          aws.String(cloudformation.ResourceAttributeProperties),
+							Name:               aws.String("KeySchema"),
+							RequiresRecreation: aws.String(cloudformation.RequiresRecreationAlways),
+						},
+					},
+					{
+						Target: &cloudformation.ResourceTargetDefinition{
+							Attribute:          aws.String(cloudformation.ResourceAttributeProperties),
+							Name:               aws.String("BillingMode"),
+							RequiresRecreation: aws.String(cloudformation.RequiresRecreationNever),
+						},
+					},
+				},
+			},
+		},
+		{
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String("Queue"),
+				ResourceType:      aws.String("AWS::SQS::Queue"),
+			},
+		},
+		{
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(cloudformation.ChangeActionAdd),
+				LogicalResourceId: aws.String("Bucket"),
+				ResourceType:      aws.String("AWS::S3::Bucket"),
+			},
+		},
+	}
+	groups := groupResourceChanges(changes)
+	adds := groups[cloudformation.ChangeActionAdd]
+	if len(adds) != 2 || *adds[0].LogicalResourceId != "Bucket" {
+		t.Fatalf("Unexpected Add group: %#v", adds)
+	}
+	modifies := groups[cloudformation.ChangeActionModify]
+	if len(modifies) != 1 {
+		t.Fatalf("Unexpected Modify group: %#v", modifies)
+	}
+	replacements := replacementProperties(modifies[0])
+	if len(replacements) != 1 || replacements[0] != "KeySchema (Always)" {
+		t.Fatalf("Unexpected replacement properties: %#v", replacements)
+	}
+
+	// Nested stack change sets
+	nestedChanges := map[string][]*cloudformation.Change{
+		"nested-1": {
+			{
+				ResourceChange: &cloudformation.ResourceChange{
+					Action:            aws.String(cloudformation.ChangeActionAdd),
+					LogicalResourceId: aws.String("NestedFunction"),
+					ResourceType:      aws.String("AWS::Lambda::Function"),
+				},
+			},
+		},
+	}
+	describeChangeSet := func(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+		return &cloudformation.DescribeChangeSetOutput{
+			Changes: nestedChanges[aws.StringValue(input.ChangeSetName)],
+		}, nil
+	}
+	hierarchyChanges, hierarchyChangesErr := withNestedStackChanges(append(changes, &cloudformation.Change{
+		ResourceChange: &cloudformation.ResourceChange{
+			Action:            aws.String(cloudformation.ChangeActionModify),
+			LogicalResourceId: aws.String("SpartaNestedStack0"),
+			ResourceType:      aws.String("AWS::CloudFormation::Stack"),
+			ChangeSetId:       aws.String("nested-1"),
+		},
+	}), describeChangeSet)
+	if hierarchyChangesErr != nil {
+		t.Fatal(hierarchyChangesErr)
+	}
+	hierarchyGroups := groupResourceChanges(hierarchyChanges)
+	if len(hierarchyGroups[cloudformation.ChangeActionAdd]) != 3 ||
+		len(hierarchyGroups[cloudformation.ChangeActionModify]) != 2 {
+		t.Fatalf("Expected nested stack changes: %#v", hierarchyGroups)
+	}
+}
@@ -0,0 +1,349 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/mweagle/Sparta/system"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// doctorMinimumGoVersion is the minimum go version that can build a
+	// Sparta service
+	doctorMinimumGoVersion = "1.15"
+
+	// doctorCommandTimeout is how long to wait for local tools to respond
+	doctorCommandTimeout = 10 * time.Second
+)
+
+const (
+	doctorStatusPass = "PASS"
+	doctorStatusWarn = "WARN"
+	doctorStatusFail = "FAIL"
+)
+
+// doctorProvisionActions are the IAM actions the caller needs to provision
+// a service
+var doctorProvisionActions = []string{
+	"cloudformation:CreateStack",
+	"cloudformation:UpdateStack",
+	"cloudformation:CreateChangeSet",
+	"cloudformation:DescribeStacks",
+	"iam:PassRole",
+	"s3:PutObject",
+}
+
+// doctorCheckResult is a row in the `doctor` report
+type doctorCheckResult struct {
+	Name        string
+	Status      string
+	Detail      string
+	Remediation string
+}
+
+func doctorPass(name string, detail string) *doctorCheckResult {
+	return &doctorCheckResult{
+		Name:   name,
+		Status: doctorStatusPass,
+		Detail: detail,
+	}
+}
+
+func doctorWarn(name string, detail string, remediation string) *doctorCheckResult {
+	return &doctorCheckResult{
+		Name:        name,
+		Status:      doctorStatusWarn,
+		Detail:      detail,
+		Remediation: remediation,
+	}
+}
+
+func doctorFail(name string, detail string, remediation string) *doctorCheckResult {
+	return &doctorCheckResult{
+		Name:        name,
+		Status:      doctorStatusFail,
+		Detail:      detail,
+		Remediation: remediation,
+	}
+}
+
+// goVersionAtLeast returns true if the major.minor[.patch] version is at
+// least the minimum major.minor version. Pre-release suffixes, as in
+// go1.17rc1 or 1.16beta1, are ignored.
+func goVersionAtLeast(version string, minimum string) bool {
+	// Strip any non-numeric suffix from the version part
+	numericPrefix := func(part string) string {
+		nonDigitIndex := strings.IndexFunc(part, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if nonDigitIndex >= 0 {
+			return part[:nonDigitIndex]
+		}
+		return part
+	}
+	parse := func(value string) (int, int, bool) {
+		parts := strings.Split(strings.TrimPrefix(value, "go"), ".")
+		if len(parts) < 2 {
+			return 0, 0, false
+		}
+		major, majorErr := strconv.Atoi(parts[0])
+		minor, minorErr := strconv.Atoi(numericPrefix(parts[1]))
+		return major, minor, majorErr == nil && minorErr == nil
+	}
+	versionMajor, versionMinor, versionOk := parse(version)
+	minimumMajor, minimumMinor, minimumOk := parse(minimum)
+	if !versionOk || !minimumOk {
+		return false
+	}
+	if versionMajor != minimumMajor {
+		return versionMajor > minimumMajor
+	}
+	return versionMinor >= minimumMinor
+}
+
+// iamPrincipalARN returns the IAM principal ARN for the caller ARN so that
+// assumed role sessions can be simulated
+func iamPrincipalARN(callerARN string) string {
+	// arn:aws:sts::123412341234:assumed-role/RoleName/SessionName
+	arnParts := strings.SplitN(callerARN, ":", 6)
+	if len(arnParts) != 6 || arnParts[2] != "sts" {
+		return callerARN
+	}
+	resourceParts := strings.Split(arnParts[5], "/")
+	if len(resourceParts) < 2 || resourceParts[0] != "assumed-role" {
+		return callerARN
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s",
+		arnParts[1],
+		arnParts[4],
+		resourceParts[1])
+}
+
+func doctorCheckGoVersion(logger *zerolog.Logger) *doctorCheckResult {
+	name := "Go version"
+	goVersion, goVersionErr := system.GoVersion(logger)
+	if goVersionErr != nil {
+		return doctorFail(name, goVersionErr.Error(), "Install Go from https://golang.org/dl/")
+	}
+	if !goVersionAtLeast(goVersion, doctorMinimumGoVersion) {
+		return doctorFail(name,
+			fmt.Sprintf("%s is older than %s", goVersion, doctorMinimumGoVersion),
+			fmt.Sprintf("Install Go %s or newer from https://golang.org/dl/", doctorMinimumGoVersion))
+	}
+	_, lookPathErr := exec.LookPath("go")
+	if lookPathErr != nil {
+		return doctorFail(name,
+			fmt.Sprintf("%s, but `go` isn't in the PATH", goVersion),
+			"Add the Go toolchain bin directory to the PATH so the service can be cross compiled")
+	}
+	return doctorPass(name, goVersion)
+}
+
+func doctorCheckDocker(useCGO bool, logger *zerolog.Logger) *doctorCheckResult {
+	name := "Docker"
+	// Docker is only required for CGO builds and Dockerfile packages
+	missing := func(detail string, remediation string) *doctorCheckResult {
+		if useCGO {
+			return doctorFail(name, detail, remediation)
+		}
+		return doctorWarn(name, detail, remediation+". Docker is only required for CGO builds and --dockerFile packages")
+	}
+	_, lookPathErr := exec.LookPath("docker")
+	if lookPathErr != nil {
+		return missing("`docker` isn't in the PATH",
+			"Install Docker from https://docs.docker.com/get-docker/")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorCommandTimeout)
+	defer cancel()
+	output, outputErr := exec.CommandContext(ctx,
+		"docker",
+		"version",
+		"--format",
+		"{{.Server.Version}}").Output()
+	if outputErr != nil {
+		logger.Debug().
+			Err(outputErr).
+			Msg("Failed to query Docker server version")
+		return missing("Docker daemon isn't running",
+			"Start the Docker daemon")
+	}
+	return doctorPass(name, fmt.Sprintf("Server %s", strings.TrimSpace(string(output))))
+}
+
+func doctorCheckCodePipelineEnvironments() *doctorCheckResult {
+	name := "CodePipeline environments"
+	if len(codePipelineEnvironments) == 0 {
+		return doctorPass(name, "None defined")
+	}
+	if !codePipelineEnvironmentsEquivalent() {
+		return doctorWarn(name,
+			"Environments do not define equivalent keys",
+			"Define the same environment keys in every CodePipeline environment")
+	}
+	return doctorPass(name, fmt.Sprintf("%d environments", len(codePipelineEnvironments)))
+}
+
+func doctorCheckRegion(awsSession *session.Session) *doctorCheckResult {
+	name := "AWS region"
+	if awsSession == nil || aws.StringValue(awsSession.Config.Region) == "" {
+		return doctorFail(name,
+			"No default region",
+			"Set env.AWS_REGION, env.AWS_DEFAULT_REGION, or env.AWS_SDK_LOAD_CONFIG=1 with a region in ~/.aws/config")
+	}
+	return doctorPass(name, aws.StringValue(awsSession.Config.Region))
+}
+
+func doctorCheckCredentials(awsSession *session.Session) (*doctorCheckResult, string) {
+	name := "AWS credentials"
+	callerInfo, callerInfoErr := sts.New(awsSession).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if callerInfoErr != nil {
+		return doctorFail(name,
+			callerInfoErr.Error(),
+			"Configure credentials with `aws configure` or set env.AWS_PROFILE. See https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/configuring-sdk.html"), ""
+	}
+	return doctorPass(name, aws.StringValue(callerInfo.Arn)), aws.StringValue(callerInfo.Arn)
+}
+
+func doctorCheckPermissions(awsSession *session.Session, callerARN string) *doctorCheckResult {
+	name := "IAM permissions"
+	principalARN := iamPrincipalARN(callerARN)
+	simulateOutput, simulateErr := iam.New(awsSession).SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalARN),
+		ActionNames:     aws.StringSlice(doctorProvisionActions),
+	})
+	if simulateErr != nil {
+		return doctorWarn(name,
+			fmt.Sprintf("Unable to simulate policy for %s", principalARN),
+			"Grant iam:SimulatePrincipalPolicy to verify permissions, or confirm them with your administrator")
+	}
+	denied := []string{}
+	for _, eachResult := range simulateOutput.EvaluationResults {
+		if aws.StringValue(eachResult.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+			denied = append(denied, aws.StringValue(eachResult.EvalActionName))
+		}
+	}
+	if len(denied) != 0 {
+		return doctorFail(name,
+			fmt.Sprintf("Denied: %s", strings.Join(denied, ", ")),
+			fmt.Sprintf("Grant %s to %s", strings.Join(denied, ", "), principalARN))
+	}
+	return doctorPass(name, fmt.Sprintf("%d provision actions allowed", len(doctorProvisionActions)))
+}
+
+func doctorCheckS3Bucket(awsSession *session.Session,
+	s3Bucket string,
+	logger *zerolog.Logger) *doctorCheckResult {
+	name := "S3 bucket"
+	if s3Bucket == "" {
+		return doctorWarn(name,
+			"No bucket provided",
+			"Pass --s3Bucket to check the artifact bucket")
+	}
+	isVersioned, bucketErr := verifyS3BucketPreconditions(awsSession, s3Bucket, logger)
+	if bucketErr != nil {
+		return doctorFail(name,
+			errors.Cause(bucketErr).Error(),
+			fmt.Sprintf("Use a bucket in %s that the credentials can access",
+				aws.StringValue(awsSession.Config.Region)))
+	}
+	if !isVersioned {
+		return doctorWarn(name,
+			fmt.Sprintf("%s versioning isn't enabled", s3Bucket),
+			"Enable bucket versioning so that unchanged code isn't reprovisioned and `rollback` can restore builds")
+	}
+	return doctorPass(name, fmt.Sprintf("%s (versioned)", s3Bucket))
+}
+
+// writeDoctorReport writes the pass/warn/fail table and returns the number
+// of failed checks
+func writeDoctorReport(results []*doctorCheckResult, writer io.Writer) (int, error) {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "CHECK\tSTATUS\tDETAIL")
+	failures := 0
+	for _, eachResult := range results {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\n",
+			eachResult.Name,
+			eachResult.Status,
+			eachResult.Detail)
+		if eachResult.Status == doctorStatusFail {
+			failures++
+		}
+	}
+	flushErr := tabWriter.Flush()
+	if flushErr != nil {
+		return failures, flushErr
+	}
+	remediations := []string{}
+	for _, eachResult := range results {
+		if eachResult.Remediation != "" {
+			remediations = append(remediations, fmt.Sprintf("  %s %s: %s",
+				eachResult.Status,
+				eachResult.Name,
+				eachResult.Remediation))
+		}
+	}
+	if len(remediations) != 0 {
+		_, writeErr := fmt.Fprintf(writer, "\nRemediation:\n%s\n", strings.Join(remediations, "\n"))
+		if writeErr != nil {
+			return failures, writeErr
+		}
+	}
+	return failures, nil
+}
+
+// Doctor validates the local and AWS environment before a provision and
+// writes a pass/warn/fail report with remediation hints. If offline is
+// true, the AWS checks are skipped. An error is returned if any check
+// fails.
+func Doctor(serviceName string,
+	s3Bucket string,
+	offline bool,
+	useCGO bool,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+
+	results := []*doctorCheckResult{
+		doctorCheckGoVersion(logger),
+		doctorCheckDocker(useCGO, logger),
+		doctorCheckCodePipelineEnvironments(),
+	}
+	if offline {
+		logger.Info().Msg("Skipping AWS checks for offline mode")
+	} else {
+		awsSession := spartaAWS.NewSession(logger)
+		regionResult := doctorCheckRegion(awsSession)
+		results = append(results, regionResult)
+		if regionResult.Status == doctorStatusPass {
+			credentialsResult, callerARN := doctorCheckCredentials(awsSession)
+			results = append(results, credentialsResult)
+			if credentialsResult.Status == doctorStatusPass {
+				results = append(results,
+					doctorCheckPermissions(awsSession, callerARN),
+					doctorCheckS3Bucket(awsSession, s3Bucket, logger))
+			}
+		}
+	}
+	failures, writeErr := writeDoctorReport(results, outputWriter)
+	if writeErr != nil {
+		return writeErr
+	}
+	if failures != 0 {
+		return errors.Errorf("%s failed %d of %d doctor checks", serviceName, failures, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGoVersionAtLeast(t *testing.T) {
+	testCases := map[string]bool{
+		"1.15":      true,
+		"1.16.4":    true,
+		"go1.17":    true,
+		"go1.17rc1": true,
+		"1.16beta1": true,
+		"2.0":       true,
+		"1.14.9":    false,
+		"go1.14rc1": false,
+		"go1.rc1":   false,
+		"devel +1":  false,
+	}
+	for eachVersion, eachExpected := range testCases {
+		if goVersionAtLeast(eachVersion, "1.15") != eachExpected {
+			t.Fatalf("Unexpected result for version %s", eachVersion)
+		}
+	}
+}
+
+func TestIAMPrincipalARN(t *testing.T) {
+	assumedRole := "arn:aws:sts::123412341234:assumed-role/Developer/session-name"
+	if iamPrincipalARN(assumedRole) != "arn:aws:iam::123412341234:role/Developer" {
+		t.Fatalf("Unexpected assumed role principal: %s", iamPrincipalARN(assumedRole))
+	}
+	user := "arn:aws:iam::123412341234:user/developer"
+	if iamPrincipalARN(user) != user {
+		t.Fatalf("Unexpected user principal: %s", iamPrincipalARN(user))
+	}
+}
+
+func TestDoctorReport(t *testing.T) {
+	var output bytes.Buffer
+	failures, writeErr := writeDoctorReport([]*doctorCheckResult{
+		doctorPass("Go version", "1.16"),
+		doctorWarn("Docker", "Docker daemon isn't running", "Start the Docker daemon"),
+		doctorFail("AWS region", "No default region", "Set env.AWS_REGION"),
+	}, &output)
+	if writeErr != nil || failures != 1 {
+		t.Fatalf("Unexpected failure count: %d (%v)", failures, writeErr)
+	}
+	report := output.String()
+	if !strings.HasPrefix(report, "CHECK") ||
+		!strings.Contains(report, "WARN Docker: Start the Docker daemon") ||
+		!strings.Contains(report, "FAIL AWS region: Set env.AWS_REGION") {
+		t.Fatalf("Unexpected report: %s", report)
+	}
+}
@@ -2,11 +2,19 @@ package sparta
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"reflect"
 	"regexp"
+	"runtime/debug"
 	"strings"
+	"time"
 
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	spartaAWS "github.com/mweagle/Sparta/aws"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 )
 
 var (
@@ -117,3 +125,266 @@ func ensureValidSignature(lambdaName string, handlerSymbol interface{}) error {
 	}
 	return nil
 }
+
+func takesContext(handler reflect.Type) bool {
+	handlerTakesContext := false
+	if handler.NumIn() > 0 {
+		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+		argumentType := handler.In(0)
+		handlerTakesContext = argumentType.Implements(contextType)
+	}
+	return handlerTakesContext
+}
+
+// LambdaTimeoutError is the error returned when a handler fails to complete
+// before the function deadline, less the TimeoutGracePeriod. The remaining
+// grace period is used to run the Complete interceptors and flush telemetry
+// before the Lambda sandbox is frozen.
+type LambdaTimeoutError struct {
+	// Deadline is the Lambda function deadline
+	Deadline time.Time
+	// GracePeriod is the duration reserved before the Deadline
+	GracePeriod time.Duration
+}
+
+// Error satisfies the error interface
+func (lte *LambdaTimeoutError) Error() string {
+	return fmt.Sprintf("Handler failed to complete within %s of the function deadline (%s)",
+		lte.GracePeriod,
+		lte.Deadline.UTC().Format(time.RFC3339Nano))
+}
+
+// PanicError is the error returned when a lambda handler panics. It
+// includes the recovered value and the stack trace of the panicking
+// goroutine.
+type PanicError struct {
+	// Value is the value passed to panic()
+	Value interface{}
+	// Stack is the formatted stack trace at the time of the panic
+	Stack string
+}
+
+// Error satisfies the error interface
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("Lambda handler panic: %v", pe.Value)
+}
+
+// dispatchResult is the result of calling the user handler
+type dispatchResult struct {
+	val interface{}
+	err error
+}
+
+// dispatchContext returns the context supplied to the user handler. If the
+// parent context has a deadline, the returned context expires gracePeriod
+// before it so there's time to run the Complete interceptors. If there
+// is less than gracePeriod remaining, half of the remaining time is reserved.
+func dispatchContext(ctx context.Context,
+	gracePeriod time.Duration) (context.Context, *LambdaTimeoutError, context.CancelFunc) {
+	if gracePeriod == 0 {
+		gracePeriod = DefaultTimeoutGracePeriod
+	}
+	deadline, deadlineOk := ctx.Deadline()
+	if !deadlineOk || gracePeriod < 0 {
+		dispatchCtx, dispatchCancel := context.WithCancel(ctx)
+		return dispatchCtx, nil, dispatchCancel
+	}
+	remaining := time.Until(deadline)
+	if remaining < gracePeriod {
+		gracePeriod = remaining / 2
+	}
+	dispatchCtx, dispatchCancel := context.WithDeadline(ctx, deadline.Add(-gracePeriod))
+	return dispatchCtx, &LambdaTimeoutError{
+		Deadline:    deadline,
+		GracePeriod: gracePeriod,
+	}, dispatchCancel
+}
+
+// flushStandardStreams makes a best effort to ensure that any buffered
+// log or EMF metric output is written before returning
+func flushStandardStreams() {
+	_ = os.Stdout.Sync()
+	_ = os.Stderr.Sync()
+}
+
+// tappedHandler is the handler that represents this binary's mode
+func tappedHandler(handlerSymbol interface{},
+	interceptors *LambdaEventInterceptors,
+	validator *lambdaSchemaValidator,
+	gracePeriod time.Duration,
+	logger *zerolog.Logger) interface{} {
+
+	// If there aren't any, make it a bit easier
+	// to call the applyInterceptors function
+	if interceptors == nil {
+		interceptors = &LambdaEventInterceptors{}
+	}
+
+	// Tap the call chain to inject the context params...
+	handler := reflect.ValueOf(handlerSymbol)
+	handlerType := reflect.TypeOf(handlerSymbol)
+	takesContext := takesContext(handlerType)
+
+	// Apply interceptors is a utility function to apply the
+	// specified interceptors as part of the lifecycle handler.
+	// We can push the specific behaviors into the interceptors
+	// and keep this function simple. 🎉
+	applyInterceptors := func(ctx context.Context,
+		msg json.RawMessage,
+		interceptors InterceptorList) context.Context {
+		for _, eachInterceptor := range interceptors {
+			ctx = eachInterceptor.Interceptor(ctx, msg)
+		}
+		return ctx
+	}
+
+	// How to determine if this handler has tracing enabled? That would be a property
+	// of the function template associated with this function.
+
+	return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
+
+		awsSession := spartaAWS.NewSession(logger)
+		ctx = applyInterceptors(ctx, msg, interceptors.Begin)
+		ctx = context.WithValue(ctx, ContextKeyLogger, logger)
+		ctx = context.WithValue(ctx, ContextKeyAWSSession, awsSession)
+		ctx = applyInterceptors(ctx, msg, interceptors.BeforeSetup)
+
+		// Create the entry logger that has some context information
+		var zerologRequestLogger zerolog.Logger
+		lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+		if lambdaContextOk {
+			zerologRequestLogger = logger.With().
+				Str(LogFieldRequestID, lambdaContext.AwsRequestID).
+				Str(LogFieldARN, lambdaContext.InvokedFunctionArn).
+				Str(LogFieldBuildID, StampedBuildID).
+				Str(LogFieldInstanceID, InstanceID()).
+				Logger()
+		}
+		ctx = context.WithValue(ctx, ContextKeyRequestLogger, &zerologRequestLogger)
+		ctx = applyInterceptors(ctx, msg, interceptors.AfterSetup)
+
+		// The handler gets a context that expires before the function
+		// deadline so that there's an opportunity for an orderly exit
+		dispatchCtx, timeoutErr, dispatchCancel := dispatchContext(ctx, gracePeriod)
+		defer dispatchCancel()
+
+		var val interface{}
+		var err error
+		handled := false
+
+		// Validate the raw event before it's unmarshalled. Invalid
+		// events are rejected without calling the handler.
+		requestErr := validator.validateRequest(msg)
+		if requestErr != nil {
+			zerologRequestLogger.Warn().
+				Err(requestErr).
+				Msg("Event failed JSON Schema validation")
+			err = requestErr
+			handled = true
+		}
+
+		// construct arguments
+		var args []reflect.Value
+		if takesContext {
+			args = append(args, reflect.ValueOf(dispatchCtx))
+		}
+		if !handled && ((handlerType.NumIn() == 1 && !takesContext) ||
+			handlerType.NumIn() == 2) {
+			eventType := handlerType.In(handlerType.NumIn() - 1)
+			event := reflect.New(eventType)
+			unmarshalErr := json.Unmarshal(msg, event.Interface())
+			if unmarshalErr != nil {
+				return nil, unmarshalErr
+			}
+			args = append(args, event.Elem())
+		}
+		ctx = applyInterceptors(ctx, msg, interceptors.BeforeDispatch)
+
+		// Give any ShortCircuit interceptors a chance to handle the
+		// request before the handler is called
+		for _, eachInterceptor := range interceptors.ShortCircuit {
+			if handled {
+				break
+			}
+			var interceptorVal interface{}
+			var interceptorErr error
+			ctx, interceptorVal, handled, interceptorErr = eachInterceptor.Interceptor(ctx, msg)
+			if handled {
+				zerologRequestLogger.Debug().
+					Str("Interceptor", eachInterceptor.Name).
+					Msg("Request handled by ShortCircuit interceptor")
+				ctx = context.WithValue(ctx, ContextKeyShortCircuitInterceptor, eachInterceptor.Name)
+				val = interceptorVal
+				err = interceptorErr
+			}
+		}
+		if !handled {
+			resultChan := make(chan *dispatchResult, 1)
+			go func() {
+				result := &dispatchResult{}
+				defer func() {
+					// Turn a panic into an error so that the interceptors
+					// still run and the process keeps handling events
+					if r := recover(); r != nil {
+						panicErr := &PanicError{
+							Value: r,
+							Stack: string(debug.Stack()),
+						}
+						zerologRequestLogger.Error().
+							Interface("Panic", r).
+							Str("Stack", panicErr.Stack).
+							Msg("Lambda handler panic recovered")
+						result.err = panicErr
+					}
+					resultChan <- result
+				}()
+				response := handler.Call(args)
+				// If the user function
+				// convert return values into (interface{}, error)
+				if len(response) > 0 {
+					if errVal, ok := response[len(response)-1].Interface().(error); ok {
+						result.err = errVal
+					}
+				}
+				if len(response) > 1 {
+					result.val = response[0].Interface()
+				}
+			}()
+			select {
+			case result := <-resultChan:
+				val = result.val
+				err = result.err
+				if err == nil {
+					err = validator.validateResponse(val)
+					if err != nil {
+						zerologRequestLogger.Error().
+							Err(err).
+							Msg("Response failed JSON Schema validation")
+						val = nil
+					}
+				}
+			case <-dispatchCtx.Done():
+				// Either we're out of time or the runtime canceled the
+				// request. Run the Complete interceptors with an error
+				// so that they can publish whatever they have.
+				var dispatchErr error = timeoutErr
+				if timeoutErr == nil || dispatchCtx.Err() != context.DeadlineExceeded {
+					dispatchErr = dispatchCtx.Err()
+				}
+				zerologRequestLogger.Error().
+					Err(dispatchErr).
+					Msg("Handler did not complete before deadline")
+				ctx = context.WithValue(ctx, ContextKeyLambdaError, dispatchErr)
+				ctx = context.WithValue(ctx, ContextKeyLambdaResponse, nil)
+				applyInterceptors(ctx, msg, interceptors.Complete)
+				flushStandardStreams()
+				return nil, dispatchErr
+			}
+		}
+		ctx = applyInterceptors(ctx, msg, interceptors.AfterDispatch)
+		ctx = context.WithValue(ctx, ContextKeyLambdaError, err)
+		ctx = context.WithValue(ctx, ContextKeyLambdaResponse, val)
+		applyInterceptors(ctx, msg, interceptors.Complete)
+		return val, err
+	}
+}
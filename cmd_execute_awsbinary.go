@@ -3,16 +3,12 @@
 package sparta
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
 	"os"
-	"reflect"
 	"sync"
+	"time"
 
 	awsLambdaGo "github.com/aws/aws-lambda-go/lambda"
-	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
-	spartaAWS "github.com/mweagle/Sparta/aws"
 	cloudformationResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
 	gocf "github.com/mweagle/go-cloudformation"
 	"github.com/rs/zerolog"
@@ -47,109 +43,6 @@ func awsLambdaFunctionName(internalFunctionName string) gocf.Stringable {
 		sanitizedName))
 }
 
-func takesContext(handler reflect.Type) bool {
-	handlerTakesContext := false
-	if handler.NumIn() > 0 {
-		contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
-		argumentType := handler.In(0)
-		handlerTakesContext = argumentType.Implements(contextType)
-	}
-	return handlerTakesContext
-}
-
-// tappedHandler is the handler that represents this binary's mode
-func tappedHandler(handlerSymbol interface{},
-	interceptors *LambdaEventInterceptors,
-	logger *zerolog.Logger) interface{} {
-
-	// If there aren't any, make it a bit easier
-	// to call the applyInterceptors function
-	if interceptors == nil {
-		interceptors = &LambdaEventInterceptors{}
-	}
-
-	// Tap the call chain to inject the context params...
-	handler := reflect.ValueOf(handlerSymbol)
-	handlerType := reflect.TypeOf(handlerSymbol)
-	takesContext := takesContext(handlerType)
-
-	// Apply interceptors is a utility function to apply the
-	// specified interceptors as part of the lifecycle handler.
-	// We can push the specific behaviors into the interceptors
-	// and keep this function simple. 🎉
-	applyInterceptors := func(ctx context.Context,
-		msg json.RawMessage,
-		interceptors InterceptorList) context.Context {
-		for _, eachInterceptor := range interceptors {
-			ctx = eachInterceptor.Interceptor(ctx, msg)
-		}
-		return ctx
-	}
-
-	// How to determine if this handler has tracing enabled? That would be a property
-	// of the function template associated with this function.
-
-	// TODO - add Context.Timeout handler to ensure orderly exit
-	return func(ctx context.Context, msg json.RawMessage) (interface{}, error) {
-
-		awsSession := spartaAWS.NewSession(logger)
-		ctx = applyInterceptors(ctx, msg, interceptors.Begin)
-		ctx = context.WithValue(ctx, ContextKeyLogger, logger)
-		ctx = context.WithValue(ctx, ContextKeyAWSSession, awsSession)
-		ctx = applyInterceptors(ctx, msg, interceptors.BeforeSetup)
-
-		// Create the entry logger that has some context information
-		var zerologRequestLogger zerolog.Logger
-		lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
-		if lambdaContextOk {
-			zerologRequestLogger = logger.With().
-				Str(LogFieldRequestID, lambdaContext.AwsRequestID).
-				Str(LogFieldARN, lambdaContext.InvokedFunctionArn).
-				Str(LogFieldBuildID, StampedBuildID).
-				Str(LogFieldInstanceID, InstanceID()).
-				Logger()
-		}
-		ctx = context.WithValue(ctx, ContextKeyRequestLogger, &zerologRequestLogger)
-		ctx = applyInterceptors(ctx, msg, interceptors.AfterSetup)
-
-		// construct arguments
-		var args []reflect.Value
-		if takesContext {
-			args = append(args, reflect.ValueOf(ctx))
-		}
-		if (handlerType.NumIn() == 1 && !takesContext) ||
-			handlerType.NumIn() == 2 {
-			eventType := handlerType.In(handlerType.NumIn() - 1)
-			event := reflect.New(eventType)
-			unmarshalErr := json.Unmarshal(msg, event.Interface())
-			if unmarshalErr != nil {
-				return nil, unmarshalErr
-			}
-			args = append(args, event.Elem())
-		}
-		ctx = applyInterceptors(ctx, msg, interceptors.BeforeDispatch)
-		response := handler.Call(args)
-		ctx = applyInterceptors(ctx, msg, interceptors.AfterDispatch)
-
-		// If the user function
-		// convert return values into (interface{}, error)
-		var err error
-		if len(response) > 0 {
-			if errVal, ok := response[len(response)-1].Interface().(error); ok {
-				err = errVal
-			}
-		}
-		ctx = context.WithValue(ctx, ContextKeyLambdaError, err)
-		var val interface{}
-		if len(response) > 1 {
-			val = response[0].Interface()
-		}
-		ctx = context.WithValue(ctx, ContextKeyLambdaResponse, val)
-		applyInterceptors(ctx, msg, interceptors.Complete)
-		return val, err
-	}
-}
-
 // Execute creates an HTTP listener to dispatch execution. Typically
 // called via Main() via command line arguments.
 func Execute(serviceName string,
@@ -175,6 +68,8 @@ func Execute(serviceName string,
 
 	// So what if we have workflow hooks in here?
 	var interceptors *LambdaEventInterceptors
+	var validator *lambdaSchemaValidator
+	var gracePeriod time.Duration
 
 	/*
 		There are three types of targets:
@@ -200,6 +95,14 @@ func Execute(serviceName string,
 		if requestedLambdaFunctionName == testAWSName {
 			handlerSymbol = eachLambdaInfo.handlerSymbol
 			interceptors = eachLambdaInfo.Interceptors
+			var validatorErr error
+			validator, validatorErr = newLambdaSchemaValidator(eachLambdaInfo)
+			if validatorErr != nil {
+				return validatorErr
+			}
+			if eachLambdaInfo.Options != nil {
+				gracePeriod = eachLambdaInfo.Options.TimeoutGracePeriod
+			}
 
 		}
 
@@ -262,7 +165,11 @@ func Execute(serviceName string,
 	}
 
 	// Startup our version...
-	tappedHandler := tappedHandler(handlerSymbol, interceptors, logger)
+	tappedHandler := tappedHandler(handlerSymbol,
+		interceptors,
+		validator,
+		gracePeriod,
+		logger)
 	awsLambdaGo.Start(tappedHandler)
 	return nil
 }
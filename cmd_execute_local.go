@@ -0,0 +1,588 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"context"
+	cryptoRand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Lambda Runtime API constants. See
+// https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html
+// for more information.
+const (
+	localRuntimeAPIVersion = "2018-06-01"
+
+	headerRuntimeRequestID          = "Lambda-Runtime-Aws-Request-Id"
+	headerRuntimeDeadlineMS         = "Lambda-Runtime-Deadline-Ms"
+	headerRuntimeInvokedFunctionArn = "Lambda-Runtime-Invoked-Function-Arn"
+	headerRuntimeTraceID            = "Lambda-Runtime-Trace-Id"
+	headerRuntimeFunctionErrorType  = "Lambda-Runtime-Function-Error-Type"
+
+	headerInvokeInvocationType = "X-Amz-Invocation-Type"
+	headerInvokeFunctionError  = "X-Amz-Function-Error"
+	headerInvokeRequestID      = "X-Amz-Request-Id"
+	headerInvokeVersion        = "X-Amz-Executed-Version"
+
+	localRuntimeAccountID = "123456789012"
+	localRuntimeRegion    = "local"
+)
+
+var (
+	// Invoke API compatible path so that the AWS CLI/SDK can target the
+	// emulator via an endpoint override
+	reLocalInvoke = regexp.MustCompile(`^/2015-03-31/functions/([^/]+)/invocations$`)
+	// Runtime API paths are scoped by function name so that the emulator
+	// can serve every registered function from a single listener
+	reLocalRuntimeNext = regexp.MustCompile(fmt.Sprintf(`^/([^/]+)/%s/runtime/invocation/next$`,
+		localRuntimeAPIVersion))
+	reLocalRuntimeResult = regexp.MustCompile(fmt.Sprintf(`^/([^/]+)/%s/runtime/invocation/([^/]+)/(response|error)$`,
+		localRuntimeAPIVersion))
+	reLocalRuntimeInitError = regexp.MustCompile(fmt.Sprintf(`^/([^/]+)/%s/runtime/init/error$`,
+		localRuntimeAPIVersion))
+)
+
+// localInvokeError is the error shape posted to the runtime API error
+// endpoint and returned to callers of a failed invocation.
+type localInvokeError struct {
+	Message string `json:"errorMessage"`
+	Type    string `json:"errorType,omitempty"`
+}
+
+func newLocalInvokeError(err error) *localInvokeError {
+	errorType := reflect.TypeOf(err)
+	errorTypeName := ""
+	if errorType != nil {
+		if errorType.Kind() == reflect.Ptr {
+			errorType = errorType.Elem()
+		}
+		errorTypeName = errorType.Name()
+	}
+	return &localInvokeError{
+		Message: err.Error(),
+		Type:    errorTypeName,
+	}
+}
+
+// newLocalRequestID returns a random, UUID formatted request ID
+func newLocalRequestID() (string, error) {
+	idBytes := make([]byte, 16)
+	_, err := cryptoRand.Read(idBytes)
+	if err != nil {
+		return "", err
+	}
+	idBytes[6] = (idBytes[6] & 0x0f) | 0x40
+	idBytes[8] = (idBytes[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		idBytes[0:4],
+		idBytes[4:6],
+		idBytes[6:8],
+		idBytes[8:10],
+		idBytes[10:]), nil
+}
+
+// localInvocationResult is the result posted by the runtime
+// for a given invocation
+type localInvocationResult struct {
+	payload []byte
+	isError bool
+}
+
+// localInvocation is a single queued event
+type localInvocation struct {
+	requestID string
+	payload   []byte
+	deadline  time.Time
+	result    chan *localInvocationResult
+}
+
+// localFunction is the emulator state for a single registered
+// LambdaAWSInfo
+type localFunction struct {
+	name          string
+	arn           string
+	timeout       time.Duration
+	gracePeriod   time.Duration
+	handlerSymbol interface{}
+	interceptors  *LambdaEventInterceptors
+	validator     *lambdaSchemaValidator
+	queue         chan *localInvocation
+	pending       sync.Map
+}
+
+// localRuntimeAPI is an in-process emulator for the AWS Lambda
+// Runtime API. Events are submitted via the Invoke API compatible
+// endpoint and dispatched to the matching function's runtime loop
+// over the standard next/response/error endpoints.
+type localRuntimeAPI struct {
+	functions map[string]*localFunction
+	listener  net.Listener
+	server    *http.Server
+	logger    *zerolog.Logger
+}
+
+func newLocalRuntimeAPI(lambdaAWSInfos []*LambdaAWSInfo,
+	address string,
+	logger *zerolog.Logger) (*localRuntimeAPI, error) {
+
+	api := &localRuntimeAPI{
+		functions: make(map[string]*localFunction),
+		logger:    logger,
+	}
+	for _, eachLambdaInfo := range lambdaAWSInfos {
+		functionName := awsLambdaInternalName(eachLambdaInfo.lambdaFunctionName())
+		if _, exists := api.functions[functionName]; exists {
+			return nil, errors.Errorf("Duplicate local function name: %s", functionName)
+		}
+		timeout := time.Duration(defaultLambdaFunctionOptions().Timeout) * time.Second
+		var gracePeriod time.Duration
+		if eachLambdaInfo.Options != nil {
+			if eachLambdaInfo.Options.Timeout != 0 {
+				timeout = time.Duration(eachLambdaInfo.Options.Timeout) * time.Second
+			}
+			gracePeriod = eachLambdaInfo.Options.TimeoutGracePeriod
+		}
+		validator, validatorErr := newLambdaSchemaValidator(eachLambdaInfo)
+		if validatorErr != nil {
+			return nil, validatorErr
+		}
+		api.functions[functionName] = &localFunction{
+			name: functionName,
+			arn: fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s",
+				localRuntimeRegion,
+				localRuntimeAccountID,
+				functionName),
+			timeout:       timeout,
+			gracePeriod:   gracePeriod,
+			handlerSymbol: eachLambdaInfo.handlerSymbol,
+			interceptors:  eachLambdaInfo.Interceptors,
+			validator:     validator,
+			queue:         make(chan *localInvocation),
+		}
+	}
+	listener, listenerErr := net.Listen("tcp", address)
+	if listenerErr != nil {
+		return nil, errors.Wrapf(listenerErr, "Failed to listen on: %s", address)
+	}
+	api.listener = listener
+	api.server = &http.Server{
+		Handler: api,
+	}
+	return api, nil
+}
+
+// Addr returns the host:port the emulator is bound to
+func (api *localRuntimeAPI) Addr() string {
+	return api.listener.Addr().String()
+}
+
+// RuntimeAPI returns the value to use for AWS_LAMBDA_RUNTIME_API
+// for the given function
+func (api *localRuntimeAPI) RuntimeAPI(functionName string) string {
+	return fmt.Sprintf("%s/%s", api.Addr(), awsLambdaInternalName(functionName))
+}
+
+func (api *localRuntimeAPI) function(functionName string) *localFunction {
+	return api.functions[awsLambdaInternalName(functionName)]
+}
+
+func (api *localRuntimeAPI) writeError(w http.ResponseWriter, statusCode int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encodeErr := json.NewEncoder(w).Encode(newLocalInvokeError(err))
+	if encodeErr != nil {
+		api.logger.Warn().Err(encodeErr).Msg("Failed to write local runtime error")
+	}
+}
+
+// ServeHTTP dispatches the Invoke and Runtime API requests
+func (api *localRuntimeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.logger.Debug().
+		Str("Method", r.Method).
+		Str("Path", r.URL.Path).
+		Msg("Local runtime request")
+
+	if match := reLocalInvoke.FindStringSubmatch(r.URL.Path); match != nil && r.Method == http.MethodPost {
+		api.handleInvoke(w, r, match[1])
+	} else if match := reLocalRuntimeNext.FindStringSubmatch(r.URL.Path); match != nil && r.Method == http.MethodGet {
+		api.handleNext(w, r, match[1])
+	} else if match := reLocalRuntimeResult.FindStringSubmatch(r.URL.Path); match != nil && r.Method == http.MethodPost {
+		api.handleResult(w, r, match[1], match[2], match[3] == "error")
+	} else if match := reLocalRuntimeInitError.FindStringSubmatch(r.URL.Path); match != nil && r.Method == http.MethodPost {
+		body, _ := ioutil.ReadAll(r.Body)
+		api.logger.Error().
+			Str("Function", match[1]).
+			Str("Error", string(body)).
+			Msg("Local runtime initialization error")
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		api.writeError(w, http.StatusNotFound, errors.Errorf("Unsupported path: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (api *localRuntimeAPI) handleInvoke(w http.ResponseWriter, r *http.Request, functionName string) {
+	fn := api.function(functionName)
+	if fn == nil {
+		knownNames := []string{}
+		for eachName := range api.functions {
+			knownNames = append(knownNames, eachName)
+		}
+		api.writeError(w, http.StatusNotFound, errors.Errorf("Function not found: %s. Registered functions: %v",
+			functionName,
+			knownNames))
+		return
+	}
+	payload, payloadErr := ioutil.ReadAll(r.Body)
+	if payloadErr != nil {
+		api.writeError(w, http.StatusBadRequest, payloadErr)
+		return
+	}
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	requestID, requestIDErr := newLocalRequestID()
+	if requestIDErr != nil {
+		api.writeError(w, http.StatusInternalServerError, requestIDErr)
+		return
+	}
+	w.Header().Set(headerInvokeRequestID, requestID)
+
+	invocationType := r.Header.Get(headerInvokeInvocationType)
+	if invocationType == "DryRun" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	invocation := &localInvocation{
+		requestID: requestID,
+		payload:   payload,
+		deadline:  time.Now().Add(fn.timeout),
+		result:    make(chan *localInvocationResult, 1),
+	}
+	api.logger.Info().
+		Str("Function", fn.name).
+		Str("RequestID", requestID).
+		Str("InvocationType", invocationType).
+		Msg("Local invocation")
+
+	if invocationType == "Event" {
+		go func() {
+			select {
+			case fn.queue <- invocation:
+			case <-time.After(fn.timeout):
+				api.logger.Warn().
+					Str("Function", fn.name).
+					Str("RequestID", requestID).
+					Msg("Dropped asynchronous local invocation")
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Synchronous, wait for the runtime to pick it up and respond
+	// within the function timeout
+	timeoutErr := errors.Errorf("%s %s Task timed out after %.2f seconds",
+		time.Now().UTC().Format(time.RFC3339),
+		requestID,
+		fn.timeout.Seconds())
+	deadlineTimer := time.NewTimer(fn.timeout)
+	defer deadlineTimer.Stop()
+
+	select {
+	case fn.queue <- invocation:
+	case <-deadlineTimer.C:
+		w.Header().Set(headerInvokeFunctionError, "Unhandled")
+		api.writeError(w, http.StatusOK, timeoutErr)
+		return
+	case <-r.Context().Done():
+		return
+	}
+	select {
+	case result := <-invocation.result:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerInvokeVersion, "$LATEST")
+		if result.isError {
+			w.Header().Set(headerInvokeFunctionError, "Unhandled")
+		}
+		_, writeErr := w.Write(result.payload)
+		if writeErr != nil {
+			api.logger.Warn().Err(writeErr).Msg("Failed to write invocation response")
+		}
+	case <-deadlineTimer.C:
+		fn.pending.Delete(requestID)
+		w.Header().Set(headerInvokeFunctionError, "Unhandled")
+		api.writeError(w, http.StatusOK, timeoutErr)
+	case <-r.Context().Done():
+		fn.pending.Delete(requestID)
+	}
+}
+
+func (api *localRuntimeAPI) handleNext(w http.ResponseWriter, r *http.Request, functionName string) {
+	fn := api.function(functionName)
+	if fn == nil {
+		api.writeError(w, http.StatusNotFound, errors.Errorf("Function not found: %s", functionName))
+		return
+	}
+	select {
+	case invocation := <-fn.queue:
+		fn.pending.Store(invocation.requestID, invocation)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(headerRuntimeRequestID, invocation.requestID)
+		w.Header().Set(headerRuntimeDeadlineMS,
+			strconv.FormatInt(invocation.deadline.UnixNano()/int64(time.Millisecond), 10))
+		w.Header().Set(headerRuntimeInvokedFunctionArn, fn.arn)
+		w.Header().Set(headerRuntimeTraceID, fmt.Sprintf("Root=1-%x-%s;Sampled=0",
+			time.Now().Unix(),
+			invocation.requestID))
+		_, writeErr := w.Write(invocation.payload)
+		if writeErr != nil {
+			api.logger.Warn().Err(writeErr).Msg("Failed to write next invocation")
+		}
+	case <-r.Context().Done():
+		return
+	}
+}
+
+func (api *localRuntimeAPI) handleResult(w http.ResponseWriter,
+	r *http.Request,
+	functionName string,
+	requestID string,
+	isError bool) {
+	fn := api.function(functionName)
+	if fn == nil {
+		api.writeError(w, http.StatusNotFound, errors.Errorf("Function not found: %s", functionName))
+		return
+	}
+	pending, pendingOk := fn.pending.Load(requestID)
+	if !pendingOk {
+		api.writeError(w, http.StatusBadRequest, errors.Errorf("Unknown request ID: %s", requestID))
+		return
+	}
+	fn.pending.Delete(requestID)
+	payload, payloadErr := ioutil.ReadAll(r.Body)
+	if payloadErr != nil {
+		api.writeError(w, http.StatusBadRequest, payloadErr)
+		return
+	}
+	if isError {
+		logEvent := api.logger.Warn().
+			Str("Function", fn.name).
+			Str("RequestID", requestID).
+			Str("ErrorType", r.Header.Get(headerRuntimeFunctionErrorType))
+		// The runtime's error body isn't guaranteed to be JSON
+		if json.Valid(payload) {
+			logEvent = logEvent.RawJSON("Error", payload)
+		} else {
+			logEvent = logEvent.Str("Error", string(payload))
+		}
+		logEvent.Msg("Local invocation failed")
+	}
+	pending.(*localInvocation).result <- &localInvocationResult{
+		payload: payload,
+		isError: isError,
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_, writeErr := w.Write([]byte(`{"status":"OK"}`))
+	if writeErr != nil {
+		api.logger.Warn().Err(writeErr).Msg("Failed to write result acknowledgement")
+	}
+}
+
+// runRuntimeClient is the in-process runtime loop for a single function. It
+// polls the runtime API for the next event, dispatches to the tappedHandler
+// and posts the result back.
+func (api *localRuntimeAPI) runRuntimeClient(ctx context.Context, fn *localFunction) error {
+	baseURL := fmt.Sprintf("http://%s/%s/runtime", api.RuntimeAPI(fn.name), localRuntimeAPIVersion)
+	handler := tappedHandler(fn.handlerSymbol,
+		fn.interceptors,
+		fn.validator,
+		fn.gracePeriod,
+		api.logger).(func(context.Context,
+		json.RawMessage) (interface{}, error))
+	client := &http.Client{}
+
+	for {
+		nextReq, nextReqErr := http.NewRequestWithContext(ctx,
+			http.MethodGet,
+			baseURL+"/invocation/next",
+			nil)
+		if nextReqErr != nil {
+			return nextReqErr
+		}
+		nextResp, nextRespErr := client.Do(nextReq)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if nextRespErr != nil {
+			return errors.Wrapf(nextRespErr, "Failed to fetch next invocation")
+		}
+		payload, payloadErr := ioutil.ReadAll(nextResp.Body)
+		closeErr := nextResp.Body.Close()
+		if payloadErr != nil {
+			return payloadErr
+		}
+		if closeErr != nil {
+			api.logger.Warn().Err(closeErr).Msg("Failed to close next invocation body")
+		}
+		requestID := nextResp.Header.Get(headerRuntimeRequestID)
+		deadlineMS, _ := strconv.ParseInt(nextResp.Header.Get(headerRuntimeDeadlineMS), 10, 64)
+
+		invokeCtx := awsLambdaContext.NewContext(ctx, &awsLambdaContext.LambdaContext{
+			AwsRequestID:       requestID,
+			InvokedFunctionArn: nextResp.Header.Get(headerRuntimeInvokedFunctionArn),
+		})
+		invokeCtx, invokeCancel := context.WithDeadline(invokeCtx,
+			time.Unix(0, deadlineMS*int64(time.Millisecond)))
+		response, responseErr := api.invokeHandler(invokeCtx, handler, payload)
+		invokeCancel()
+
+		resultPath := "response"
+		var resultBody []byte
+		if responseErr != nil {
+			resultPath = "error"
+			resultBody, _ = json.Marshal(newLocalInvokeError(responseErr))
+		} else {
+			var marshalErr error
+			resultBody, marshalErr = json.Marshal(response)
+			if marshalErr != nil {
+				resultPath = "error"
+				resultBody, _ = json.Marshal(newLocalInvokeError(marshalErr))
+			}
+		}
+		resultReq, resultReqErr := http.NewRequestWithContext(ctx,
+			http.MethodPost,
+			fmt.Sprintf("%s/invocation/%s/%s", baseURL, requestID, resultPath),
+			bytes.NewReader(resultBody))
+		if resultReqErr != nil {
+			return resultReqErr
+		}
+		resultResp, resultRespErr := client.Do(resultReq)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if resultRespErr != nil {
+			return errors.Wrapf(resultRespErr, "Failed to post invocation result")
+		}
+		_ = resultResp.Body.Close()
+	}
+}
+
+// invokeHandler calls the handler and, like the aws-lambda-go runtime,
+// converts a panic into an error so that the emulator keeps running
+func (api *localRuntimeAPI) invokeHandler(ctx context.Context,
+	handler func(context.Context, json.RawMessage) (interface{}, error),
+	payload []byte) (response interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("%v", r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// Run starts the emulator and all function runtime loops. It
+// blocks until the context is canceled.
+func (api *localRuntimeAPI) Run(ctx context.Context) error {
+	serveErrChan := make(chan error, 1)
+	go func() {
+		serveErr := api.server.Serve(api.listener)
+		if serveErr != http.ErrServerClosed {
+			serveErrChan <- serveErr
+		}
+		close(serveErrChan)
+	}()
+
+	clientCtx, clientCancel := context.WithCancel(ctx)
+	defer clientCancel()
+	var wg sync.WaitGroup
+	for _, eachFunction := range api.functions {
+		wg.Add(1)
+		go func(fn *localFunction) {
+			defer wg.Done()
+			clientErr := api.runRuntimeClient(clientCtx, fn)
+			if clientErr != nil {
+				api.logger.Error().
+					Err(clientErr).
+					Str("Function", fn.name).
+					Msg("Local runtime loop failed")
+			}
+		}(eachFunction)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErrChan:
+	}
+	clientCancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	shutdownErr := api.server.Shutdown(shutdownCtx)
+	wg.Wait()
+	if runErr == nil {
+		runErr = shutdownErr
+	}
+	return runErr
+}
+
+// ExecuteLocal starts a local AWS Lambda Runtime API emulator bound to
+// address that dispatches events to the registered lambdaAWSInfos. Events
+// are submitted to http://address/2015-03-31/functions/{name}/invocations,
+// which is compatible with the AWS CLI and SDK `--endpoint-url` option.
+// The emulator runs until the process receives SIGINT or SIGTERM.
+func ExecuteLocal(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	address string,
+	logger *zerolog.Logger) error {
+
+	api, apiErr := newLocalRuntimeAPI(lambdaAWSInfos, address, logger)
+	if apiErr != nil {
+		return apiErr
+	}
+	for _, eachFunction := range api.functions {
+		logger.Info().
+			Str("Function", eachFunction.name).
+			Str("InvokeURL", fmt.Sprintf("http://%s/2015-03-31/functions/%s/invocations",
+				api.Addr(),
+				eachFunction.name)).
+			Str("AWS_LAMBDA_RUNTIME_API", api.RuntimeAPI(eachFunction.name)).
+			Msg("Local function")
+	}
+	logger.Info().
+		Str("ServiceName", serviceName).
+		Str("Address", api.Addr()).
+		Msg("Local runtime API emulator started. Press Ctrl+C to exit.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+	go func() {
+		select {
+		case <-signalChan:
+			logger.Info().Msg("Stopping local runtime API emulator")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return api.Run(ctx)
+}
@@ -0,0 +1,134 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+type localEchoEvent struct {
+	Message string `json:"message"`
+}
+
+func localEchoLambda(ctx context.Context, event localEchoEvent) (map[string]string, error) {
+	lambdaContext, _ := awsLambdaContext.FromContext(ctx)
+	if event.Message == "fail" {
+		return nil, errors.New("requested failure")
+	}
+	return map[string]string{
+		"message":   event.Message,
+		"requestID": lambdaContext.AwsRequestID,
+	}, nil
+}
+
+type localCountingInterceptor struct {
+	begin    int32
+	complete int32
+}
+
+func (lci *localCountingInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	atomic.AddInt32(&lci.begin, 1)
+	return ctx
+}
+func (lci *localCountingInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (lci *localCountingInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (lci *localCountingInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (lci *localCountingInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (lci *localCountingInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	atomic.AddInt32(&lci.complete, 1)
+	return ctx
+}
+
+func localInvoke(t *testing.T, api *localRuntimeAPI, functionName string, body string) (*http.Response, []byte) {
+	invokeURL := fmt.Sprintf("http://%s/2015-03-31/functions/%s/invocations",
+		api.Addr(),
+		functionName)
+	resp, respErr := http.Post(invokeURL, "application/json", strings.NewReader(body))
+	if respErr != nil {
+		t.Fatalf("Failed to invoke local function: %s", respErr)
+	}
+	defer resp.Body.Close()
+	respBody, respBodyErr := ioutil.ReadAll(resp.Body)
+	if respBodyErr != nil {
+		t.Fatalf("Failed to read local response: %s", respBodyErr)
+	}
+	return resp, respBody
+}
+
+func TestExecuteLocal(t *testing.T) {
+	logger, _ := NewLogger(zerolog.WarnLevel.String())
+	lambdaFn, _ := NewAWSLambda("localEcho", localEchoLambda, IAMRoleDefinition{})
+	interceptor := &localCountingInterceptor{}
+	lambdaFn.Interceptors = (&LambdaEventInterceptors{}).Register(interceptor)
+
+	api, apiErr := newLocalRuntimeAPI([]*LambdaAWSInfo{lambdaFn}, "127.0.0.1:0", logger)
+	if apiErr != nil {
+		t.Fatalf("Failed to create local runtime: %s", apiErr)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErrChan := make(chan error, 1)
+	go func() {
+		runErrChan <- api.Run(ctx)
+	}()
+
+	// Success
+	resp, body := localInvoke(t, api, "localEcho", `{"message":"hello"}`)
+	if resp.Header.Get(headerInvokeFunctionError) != "" {
+		t.Fatalf("Unexpected function error: %s", string(body))
+	}
+	var response map[string]string
+	unmarshalErr := json.Unmarshal(body, &response)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal response: %s", unmarshalErr)
+	}
+	if response["message"] != "hello" {
+		t.Fatalf("Unexpected response: %#v", response)
+	}
+	if response["requestID"] != resp.Header.Get(headerInvokeRequestID) {
+		t.Fatalf("Request ID not propagated to handler context: %#v", response)
+	}
+
+	// Function error
+	resp, body = localInvoke(t, api, "localEcho", `{"message":"fail"}`)
+	if resp.Header.Get(headerInvokeFunctionError) == "" {
+		t.Fatalf("Expected function error header. Body: %s", string(body))
+	}
+	if !strings.Contains(string(body), "requested failure") {
+		t.Fatalf("Unexpected error body: %s", string(body))
+	}
+
+	// Unknown function
+	resp, _ = localInvoke(t, api, "unknownFunction", `{}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown function, got: %d", resp.StatusCode)
+	}
+
+	cancel()
+	runErr := <-runErrChan
+	if runErr != nil {
+		t.Fatalf("Local runtime failed to shutdown: %s", runErr)
+	}
+	if atomic.LoadInt32(&interceptor.begin) != 2 ||
+		atomic.LoadInt32(&interceptor.complete) != 2 {
+		t.Fatalf("Unexpected interceptor counts: %#v", interceptor)
+	}
+}
@@ -0,0 +1,146 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type completeErrorInterceptor struct {
+	completeErr error
+}
+
+func (cei *completeErrorInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (cei *completeErrorInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (cei *completeErrorInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (cei *completeErrorInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (cei *completeErrorInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+func (cei *completeErrorInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	cei.completeErr, _ = ctx.Value(ContextKeyLambdaError).(error)
+	return ctx
+}
+
+func slowLambda(ctx context.Context) (string, error) {
+	select {
+	case <-time.After(5 * time.Second):
+		return "too slow", nil
+	case <-ctx.Done():
+		// Ignore the cancellation to make sure the tapped handler
+		// doesn't wait for us
+		time.Sleep(time.Second)
+		return "", ctx.Err()
+	}
+}
+
+func TestTappedHandlerTimeout(t *testing.T) {
+	logger, _ := NewLogger(zerolog.WarnLevel.String())
+	interceptor := &completeErrorInterceptor{}
+	interceptors := (&LambdaEventInterceptors{}).Register(interceptor)
+	handler := tappedHandler(slowLambda,
+		interceptors,
+		nil,
+		200*time.Millisecond,
+		logger).(func(context.Context, json.RawMessage) (interface{}, error))
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	_, err := handler(ctx, json.RawMessage(`{}`))
+	if time.Now().After(deadline) {
+		t.Fatalf("Tapped handler returned after the function deadline")
+	}
+	timeoutErr, timeoutErrOk := err.(*LambdaTimeoutError)
+	if !timeoutErrOk {
+		t.Fatalf("Expected *LambdaTimeoutError, got: %#v", err)
+	}
+	if timeoutErr.GracePeriod != 200*time.Millisecond {
+		t.Fatalf("Unexpected grace period: %s", timeoutErr.GracePeriod)
+	}
+	if interceptor.completeErr != err {
+		t.Fatalf("Complete interceptor didn't receive timeout error: %#v", interceptor.completeErr)
+	}
+}
+
+type cachingInterceptor struct {
+	completeErrorInterceptor
+	completeResponse interface{}
+}
+
+func (ci *cachingInterceptor) ShortCircuit(ctx context.Context,
+	msg json.RawMessage) (context.Context, interface{}, bool, error) {
+	return ctx, "cached", true, nil
+}
+
+func (ci *cachingInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	ci.completeResponse = ctx.Value(ContextKeyLambdaResponse)
+	return ctx
+}
+
+func TestTappedHandlerShortCircuit(t *testing.T) {
+	logger, _ := NewLogger(zerolog.WarnLevel.String())
+	handlerCalled := false
+	lambdaHandler := func(ctx context.Context) (string, error) {
+		handlerCalled = true
+		return "handler", nil
+	}
+	interceptor := &cachingInterceptor{}
+	interceptors := (&LambdaEventInterceptors{}).Register(interceptor)
+	if len(interceptors.ShortCircuit) != 1 {
+		t.Fatalf("Failed to register ShortCircuit interceptor")
+	}
+	handler := tappedHandler(lambdaHandler,
+		interceptors,
+		nil,
+		0,
+		logger).(func(context.Context, json.RawMessage) (interface{}, error))
+	response, err := handler(context.Background(), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if handlerCalled {
+		t.Fatalf("Handler was called for short circuited request")
+	}
+	if response != "cached" || interceptor.completeResponse != "cached" {
+		t.Fatalf("Unexpected response. Returned: %#v, Complete: %#v",
+			response,
+			interceptor.completeResponse)
+	}
+}
+
+func TestTappedHandlerPanic(t *testing.T) {
+	logger, _ := NewLogger(zerolog.Disabled.String())
+	lambdaHandler := func(ctx context.Context) (string, error) {
+		panic("boom")
+	}
+	interceptor := &completeErrorInterceptor{}
+	interceptors := (&LambdaEventInterceptors{}).Register(interceptor)
+	handler := tappedHandler(lambdaHandler,
+		interceptors,
+		nil,
+		0,
+		logger).(func(context.Context, json.RawMessage) (interface{}, error))
+	_, err := handler(context.Background(), json.RawMessage(`{}`))
+	panicErr, panicErrOk := err.(*PanicError)
+	if !panicErrOk {
+		t.Fatalf("Expected *PanicError, got: %#v", err)
+	}
+	if panicErr.Value != "boom" || panicErr.Stack == "" {
+		t.Fatalf("Unexpected panic error: %#v", panicErr)
+	}
+	if interceptor.completeErr != err {
+		t.Fatalf("Complete interceptor didn't receive panic error: %#v", interceptor.completeErr)
+	}
+}
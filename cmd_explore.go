@@ -3,11 +3,10 @@
 package sparta
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
 	broadcast "github.com/dustin/go-broadcast"
 	tcell "github.com/gdamore/tcell/v2"
 	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	"github.com/rivo/tview"
 	"github.com/rs/zerolog"
 )
@@ -51,14 +50,10 @@ func ExploreWithInputFilter(serviceName string,
 	// Great - everybody get's an aws session
 	awsSession := spartaAWS.NewSession(logger)
 	// Go get the stack and put the ARNs in the list of things. For that
-	// we need to get the stack resources...
-	cfSvc := cloudformation.New(awsSession)
-	input := &cloudformation.DescribeStackResourcesInput{
-		StackName: aws.String(serviceName),
-	}
-	stackResourceOutputs, stackResourceOutputsErr := cfSvc.DescribeStackResources(input)
-	if stackResourceOutputsErr != nil {
-		return stackResourceOutputsErr
+	// we need to get the stack resources, including the nested stacks'...
+	stackResources, stackResourcesErr := spartaCF.StackResources(serviceName, awsSession)
+	if stackResourcesErr != nil {
+		return stackResourcesErr
 	}
 
 	// Load the settings
@@ -73,7 +68,7 @@ func ExploreWithInputFilter(serviceName string,
 	// Setup the rest of them...
 	focusTargets := []tview.Primitive{}
 	dropdown, selectorFocusable := newFunctionSelector(awsSession,
-		stackResourceOutputs.StackResources,
+		stackResources,
 		application,
 		lambdaAWSInfos,
 		settingsMap,
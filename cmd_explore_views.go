@@ -123,6 +123,22 @@ func writePrettyString(writer io.Writer, input string) {
 //
 // Select the function to test
 //
+// stackLambdaARN returns the ARN of the lambda function provisioned by the stack
+func stackLambdaARN(stackID string, functionName string) string {
+	// stackID: arn:aws:cloudformation:us-west-2:123412341234:stack/MyHelloWorldStack-mweagle/54339e80-6686-11e8-90cd-503f20f2ad82
+	// lambdaARN: arn:aws:lambda:us-west-2:123412341234:function:MyHelloWorldStack-mweagle_Hello_World
+	stackParts := strings.Split(stackID, ":")
+	lambdaARNParts := []string{
+		"arn:aws:lambda:",
+		stackParts[3],
+		":",
+		stackParts[4],
+		":function:",
+		functionName,
+	}
+	return strings.Join(lambdaARNParts, "")
+}
+
 func newFunctionSelector(awsSession *session.Session,
 	stackResources []*cloudformation.StackResource,
 	app *tview.Application,
@@ -131,20 +147,6 @@ func newFunctionSelector(awsSession *session.Session,
 	onChangeBroadcaster broadcast.Broadcaster,
 	logger *zerolog.Logger) (tview.Primitive, []tview.Primitive) {
 
-	lambdaARN := func(stackID string, logicalName string) string {
-		// stackID: arn:aws:cloudformation:us-west-2:123412341234:stack/MyHelloWorldStack-mweagle/54339e80-6686-11e8-90cd-503f20f2ad82
-		// lambdaARN: arn:aws:lambda:us-west-2:123412341234:function:MyHelloWorldStack-mweagle_Hello_World
-		stackParts := strings.Split(stackID, ":")
-		lambdaARNParts := []string{
-			"arn:aws:lambda:",
-			stackParts[3],
-			":",
-			stackParts[4],
-			":function:",
-			logicalName,
-		}
-		return strings.Join(lambdaARNParts, "")
-	}
 	// Ok, walk the resources and assemble all the ARNs for the lambda functions
 	lambdaFunctionARNs := []string{}
 	for _, eachResource := range stackResources {
@@ -153,7 +155,7 @@ func newFunctionSelector(awsSession *session.Session,
 				Str("Resource", *eachResource.LogicalResourceId).
 				Msg("Found provisioned Lambda function")
 			lambdaFunctionARNs = append(lambdaFunctionARNs,
-				lambdaARN(*eachResource.StackId, *eachResource.PhysicalResourceId))
+				stackLambdaARN(*eachResource.StackId, *eachResource.PhysicalResourceId))
 		}
 	}
 	sort.Strings(lambdaFunctionARNs)
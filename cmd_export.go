@@ -0,0 +1,814 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	cfCustomResources "github.com/mweagle/Sparta/aws/cloudformation/resources"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// samTransform is the transform that identifies a SAM template
+	samTransform = "AWS::Serverless-2016-10-31"
+	// samTemplateName is the name of the exported SAM template. It's one
+	// of the names the SAM CLI looks for by default.
+	samTemplateName = "template.json"
+	// samConfigName is the name of the exported SAM CLI configuration
+	samConfigName = "samconfig.toml"
+	// samDefaultStageName is the API stage name used if the API doesn't
+	// define one
+	samDefaultStageName = "Prod"
+)
+
+// samFunctionPropertyNames are the AWS::Lambda::Function properties that
+// are copied as-is to the AWS::Serverless::Function
+var samFunctionPropertyNames = map[string]bool{
+	"Architectures":                true,
+	"CodeSigningConfigArn":         true,
+	"Description":                  true,
+	"Environment":                  true,
+	"FileSystemConfigs":            true,
+	"FunctionName":                 true,
+	"Handler":                      true,
+	"ImageConfig":                  true,
+	"KmsKeyArn":                    true,
+	"Layers":                       true,
+	"MemorySize":                   true,
+	"PackageType":                  true,
+	"ReservedConcurrentExecutions": true,
+	"Role":                         true,
+	"Runtime":                      true,
+	"Timeout":                      true,
+	"VpcConfig":                    true,
+}
+
+// samStreamEventPropertyNames are the AWS::Lambda::EventSourceMapping
+// properties supported by the SAM Kinesis and DynamoDB events
+var samStreamEventPropertyNames = map[string]bool{
+	"BatchSize":                      true,
+	"BisectBatchOnFunctionError":     true,
+	"DestinationConfig":              true,
+	"Enabled":                        true,
+	"FunctionResponseTypes":          true,
+	"MaximumBatchingWindowInSeconds": true,
+	"MaximumRecordAgeInSeconds":      true,
+	"MaximumRetryAttempts":           true,
+	"ParallelizationFactor":          true,
+	"StartingPosition":               true,
+}
+
+// samEventSources are the SAM event types for the event source mapping
+// ARN services. The arnProperty is the SAM property name of the
+// EventSourceArn.
+var samEventSources = map[string]struct {
+	eventType     string
+	arnProperty   string
+	propertyNames map[string]bool
+}{
+	"sqs": {
+		eventType:   "SQS",
+		arnProperty: "Queue",
+		propertyNames: map[string]bool{
+			"BatchSize":                      true,
+			"Enabled":                        true,
+			"MaximumBatchingWindowInSeconds": true,
+		},
+	},
+	"kinesis": {
+		eventType:     "Kinesis",
+		arnProperty:   "Stream",
+		propertyNames: samStreamEventPropertyNames,
+	},
+	"dynamodb": {
+		eventType:     "DynamoDB",
+		arnProperty:   "Stream",
+		propertyNames: samStreamEventPropertyNames,
+	},
+	"kafka": {
+		eventType:   "MSK",
+		arnProperty: "Stream",
+		propertyNames: map[string]bool{
+			"StartingPosition": true,
+			"Topics":           true,
+		},
+	},
+}
+
+var arnServiceRegexp = regexp.MustCompile(`arn:aws[a-z-]*:([a-z0-9-]+):`)
+
+// samArnService returns the lowercase AWS service name of the ARN, which
+// is either a literal or an intrinsic function
+func samArnService(arnValue interface{}, resources map[string]interface{}) string {
+	// Attributes of template resources use the resource type
+	typedValue, typedValueOk := arnValue.(map[string]interface{})
+	if typedValueOk {
+		getAtt, getAttOk := typedValue["Fn::GetAtt"].([]interface{})
+		if getAttOk && len(getAtt) != 0 {
+			resourceName, _ := getAtt[0].(string)
+			resource, resourceOk := resources[resourceName].(map[string]interface{})
+			if resourceOk {
+				resourceType, _ := resource["Type"].(string)
+				typeParts := strings.Split(resourceType, "::")
+				if len(typeParts) == 3 {
+					service := strings.ToLower(typeParts[1])
+					if service == "msk" {
+						service = "kafka"
+					}
+					return service
+				}
+			}
+		}
+	}
+	jsonBytes, jsonBytesErr := json.Marshal(arnValue)
+	if jsonBytesErr != nil {
+		return ""
+	}
+	matches := arnServiceRegexp.FindStringSubmatch(string(jsonBytes))
+	if len(matches) != 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// samRefersTo returns true if the value includes a Ref or Fn::GetAtt
+// of the logical resource name
+func samRefersTo(value interface{}, logicalName string) bool {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if typedValue["Ref"] == logicalName {
+			return true
+		}
+		getAtt, getAttOk := typedValue["Fn::GetAtt"].([]interface{})
+		if getAttOk && len(getAtt) != 0 && getAtt[0] == logicalName {
+			return true
+		}
+		for _, eachValue := range typedValue {
+			if samRefersTo(eachValue, logicalName) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			if samRefersTo(eachValue, logicalName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// samResource is a template resource
+type samResource struct {
+	name       string
+	resource   map[string]interface{}
+	properties map[string]interface{}
+}
+
+// samResourcesOfType returns the template resources of the given type,
+// sorted by name
+func samResourcesOfType(resources map[string]interface{}, resourceType string) []*samResource {
+	typedResources := []*samResource{}
+	for eachName, eachResource := range resources {
+		resource, resourceOk := eachResource.(map[string]interface{})
+		if !resourceOk || resource["Type"] != resourceType {
+			continue
+		}
+		properties, _ := resource["Properties"].(map[string]interface{})
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+		typedResources = append(typedResources, &samResource{
+			name:       eachName,
+			resource:   resource,
+			properties: properties,
+		})
+	}
+	sort.Slice(typedResources, func(i, j int) bool {
+		return typedResources[i].name < typedResources[j].name
+	})
+	return typedResources
+}
+
+// samConverter converts a Sparta CloudFormation template to a SAM template
+type samConverter struct {
+	resources map[string]interface{}
+	codeURI   string
+	// events are the SAM events for each function
+	events map[string]map[string]interface{}
+	// removed are the resource names that SAM events or APIs replace
+	removed map[string]bool
+	logger  *zerolog.Logger
+}
+
+func (sc *samConverter) addEvent(functionName string,
+	eventName string,
+	eventType string,
+	properties map[string]interface{}) {
+	if sc.events[functionName] == nil {
+		sc.events[functionName] = make(map[string]interface{})
+	}
+	sc.events[functionName][eventName] = map[string]interface{}{
+		"Type":       eventType,
+		"Properties": properties,
+	}
+}
+
+// removePermissions removes the function's lambda permissions for the
+// principal, which are created by the SAM events
+func (sc *samConverter) removePermissions(functionName string, principal string) {
+	for _, eachPermission := range samResourcesOfType(sc.resources, "AWS::Lambda::Permission") {
+		if eachPermission.properties["Principal"] == principal &&
+			samRefersTo(eachPermission.properties["FunctionName"], functionName) {
+			sc.removed[eachPermission.name] = true
+		}
+	}
+}
+
+func (sc *samConverter) convertEventSourceMappings(functionName string) {
+	for _, eachMapping := range samResourcesOfType(sc.resources, "AWS::Lambda::EventSourceMapping") {
+		if !samRefersTo(eachMapping.properties["FunctionName"], functionName) {
+			continue
+		}
+		arnValue := eachMapping.properties["EventSourceArn"]
+		eventSource, eventSourceExists := samEventSources[samArnService(arnValue, sc.resources)]
+		if !eventSourceExists {
+			sc.logger.Warn().
+				Str("Resource", eachMapping.name).
+				Interface("EventSourceArn", arnValue).
+				Msg("Unsupported SAM event source. Mapping is exported as a resource")
+			continue
+		}
+		eventProperties := map[string]interface{}{
+			eventSource.arnProperty: arnValue,
+		}
+		for eachKey, eachValue := range eachMapping.properties {
+			if eventSource.propertyNames[eachKey] {
+				eventProperties[eachKey] = eachValue
+			}
+		}
+		sc.addEvent(functionName, eachMapping.name, eventSource.eventType, eventProperties)
+		sc.removed[eachMapping.name] = true
+	}
+}
+
+func (sc *samConverter) convertEventRules(functionName string) {
+	convertedRules := 0
+	for _, eachRule := range samResourcesOfType(sc.resources, "AWS::Events::Rule") {
+		targets, _ := eachRule.properties["Targets"].([]interface{})
+		if len(targets) != 1 {
+			if samRefersTo(targets, functionName) {
+				sc.logger.Warn().
+					Str("Resource", eachRule.name).
+					Msg("Rules with multiple targets are exported as resources")
+				return
+			}
+			continue
+		}
+		target, _ := targets[0].(map[string]interface{})
+		if !samRefersTo(target["Arn"], functionName) {
+			continue
+		}
+		eventType := "EventBridgeRule"
+		eventProperties := map[string]interface{}{}
+		if schedule, scheduleExists := eachRule.properties["ScheduleExpression"]; scheduleExists {
+			eventType = "Schedule"
+			eventProperties["Schedule"] = schedule
+			if description, descriptionExists := eachRule.properties["Description"]; descriptionExists {
+				eventProperties["Description"] = description
+			}
+		} else {
+			eventProperties["Pattern"] = eachRule.properties["EventPattern"]
+			if eventBusName, eventBusNameExists := eachRule.properties["EventBusName"]; eventBusNameExists {
+				eventProperties["EventBusName"] = eventBusName
+			}
+			if inputPath, inputPathExists := target["InputPath"]; inputPathExists {
+				eventProperties["InputPath"] = inputPath
+			}
+		}
+		if input, inputExists := target["Input"]; inputExists {
+			eventProperties["Input"] = input
+		}
+		sc.addEvent(functionName, eachRule.name, eventType, eventProperties)
+		sc.removed[eachRule.name] = true
+		convertedRules++
+	}
+	if convertedRules != 0 {
+		sc.removePermissions(functionName, CloudWatchEventsPrincipal)
+	}
+}
+
+func (sc *samConverter) convertSNSSubscriptions(functionName string) {
+	convertedTopics := 0
+	for _, eachSubscription := range samResourcesOfType(sc.resources, cfCustomResources.SNSLambdaEventSource) {
+		if !samRefersTo(eachSubscription.properties["LambdaTargetArn"], functionName) {
+			continue
+		}
+		sc.addEvent(functionName, eachSubscription.name, "SNS", map[string]interface{}{
+			"Topic": eachSubscription.properties["SNSTopicArn"],
+		})
+		sc.removed[eachSubscription.name] = true
+		convertedTopics++
+	}
+	if convertedTopics != 0 {
+		sc.removePermissions(functionName, SNSPrincipal)
+	}
+}
+
+// functionProperties returns the AWS::Serverless::Function properties
+func (sc *samConverter) functionProperties(functionName string,
+	lambdaProperties map[string]interface{}) map[string]interface{} {
+
+	samProperties := make(map[string]interface{})
+	for eachKey, eachValue := range lambdaProperties {
+		switch eachKey {
+		case "Code":
+			code, _ := eachValue.(map[string]interface{})
+			if imageURI, imageURIExists := code["ImageUri"]; imageURIExists {
+				samProperties["ImageUri"] = imageURI
+			} else {
+				samProperties["CodeUri"] = sc.codeURI
+			}
+		case "TracingConfig":
+			tracingConfig, _ := eachValue.(map[string]interface{})
+			samProperties["Tracing"] = tracingConfig["Mode"]
+		case "DeadLetterConfig":
+			deadLetterConfig, _ := eachValue.(map[string]interface{})
+			targetArn := deadLetterConfig["TargetArn"]
+			deadLetterType := "SNS"
+			if samArnService(targetArn, sc.resources) == "sqs" {
+				deadLetterType = "SQS"
+			}
+			samProperties["DeadLetterQueue"] = map[string]interface{}{
+				"Type":      deadLetterType,
+				"TargetArn": targetArn,
+			}
+		case "Tags":
+			// SAM tags are a map
+			tags := make(map[string]interface{})
+			tagList, _ := eachValue.([]interface{})
+			for _, eachTag := range tagList {
+				tag, _ := eachTag.(map[string]interface{})
+				tagKey, tagKeyOk := tag["Key"].(string)
+				if tagKeyOk {
+					tags[tagKey] = tag["Value"]
+				}
+			}
+			samProperties["Tags"] = tags
+		default:
+			if samFunctionPropertyNames[eachKey] {
+				samProperties[eachKey] = eachValue
+			} else {
+				sc.logger.Warn().
+					Str("Function", functionName).
+					Str("Property", eachKey).
+					Msg("Unsupported SAM function property")
+			}
+		}
+	}
+	return samProperties
+}
+
+// convertAPI converts the API Gateway RestApi and its resources, methods
+// and deployments to an AWS::Serverless::Api with an OpenAPI definition.
+// The integrations are unchanged.
+func (sc *samConverter) convertAPI(api *samResource) {
+	// Resource paths
+	resourcePaths := make(map[string]string)
+	apiResources := samResourcesOfType(sc.resources, "AWS::ApiGateway::Resource")
+	var resourcePath func(resourceName string) string
+	resourcePath = func(resourceName string) string {
+		if path, pathExists := resourcePaths[resourceName]; pathExists {
+			return path
+		}
+		for _, eachResource := range apiResources {
+			if eachResource.name != resourceName {
+				continue
+			}
+			parentPath := ""
+			parentID, _ := eachResource.properties["ParentId"].(map[string]interface{})
+			if parentName, parentNameOk := parentID["Ref"].(string); parentNameOk {
+				parentPath = resourcePath(parentName)
+			}
+			resourcePaths[resourceName] = fmt.Sprintf("%s/%s",
+				parentPath,
+				eachResource.properties["PathPart"])
+		}
+		return resourcePaths[resourceName]
+	}
+	for _, eachResource := range apiResources {
+		if samRefersTo(eachResource.properties["RestApiId"], api.name) {
+			resourcePath(eachResource.name)
+			sc.removed[eachResource.name] = true
+		}
+	}
+
+	// Methods
+	paths := make(map[string]interface{})
+	for _, eachMethod := range samResourcesOfType(sc.resources, "AWS::ApiGateway::Method") {
+		if !samRefersTo(eachMethod.properties["RestApiId"], api.name) {
+			continue
+		}
+		path := "/"
+		resourceID, _ := eachMethod.properties["ResourceId"].(map[string]interface{})
+		if resourceName, resourceNameOk := resourceID["Ref"].(string); resourceNameOk {
+			path = resourcePath(resourceName)
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		httpMethod, _ := eachMethod.properties["HttpMethod"].(string)
+		paths[path].(map[string]interface{})[strings.ToLower(httpMethod)] = sc.apiOperation(eachMethod)
+		sc.removed[eachMethod.name] = true
+	}
+
+	// The API properties
+	apiProperties := map[string]interface{}{
+		"StageName": samDefaultStageName,
+		"DefinitionBody": map[string]interface{}{
+			"swagger": "2.0",
+			"info": map[string]interface{}{
+				"title":   api.properties["Name"],
+				"version": "1.0",
+			},
+			"paths": paths,
+		},
+	}
+	for _, eachKey := range []string{"Name",
+		"Description",
+		"BinaryMediaTypes",
+		"FailOnWarnings",
+		"MinimumCompressionSize"} {
+		if value, valueExists := api.properties[eachKey]; valueExists {
+			apiProperties[eachKey] = value
+		}
+	}
+	endpointConfiguration, _ := api.properties["EndpointConfiguration"].(map[string]interface{})
+	endpointTypes, _ := endpointConfiguration["Types"].([]interface{})
+	if len(endpointTypes) != 0 {
+		apiProperties["EndpointConfiguration"] = endpointTypes[0]
+	}
+	stageNameExists := false
+	for _, eachDeployment := range samResourcesOfType(sc.resources, "AWS::ApiGateway::Deployment") {
+		if !samRefersTo(eachDeployment.properties["RestApiId"], api.name) {
+			continue
+		}
+		if stageName, stageNameOk := eachDeployment.properties["StageName"]; stageNameOk {
+			apiProperties["StageName"] = stageName
+			stageNameExists = true
+		}
+		stageDescription, _ := eachDeployment.properties["StageDescription"].(map[string]interface{})
+		for _, eachKey := range []string{"Variables",
+			"CacheClusterEnabled",
+			"CacheClusterSize"} {
+			if value, valueExists := stageDescription[eachKey]; valueExists {
+				apiProperties[eachKey] = value
+			}
+		}
+		sc.removed[eachDeployment.name] = true
+	}
+	if !stageNameExists {
+		sc.logger.Info().
+			Str("API", api.name).
+			Str("StageName", samDefaultStageName).
+			Msg("API doesn't define a stage. Using the default SAM stage name")
+	}
+	api.resource["Type"] = "AWS::Serverless::Api"
+	api.resource["Properties"] = apiProperties
+}
+
+// apiOperation returns the OpenAPI operation for the API Gateway method
+func (sc *samConverter) apiOperation(method *samResource) map[string]interface{} {
+	integration, _ := method.properties["Integration"].(map[string]interface{})
+	integrationType, _ := integration["Type"].(string)
+	apiIntegration := map[string]interface{}{
+		"type": strings.ToLower(integrationType),
+	}
+	integrationKeys := map[string]string{
+		"IntegrationHttpMethod": "httpMethod",
+		"Uri":                   "uri",
+		"RequestTemplates":      "requestTemplates",
+		"RequestParameters":     "requestParameters",
+		"PassthroughBehavior":   "passthroughBehavior",
+		"ContentHandling":       "contentHandling",
+		"TimeoutInMillis":       "timeoutInMillis",
+	}
+	for eachKey, eachOpenAPIKey := range integrationKeys {
+		if value, valueExists := integration[eachKey]; valueExists {
+			apiIntegration[eachOpenAPIKey] = value
+		}
+	}
+	integrationResponses, _ := integration["IntegrationResponses"].([]interface{})
+	if len(integrationResponses) != 0 {
+		responses := make(map[string]interface{})
+		for _, eachResponse := range integrationResponses {
+			integrationResponse, _ := eachResponse.(map[string]interface{})
+			selectionPattern, _ := integrationResponse["SelectionPattern"].(string)
+			if selectionPattern == "" {
+				selectionPattern = "default"
+			}
+			response := map[string]interface{}{
+				"statusCode": integrationResponse["StatusCode"],
+			}
+			if value, valueExists := integrationResponse["ResponseParameters"]; valueExists {
+				response["responseParameters"] = value
+			}
+			if value, valueExists := integrationResponse["ResponseTemplates"]; valueExists {
+				response["responseTemplates"] = value
+			}
+			responses[selectionPattern] = response
+		}
+		apiIntegration["responses"] = responses
+	}
+
+	// Method responses
+	responses := make(map[string]interface{})
+	methodResponses, _ := method.properties["MethodResponses"].([]interface{})
+	for _, eachResponse := range methodResponses {
+		methodResponse, _ := eachResponse.(map[string]interface{})
+		statusCode := fmt.Sprintf("%v", methodResponse["StatusCode"])
+		response := map[string]interface{}{
+			"description": statusCode,
+		}
+		responseParameters, _ := methodResponse["ResponseParameters"].(map[string]interface{})
+		if len(responseParameters) != 0 {
+			headers := make(map[string]interface{})
+			for eachKey := range responseParameters {
+				headerName := strings.TrimPrefix(eachKey, "method.response.header.")
+				headers[headerName] = map[string]interface{}{
+					"type": "string",
+				}
+			}
+			response["headers"] = headers
+		}
+		responses[statusCode] = response
+	}
+	if len(responses) == 0 {
+		responses["200"] = map[string]interface{}{
+			"description": "200",
+		}
+	}
+
+	operation := map[string]interface{}{
+		"responses":                       responses,
+		"x-amazon-apigateway-integration": apiIntegration,
+	}
+
+	// Request parameters
+	requestParameters, _ := method.properties["RequestParameters"].(map[string]interface{})
+	if len(requestParameters) != 0 {
+		parameterLocations := map[string]string{
+			"querystring": "query",
+			"header":      "header",
+			"path":        "path",
+		}
+		parameterNames := []string{}
+		for eachKey := range requestParameters {
+			parameterNames = append(parameterNames, eachKey)
+		}
+		sort.Strings(parameterNames)
+		parameters := []interface{}{}
+		for _, eachKey := range parameterNames {
+			keyParts := strings.SplitN(eachKey, ".", 4)
+			if len(keyParts) != 4 {
+				continue
+			}
+			location, locationExists := parameterLocations[keyParts[2]]
+			if !locationExists {
+				continue
+			}
+			required := fmt.Sprintf("%v", requestParameters[eachKey]) == "true" ||
+				location == "path"
+			parameters = append(parameters, map[string]interface{}{
+				"name":     keyParts[3],
+				"in":       location,
+				"required": required,
+				"type":     "string",
+			})
+		}
+		operation["parameters"] = parameters
+	}
+	authorizationType, _ := method.properties["AuthorizationType"].(string)
+	if authorizationType != "" && authorizationType != "NONE" {
+		sc.logger.Warn().
+			Str("Method", method.name).
+			Str("AuthorizationType", authorizationType).
+			Msg("Method authorizers are not exported to the SAM API")
+	}
+	return operation
+}
+
+// newSAMTemplate converts the Sparta CloudFormation template to an AWS SAM
+// template. Lambda functions become AWS::Serverless::Function resources
+// whose Events replace the event source mappings, event rules and SNS
+// subscriptions. API Gateway RestApis become AWS::Serverless::Api
+// resources. All other resources are unchanged.
+func newSAMTemplate(template map[string]interface{},
+	codeURI string,
+	logger *zerolog.Logger) (map[string]interface{}, error) {
+
+	resources, resourcesOk := template["Resources"].(map[string]interface{})
+	if !resourcesOk {
+		return nil, errors.New("Template doesn't define any Resources")
+	}
+	converter := &samConverter{
+		resources: resources,
+		codeURI:   codeURI,
+		events:    make(map[string]map[string]interface{}),
+		removed:   make(map[string]bool),
+		logger:    logger,
+	}
+	functions := samResourcesOfType(resources, "AWS::Lambda::Function")
+	for _, eachFunction := range functions {
+		converter.convertEventSourceMappings(eachFunction.name)
+		converter.convertEventRules(eachFunction.name)
+		converter.convertSNSSubscriptions(eachFunction.name)
+	}
+	for _, eachAPI := range samResourcesOfType(resources, "AWS::ApiGateway::RestApi") {
+		converter.convertAPI(eachAPI)
+	}
+	for _, eachFunction := range functions {
+		samProperties := converter.functionProperties(eachFunction.name,
+			eachFunction.properties)
+		if len(converter.events[eachFunction.name]) != 0 {
+			samProperties["Events"] = converter.events[eachFunction.name]
+		}
+		eachFunction.resource["Type"] = "AWS::Serverless::Function"
+		eachFunction.resource["Properties"] = samProperties
+	}
+
+	// Remove the replaced resources and any dependencies on them
+	for eachName := range converter.removed {
+		delete(resources, eachName)
+	}
+	for _, eachResource := range resources {
+		resource, resourceOk := eachResource.(map[string]interface{})
+		if !resourceOk {
+			continue
+		}
+		var dependsOn []interface{}
+		switch typedDependsOn := resource["DependsOn"].(type) {
+		case string:
+			dependsOn = []interface{}{typedDependsOn}
+		case []interface{}:
+			dependsOn = typedDependsOn
+		default:
+			continue
+		}
+		remainingDependsOn := []interface{}{}
+		for _, eachDependency := range dependsOn {
+			dependencyName, _ := eachDependency.(string)
+			if !converter.removed[dependencyName] {
+				remainingDependsOn = append(remainingDependsOn, eachDependency)
+			}
+		}
+		if len(remainingDependsOn) == 0 {
+			delete(resource, "DependsOn")
+		} else {
+			resource["DependsOn"] = remainingDependsOn
+		}
+	}
+
+	// The function code parameters are replaced by the CodeUri
+	parameters, _ := template["Parameters"].(map[string]interface{})
+	for _, eachParam := range []string{StackParamS3CodeKeyName, StackParamS3CodeVersion} {
+		if samRefersTo(resources, eachParam) {
+			continue
+		}
+		delete(parameters, eachParam)
+	}
+	template["Transform"] = samTransform
+	return template, nil
+}
+
+// samConfig returns the samconfig.toml file contents
+func samConfig(serviceName string,
+	s3Bucket string,
+	parameterOverrides map[string]string) string {
+
+	var config strings.Builder
+	config.WriteString("version = 0.1\n\n")
+	config.WriteString("[default.global.parameters]\n")
+	config.WriteString(fmt.Sprintf("stack_name = %s\n", strconv.Quote(serviceName)))
+	if len(parameterOverrides) != 0 {
+		parameterNames := []string{}
+		for eachKey := range parameterOverrides {
+			parameterNames = append(parameterNames, eachKey)
+		}
+		sort.Strings(parameterNames)
+		overrides := []string{}
+		for _, eachKey := range parameterNames {
+			overrides = append(overrides, fmt.Sprintf("%s=%s",
+				eachKey,
+				strconv.Quote(parameterOverrides[eachKey])))
+		}
+		config.WriteString(fmt.Sprintf("parameter_overrides = %s\n",
+			strconv.Quote(strings.Join(overrides, " "))))
+	}
+	config.WriteString("\n[default.deploy.parameters]\n")
+	config.WriteString(fmt.Sprintf("capabilities = %s\n",
+		strconv.Quote("CAPABILITY_IAM CAPABILITY_NAMED_IAM CAPABILITY_AUTO_EXPAND")))
+	if s3Bucket != "" {
+		config.WriteString(fmt.Sprintf("s3_bucket = %s\n", strconv.Quote(s3Bucket)))
+	} else {
+		config.WriteString("resolve_s3 = true\n")
+	}
+	config.WriteString(fmt.Sprintf("s3_prefix = %s\n", strconv.Quote(serviceName)))
+	config.WriteString("confirm_changeset = true\n")
+	return config.String()
+}
+
+// Export converts the template produced by Build to the given format. For
+// ExportFormatSAM, an AWS SAM template.json and samconfig.toml file are
+// written to the output directory so that the service can be run with
+// `sam local` and deployed with `sam deploy`.
+func Export(format string,
+	serviceName string,
+	templatePath string,
+	s3Bucket string,
+	outputDirectory string,
+	logger *zerolog.Logger) error {
+
+	if format != ExportFormatSAM {
+		return errors.Errorf("Unsupported export format: %s", format)
+	}
+	/* #nosec G304 */
+	templateBytes, templateBytesErr := ioutil.ReadFile(templatePath)
+	if templateBytesErr != nil {
+		return templateBytesErr
+	}
+	var template map[string]interface{}
+	unmarshalErr := json.Unmarshal(templateBytes, &template)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal template: %s", templatePath)
+	}
+	absOutputDirectory, absOutputDirectoryErr := filepath.Abs(outputDirectory)
+	if absOutputDirectoryErr != nil {
+		return absOutputDirectoryErr
+	}
+
+	// The CodeUri is relative to the SAM template
+	codeURI := ""
+	metadata, _ := template["Metadata"].(map[string]interface{})
+	codeArchivePath, _ := metadata[MetadataParamCodeArchivePath].(string)
+	if codeArchivePath != "" {
+		absCodeArchivePath, absCodeArchivePathErr := filepath.Abs(codeArchivePath)
+		if absCodeArchivePathErr != nil {
+			return absCodeArchivePathErr
+		}
+		relCodeArchivePath, relCodeArchivePathErr := filepath.Rel(absOutputDirectory,
+			absCodeArchivePath)
+		if relCodeArchivePathErr != nil {
+			return relCodeArchivePathErr
+		}
+		codeURI = relCodeArchivePath
+	}
+	if _, nestedExists := metadata[MetadataParamNestedTemplates]; nestedExists {
+		return errors.Errorf("Templates with nested stacks can't be exported to %s", format)
+	}
+	if _, siteExists := metadata[MetadataParamS3SiteArchivePath]; siteExists {
+		logger.Warn().
+			Msg("S3 site archives are not packaged by SAM. Upload the archive and set the stack parameters before deploying")
+	}
+	samTemplate, samTemplateErr := newSAMTemplate(template, codeURI, logger)
+	if samTemplateErr != nil {
+		return samTemplateErr
+	}
+	samTemplateBytes, samTemplateBytesErr := json.MarshalIndent(samTemplate, "", " ")
+	if samTemplateBytesErr != nil {
+		return samTemplateBytesErr
+	}
+	samTemplatePath := filepath.Join(absOutputDirectory, samTemplateName)
+	writeErr := ioutil.WriteFile(samTemplatePath, samTemplateBytes, os.ModePerm)
+	if writeErr != nil {
+		return errors.Wrapf(writeErr, "Failed to write SAM template: %s", samTemplatePath)
+	}
+
+	parameterOverrides := make(map[string]string)
+	parameters, _ := samTemplate["Parameters"].(map[string]interface{})
+	if _, bucketParamExists := parameters[StackParamArtifactBucketName]; bucketParamExists && s3Bucket != "" {
+		parameterOverrides[StackParamArtifactBucketName] = s3Bucket
+	}
+	samConfigPath := filepath.Join(absOutputDirectory, samConfigName)
+	writeErr = ioutil.WriteFile(samConfigPath,
+		[]byte(samConfig(serviceName, s3Bucket, parameterOverrides)),
+		os.ModePerm)
+	if writeErr != nil {
+		return errors.Wrapf(writeErr, "Failed to write SAM config: %s", samConfigPath)
+	}
+	logger.Info().
+		Str("Template", relativePath(samTemplatePath)).
+		Str("Config", relativePath(samConfigPath)).
+		Msg("Exported SAM template")
+	return nil
+}
@@ -0,0 +1,183 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const exportTestTemplate = `{
+  "Parameters": {
+    "ArtifactS3Bucket": {"Type": "String"},
+    "CodeArtifactS3Key": {"Type": "String"},
+    "CodeArtifactS3ObjectVersion": {"Type": "String"}
+  },
+  "Resources": {
+    "HelloLambda": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {
+        "Code": {"S3Bucket": {"Ref": "ArtifactS3Bucket"}, "S3Key": {"Ref": "CodeArtifactS3Key"}},
+        "Handler": "Sparta.lambda.amd64",
+        "Runtime": "go1.x",
+        "TracingConfig": {"Mode": "Active"},
+        "Tags": [{"Key": "team", "Value": "sparta"}]
+      }
+    },
+    "Queue": {"Type": "AWS::SQS::Queue"},
+    "QueueMapping": {
+      "Type": "AWS::Lambda::EventSourceMapping",
+      "Properties": {
+        "EventSourceArn": {"Fn::GetAtt": ["Queue", "Arn"]},
+        "FunctionName": {"Fn::GetAtt": ["HelloLambda", "Arn"]},
+        "BatchSize": 10
+      }
+    },
+    "ScheduleRule": {
+      "Type": "AWS::Events::Rule",
+      "Properties": {
+        "ScheduleExpression": "rate(5 minutes)",
+        "Targets": [{"Arn": {"Fn::GetAtt": ["HelloLambda", "Arn"]}, "Id": "hello"}]
+      }
+    },
+    "EventsPermission": {
+      "Type": "AWS::Lambda::Permission",
+      "Properties": {
+        "Action": "lambda:InvokeFunction",
+        "FunctionName": {"Fn::GetAtt": ["HelloLambda", "Arn"]},
+        "Principal": "events.amazonaws.com"
+      }
+    },
+    "API": {
+      "Type": "AWS::ApiGateway::RestApi",
+      "Properties": {"Name": "HelloAPI", "EndpointConfiguration": {"Types": ["REGIONAL"]}}
+    },
+    "HelloResource": {
+      "Type": "AWS::ApiGateway::Resource",
+      "Properties": {
+        "ParentId": {"Fn::GetAtt": ["API", "RootResourceId"]},
+        "PathPart": "hello",
+        "RestApiId": {"Ref": "API"}
+      }
+    },
+    "HelloMethod": {
+      "Type": "AWS::ApiGateway::Method",
+      "DependsOn": ["APIPermission"],
+      "Properties": {
+        "HttpMethod": "GET",
+        "ResourceId": {"Ref": "HelloResource"},
+        "RestApiId": {"Ref": "API"},
+        "AuthorizationType": "NONE",
+        "RequestParameters": {"method.request.querystring.name": "true"},
+        "Integration": {
+          "Type": "AWS",
+          "IntegrationHttpMethod": "POST",
+          "Uri": {"Fn::Join": ["", ["arn:aws:apigateway:", {"Fn::GetAtt": ["HelloLambda", "Arn"]}]]},
+          "IntegrationResponses": [{"StatusCode": "200"}, {"StatusCode": "500", "SelectionPattern": ".*error.*"}]
+        },
+        "MethodResponses": [{"StatusCode": "200"}, {"StatusCode": "500"}]
+      }
+    },
+    "APIPermission": {
+      "Type": "AWS::Lambda::Permission",
+      "Properties": {
+        "Action": "lambda:InvokeFunction",
+        "FunctionName": {"Fn::GetAtt": ["HelloLambda", "Arn"]},
+        "Principal": "apigateway.amazonaws.com"
+      }
+    },
+    "Deployment": {
+      "Type": "AWS::ApiGateway::Deployment",
+      "DependsOn": ["HelloMethod", "API"],
+      "Properties": {
+        "RestApiId": {"Ref": "API"},
+        "StageName": "v1",
+        "StageDescription": {"Variables": {"stage": "v1"}}
+      }
+    }
+  }
+}`
+
+func TestSAMTemplate(t *testing.T) {
+	logger, _ := NewLogger(zerolog.WarnLevel.String())
+	var template map[string]interface{}
+	unmarshalErr := json.Unmarshal([]byte(exportTestTemplate), &template)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal template: %s", unmarshalErr)
+	}
+	samTemplate, samTemplateErr := newSAMTemplate(template, "../code.zip", logger)
+	if samTemplateErr != nil {
+		t.Fatalf("Failed to convert template: %s", samTemplateErr)
+	}
+	if samTemplate["Transform"] != samTransform {
+		t.Fatalf("Missing SAM transform")
+	}
+	resources := samTemplate["Resources"].(map[string]interface{})
+	for _, eachRemoved := range []string{"QueueMapping",
+		"ScheduleRule",
+		"EventsPermission",
+		"HelloResource",
+		"HelloMethod",
+		"Deployment"} {
+		if _, exists := resources[eachRemoved]; exists {
+			t.Fatalf("Expected resource to be replaced: %s", eachRemoved)
+		}
+	}
+	if _, exists := resources["APIPermission"]; !exists {
+		t.Fatalf("Expected API permission to be retained")
+	}
+
+	function := resources["HelloLambda"].(map[string]interface{})
+	properties := function["Properties"].(map[string]interface{})
+	if function["Type"] != "AWS::Serverless::Function" ||
+		properties["CodeUri"] != "../code.zip" ||
+		properties["Tracing"] != "Active" ||
+		properties["Tags"].(map[string]interface{})["team"] != "sparta" {
+		t.Fatalf("Unexpected function: %#v", function)
+	}
+	events := properties["Events"].(map[string]interface{})
+	queueEvent := events["QueueMapping"].(map[string]interface{})
+	scheduleEvent := events["ScheduleRule"].(map[string]interface{})
+	if queueEvent["Type"] != "SQS" || scheduleEvent["Type"] != "Schedule" {
+		t.Fatalf("Unexpected function events: %#v", events)
+	}
+	parameters := samTemplate["Parameters"].(map[string]interface{})
+	if _, exists := parameters[StackParamS3CodeKeyName]; exists {
+		t.Fatalf("Expected unused code parameter to be removed")
+	}
+
+	api := resources["API"].(map[string]interface{})
+	apiProperties := api["Properties"].(map[string]interface{})
+	if api["Type"] != "AWS::Serverless::Api" ||
+		apiProperties["StageName"] != "v1" ||
+		apiProperties["EndpointConfiguration"] != "REGIONAL" {
+		t.Fatalf("Unexpected API: %#v", api)
+	}
+	paths := apiProperties["DefinitionBody"].(map[string]interface{})["paths"].(map[string]interface{})
+	operation := paths["/hello"].(map[string]interface{})["get"].(map[string]interface{})
+	integration := operation["x-amazon-apigateway-integration"].(map[string]interface{})
+	if integration["type"] != "aws" ||
+		len(integration["responses"].(map[string]interface{})) != 2 ||
+		len(operation["parameters"].([]interface{})) != 1 {
+		t.Fatalf("Unexpected API operation: %#v", operation)
+	}
+}
+
+func TestSAMConfig(t *testing.T) {
+	config := samConfig("MyService", "myBucket", map[string]string{
+		StackParamArtifactBucketName: "myBucket",
+	})
+	for _, eachExpected := range []string{`stack_name = "MyService"`,
+		`parameter_overrides = "ArtifactS3Bucket=\"myBucket\""`,
+		`s3_bucket = "myBucket"`} {
+		if !strings.Contains(config, eachExpected) {
+			t.Fatalf("Expected %s in config:\n%s", eachExpected, config)
+		}
+	}
+	if !strings.Contains(samConfig("MyService", "", nil), "resolve_s3 = true") {
+		t.Fatalf("Expected resolve_s3 without a bucket")
+	}
+}
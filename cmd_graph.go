@@ -0,0 +1,283 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// ServiceGraphNode is a node in the service topology. Nodes with a Parent
+// are grouped by the parent node.
+type ServiceGraphNode struct {
+	ID     string `json:"id"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// ServiceGraphEdge is a directed edge in the service topology
+type ServiceGraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Label  string `json:"label,omitempty"`
+}
+
+// ServiceGraph is the service topology that's produced by the `graph`
+// command. It's the same node and edge model that's rendered by the
+// `describe` command.
+type ServiceGraph struct {
+	Service string              `json:"service"`
+	Nodes   []*ServiceGraphNode `json:"nodes"`
+	Edges   []*ServiceGraphEdge `json:"edges"`
+}
+
+// serviceGraphWriter is the serviceDescriptionWriter that collects the
+// ServiceGraph nodes and edges
+type serviceGraphWriter struct {
+	graph *ServiceGraph
+	nodes map[string]*ServiceGraphNode
+	edges map[ServiceGraphEdge]bool
+}
+
+func (sgw *serviceGraphWriter) writeNodeWithParent(nodeName string,
+	nodeColor string,
+	nodeImage string,
+	nodeParent string,
+	labelWeight string) error {
+	nodeID := serviceGraphNodeID(nodeName)
+	if _, exists := sgw.nodes[nodeID]; exists {
+		return nil
+	}
+	node := &ServiceGraphNode{
+		ID:     nodeID,
+		Parent: serviceGraphNodeID(nodeParent),
+	}
+	sgw.nodes[nodeID] = node
+	sgw.graph.Nodes = append(sgw.graph.Nodes, node)
+	return nil
+}
+
+func (sgw *serviceGraphWriter) writeEdge(fromNode string,
+	toNode string,
+	label string) error {
+	edge := ServiceGraphEdge{
+		Source: serviceGraphNodeID(fromNode),
+		Target: serviceGraphNodeID(toNode),
+		Label:  label,
+	}
+	if sgw.edges[edge] {
+		return nil
+	}
+	sgw.edges[edge] = true
+	sgw.graph.Edges = append(sgw.graph.Edges, &edge)
+	return nil
+}
+
+// serviceGraphNodeID returns the node ID for the description node name.
+// Event source names are JSON encoded values.
+func serviceGraphNodeID(nodeName string) string {
+	return strings.Trim(nodeName, "\"")
+}
+
+// NewServiceGraph returns the topology of the service's Lambda functions,
+// event sources, API and workflow hooks. Nodes and edges are sorted so that
+// the graph is stable across builds.
+func NewServiceGraph(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	workflowHooks *WorkflowHooks) (*ServiceGraph, error) {
+
+	graphWriter := &serviceGraphWriter{
+		graph: &ServiceGraph{
+			Service: serviceName,
+			Nodes:   make([]*ServiceGraphNode, 0),
+			Edges:   make([]*ServiceGraphEdge, 0),
+		},
+		nodes: make(map[string]*ServiceGraphNode),
+		edges: make(map[ServiceGraphEdge]bool),
+	}
+	noIconPath := func(descriptionNode *DescriptionIcon) string {
+		return ""
+	}
+	writeErr := writeServiceDescription(serviceName,
+		lambdaAWSInfos,
+		api,
+		workflowHooks,
+		graphWriter,
+		noIconPath)
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	// Edges may refer to nodes that aren't otherwise described
+	for _, eachEdge := range graphWriter.graph.Edges {
+		for _, eachID := range []string{eachEdge.Source, eachEdge.Target} {
+			_ = graphWriter.writeNodeWithParent(eachID, "", "", "", "")
+		}
+	}
+	graph := graphWriter.graph
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		lhs, rhs := graph.Edges[i], graph.Edges[j]
+		if lhs.Source != rhs.Source {
+			return lhs.Source < rhs.Source
+		}
+		if lhs.Target != rhs.Target {
+			return lhs.Target < rhs.Target
+		}
+		return lhs.Label < rhs.Label
+	})
+	return graph, nil
+}
+
+// children returns the nodes grouped by the parent node ID
+func (graph *ServiceGraph) children() map[string][]*ServiceGraphNode {
+	children := make(map[string][]*ServiceGraphNode)
+	for _, eachNode := range graph.Nodes {
+		children[eachNode.Parent] = append(children[eachNode.Parent], eachNode)
+	}
+	return children
+}
+
+// shortIDs returns the format safe identifier for each node
+func (graph *ServiceGraph) shortIDs() map[string]string {
+	shortIDs := make(map[string]string)
+	for index, eachNode := range graph.Nodes {
+		shortIDs[eachNode.ID] = fmt.Sprintf("n%d", index)
+	}
+	return shortIDs
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart. Parent nodes are
+// written as subgraphs.
+func (graph *ServiceGraph) writeMermaid(writer io.Writer) error {
+	escape := strings.NewReplacer("\"", "#quot;", "\n", " ").Replace
+	shortIDs := graph.shortIDs()
+	children := graph.children()
+
+	var output strings.Builder
+	output.WriteString("flowchart LR\n")
+	var writeNodes func(parentID string, indent string)
+	writeNodes = func(parentID string, indent string) {
+		for _, eachNode := range children[parentID] {
+			if len(children[eachNode.ID]) != 0 {
+				fmt.Fprintf(&output, "%ssubgraph %s[\"%s\"]\n",
+					indent,
+					shortIDs[eachNode.ID],
+					escape(eachNode.ID))
+				writeNodes(eachNode.ID, indent+"  ")
+				fmt.Fprintf(&output, "%send\n", indent)
+				continue
+			}
+			fmt.Fprintf(&output, "%s%s[\"%s\"]\n",
+				indent,
+				shortIDs[eachNode.ID],
+				escape(eachNode.ID))
+		}
+	}
+	writeNodes("", "  ")
+	for _, eachEdge := range graph.Edges {
+		if eachEdge.Label != "" {
+			fmt.Fprintf(&output, "  %s -->|\"%s\"| %s\n",
+				shortIDs[eachEdge.Source],
+				escape(eachEdge.Label),
+				shortIDs[eachEdge.Target])
+		} else {
+			fmt.Fprintf(&output, "  %s --> %s\n",
+				shortIDs[eachEdge.Source],
+				shortIDs[eachEdge.Target])
+		}
+	}
+	_, writeErr := io.WriteString(writer, output.String())
+	return writeErr
+}
+
+// writeDOT writes the graph in the Graphviz DOT language. Parent nodes are
+// written as clusters.
+func (graph *ServiceGraph) writeDOT(writer io.Writer) error {
+	quote := func(value string) string {
+		return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value) + "\""
+	}
+	shortIDs := graph.shortIDs()
+	children := graph.children()
+
+	var output strings.Builder
+	fmt.Fprintf(&output, "digraph %s {\n", quote(graph.Service))
+	output.WriteString("  rankdir=LR;\n")
+	output.WriteString("  node [shape=box];\n")
+	var writeNodes func(parentID string, indent string)
+	writeNodes = func(parentID string, indent string) {
+		for _, eachNode := range children[parentID] {
+			if len(children[eachNode.ID]) != 0 {
+				fmt.Fprintf(&output, "%ssubgraph cluster_%s {\n", indent, shortIDs[eachNode.ID])
+				fmt.Fprintf(&output, "%s  label=%s;\n", indent, quote(eachNode.ID))
+				writeNodes(eachNode.ID, indent+"  ")
+				fmt.Fprintf(&output, "%s}\n", indent)
+				continue
+			}
+			fmt.Fprintf(&output, "%s%s [label=%s];\n",
+				indent,
+				shortIDs[eachNode.ID],
+				quote(eachNode.ID))
+		}
+	}
+	writeNodes("", "  ")
+	for _, eachEdge := range graph.Edges {
+		fmt.Fprintf(&output, "  %s -> %s", shortIDs[eachEdge.Source], shortIDs[eachEdge.Target])
+		if eachEdge.Label != "" {
+			fmt.Fprintf(&output, " [label=%s]", quote(eachEdge.Label))
+		}
+		output.WriteString(";\n")
+	}
+	output.WriteString("}\n")
+	_, writeErr := io.WriteString(writer, output.String())
+	return writeErr
+}
+
+// Write writes the graph to the writer in the mermaid, dot or json format
+func (graph *ServiceGraph) Write(format string, writer io.Writer) error {
+	switch format {
+	case GraphFormatMermaid:
+		return graph.writeMermaid(writer)
+	case GraphFormatDOT:
+		return graph.writeDOT(writer)
+	case GraphFormatJSON:
+		graphBytes, graphBytesErr := json.MarshalIndent(graph, "", "  ")
+		if graphBytesErr != nil {
+			return errors.Wrapf(graphBytesErr, "Failed to marshal service graph")
+		}
+		_, writeErr := fmt.Fprintf(writer, "%s\n", graphBytes)
+		return writeErr
+	default:
+		return errors.Errorf("Unsupported graph format: %s", format)
+	}
+}
+
+// Graph writes the topology of the service in the Mermaid, Graphviz DOT or
+// JSON format. The graph is the same node and edge model that's rendered by
+// `describe`, so that architecture diagrams can be generated from the code.
+func Graph(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	workflowHooks *WorkflowHooks,
+	format string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+
+	graph, graphErr := NewServiceGraph(serviceName, lambdaAWSInfos, api, workflowHooks)
+	if graphErr != nil {
+		return graphErr
+	}
+	logger.Debug().
+		Str("Format", format).
+		Int("Nodes", len(graph.Nodes)).
+		Int("Edges", len(graph.Edges)).
+		Msg("Service graph")
+	return graph.Write(format, outputWriter)
+}
@@ -0,0 +1,66 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	graph, graphErr := NewServiceGraph("SampleService", testLambdaData(), nil, nil)
+	if graphErr != nil {
+		t.Fatalf("Failed to create graph: %s", graphErr)
+	}
+	nodeIDs := make(map[string]bool)
+	for _, eachNode := range graph.Nodes {
+		nodeIDs[eachNode.ID] = true
+	}
+	if !nodeIDs["SampleService"] || !nodeIDs["Lambdas"] {
+		t.Fatalf("Expected service and Lambdas nodes: %#v", nodeIDs)
+	}
+	for _, eachEdge := range graph.Edges {
+		if !nodeIDs[eachEdge.Source] || !nodeIDs[eachEdge.Target] {
+			t.Fatalf("Edge refers to unknown node: %#v", eachEdge)
+		}
+	}
+
+	var mermaid bytes.Buffer
+	writeErr := graph.Write(GraphFormatMermaid, &mermaid)
+	if writeErr != nil ||
+		!strings.HasPrefix(mermaid.String(), "flowchart LR\n") ||
+		!strings.Contains(mermaid.String(), `subgraph n`) ||
+		!strings.Contains(mermaid.String(), " --> ") {
+		t.Fatalf("Unexpected mermaid graph: %s (%v)", mermaid.String(), writeErr)
+	}
+	var dot bytes.Buffer
+	writeErr = graph.Write(GraphFormatDOT, &dot)
+	if writeErr != nil ||
+		!strings.HasPrefix(dot.String(), `digraph "SampleService" {`) ||
+		!strings.Contains(dot.String(), "subgraph cluster_n") ||
+		!strings.Contains(dot.String(), " -> ") {
+		t.Fatalf("Unexpected DOT graph: %s (%v)", dot.String(), writeErr)
+	}
+	var jsonGraph bytes.Buffer
+	writeErr = graph.Write(GraphFormatJSON, &jsonGraph)
+	var decoded ServiceGraph
+	if writeErr != nil ||
+		json.Unmarshal(jsonGraph.Bytes(), &decoded) != nil ||
+		len(decoded.Nodes) != len(graph.Nodes) ||
+		len(decoded.Edges) != len(graph.Edges) {
+		t.Fatalf("Unexpected JSON graph: %s (%v)", jsonGraph.String(), writeErr)
+	}
+	if graph.Write("svg", &jsonGraph) == nil {
+		t.Fatalf("Expected error for unsupported format")
+	}
+
+	// The graph is stable so that it can be checked in
+	stableGraph, _ := NewServiceGraph("SampleService", testLambdaData(), nil, nil)
+	var stableMermaid bytes.Buffer
+	_ = stableGraph.Write(GraphFormatMermaid, &stableMermaid)
+	if stableMermaid.String() != mermaid.String() {
+		t.Fatalf("Expected stable graph output")
+	}
+}
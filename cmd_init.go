@@ -0,0 +1,39 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"github.com/mweagle/Sparta/generator"
+	"github.com/rs/zerolog"
+)
+
+// Init is the command that creates a new service from a project template
+func Init(template string,
+	serviceName string,
+	modulePath string,
+	outputDirectory string,
+	logger *zerolog.Logger) error {
+
+	// The Sparta requirement is left for `go mod tidy` to resolve, since
+	// SpartaVersion isn't necessarily a published module version
+	createdPaths, generateErr := generator.Generate(&generator.Options{
+		ServiceName:     serviceName,
+		Template:        template,
+		ModulePath:      modulePath,
+		OutputDirectory: outputDirectory,
+	}, logger)
+	if generateErr != nil {
+		return generateErr
+	}
+	for _, eachPath := range createdPaths {
+		logger.Info().
+			Str("Path", eachPath).
+			Msg("Created")
+	}
+	logger.Info().
+		Str("ServiceName", serviceName).
+		Str("Template", template).
+		Int("FileCount", len(createdPaths)).
+		Msg("Service created. Run `go mod tidy` in the new directory to resolve the dependencies")
+	return nil
+}
@@ -0,0 +1,324 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// invocationTypes maps the `invoke --type` values to Lambda invocation types
+var invocationTypes = map[string]string{
+	InvocationTypeSync:   lambda.InvocationTypeRequestResponse,
+	InvocationTypeAsync:  lambda.InvocationTypeEvent,
+	InvocationTypeDryRun: lambda.InvocationTypeDryRun,
+}
+
+// InvokeEventTemplates are the built-in event payloads that can be
+// supplied to the `invoke --event` command
+var InvokeEventTemplates = map[string]string{
+	"empty": `{}`,
+	"apigateway": `{
+  "resource": "/",
+  "path": "/",
+  "httpMethod": "GET",
+  "headers": {"Accept": "application/json"},
+  "queryStringParameters": null,
+  "pathParameters": null,
+  "requestContext": {
+    "resourcePath": "/",
+    "httpMethod": "GET",
+    "stage": "v1",
+    "requestId": "c6af9ac6-7b61-11e6-9a41-93e8deadbeef",
+    "identity": {"sourceIp": "127.0.0.1", "userAgent": "Sparta"}
+  },
+  "body": null,
+  "isBase64Encoded": false
+}`,
+	"s3": `{
+  "Records": [{
+    "eventVersion": "2.1",
+    "eventSource": "aws:s3",
+    "awsRegion": "us-west-2",
+    "eventTime": "1970-01-01T00:00:00.000Z",
+    "eventName": "ObjectCreated:Put",
+    "s3": {
+      "s3SchemaVersion": "1.0",
+      "bucket": {"name": "sparta-bucket", "arn": "arn:aws:s3:::sparta-bucket"},
+      "object": {"key": "sparta/object.json", "size": 1024, "eTag": "0123456789abcdef0123456789abcdef"}
+    }
+  }]
+}`,
+	"sns": `{
+  "Records": [{
+    "EventSource": "aws:sns",
+    "EventVersion": "1.0",
+    "EventSubscriptionArn": "arn:aws:sns:us-west-2:123456789012:sparta-topic:2bcfbf39-05c3-41de-beaa-fcfcc21c8f55",
+    "Sns": {
+      "Type": "Notification",
+      "MessageId": "95df01b4-ee98-5cb9-9903-4c221d41eb5e",
+      "TopicArn": "arn:aws:sns:us-west-2:123456789012:sparta-topic",
+      "Subject": "Sparta",
+      "Message": "Hello from SNS",
+      "Timestamp": "1970-01-01T00:00:00.000Z",
+      "MessageAttributes": {}
+    }
+  }]
+}`,
+	"sqs": `{
+  "Records": [{
+    "messageId": "19dd0b57-b21e-4ac1-bd88-01bbb068cb78",
+    "receiptHandle": "MessageReceiptHandle",
+    "body": "Hello from SQS",
+    "attributes": {"ApproximateReceiveCount": "1", "SentTimestamp": "0"},
+    "messageAttributes": {},
+    "eventSource": "aws:sqs",
+    "eventSourceARN": "arn:aws:sqs:us-west-2:123456789012:sparta-queue",
+    "awsRegion": "us-west-2"
+  }]
+}`,
+	"eventbridge": `{
+  "version": "0",
+  "id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+  "detail-type": "Sparta Event",
+  "source": "io.gosparta",
+  "account": "123456789012",
+  "time": "1970-01-01T00:00:00Z",
+  "region": "us-west-2",
+  "resources": [],
+  "detail": {"message": "Hello from EventBridge"}
+}`,
+	"scheduled": `{
+  "version": "0",
+  "id": "89d1a02d-5ec7-412e-82f5-13505f849b41",
+  "detail-type": "Scheduled Event",
+  "source": "aws.events",
+  "account": "123456789012",
+  "time": "1970-01-01T00:00:00Z",
+  "region": "us-west-2",
+  "resources": ["arn:aws:events:us-west-2:123456789012:rule/sparta-schedule"],
+  "detail": {}
+}`,
+	"dynamodb": `{
+  "Records": [{
+    "eventID": "c4ca4238a0b923820dcc509a6f75849b",
+    "eventName": "INSERT",
+    "eventVersion": "1.1",
+    "eventSource": "aws:dynamodb",
+    "awsRegion": "us-west-2",
+    "dynamodb": {
+      "Keys": {"Id": {"N": "101"}},
+      "NewImage": {"Message": {"S": "Hello from DynamoDB"}, "Id": {"N": "101"}},
+      "SequenceNumber": "4421584500000000017450439091",
+      "SizeBytes": 26,
+      "StreamViewType": "NEW_AND_OLD_IMAGES"
+    },
+    "eventSourceARN": "arn:aws:dynamodb:us-west-2:123456789012:table/sparta-table/stream/1970-01-01T00:00:00.000"
+  }]
+}`,
+	"kinesis": `{
+  "Records": [{
+    "kinesis": {
+      "kinesisSchemaVersion": "1.0",
+      "partitionKey": "1",
+      "sequenceNumber": "49590338271490256608559692538361571095921575989136588898",
+      "data": "SGVsbG8gZnJvbSBLaW5lc2lz",
+      "approximateArrivalTimestamp": 0
+    },
+    "eventSource": "aws:kinesis",
+    "eventVersion": "1.0",
+    "eventID": "shardId-000000000006:49590338271490256608559692538361571095921575989136588898",
+    "eventName": "aws:kinesis:record",
+    "awsRegion": "us-west-2",
+    "eventSourceARN": "arn:aws:kinesis:us-west-2:123456789012:stream/sparta-stream"
+  }]
+}`,
+}
+
+// InvokeFunctionError is the error returned by Invoke when the function
+// returns an error
+type InvokeFunctionError struct {
+	// FunctionName is the name of the invoked function
+	FunctionName string
+	// FunctionError is the Lambda FunctionError value: Handled or Unhandled
+	FunctionError string
+	// Payload is the function's error response
+	Payload []byte
+}
+
+func (ife *InvokeFunctionError) Error() string {
+	return fmt.Sprintf("function %s returned an error (%s): %s",
+		ife.FunctionName,
+		ife.FunctionError,
+		strings.TrimSpace(string(ife.Payload)))
+}
+
+// invokePayload returns the event payload from the path, `-` for stdin, or
+// the named InvokeEventTemplates entry. The default payload is an
+// empty JSON object.
+func invokePayload(payloadPath string,
+	eventTemplate string,
+	stdin io.Reader) ([]byte, error) {
+	var payload []byte
+	switch {
+	case payloadPath != "" && eventTemplate != "":
+		return nil, errors.New("Only one of payload and event template may be provided")
+	case payloadPath == "-":
+		stdinPayload, stdinPayloadErr := ioutil.ReadAll(stdin)
+		if stdinPayloadErr != nil {
+			return nil, errors.Wrapf(stdinPayloadErr, "Failed to read payload from stdin")
+		}
+		payload = stdinPayload
+	case payloadPath != "":
+		/* #nosec G304 */
+		filePayload, filePayloadErr := ioutil.ReadFile(payloadPath)
+		if filePayloadErr != nil {
+			return nil, errors.Wrapf(filePayloadErr, "Failed to read payload")
+		}
+		payload = filePayload
+	case eventTemplate != "":
+		templatePayload, templatePayloadExists := InvokeEventTemplates[eventTemplate]
+		if !templatePayloadExists {
+			templateNames := make([]string, 0, len(InvokeEventTemplates))
+			for eachName := range InvokeEventTemplates {
+				templateNames = append(templateNames, eachName)
+			}
+			sort.Strings(templateNames)
+			return nil, errors.Errorf("Unknown event template: %s. Valid templates: %s",
+				eventTemplate,
+				strings.Join(templateNames, ", "))
+		}
+		payload = []byte(templatePayload)
+	default:
+		payload = []byte(InvokeEventTemplates["empty"])
+	}
+	if !json.Valid(payload) {
+		return nil, errors.New("Payload is not valid JSON")
+	}
+	return payload, nil
+}
+
+// invokeFunctionARN returns the ARN of the stack's lambda function with the
+// Sparta function name or logical resource name
+func invokeFunctionARN(stackResources []*cloudformation.StackResource,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string) (string, error) {
+
+	logicalName := functionName
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda.lambdaFunctionName() == functionName {
+			logicalName = eachLambda.LogicalResourceName()
+			break
+		}
+	}
+	functionNames := []string{}
+	for _, eachResource := range stackResources {
+		if aws.StringValue(eachResource.ResourceType) != "AWS::Lambda::Function" {
+			continue
+		}
+		if aws.StringValue(eachResource.LogicalResourceId) == logicalName {
+			return stackLambdaARN(aws.StringValue(eachResource.StackId),
+				aws.StringValue(eachResource.PhysicalResourceId)), nil
+		}
+		functionNames = append(functionNames, aws.StringValue(eachResource.LogicalResourceId))
+	}
+	sort.Strings(functionNames)
+	return "", errors.Errorf("Failed to find function %s in stack. Provisioned functions: %s",
+		functionName,
+		strings.Join(functionNames, ", "))
+}
+
+// Invoke invokes the provisioned lambda function with the payload. The
+// functionName is either the Sparta function name or the logical resource
+// name. Synchronous invocations write the response to stdout and the tail
+// of the function's log output to stderr. Invoke returns an
+// *InvokeFunctionError if the function returns an error.
+func Invoke(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	payload []byte,
+	invocationType string,
+	logger *zerolog.Logger) error {
+
+	lambdaInvocationType, lambdaInvocationTypeExists := invocationTypes[invocationType]
+	if !lambdaInvocationTypeExists {
+		return errors.Errorf("Unsupported invocation type: %s", invocationType)
+	}
+	awsSession := spartaAWS.NewSession(logger)
+	stackResources, stackResourcesErr := spartaCF.StackResources(serviceName, awsSession)
+	if stackResourcesErr != nil {
+		return stackResourcesErr
+	}
+	functionARN, functionARNErr := invokeFunctionARN(stackResources,
+		lambdaAWSInfos,
+		functionName)
+	if functionARNErr != nil {
+		return functionARNErr
+	}
+	logger.Info().
+		Str("Function", functionName).
+		Str("ARN", functionARN).
+		Str("InvocationType", lambdaInvocationType).
+		Msg("Invoking function")
+
+	invokeInput := &lambda.InvokeInput{
+		FunctionName:   aws.String(functionARN),
+		InvocationType: aws.String(lambdaInvocationType),
+		Payload:        payload,
+	}
+	if lambdaInvocationType == lambda.InvocationTypeRequestResponse {
+		invokeInput.LogType = aws.String(lambda.LogTypeTail)
+	}
+	invokeOutput, invokeOutputErr := lambda.New(awsSession).Invoke(invokeInput)
+	if invokeOutputErr != nil {
+		return errors.Wrapf(invokeOutputErr, "Failed to invoke function: %s", functionName)
+	}
+	logEvent := logger.Info().
+		Int64("StatusCode", aws.Int64Value(invokeOutput.StatusCode))
+	if invokeOutput.ExecutedVersion != nil {
+		logEvent = logEvent.Str("ExecutedVersion", *invokeOutput.ExecutedVersion)
+	}
+	logEvent.Msg("Function invoked")
+
+	if invokeOutput.LogResult != nil {
+		logTail, logTailErr := base64.StdEncoding.DecodeString(*invokeOutput.LogResult)
+		if logTailErr != nil {
+			logger.Warn().
+				Err(logTailErr).
+				Msg("Failed to decode log output")
+		} else {
+			fmt.Fprint(os.Stderr, string(logTail))
+		}
+	}
+	if len(invokeOutput.Payload) != 0 {
+		var response bytes.Buffer
+		if json.Indent(&response, invokeOutput.Payload, "", "  ") != nil {
+			response.Reset()
+			response.Write(invokeOutput.Payload)
+		}
+		fmt.Fprintln(os.Stdout, response.String())
+	}
+	if invokeOutput.FunctionError != nil {
+		return &InvokeFunctionError{
+			FunctionName:  functionName,
+			FunctionError: *invokeOutput.FunctionError,
+			Payload:       invokeOutput.Payload,
+		}
+	}
+	return nil
+}
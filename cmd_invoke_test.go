@@ -0,0 +1,75 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestInvokePayload(t *testing.T) {
+	for eachName, eachTemplate := range InvokeEventTemplates {
+		if !json.Valid([]byte(eachTemplate)) {
+			t.Fatalf("Invalid event template: %s", eachName)
+		}
+	}
+	payload, payloadErr := invokePayload("", "", nil)
+	if payloadErr != nil || string(payload) != "{}" {
+		t.Fatalf("Unexpected default payload: %s (%v)", payload, payloadErr)
+	}
+	payload, payloadErr = invokePayload("-", "", strings.NewReader(`{"hello":"world"}`))
+	if payloadErr != nil || string(payload) != `{"hello":"world"}` {
+		t.Fatalf("Unexpected stdin payload: %s (%v)", payload, payloadErr)
+	}
+	payloadFile, _ := ioutil.TempFile("", "sparta-invoke")
+	defer os.Remove(payloadFile.Name())
+	_, _ = payloadFile.WriteString(`{"file":true}`)
+	payloadFile.Close()
+	payload, payloadErr = invokePayload(payloadFile.Name(), "", nil)
+	if payloadErr != nil || string(payload) != `{"file":true}` {
+		t.Fatalf("Unexpected file payload: %s (%v)", payload, payloadErr)
+	}
+	_, payloadErr = invokePayload("-", "", strings.NewReader("not json"))
+	if payloadErr == nil {
+		t.Fatalf("Expected error for invalid JSON payload")
+	}
+	_, payloadErr = invokePayload("", "unknown", nil)
+	if payloadErr == nil {
+		t.Fatalf("Expected error for unknown event template")
+	}
+	_, payloadErr = invokePayload("-", "sqs", nil)
+	if payloadErr == nil {
+		t.Fatalf("Expected error for multiple payload sources")
+	}
+}
+
+func TestInvokeFunctionARN(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("invokeLambda", userDefinedCustomResource1, IAMRoleDefinition{})
+	stackResources := []*cloudformation.StackResource{
+		{
+			StackId:            aws.String("arn:aws:cloudformation:us-west-2:123412341234:stack/MyStack/54339e80"),
+			LogicalResourceId:  aws.String(lambdaFn.LogicalResourceName()),
+			PhysicalResourceId: aws.String("MyStack_invokeLambda"),
+			ResourceType:       aws.String("AWS::Lambda::Function"),
+		},
+	}
+	functionARN, functionARNErr := invokeFunctionARN(stackResources,
+		[]*LambdaAWSInfo{lambdaFn},
+		"invokeLambda")
+	if functionARNErr != nil ||
+		functionARN != "arn:aws:lambda:us-west-2:123412341234:function:MyStack_invokeLambda" {
+		t.Fatalf("Unexpected function ARN: %s (%v)", functionARN, functionARNErr)
+	}
+	_, functionARNErr = invokeFunctionARN(stackResources,
+		[]*LambdaAWSInfo{lambdaFn},
+		"missingLambda")
+	if functionARNErr == nil {
+		t.Fatalf("Expected error for missing function")
+	}
+}
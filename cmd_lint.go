@@ -0,0 +1,54 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/mweagle/Sparta/validator/lint"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Lint is the command that evaluates the built-in lint rules against the
+// service's CloudFormation template and any nested stack templates. The
+// report is written in the text, json or sarif format and an error is
+// returned if there is a finding at least as severe as failOn.
+func Lint(serviceName string,
+	templatePath string,
+	format string,
+	failOn string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+
+	rawTemplate, rawTemplateErr := readTemplateWithNestedResources(templatePath)
+	if rawTemplateErr != nil {
+		return rawTemplateErr
+	}
+	templateBytes, templateBytesErr := json.Marshal(rawTemplate)
+	if templateBytesErr != nil {
+		return errors.Wrapf(templateBytesErr, "Failed to marshal template: %s", templatePath)
+	}
+	template, templateErr := lint.ParseTemplate(templateBytes)
+	if templateErr != nil {
+		return templateErr
+	}
+	report := lint.Lint(template)
+	writeErr := report.Write(format, outputWriter)
+	if writeErr != nil {
+		return writeErr
+	}
+	logger.Info().
+		Str("ServiceName", serviceName).
+		Int("Errors", report.Count(lint.SeverityError)).
+		Int("Warnings", report.Count(lint.SeverityWarning)).
+		Int("Notes", report.Count(lint.SeverityNote)).
+		Int("Suppressed", len(report.Suppressed)).
+		Msg("Template lint complete")
+
+	if report.Failed(lint.Severity(failOn)) {
+		return errors.Errorf("Template failed lint rules: %s", report.Summary())
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	spartaCWLogs "github.com/mweagle/Sparta/aws/cloudwatch/logs"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// defaultLogsQueryDuration is the query window used when only one of the
+// start and end times is provided
+const defaultLogsQueryDuration = time.Hour
+
+// LogsQueryTemplates are the named CloudWatch Logs Insights queries that
+// can be supplied to the `logs --query` command
+var LogsQueryTemplates = map[string]string{
+	"errors": `fields @timestamp, @log, @message
+| filter level = "error" or @message like /(?i)(panic|task timed out)/
+| sort @timestamp desc
+| limit 100`,
+	"coldstarts": `filter @type = "REPORT" and ispresent(@initDuration)
+| stats count(*) as coldStarts, avg(@initDuration) as avgInitDuration, max(@initDuration) as maxInitDuration by @log`,
+	"duration": `filter @type = "REPORT"
+| stats avg(@duration) as avgDuration, max(@duration) as maxDuration, pct(@duration, 99) as p99Duration by @log`,
+	"memory": `filter @type = "REPORT"
+| stats max(@memorySize / 1000 / 1000) as provisionedMB, max(@maxMemoryUsed / 1000 / 1000) as maxUsedMB by @log`,
+}
+
+// logsColors are the ANSI colors used for the function name prefixes
+var logsColors = []string{
+	"\x1b[36m",
+	"\x1b[33m",
+	"\x1b[35m",
+	"\x1b[32m",
+	"\x1b[34m",
+	"\x1b[91m",
+}
+
+const logsColorReset = "\x1b[0m"
+
+// logsFunction is a provisioned lambda function whose logs are included
+type logsFunction struct {
+	name         string
+	logGroupName string
+	color        string
+}
+
+// parseLogsTime parses either an RFC3339 timestamp or a duration, relative
+// to now, such as `15m`. Empty values return the zero time.
+func parseLogsTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	duration, durationErr := time.ParseDuration(value)
+	if durationErr == nil {
+		if duration < 0 {
+			duration = -duration
+		}
+		return now.Add(-duration), nil
+	}
+	timestamp, timestampErr := time.Parse(time.RFC3339, value)
+	if timestampErr != nil {
+		return time.Time{}, errors.Errorf("Invalid time %s. Use a duration (eg: 15m) or an RFC3339 timestamp", value)
+	}
+	return timestamp, nil
+}
+
+// logsQueryString returns the Insights query for the named template or
+// literal query, optionally limited to a single request
+func logsQueryString(query string, requestID string) string {
+	queryString, queryTemplateExists := LogsQueryTemplates[query]
+	if !queryTemplateExists {
+		queryString = query
+	}
+	if requestID != "" {
+		queryString = fmt.Sprintf("filter @requestId = %q or %s = %q\n| %s",
+			requestID,
+			LogFieldRequestID,
+			requestID,
+			queryString)
+	}
+	return queryString
+}
+
+// logsFunctions returns the stack's lambda functions that match the
+// optional function names
+func logsFunctions(stackResources []*cloudformation.StackResource,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionNames []string) []*logsFunction {
+
+	displayNames := make(map[string]string)
+	for _, eachLambda := range lambdaAWSInfos {
+		displayNames[eachLambda.LogicalResourceName()] = eachLambda.lambdaFunctionName()
+	}
+	functions := []*logsFunction{}
+	for _, eachResource := range stackResources {
+		if aws.StringValue(eachResource.ResourceType) != "AWS::Lambda::Function" {
+			continue
+		}
+		logicalName := aws.StringValue(eachResource.LogicalResourceId)
+		displayName, displayNameExists := displayNames[logicalName]
+		if !displayNameExists {
+			displayName = logicalName
+		}
+		included := len(functionNames) == 0
+		for _, eachName := range functionNames {
+			if eachName == displayName || eachName == logicalName {
+				included = true
+			}
+		}
+		if !included {
+			continue
+		}
+		functions = append(functions, &logsFunction{
+			name: displayName,
+			logGroupName: fmt.Sprintf("/aws/lambda/%s",
+				aws.StringValue(eachResource.PhysicalResourceId)),
+		})
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].name < functions[j].name
+	})
+	for eachIndex, eachFunction := range functions {
+		eachFunction.color = logsColors[eachIndex%len(logsColors)]
+	}
+	return functions
+}
+
+// logsPrinter writes log events from multiple functions to a single
+// output
+type logsPrinter struct {
+	writer        io.Writer
+	jsonFormat    bool
+	disableColors bool
+	mu            sync.Mutex
+}
+
+func (lp *logsPrinter) print(function *logsFunction, event *cloudwatchlogs.FilteredLogEvent) error {
+	message := strings.TrimRight(aws.StringValue(event.Message), "\r\n")
+	timestamp := time.Unix(0, aws.Int64Value(event.Timestamp)*int64(time.Millisecond)).UTC()
+
+	var output string
+	if lp.jsonFormat {
+		// Our zerolog JSON output is emitted as-is. Other lines, like the
+		// START and REPORT lines, are wrapped.
+		trimmed := strings.TrimSpace(message)
+		if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+			output = trimmed
+		} else {
+			jsonBytes, jsonBytesErr := json.Marshal(map[string]string{
+				"function": function.name,
+				"time":     timestamp.Format(time.RFC3339Nano),
+				"message":  message,
+			})
+			if jsonBytesErr != nil {
+				return jsonBytesErr
+			}
+			output = string(jsonBytes)
+		}
+	} else {
+		prefix := fmt.Sprintf("[%s]", function.name)
+		if !lp.disableColors {
+			prefix = function.color + prefix + logsColorReset
+		}
+		output = fmt.Sprintf("%s %s %s",
+			prefix,
+			timestamp.Format(time.RFC3339),
+			strings.TrimSpace(message))
+	}
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	_, writeErr := fmt.Fprintln(lp.writer, output)
+	return writeErr
+}
+
+func (lp *logsPrinter) printQueryResult(row []*cloudwatchlogs.ResultField) error {
+	var output string
+	if lp.jsonFormat {
+		rowMap := make(map[string]string)
+		for _, eachField := range row {
+			rowMap[aws.StringValue(eachField.Field)] = aws.StringValue(eachField.Value)
+		}
+		delete(rowMap, "@ptr")
+		jsonBytes, jsonBytesErr := json.Marshal(rowMap)
+		if jsonBytesErr != nil {
+			return jsonBytesErr
+		}
+		output = string(jsonBytes)
+	} else {
+		fields := []string{}
+		for _, eachField := range row {
+			if aws.StringValue(eachField.Field) == "@ptr" {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s=%s",
+				aws.StringValue(eachField.Field),
+				strings.TrimSpace(aws.StringValue(eachField.Value))))
+		}
+		output = strings.Join(fields, " ")
+	}
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	_, writeErr := fmt.Fprintln(lp.writer, output)
+	return writeErr
+}
+
+// Logs writes the CloudWatch log events of the service's lambda functions
+// to stdout. Events are prefixed with the function name. If endTime is zero,
+// new events are tailed until the process is interrupted. If query is
+// nonempty, the named LogsQueryTemplates entry or the literal CloudWatch
+// Logs Insights query is run across the functions' log groups instead.
+func Logs(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionNames []string,
+	startTime time.Time,
+	endTime time.Time,
+	filterPattern string,
+	requestID string,
+	query string,
+	jsonFormat bool,
+	disableColors bool,
+	logger *zerolog.Logger) error {
+
+	awsSession := spartaAWS.NewSession(logger)
+	stackResources, stackResourcesErr := spartaCF.StackResources(serviceName, awsSession)
+	if stackResourcesErr != nil {
+		return stackResourcesErr
+	}
+	functions := logsFunctions(stackResources,
+		lambdaAWSInfos,
+		functionNames)
+	if len(functions) == 0 {
+		return errors.Errorf("No lambda functions found in stack %s matching: %s",
+			serviceName,
+			strings.Join(functionNames, ", "))
+	}
+	printer := &logsPrinter{
+		writer:        os.Stdout,
+		jsonFormat:    jsonFormat,
+		disableColors: disableColors,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	go func() {
+		select {
+		case <-signalChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Insights query
+	if query != "" {
+		if endTime.IsZero() {
+			endTime = time.Now()
+		}
+		if startTime.IsZero() {
+			startTime = endTime.Add(-defaultLogsQueryDuration)
+		}
+		logGroupNames := make([]string, len(functions))
+		for eachIndex, eachFunction := range functions {
+			logGroupNames[eachIndex] = eachFunction.logGroupName
+		}
+		queryString := logsQueryString(query, requestID)
+		logger.Info().
+			Strs("LogGroups", logGroupNames).
+			Str("Start", startTime.UTC().Format(time.RFC3339)).
+			Str("End", endTime.UTC().Format(time.RFC3339)).
+			Str("Query", queryString).
+			Msg("Running CloudWatch Logs Insights query")
+		results, resultsErr := spartaCWLogs.QueryWithContext(ctx,
+			awsSession,
+			logGroupNames,
+			queryString,
+			startTime,
+			endTime,
+			logger)
+		if resultsErr != nil {
+			return resultsErr
+		}
+		for _, eachRow := range results {
+			printErr := printer.printQueryResult(eachRow)
+			if printErr != nil {
+				return printErr
+			}
+		}
+		return nil
+	}
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Tail or filter
+	if !endTime.IsZero() && startTime.IsZero() {
+		startTime = endTime.Add(-defaultLogsQueryDuration)
+	}
+	tailOptions := spartaCWLogs.TailOptions{
+		FilterPattern: filterPattern,
+		StartTime:     startTime,
+		EndTime:       endTime,
+	}
+	for _, eachFunction := range functions {
+		logger.Info().
+			Str("Function", eachFunction.name).
+			Str("LogGroup", eachFunction.logGroupName).
+			Msg("Reading log events")
+	}
+	closeChan := make(chan bool)
+	defer close(closeChan)
+
+	var wg sync.WaitGroup
+	for _, eachFunction := range functions {
+		wg.Add(1)
+		messages := spartaCWLogs.TailWithOptions(ctx,
+			closeChan,
+			awsSession,
+			eachFunction.logGroupName,
+			tailOptions,
+			logger)
+		go func(function *logsFunction) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, eventOk := <-messages:
+					if !eventOk {
+						return
+					}
+					if requestID != "" &&
+						!strings.Contains(aws.StringValue(event.Message), requestID) {
+						continue
+					}
+					printErr := printer.print(function, event)
+					if printErr != nil {
+						logger.Warn().
+							Err(printErr).
+							Msg("Failed to write log event")
+					}
+				}
+			}
+		}(eachFunction)
+	}
+	wg.Wait()
+	return nil
+}
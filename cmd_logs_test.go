@@ -0,0 +1,96 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestParseLogsTime(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	since, sinceErr := parseLogsTime("15m", now)
+	if sinceErr != nil || !since.Equal(now.Add(-15*time.Minute)) {
+		t.Fatalf("Unexpected duration time: %s (%v)", since, sinceErr)
+	}
+	until, untilErr := parseLogsTime("2021-06-01T11:00:00Z", now)
+	if untilErr != nil || !until.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("Unexpected timestamp time: %s (%v)", until, untilErr)
+	}
+	empty, emptyErr := parseLogsTime("", now)
+	if emptyErr != nil || !empty.IsZero() {
+		t.Fatalf("Expected zero time for empty value")
+	}
+	_, invalidErr := parseLogsTime("yesterday", now)
+	if invalidErr == nil {
+		t.Fatalf("Expected error for invalid time")
+	}
+}
+
+func TestLogsFunctions(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("logsLambda", userDefinedCustomResource1, IAMRoleDefinition{})
+	stackResources := []*cloudformation.StackResource{
+		{
+			LogicalResourceId:  aws.String(lambdaFn.LogicalResourceName()),
+			PhysicalResourceId: aws.String("MyStack_logsLambda"),
+			ResourceType:       aws.String("AWS::Lambda::Function"),
+		},
+		{
+			LogicalResourceId:  aws.String("CustomResourceHandler"),
+			PhysicalResourceId: aws.String("MyStack-CustomResourceHandler"),
+			ResourceType:       aws.String("AWS::Lambda::Function"),
+		},
+		{
+			LogicalResourceId:  aws.String("Bucket"),
+			PhysicalResourceId: aws.String("my-bucket"),
+			ResourceType:       aws.String("AWS::S3::Bucket"),
+		},
+	}
+	functions := logsFunctions(stackResources, []*LambdaAWSInfo{lambdaFn}, nil)
+	if len(functions) != 2 {
+		t.Fatalf("Expected two functions: %#v", functions)
+	}
+	functions = logsFunctions(stackResources, []*LambdaAWSInfo{lambdaFn}, []string{"logsLambda"})
+	if len(functions) != 1 ||
+		functions[0].logGroupName != "/aws/lambda/MyStack_logsLambda" {
+		t.Fatalf("Unexpected filtered functions: %#v", functions)
+	}
+
+	var output bytes.Buffer
+	printer := &logsPrinter{
+		writer:     &output,
+		jsonFormat: true,
+	}
+	zerologLine := `{"level":"info","reqID":"abc","message":"Hello"}`
+	_ = printer.print(functions[0], &cloudwatchlogs.FilteredLogEvent{
+		Message:   aws.String(zerologLine + "\n"),
+		Timestamp: aws.Int64(0),
+	})
+	_ = printer.print(functions[0], &cloudwatchlogs.FilteredLogEvent{
+		Message:   aws.String("START RequestId: abc Version: $LATEST\n"),
+		Timestamp: aws.Int64(0),
+	})
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 ||
+		lines[0] != zerologLine ||
+		!strings.Contains(lines[1], `"function":"logsLambda"`) {
+		t.Fatalf("Unexpected JSON output: %s", output.String())
+	}
+}
+
+func TestLogsQueryString(t *testing.T) {
+	if logsQueryString("errors", "") != LogsQueryTemplates["errors"] {
+		t.Fatalf("Expected template query")
+	}
+	query := logsQueryString("fields @message", "abc")
+	if !strings.HasPrefix(query, `filter @requestId = "abc" or reqID = "abc"`) ||
+		!strings.HasSuffix(query, "| fields @message") {
+		t.Fatalf("Unexpected request ID query: %s", query)
+	}
+}
@@ -0,0 +1,178 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// buildTemplateSuffix is the suffix of the template written by Build
+const buildTemplateSuffix = "-cftemplate.json"
+
+// buildTemplatePath returns the path to the template in a previous build's
+// output directory. The serviceName's template is preferred, otherwise the
+// directory must have a single template s.t. an artifact built for one
+// stage can be provisioned to another one.
+func buildTemplatePath(buildDir string, serviceName string) (string, error) {
+	servicePath := filepath.Join(buildDir,
+		fmt.Sprintf("%s%s", sanitizedName(serviceName), buildTemplateSuffix))
+	_, statErr := os.Stat(servicePath)
+	if statErr == nil {
+		return servicePath, nil
+	}
+	matches, matchesErr := filepath.Glob(filepath.Join(buildDir, "*"+buildTemplateSuffix))
+	if matchesErr != nil {
+		return "", errors.Wrapf(matchesErr, "Failed to find template in build directory: %s", buildDir)
+	}
+	switch len(matches) {
+	case 0:
+		return "", errors.Errorf("Build directory %s doesn't contain a template (*%s)",
+			buildDir,
+			buildTemplateSuffix)
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", errors.Errorf("Build directory %s contains multiple templates: [%s]",
+		buildDir,
+		strings.Join(matches, ", "))
+}
+
+// promotedTemplateOutputFile returns the file for the promoted template. It's
+// distinct from the build template s.t. the build directory can be the
+// output directory.
+func promotedTemplateOutputFile(outputDir string, serviceName string) (*os.File, error) {
+	mkdirErr := os.MkdirAll(outputDir, os.ModePerm)
+	if nil != mkdirErr {
+		return nil, errors.Wrapf(mkdirErr, "Attempting to create output directory: %s", outputDir)
+	}
+	return os.Create(filepath.Join(outputDir,
+		fmt.Sprintf("%s-promoted.json", sanitizedName(serviceName))))
+}
+
+// PromoteBuild prepares the template produced by an earlier `build` for
+// provisioning. The template, code archive and S3 site archive are read from
+// buildDir, which may have been copied from another machine. The promoted
+// template is written to templateWriter with:
+//
+//   - The archive and nested stack template paths resolved to the files in
+//     buildDir
+//   - The ServiceName metadata set to serviceName s.t. the same artifact can
+//     be provisioned as a different stack (eg, staging then prod)
+//   - The Stage output set to the stage, if any
+//
+// The returned value is the BuildID of the earlier build. Resources that are
+// named at build time, such as the API Gateway name, are unchanged.
+func PromoteBuild(buildDir string,
+	serviceName string,
+	stage string,
+	templateWriter io.Writer,
+	logger *zerolog.Logger) (string, error) {
+
+	templatePath, templatePathErr := buildTemplatePath(buildDir, serviceName)
+	if templatePathErr != nil {
+		return "", templatePathErr
+	}
+	/* #nosec G304 */
+	templateBytes, templateBytesErr := ioutil.ReadFile(templatePath)
+	if templateBytesErr != nil {
+		return "", errors.Wrapf(templateBytesErr, "Failed to read template: %s", templatePath)
+	}
+	// Preserve the numeric values s.t. the promoted template is unchanged
+	// other than the updated properties
+	var template map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(templateBytes))
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(&template)
+	if decodeErr != nil {
+		return "", errors.Wrapf(decodeErr, "Failed to parse template: %s", templatePath)
+	}
+	metadata, _ := template["Metadata"].(map[string]interface{})
+	if metadata == nil {
+		return "", errors.Errorf("Template %s doesn't include Sparta build metadata", templatePath)
+	}
+	builtServiceName, _ := metadata[MetadataParamServiceName].(string)
+	if builtServiceName == "" {
+		return "", errors.Errorf("Template %s doesn't include the %s metadata",
+			templatePath,
+			MetadataParamServiceName)
+	}
+
+	// The archives are always read from the build directory
+	for _, eachKey := range []string{MetadataParamCodeArchivePath, MetadataParamS3SiteArchivePath} {
+		archivePath, _ := metadata[eachKey].(string)
+		if archivePath == "" {
+			continue
+		}
+		buildArchivePath := filepath.Join(buildDir, filepath.Base(archivePath))
+		_, statErr := os.Stat(buildArchivePath)
+		if statErr != nil {
+			return "", errors.Wrapf(statErr, "Failed to find build artifact: %s", buildArchivePath)
+		}
+		metadata[eachKey] = buildArchivePath
+	}
+	// As are the nested stack templates
+	if nestedTemplates, nestedTemplatesOk := metadata[MetadataParamNestedTemplates].(map[string]interface{}); nestedTemplatesOk {
+		for eachStackID, eachPath := range nestedTemplates {
+			nestedPath, _ := eachPath.(string)
+			buildNestedPath := filepath.Join(buildDir, filepath.Base(nestedPath))
+			_, statErr := os.Stat(buildNestedPath)
+			if statErr != nil {
+				return "", errors.Wrapf(statErr, "Failed to find nested stack template: %s", buildNestedPath)
+			}
+			nestedTemplates[eachStackID] = buildNestedPath
+		}
+	}
+	metadata[MetadataParamServiceName] = serviceName
+
+	// Build info
+	buildID := ""
+	outputs, _ := template["Outputs"].(map[string]interface{})
+	if outputs == nil {
+		outputs = make(map[string]interface{})
+		template["Outputs"] = outputs
+	}
+	if buildIDOutput, buildIDOutputOk := outputs[StackOutputBuildID].(map[string]interface{}); buildIDOutputOk {
+		buildID, _ = buildIDOutput["Value"].(string)
+	}
+	if stage != "" {
+		outputs[StackOutputStage] = map[string]interface{}{
+			"Description": "Stage",
+			"Value":       stage,
+		}
+	} else {
+		delete(outputs, StackOutputStage)
+	}
+	if ecrTag, _ := metadata[MetadataParamECRTag].(string); ecrTag != "" {
+		logger.Info().
+			Str("ECRTag", ecrTag).
+			Msg("Build uses a locally tagged image which must exist on this machine")
+	}
+
+	promotedBytes, promotedBytesErr := json.MarshalIndent(template, "", " ")
+	if promotedBytesErr != nil {
+		return "", errors.Wrapf(promotedBytesErr, "Failed to marshal promoted template")
+	}
+	_, writeErr := templateWriter.Write(promotedBytes)
+	if writeErr != nil {
+		return "", errors.Wrapf(writeErr, "Failed to write promoted template")
+	}
+	logger.Info().
+		Str("Template", templatePath).
+		Str("BuildServiceName", builtServiceName).
+		Str("ServiceName", serviceName).
+		Str("BuildID", buildID).
+		Msg("Provisioning previous build")
+	return buildID, nil
+}
@@ -0,0 +1,99 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+const promoteTestTemplate = `{
+  "Metadata": {
+    "ServiceName": "MyService-staging",
+    "CodeArchivePath": "/home/ci/project/.sparta/MyService_staging-code.zip",
+    "ArtifactS3Bucket": "staging-bucket"
+  },
+  "Resources": {
+    "Alarm": {
+      "Type": "AWS::CloudWatch::Alarm",
+      "Properties": {"Threshold": 9007199254740993, "EvaluationPeriods": 1}
+    }
+  },
+  "Outputs": {
+    "BuildID": {"Description": "BuildID", "Value": "abc123"},
+    "Stage": {"Description": "Stage", "Value": "staging"}
+  }
+}`
+
+func TestPromoteBuild(t *testing.T) {
+	buildDir, buildDirErr := ioutil.TempDir("", "sparta-promote")
+	if buildDirErr != nil {
+		t.Fatal(buildDirErr)
+	}
+	defer os.RemoveAll(buildDir)
+	logger := zerolog.New(ioutil.Discard)
+
+	var output bytes.Buffer
+	_, missingErr := PromoteBuild(buildDir, "MyService-prod", "prod", &output, &logger)
+	if missingErr == nil {
+		t.Fatalf("Expected error for empty build directory")
+	}
+	writeErr := ioutil.WriteFile(filepath.Join(buildDir, "MyService_staging-cftemplate.json"),
+		[]byte(promoteTestTemplate),
+		0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	_, missingErr = PromoteBuild(buildDir, "MyService-prod", "prod", &output, &logger)
+	if missingErr == nil {
+		t.Fatalf("Expected error for missing code archive")
+	}
+	codeArchivePath := filepath.Join(buildDir, "MyService_staging-code.zip")
+	writeErr = ioutil.WriteFile(codeArchivePath, []byte("zip"), 0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	buildID, promoteErr := PromoteBuild(buildDir, "MyService-prod", "prod", &output, &logger)
+	if promoteErr != nil {
+		t.Fatal(promoteErr)
+	}
+	if buildID != "abc123" {
+		t.Fatalf("Expected build ID abc123. Found: %s", buildID)
+	}
+	var promoted struct {
+		Metadata map[string]string
+		Outputs  map[string]map[string]string
+	}
+	unmarshalErr := json.Unmarshal(output.Bytes(), &promoted)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	if promoted.Metadata[MetadataParamServiceName] != "MyService-prod" ||
+		promoted.Metadata[MetadataParamCodeArchivePath] != codeArchivePath ||
+		promoted.Outputs[StackOutputStage]["Value"] != "prod" ||
+		promoted.Outputs[StackOutputBuildID]["Value"] != "abc123" {
+		t.Fatalf("Unexpected promoted template: %s", output.String())
+	}
+	if !bytes.Contains(output.Bytes(), []byte(`"Threshold": 9007199254740993`)) {
+		t.Fatalf("Promoted template didn't preserve numeric values: %s", output.String())
+	}
+
+	// Ambiguous build directory
+	writeErr = ioutil.WriteFile(filepath.Join(buildDir, "OtherService-cftemplate.json"),
+		[]byte(promoteTestTemplate),
+		0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	_, ambiguousErr := PromoteBuild(buildDir, "MyService-prod", "prod", &output, &logger)
+	if ambiguousErr == nil {
+		t.Fatalf("Expected error for multiple build templates")
+	}
+}
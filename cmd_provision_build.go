@@ -239,6 +239,30 @@ func uploadLocalFileToS3(awsSession *session.Session,
 	return s3URL, nil
 }
 
+// provisionedStackParameters returns the parameter values of the provisioned
+// stack. The map is empty if the stack doesn't exist.
+func provisionedStackParameters(serviceName string,
+	awsSession *session.Session,
+	logger *zerolog.Logger) (map[string]string, error) {
+	stackParams := map[string]string{}
+	stackExists, stackExistsErr := spartaCF.StackExists(serviceName, awsSession, logger)
+	if stackExistsErr != nil || !stackExists {
+		return stackParams, stackExistsErr
+	}
+	describeStackOutput, describeStackOutputErr := cloudformation.New(awsSession).DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if describeStackOutputErr != nil {
+		return nil, describeStackOutputErr
+	}
+	for _, eachStack := range describeStackOutput.Stacks {
+		for _, eachParam := range eachStack.Parameters {
+			stackParams[aws.StringValue(eachParam.ParameterKey)] = aws.StringValue(eachParam.ParameterValue)
+		}
+	}
+	return stackParams, nil
+}
+
 // Private - END
 ////////////////////////////////////////////////////////////////////////////////
 
@@ -257,6 +281,28 @@ func (pwo *provisionWorkflowOp) MetadataString(keyName string) (string, error) {
 	return reader.AsString(keyName)
 }
 
+// nestedTemplates returns the map of nested stack logical IDs to the local
+// template paths
+func (pwo *provisionWorkflowOp) nestedTemplates() (map[string]string, error) {
+	nestedTemplates := make(map[string]string)
+	metadataValue, metadataValueExists := pwo.provisionContext.cfTemplate.Metadata[MetadataParamNestedTemplates]
+	if !metadataValueExists {
+		return nestedTemplates, nil
+	}
+	typedMetadataValue, typedMetadataValueOk := metadataValue.(map[string]interface{})
+	if !typedMetadataValueOk {
+		return nil, errors.Errorf("Failed to convert %s metadata %#v to map", MetadataParamNestedTemplates, metadataValue)
+	}
+	for eachStackID, eachPath := range typedMetadataValue {
+		typedPath, typedPathOk := eachPath.(string)
+		if !typedPathOk {
+			return nil, errors.Errorf("Failed to convert %s template path %#v to string", eachStackID, eachPath)
+		}
+		nestedTemplates[eachStackID] = typedPath
+	}
+	return nestedTemplates, nil
+}
+
 func (pwo *provisionWorkflowOp) s3Bucket() string {
 	s3ParamBucketName, s3ParamBucketNameExists := pwo.provisionContext.stackParameterValues[StackParamArtifactBucketName]
 	if !s3ParamBucketNameExists {
@@ -325,57 +371,75 @@ func (eppo *ensureProvisionPreconditionsOp) Invoke(ctx context.Context, logger *
 			Str("Region", *eppo.provisionContext.awsSession.Config.Region).
 			Msg(noopMessage("S3 preconditions check"))
 	} else if len(s3BucketName) != 0 {
-		// Bucket region should match target
-		/*
-			The name of the Amazon S3 bucket where the .zip file that contains your deployment package is stored. This bucket must reside in the same AWS Region that you're creating the Lambda function in. You can specify a bucket from another AWS account as long as the Lambda function and the bucket are in the same region.
-		*/
-		bucketRegion, bucketRegionErr := spartaS3.BucketRegion(eppo.provisionContext.awsSession,
+		isEnabled, bucketErr := verifyS3BucketPreconditions(eppo.provisionContext.awsSession,
 			s3BucketName,
 			logger)
-
-		if bucketRegionErr != nil {
-			return errors.Wrap(bucketRegionErr,
-				fmt.Sprintf("Checking S3 bucket <%s>", s3BucketName))
-		}
-		logger.Info().
-			Str("Bucket", s3BucketName).
-			Str("Region", bucketRegion).
-			Str("CredentialsRegion", *eppo.provisionContext.awsSession.Config.Region).
-			Msg("Checking S3 region")
-		if bucketRegion != *eppo.provisionContext.awsSession.Config.Region {
-			return fmt.Errorf("region (%s) does not match bucket region (%s)",
-				*eppo.provisionContext.awsSession.Config.Region,
-				bucketRegion)
+		if bucketErr != nil {
+			return bucketErr
 		}
-		// Check versioning
-		// Get the S3 bucket and see if it has versioning enabled
-		isEnabled, versioningPolicyErr := spartaS3.BucketVersioningEnabled(eppo.provisionContext.awsSession,
-			s3BucketName,
-			logger)
-		// If this is an error and suggests missing region, output some helpful error text
-		if nil != versioningPolicyErr {
-			return versioningPolicyErr
-		}
-		logger.Info().
-			Bool("VersioningEnabled", isEnabled).
-			Str("Bucket", s3BucketName).
-			Str("Region", *eppo.provisionContext.awsSession.Config.Region).
-			Msg("Checking S3 versioning policy")
 		eppo.provisionContext.isVersionAwareBucket = isEnabled
-
-		// Nothing else to do...
-		logger.Debug().
-			Str("Region", bucketRegion).
-			Msg("Confirmed S3 region match")
 	}
 	return nil
 }
 
+// verifyS3BucketPreconditions ensures that the artifact bucket is in the
+// same region as the session and returns whether versioning is enabled
+func verifyS3BucketPreconditions(awsSession *session.Session,
+	s3BucketName string,
+	logger *zerolog.Logger) (bool, error) {
+	// Bucket region should match target
+	/*
+		The name of the Amazon S3 bucket where the .zip file that contains your deployment package is stored. This bucket must reside in the same AWS Region that you're creating the Lambda function in. You can specify a bucket from another AWS account as long as the Lambda function and the bucket are in the same region.
+	*/
+	bucketRegion, bucketRegionErr := spartaS3.BucketRegion(awsSession,
+		s3BucketName,
+		logger)
+
+	if bucketRegionErr != nil {
+		return false, errors.Wrap(bucketRegionErr,
+			fmt.Sprintf("Checking S3 bucket <%s>", s3BucketName))
+	}
+	logger.Info().
+		Str("Bucket", s3BucketName).
+		Str("Region", bucketRegion).
+		Str("CredentialsRegion", aws.StringValue(awsSession.Config.Region)).
+		Msg("Checking S3 region")
+	if bucketRegion != aws.StringValue(awsSession.Config.Region) {
+		return false, fmt.Errorf("region (%s) does not match bucket region (%s)",
+			aws.StringValue(awsSession.Config.Region),
+			bucketRegion)
+	}
+	// Check versioning
+	// Get the S3 bucket and see if it has versioning enabled
+	isEnabled, versioningPolicyErr := spartaS3.BucketVersioningEnabled(awsSession,
+		s3BucketName,
+		logger)
+	// If this is an error and suggests missing region, output some helpful error text
+	if nil != versioningPolicyErr {
+		return false, versioningPolicyErr
+	}
+	logger.Info().
+		Bool("VersioningEnabled", isEnabled).
+		Str("Bucket", s3BucketName).
+		Str("Region", aws.StringValue(awsSession.Config.Region)).
+		Msg("Checking S3 versioning policy")
+
+	// Nothing else to do...
+	logger.Debug().
+		Str("Region", bucketRegion).
+		Msg("Confirmed S3 region match")
+	return isEnabled, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // uploadPackageOp
 // uplaod the ZIP packages
 type uploadPackageOp struct {
 	provisionWorkflowOp
+	// preview uploads are deleted after use. Archives are only uploaded
+	// to version aware buckets so that deleting them doesn't affect the
+	// provisioned service. Otherwise the provisioned archives are used.
+	preview bool
 }
 
 func (upo *uploadPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
@@ -404,15 +468,43 @@ func (upo *uploadPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 		}
 	}
 	s3BucketName := upo.s3Bucket()
+	skipArchiveUploads := upo.preview && !upo.provisionContext.isVersionAwareBucket
+	provisionedParameters := map[string]string{}
+	if skipArchiveUploads {
+		logger.Info().
+			Str("Bucket", s3BucketName).
+			Msg("Bucket versioning is disabled. Code package changes will not be reported")
+		if !upo.provisionContext.noop {
+			stackParams, stackParamsErr := provisionedStackParameters(upo.provisionContext.serviceName,
+				upo.provisionContext.awsSession,
+				logger)
+			if stackParamsErr != nil {
+				return stackParamsErr
+			}
+			provisionedParameters = stackParams
+		}
+	}
 
 	// For each non-empty S3 local file, upload it in here...
+	var s3UploadsMutex sync.Mutex
 	uploadLocalFileTask := func(keyName string, localPath string) *workTask {
 		uploadTask := func() workResult {
 			// Keyname is the name of the zip file
 			archiveBaseName := filepath.Base(localPath)
-			// Put it in the service bucket
+			// Put it in the service bucket. Preview uploads are deleted after
+			// use, so buckets without versioning use a unique key to avoid
+			// deleting the provisioned artifacts.
 			uploadKeyPath := fmt.Sprintf("%s/%s", upo.provisionContext.serviceName,
 				archiveBaseName)
+			if upo.preview {
+				previewKeyPath, previewKeyPathErr := versionAwareS3KeyName(uploadKeyPath,
+					upo.provisionContext.isVersionAwareBucket,
+					logger)
+				if previewKeyPathErr != nil {
+					return newTaskResult(nil, previewKeyPathErr)
+				}
+				uploadKeyPath = previewKeyPath
+			}
 			// Create the S3 key...
 			zipS3URL, zipS3URLErr := uploadLocalFileToS3(upo.provisionContext.awsSession,
 				localPath,
@@ -426,15 +518,30 @@ func (upo *uploadPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 				return newTaskResult(nil, zipS3URLErr)
 			}
 			// All good, save it...
-			upo.provisionContext.s3Uploads[keyName] = newS3UploadURL(zipS3URL)
-			return newTaskResult(upo.provisionContext.s3Uploads[keyName], nil)
+			uploadURL := newS3UploadURL(zipS3URL)
+			s3UploadsMutex.Lock()
+			upo.provisionContext.s3Uploads[keyName] = uploadURL
+			s3UploadsMutex.Unlock()
+			return newTaskResult(uploadURL, nil)
 		}
 		return newWorkTask(uploadTask)
 	}
 	// For each nonEmpty S3 upload, push it.
 	for eachKey, eachLocalPath := range s3UploadMap {
+		if skipArchiveUploads && eachKey != s3UploadCloudFormationStackKey {
+			continue
+		}
 		uploadTasks = append(uploadTasks, uploadLocalFileTask(eachKey, eachLocalPath))
 	}
+	// Nested stack templates are uploaded like the service template, from
+	// the local file, s.t. every template attribute is preserved
+	nestedTemplates, nestedTemplatesErr := upo.nestedTemplates()
+	if nestedTemplatesErr != nil {
+		return nestedTemplatesErr
+	}
+	for eachStackID, eachLocalPath := range nestedTemplates {
+		uploadTasks = append(uploadTasks, uploadLocalFileTask(eachStackID, eachLocalPath))
+	}
 
 	//////////////////////////////////////////////////////////////////////////////
 	// OCI Package Format
@@ -457,6 +564,12 @@ func (upo *uploadPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 					Msg("Bypassing ECR push due to -n/--noop flag")
 				return newTaskResult("ECR Push bypassed", nil)
 			}
+			if upo.preview {
+				logger.Info().
+					Str("ECRTag", ecrImageTag).
+					Msg("Bypassing ECR push for preview")
+				return newTaskResult("ECR Push bypassed", nil)
+			}
 			logger.Info().
 				Str("Tag", ecrImageTag).
 				Msg("Pushing local image to ECR")
@@ -486,21 +599,34 @@ func (upo *uploadPackageOp) Invoke(ctx context.Context, logger *zerolog.Logger)
 	// Save the stack params, based on what we uploaded
 	//////////////////////////////////////////////////////////////////////////////
 	// TODO: This could be a bit cleaner...
+	setArtifactParameters := func(uploadKey string, keyParam string, versionParam string) {
+		uploaded, uploadedExists := upo.provisionContext.s3Uploads[uploadKey]
+		if uploadedExists {
+			upo.provisionContext.stackParameterValues[keyParam] = uploaded.path
+			upo.provisionContext.stackParameterValues[versionParam] = uploaded.version
+			return
+		}
+		// Skipped preview uploads use the provisioned archive
+		upo.provisionContext.stackParameterValues[keyParam] = provisionedParameters[keyParam]
+		upo.provisionContext.stackParameterValues[versionParam] = provisionedParameters[versionParam]
+	}
 	if len(s3UploadMap[MetadataParamCodeArchivePath]) != 0 {
-		upo.provisionContext.stackParameterValues[StackParamS3CodeKeyName] =
-			upo.provisionContext.s3Uploads[MetadataParamCodeArchivePath].path
-		upo.provisionContext.stackParameterValues[StackParamS3CodeVersion] =
-			upo.provisionContext.s3Uploads[MetadataParamCodeArchivePath].version
+		setArtifactParameters(MetadataParamCodeArchivePath,
+			StackParamS3CodeKeyName,
+			StackParamS3CodeVersion)
 	}
 	if len(s3UploadMap[MetadataParamS3SiteArchivePath]) != 0 {
-		upo.provisionContext.stackParameterValues[StackParamS3SiteArchiveKey] =
-			upo.provisionContext.s3Uploads[MetadataParamS3SiteArchivePath].path
-		upo.provisionContext.stackParameterValues[StackParamS3SiteArchiveVersion] =
-			upo.provisionContext.s3Uploads[MetadataParamS3SiteArchivePath].version
+		setArtifactParameters(MetadataParamS3SiteArchivePath,
+			StackParamS3SiteArchiveKey,
+			StackParamS3SiteArchiveVersion)
 	}
 	if len(ecrImageTag) != 0 {
 		upo.provisionContext.stackParameterValues[StackParamCodeImageURI] = ecrImageTag
 	}
+	for eachStackID := range nestedTemplates {
+		upo.provisionContext.stackParameterValues[eachStackID+nestedStackTemplateURLSuffix] =
+			upo.provisionContext.s3Uploads[eachStackID].location
+	}
 	return nil
 }
 
@@ -545,6 +671,13 @@ func (cpto *codePipelineTriggerOp) Rollback(ctx context.Context, logger *zerolog
 }
 
 func (cpto *codePipelineTriggerOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
+	nestedTemplates, nestedTemplatesErr := cpto.nestedTemplates()
+	if nestedTemplatesErr != nil {
+		return nestedTemplatesErr
+	}
+	if len(nestedTemplates) != 0 {
+		return errors.Errorf("CodePipeline packages don't support nested stack templates")
+	}
 	tmpFile, err := system.TemporaryFile(ScratchDirectory, cpto.provisionContext.codePipelineTrigger)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to create temporary file for CodePipeline")
@@ -813,6 +946,66 @@ func (osi *outputStackInfoOp) Invoke(ctx context.Context, logger *zerolog.Logger
 	return nil
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// recordProvisionOp
+// Save the provisioned build record so that the rollback command can
+// redeploy it
+type recordProvisionOp struct {
+	provisionWorkflowOp
+}
+
+func (rpo *recordProvisionOp) Rollback(ctx context.Context, logger *zerolog.Logger) error {
+	return nil
+}
+func (rpo *recordProvisionOp) Invoke(ctx context.Context, logger *zerolog.Logger) error {
+	templateUpload, templateUploadExists := rpo.provisionContext.s3Uploads[s3UploadCloudFormationStackKey]
+	if rpo.provisionContext.noop ||
+		rpo.provisionContext.stack == nil ||
+		!templateUploadExists {
+		return nil
+	}
+	buildID := rpo.provisionContext.stackTags[SpartaTagBuildIDKey]
+	if buildID == "" {
+		buildID = StampedBuildID
+	}
+	if buildID == "" {
+		logger.Debug().Msg("Skipping build record for empty BuildID")
+		return nil
+	}
+	// The artifacts of previous builds are overwritten in buckets
+	// without versioning, so they can't be redeployed
+	if !rpo.provisionContext.isVersionAwareBucket {
+		logger.Info().
+			Str("Bucket", rpo.s3Bucket()).
+			Msg("Bucket versioning is disabled. The build will not be available to the rollback command")
+		return nil
+	}
+	record := &provisionRecord{
+		BuildID:     buildID,
+		Time:        time.Now().UTC(),
+		TemplateURL: templateUpload.location,
+		Parameters:  rpo.provisionContext.stackParameterValues,
+		Tags:        rpo.provisionContext.stackTags,
+	}
+	recordErr := saveProvisionRecord(rpo.provisionContext.awsSession,
+		rpo.s3Bucket(),
+		rpo.provisionContext.serviceName,
+		record)
+	if recordErr != nil {
+		// Don't fail the provision, it's already applied
+		logger.Warn().
+			Err(recordErr).
+			Str("BuildID", buildID).
+			Msg("Failed to save build record. The build will not be available to the rollback command")
+		return nil
+	}
+	logger.Debug().
+		Str("BuildID", buildID).
+		Str("Key", provisionRecordKey(rpo.provisionContext.serviceName, buildID)).
+		Msg("Saved build record")
+	return nil
+}
+
 /*
 type validatePostConditionOp struct {
 	provisionWorkflowOp
@@ -851,6 +1044,26 @@ func Provision(noop bool,
 	inPlaceUpdates bool,
 	codePipelineTrigger string,
 	logger *zerolog.Logger) error {
+	return provisionWithSession(spartaAWS.NewSession(logger),
+		noop,
+		templatePath,
+		stackParamValues,
+		stackTags,
+		inPlaceUpdates,
+		codePipelineTrigger,
+		logger)
+}
+
+// provisionWithSession provisions the template using the AWS session's region
+// and credentials
+func provisionWithSession(awsSession *session.Session,
+	noop bool,
+	templatePath string,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	inPlaceUpdates bool,
+	codePipelineTrigger string,
+	logger *zerolog.Logger) error {
 
 	logger.Info().
 		Bool("NOOP", noop).
@@ -861,7 +1074,7 @@ func Provision(noop bool,
 		Msg("Provisioning service")
 
 	pc := &provisionContext{
-		awsSession:           spartaAWS.NewSession(logger),
+		awsSession:           awsSession,
 		cfTemplatePath:       templatePath,
 		cfTemplate:           gocf.NewTemplate(),
 		codePipelineTrigger:  codePipelineTrigger,
@@ -935,6 +1148,12 @@ func Provision(noop bool,
 		provisionWorkflowOp: provisionWorkflowOp{
 			provisionContext: pc,
 		}})
+	if !inPlaceUpdates {
+		stageDescribe.Append("recordProvision", &recordProvisionOp{
+			provisionWorkflowOp: provisionWorkflowOp{
+				provisionContext: pc,
+			}})
+	}
 	provisionPipeline.Append("describe", stageDescribe)
 
 	// Run
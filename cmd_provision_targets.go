@@ -0,0 +1,304 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	provisionTargetSucceeded = "succeeded"
+	provisionTargetFailed    = "failed"
+	provisionTargetSkipped   = "skipped"
+)
+
+// provisionTargetRoleSessionName is the session name for assumed roles
+const provisionTargetRoleSessionName = "sparta-provision"
+
+// displayName returns the target's name for logging
+func (target *ProvisionTarget) displayName() string {
+	if target.Name != "" {
+		return target.Name
+	}
+	if target.RoleArn != "" {
+		roleARN, roleARNErr := arn.Parse(target.RoleArn)
+		if roleARNErr == nil {
+			return fmt.Sprintf("%s/%s", roleARN.AccountID, target.Region)
+		}
+	}
+	return target.Region
+}
+
+// validate ensures the target has the required values
+func (target *ProvisionTarget) validate() error {
+	if target.Region == "" {
+		return errors.Errorf("Provision target %s requires a region", target.displayName())
+	}
+	if target.S3Bucket == "" {
+		return errors.Errorf("Provision target %s requires a region-local s3Bucket", target.displayName())
+	}
+	if target.RoleArn != "" {
+		_, roleARNErr := arn.Parse(target.RoleArn)
+		if roleARNErr != nil {
+			return errors.Wrapf(roleARNErr, "Invalid roleArn for provision target %s", target.displayName())
+		}
+	}
+	return nil
+}
+
+// session returns the AWS session for the target's region and, optionally,
+// the assumed role
+func (target *ProvisionTarget) session(logger *zerolog.Logger) *session.Session {
+	awsSession := spartaAWS.NewSessionWithConfig(&aws.Config{
+		Region:                        aws.String(target.Region),
+		CredentialsChainVerboseErrors: aws.Bool(true),
+	}, logger)
+	if target.RoleArn == "" {
+		return awsSession
+	}
+	roleCredentials := stscreds.NewCredentials(awsSession,
+		target.RoleArn,
+		func(provider *stscreds.AssumeRoleProvider) {
+			provider.RoleSessionName = provisionTargetRoleSessionName
+			if target.ExternalID != "" {
+				provider.ExternalID = aws.String(target.ExternalID)
+			}
+		})
+	return awsSession.Copy(&aws.Config{
+		Credentials: roleCredentials,
+	})
+}
+
+// provisionTargetResult is the outcome of a single target provision
+type provisionTargetResult struct {
+	target   *ProvisionTarget
+	status   string
+	duration time.Duration
+	err      error
+}
+
+// targetStackValues returns the stack params and tags for the target. The
+// target's values take precedence and the artifacts are uploaded to the
+// target's region-local bucket.
+func targetStackValues(target *ProvisionTarget,
+	stackParamValues map[string]string,
+	stackTags map[string]string) (map[string]string, map[string]string) {
+	targetParams := make(map[string]string)
+	for eachKey, eachValue := range stackParamValues {
+		targetParams[eachKey] = eachValue
+	}
+	for eachKey, eachValue := range target.Params {
+		targetParams[eachKey] = eachValue
+	}
+	targetParams[StackParamArtifactBucketName] = target.S3Bucket
+	targetTags := make(map[string]string)
+	for eachKey, eachValue := range stackTags {
+		targetTags[eachKey] = eachValue
+	}
+	for eachKey, eachValue := range target.Tags {
+		targetTags[eachKey] = eachValue
+	}
+	return targetParams, targetTags
+}
+
+// targetProvisioner provisions a single target
+type targetProvisioner func(target *ProvisionTarget,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	logger *zerolog.Logger) error
+
+// ensureTargetsTemplate returns an error if the template can't be
+// provisioned to multiple targets. Images are only pushed to the default
+// account's ECR registry, so their URIs aren't valid in other regions and
+// accounts.
+func ensureTargetsTemplate(templatePath string) error {
+	/* #nosec G304 */
+	templateBytes, templateBytesErr := ioutil.ReadFile(templatePath)
+	if templateBytesErr != nil {
+		return templateBytesErr
+	}
+	var template struct {
+		Metadata map[string]interface{} `json:"Metadata"`
+	}
+	unmarshalErr := json.Unmarshal(templateBytes, &template)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal template: %s", templatePath)
+	}
+	if ecrTag, _ := template.Metadata[MetadataParamECRTag].(string); ecrTag != "" {
+		return errors.Errorf("Container image builds (%s) can't be provisioned to stage targets. Provision each region and account separately",
+			ecrTag)
+	}
+	return nil
+}
+
+// ProvisionTargets provisions the template to each of the targets. The
+// targets are provisioned concurrently, at most concurrency at a time, and
+// each target's S3Bucket receives a copy of the artifacts. The target's
+// params and tags are merged over the stackParamValues and stackTags. If the
+// failurePolicy is ProvisionFailurePolicyFailFast, targets that haven't
+// started are skipped after the first failure. Templates that use a
+// container image aren't supported.
+func ProvisionTargets(noop bool,
+	templatePath string,
+	targets []*ProvisionTarget,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	inPlaceUpdates bool,
+	failurePolicy string,
+	concurrency int,
+	logger *zerolog.Logger) error {
+
+	templateErr := ensureTargetsTemplate(templatePath)
+	if templateErr != nil {
+		return templateErr
+	}
+	provisioner := func(target *ProvisionTarget,
+		targetParams map[string]string,
+		targetTags map[string]string,
+		targetLogger *zerolog.Logger) error {
+		return provisionWithSession(target.session(targetLogger),
+			noop,
+			templatePath,
+			targetParams,
+			targetTags,
+			inPlaceUpdates,
+			"",
+			targetLogger)
+	}
+	return provisionTargets(targets,
+		stackParamValues,
+		stackTags,
+		failurePolicy,
+		concurrency,
+		provisioner,
+		logger)
+}
+
+// provisionTargets provisions the targets through the workerPool with the
+// provisioner
+func provisionTargets(targets []*ProvisionTarget,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	failurePolicy string,
+	concurrency int,
+	provisioner targetProvisioner,
+	logger *zerolog.Logger) error {
+
+	if len(targets) == 0 {
+		return errors.Errorf("ProvisionTargets requires at least one target")
+	}
+	switch failurePolicy {
+	case "":
+		failurePolicy = ProvisionFailurePolicyFailFast
+	case ProvisionFailurePolicyFailFast, ProvisionFailurePolicyContinue:
+		// NOP
+	default:
+		return errors.Errorf("Unsupported failure policy: %s. Valid values: %s, %s",
+			failurePolicy,
+			ProvisionFailurePolicyFailFast,
+			ProvisionFailurePolicyContinue)
+	}
+	targetNames := make(map[string]bool)
+	for _, eachTarget := range targets {
+		validateErr := eachTarget.validate()
+		if validateErr != nil {
+			return validateErr
+		}
+		if targetNames[eachTarget.displayName()] {
+			return errors.Errorf("Duplicate provision target: %s. Use the target name to disambiguate",
+				eachTarget.displayName())
+		}
+		targetNames[eachTarget.displayName()] = true
+	}
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+	logger.Info().
+		Int("Targets", len(targets)).
+		Int("Concurrency", concurrency).
+		Str("FailurePolicy", failurePolicy).
+		Msg("Provisioning targets")
+
+	var failed int32
+	var completed int32
+	var resultsMutex sync.Mutex
+	results := make([]*provisionTargetResult, len(targets))
+	provisionTasks := make([]*workTask, len(targets))
+	for eachIndex, eachTarget := range targets {
+		targetIndex := eachIndex
+		target := eachTarget
+		provisionTasks[eachIndex] = newWorkTask(func() workResult {
+			result := &provisionTargetResult{
+				target: target,
+				status: provisionTargetSkipped,
+			}
+			defer func() {
+				resultsMutex.Lock()
+				results[targetIndex] = result
+				resultsMutex.Unlock()
+			}()
+			if failurePolicy == ProvisionFailurePolicyFailFast && atomic.LoadInt32(&failed) != 0 {
+				return newTaskResult(result, nil)
+			}
+			targetLogger := logger.With().
+				Str("Target", target.displayName()).
+				Logger()
+
+			targetParams, targetTags := targetStackValues(target, stackParamValues, stackTags)
+			startTime := time.Now()
+			result.err = provisioner(target, targetParams, targetTags, &targetLogger)
+			result.duration = time.Since(startTime)
+			result.status = provisionTargetSucceeded
+			if result.err != nil {
+				result.status = provisionTargetFailed
+				atomic.AddInt32(&failed, 1)
+			}
+			targetLogger.Info().
+				Str("Status", result.status).
+				Int32("Completed", atomic.AddInt32(&completed, 1)).
+				Int("Total", len(targets)).
+				Msg("Target provisioning complete")
+			return newTaskResult(result, nil)
+		})
+	}
+	pool := newWorkerPool(provisionTasks, concurrency)
+	pool.Run()
+
+	// Summary
+	logger.Info().Msg(headerDivider)
+	failedNames := make([]string, 0)
+	for _, eachResult := range results {
+		event := logger.Info()
+		if eachResult.err != nil {
+			event = logger.Error().Err(eachResult.err)
+			failedNames = append(failedNames, eachResult.target.displayName())
+		}
+		event.
+			Str("Target", eachResult.target.displayName()).
+			Str("Region", eachResult.target.Region).
+			Str("Bucket", eachResult.target.S3Bucket).
+			Str("Status", eachResult.status).
+			Dur(fmt.Sprintf("Duration (%s)", durationUnitLabel), eachResult.duration).
+			Msg("Provision target summary")
+	}
+	if len(failedNames) != 0 {
+		return errors.Errorf("Failed to provision %d of %d targets: %v",
+			len(failedNames),
+			len(targets),
+			failedNames)
+	}
+	return nil
+}
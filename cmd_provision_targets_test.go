@@ -0,0 +1,122 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func TestProvisionTargetValues(t *testing.T) {
+	target := &ProvisionTarget{
+		Region:   "eu-west-1",
+		S3Bucket: "eu-artifacts",
+		RoleArn:  "arn:aws:iam::123456789012:role/SpartaDeploy",
+		Params:   StageStringMap{"LogLevel": "warn"},
+		Tags:     StageStringMap{"region": "eu"},
+	}
+	if target.displayName() != "123456789012/eu-west-1" {
+		t.Fatalf("Unexpected target name: %s", target.displayName())
+	}
+	params, tags := targetStackValues(target,
+		map[string]string{"LogLevel": "info", StackParamArtifactBucketName: "us-artifacts"},
+		map[string]string{"team": "platform"})
+	if params["LogLevel"] != "warn" ||
+		params[StackParamArtifactBucketName] != "eu-artifacts" ||
+		tags["team"] != "platform" ||
+		tags["region"] != "eu" {
+		t.Fatalf("Unexpected target values: %#v, %#v", params, tags)
+	}
+	config, configErr := ParseStageConfiguration("sparta.yaml",
+		[]byte("default:\n  failurePolicy: continue\n  targets:\n    - region: eu-west-1\n      s3Bucket: eu-artifacts\n      params:\n        Port: 8080\n"),
+		"")
+	if configErr != nil {
+		t.Fatal(configErr)
+	}
+	if config.FailurePolicy != ProvisionFailurePolicyContinue ||
+		len(config.Targets) != 1 ||
+		config.Targets[0].S3Bucket != "eu-artifacts" ||
+		config.Targets[0].Params["Port"] != "8080" {
+		t.Fatalf("Unexpected target configuration: %#v", config)
+	}
+	invalidTargets := []*ProvisionTarget{
+		{S3Bucket: "bucket"},
+		{Region: "us-west-2"},
+		{Region: "us-west-2", S3Bucket: "bucket", RoleArn: "SpartaDeploy"},
+	}
+	for _, eachTarget := range invalidTargets {
+		if eachTarget.validate() == nil {
+			t.Fatalf("Expected validation error for target: %#v", eachTarget)
+		}
+	}
+
+	templateFile, templateFileErr := ioutil.TempFile("", "sparta-targets")
+	if templateFileErr != nil {
+		t.Fatal(templateFileErr)
+	}
+	defer os.Remove(templateFile.Name())
+	_, writeErr := templateFile.WriteString(`{"Metadata":{"` + MetadataParamECRTag + `":"sparta/service:latest"}}`)
+	templateFile.Close()
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	if ensureTargetsTemplate(templateFile.Name()) == nil {
+		t.Fatalf("Expected error for container image template")
+	}
+}
+
+func TestProvisionTargetsFailurePolicy(t *testing.T) {
+	logger := zerolog.New(ioutil.Discard)
+	targets := []*ProvisionTarget{
+		{Region: "us-east-1", S3Bucket: "us-east-1-artifacts"},
+		{Region: "us-west-2", S3Bucket: "us-west-2-artifacts"},
+		{Region: "eu-west-1", S3Bucket: "eu-west-1-artifacts"},
+	}
+	var provisioned int32
+	provisioner := func(target *ProvisionTarget,
+		params map[string]string,
+		tags map[string]string,
+		logger *zerolog.Logger) error {
+		atomic.AddInt32(&provisioned, 1)
+		if target.Region == "us-east-1" {
+			return errors.Errorf("Failed to provision %s", target.Region)
+		}
+		return nil
+	}
+	// Serial s.t. the failed target is first
+	failFastErr := provisionTargets(targets, nil, nil, ProvisionFailurePolicyFailFast, 1, provisioner, &logger)
+	if failFastErr == nil || provisioned != 1 {
+		t.Fatalf("Expected fail fast to skip remaining targets. Provisioned: %d, Error: %v",
+			provisioned,
+			failFastErr)
+	}
+	provisioned = 0
+	continueErr := provisionTargets(targets, nil, nil, ProvisionFailurePolicyContinue, 2, provisioner, &logger)
+	if continueErr == nil || provisioned != 3 {
+		t.Fatalf("Expected continue to provision all targets. Provisioned: %d, Error: %v",
+			provisioned,
+			continueErr)
+	}
+	provisioned = 0
+	successErr := provisionTargets(targets[1:], nil, nil, "", 0, provisioner, &logger)
+	if successErr != nil || provisioned != 2 {
+		t.Fatalf("Expected all targets to succeed. Provisioned: %d, Error: %v",
+			provisioned,
+			successErr)
+	}
+	duplicateErr := provisionTargets([]*ProvisionTarget{targets[0], targets[0]},
+		nil,
+		nil,
+		ProvisionFailurePolicyContinue,
+		1,
+		provisioner,
+		&logger)
+	if duplicateErr == nil {
+		t.Fatalf("Expected error for duplicate targets")
+	}
+}
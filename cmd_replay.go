@@ -0,0 +1,291 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/s3"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// replayResult is the outcome of replaying a single captured payload
+type replayResult struct {
+	response json.RawMessage
+	errorMsg string
+}
+
+// loadCapturedPayloads returns the captured payloads from the source, which is
+// either a local file, a local directory, or an s3://bucket/prefix URL
+func loadCapturedPayloads(source string,
+	awsSession *session.Session,
+	logger *zerolog.Logger) ([]*CapturedPayload, error) {
+
+	var payloadBytes [][]byte
+	if strings.HasPrefix(source, "s3://") {
+		sourceURL, sourceURLErr := url.Parse(source)
+		if sourceURLErr != nil {
+			return nil, errors.Wrapf(sourceURLErr, "Failed to parse source: %s", source)
+		}
+		s3Svc := s3.New(awsSession)
+		listInput := &s3.ListObjectsV2Input{
+			Bucket: aws.String(sourceURL.Host),
+			Prefix: aws.String(strings.TrimPrefix(sourceURL.Path, "/")),
+		}
+		var getErr error
+		listErr := s3Svc.ListObjectsV2Pages(listInput,
+			func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+				for _, eachObject := range page.Contents {
+					if !strings.HasSuffix(*eachObject.Key, ".json") {
+						continue
+					}
+					logger.Debug().
+						Str("Key", *eachObject.Key).
+						Msg("Downloading captured payload")
+					getOutput, getOutputErr := s3Svc.GetObject(&s3.GetObjectInput{
+						Bucket: listInput.Bucket,
+						Key:    eachObject.Key,
+					})
+					if getOutputErr != nil {
+						getErr = getOutputErr
+						return false
+					}
+					data, dataErr := ioutil.ReadAll(getOutput.Body)
+					getOutput.Body.Close()
+					if dataErr != nil {
+						getErr = dataErr
+						return false
+					}
+					payloadBytes = append(payloadBytes, data)
+				}
+				return true
+			})
+		if listErr != nil {
+			return nil, errors.Wrapf(listErr, "Failed to list captured payloads: %s", source)
+		}
+		if getErr != nil {
+			return nil, errors.Wrapf(getErr, "Failed to download captured payload")
+		}
+	} else {
+		walkErr := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".json") {
+				return nil
+			}
+			data, dataErr := ioutil.ReadFile(path)
+			if dataErr != nil {
+				return dataErr
+			}
+			payloadBytes = append(payloadBytes, data)
+			return nil
+		})
+		if walkErr != nil {
+			return nil, errors.Wrapf(walkErr, "Failed to read captured payloads: %s", source)
+		}
+	}
+	payloads := make([]*CapturedPayload, 0, len(payloadBytes))
+	for _, eachData := range payloadBytes {
+		var payload CapturedPayload
+		unmarshalErr := json.Unmarshal(eachData, &payload)
+		if unmarshalErr != nil {
+			return nil, errors.Wrapf(unmarshalErr, "Failed to unmarshal captured payload")
+		}
+		payloads = append(payloads, &payload)
+	}
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].Timestamp.Before(payloads[j].Timestamp)
+	})
+	return payloads, nil
+}
+
+// replayLocal invokes the function via the local runtime API emulator
+func replayLocal(api *localRuntimeAPI, payload *CapturedPayload) (*replayResult, error) {
+	invokeURL := fmt.Sprintf("http://%s/2015-03-31/functions/%s/invocations",
+		api.Addr(),
+		awsLambdaInternalName(capturedPayloadInternalName(payload.FunctionName)))
+	resp, respErr := http.Post(invokeURL, "application/json", bytes.NewReader(payload.Event))
+	if respErr != nil {
+		return nil, respErr
+	}
+	defer resp.Body.Close()
+	body, bodyErr := ioutil.ReadAll(resp.Body)
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Local invocation failed (HTTP %d): %s",
+			resp.StatusCode,
+			string(body))
+	}
+	return newReplayResult(resp.Header.Get(headerInvokeFunctionError) != "", body), nil
+}
+
+// replayRemote invokes the deployed function
+func replayRemote(lambdaSvc *lambda.Lambda, payload *CapturedPayload) (*replayResult, error) {
+	invokeOutput, invokeOutputErr := lambdaSvc.Invoke(&lambda.InvokeInput{
+		FunctionName: aws.String(payload.FunctionName),
+		Payload:      payload.Event,
+	})
+	if invokeOutputErr != nil {
+		return nil, invokeOutputErr
+	}
+	return newReplayResult(invokeOutput.FunctionError != nil, invokeOutput.Payload), nil
+}
+
+func newReplayResult(isError bool, body []byte) *replayResult {
+	if !isError {
+		return &replayResult{response: body}
+	}
+	var invokeErr localInvokeError
+	if json.Unmarshal(body, &invokeErr) != nil || invokeErr.Message == "" {
+		invokeErr.Message = string(body)
+	}
+	return &replayResult{errorMsg: invokeErr.Message}
+}
+
+// jsonEqual returns true if the two JSON documents are semantically equal
+func jsonEqual(lhs json.RawMessage, rhs json.RawMessage) bool {
+	var lhsValue, rhsValue interface{}
+	lhsErr := json.Unmarshal(lhs, &lhsValue)
+	rhsErr := json.Unmarshal(rhs, &rhsValue)
+	if lhsErr != nil || rhsErr != nil {
+		return bytes.Equal(bytes.TrimSpace(lhs), bytes.TrimSpace(rhs))
+	}
+	return reflect.DeepEqual(lhsValue, rhsValue)
+}
+
+// Replay invokes the lambda functions with the captured payloads produced
+// by the payload capture interceptor. The payloads are replayed either
+// in-process via the local runtime API emulator or against the deployed
+// functions. Replay returns an error if any replayed result differs from
+// the captured result.
+func Replay(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	source string,
+	functionName string,
+	remote bool,
+	logger *zerolog.Logger) error {
+
+	awsSession := spartaAWS.NewSession(logger)
+	payloads, payloadsErr := loadCapturedPayloads(source, awsSession, logger)
+	if payloadsErr != nil {
+		return payloadsErr
+	}
+	if functionName != "" {
+		filtered := make([]*CapturedPayload, 0, len(payloads))
+		for _, eachPayload := range payloads {
+			if eachPayload.FunctionName == functionName ||
+				capturedPayloadInternalName(eachPayload.FunctionName) == functionName {
+				filtered = append(filtered, eachPayload)
+			}
+		}
+		payloads = filtered
+	}
+	logger.Info().
+		Str("Source", source).
+		Int("Count", len(payloads)).
+		Bool("Remote", remote).
+		Msg("Replaying captured payloads")
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var invoker func(*CapturedPayload) (*replayResult, error)
+	if remote {
+		lambdaSvc := lambda.New(awsSession)
+		invoker = func(payload *CapturedPayload) (*replayResult, error) {
+			return replayRemote(lambdaSvc, payload)
+		}
+	} else {
+		api, apiErr := newLocalRuntimeAPI(lambdaAWSInfos, "127.0.0.1:0", logger)
+		if apiErr != nil {
+			return apiErr
+		}
+		runErrChan := make(chan error, 1)
+		go func() {
+			runErrChan <- api.Run(ctx)
+		}()
+		defer func() {
+			cancel()
+			<-runErrChan
+		}()
+		invoker = func(payload *CapturedPayload) (*replayResult, error) {
+			return replayLocal(api, payload)
+		}
+	}
+
+	mismatchCount := 0
+	for _, eachPayload := range payloads {
+		result, resultErr := invoker(eachPayload)
+		if resultErr != nil {
+			return errors.Wrapf(resultErr,
+				"Failed to replay request %s for function %s",
+				eachPayload.RequestID,
+				eachPayload.FunctionName)
+		}
+		// The captured response was redacted, so redact the replayed
+		// response with the same expressions before comparing them
+		redactor, redactorErr := NewPayloadRedactor(eachPayload.RedactPaths)
+		if redactorErr != nil {
+			return errors.Wrapf(redactorErr,
+				"Invalid redaction path for request %s",
+				eachPayload.RequestID)
+		}
+		redactedResponse, redactedResponseErr := redactor.Redact(result.response)
+		if redactedResponseErr == nil {
+			result.response = redactedResponse
+		}
+		matches := result.errorMsg == eachPayload.Error
+		if matches && eachPayload.Error == "" {
+			matches = jsonEqual(eachPayload.Response, result.response)
+		}
+		logEvent := logger.Info()
+		if !matches {
+			mismatchCount++
+			logEvent = logger.Warn().
+				RawJSON("CapturedResponse", rawJSONOrNull(eachPayload.Response)).
+				Str("CapturedError", eachPayload.Error).
+				RawJSON("ReplayedResponse", rawJSONOrNull(result.response)).
+				Str("ReplayedError", result.errorMsg)
+		}
+		logEvent.
+			Str("Function", eachPayload.FunctionName).
+			Str("RequestID", eachPayload.RequestID).
+			Bool("Matches", matches).
+			Msg("Replayed payload")
+	}
+	if mismatchCount != 0 {
+		return errors.Errorf("%d of %d replayed payloads differ from the captured results",
+			mismatchCount,
+			len(payloads))
+	}
+	return nil
+}
+
+func rawJSONOrNull(data json.RawMessage) []byte {
+	if len(data) == 0 || !json.Valid(data) {
+		return []byte("null")
+	}
+	return data
+}
@@ -0,0 +1,103 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+func replayUpperLambda(ctx context.Context, event localEchoEvent) (map[string]string, error) {
+	if event.Message == "fail" {
+		return nil, errors.New("requested failure")
+	}
+	return map[string]string{
+		"message": strings.ToUpper(event.Message),
+	}, nil
+}
+
+func writeCapturedPayloads(t *testing.T, payloads ...*CapturedPayload) string {
+	tempDir, tempDirErr := ioutil.TempDir("", "sparta-replay")
+	if tempDirErr != nil {
+		t.Fatalf("Failed to create temp dir: %s", tempDirErr)
+	}
+	for _, eachPayload := range payloads {
+		payloadPath := filepath.Join(tempDir,
+			CapturedPayloadKey("captured", eachPayload.FunctionName, eachPayload.RequestID))
+		mkdirErr := os.MkdirAll(filepath.Dir(payloadPath), os.ModePerm)
+		if mkdirErr != nil {
+			t.Fatalf("Failed to create payload dir: %s", mkdirErr)
+		}
+		payloadBytes, _ := json.Marshal(eachPayload)
+		writeErr := ioutil.WriteFile(payloadPath, payloadBytes, 0644)
+		if writeErr != nil {
+			t.Fatalf("Failed to write payload: %s", writeErr)
+		}
+	}
+	return tempDir
+}
+
+func TestReplayLocal(t *testing.T) {
+	logger, _ := NewLogger(zerolog.WarnLevel.String())
+	lambdaFn, _ := NewAWSLambda("replayUpper", replayUpperLambda, IAMRoleDefinition{})
+	lambdaAWSInfos := []*LambdaAWSInfo{lambdaFn}
+	functionName := "MyStack" + functionNameDelimiter + awsLambdaInternalName(lambdaFn.lambdaFunctionName())
+
+	matching := writeCapturedPayloads(t,
+		&CapturedPayload{
+			FunctionName: functionName,
+			RequestID:    "request-1",
+			Timestamp:    time.Now(),
+			Event:        json.RawMessage(`{"message":"hello"}`),
+			Response:     json.RawMessage(`{"message": "HELLO"}`),
+		},
+		&CapturedPayload{
+			FunctionName: functionName,
+			RequestID:    "request-redacted",
+			Timestamp:    time.Now(),
+			Event:        json.RawMessage(`{"message":"secret"}`),
+			Response:     json.RawMessage(`{"message":"` + PayloadRedactedValue + `"}`),
+			RedactPaths:  []string{"$.message"},
+		},
+		&CapturedPayload{
+			FunctionName: functionName,
+			RequestID:    "request-2",
+			Timestamp:    time.Now(),
+			Event:        json.RawMessage(`{"message":"fail"}`),
+			Error:        "requested failure",
+		})
+	defer os.RemoveAll(matching)
+	replayErr := Replay("MyStack", lambdaAWSInfos, matching, "", false, logger)
+	if replayErr != nil {
+		t.Fatalf("Unexpected replay error: %s", replayErr)
+	}
+
+	differing := writeCapturedPayloads(t,
+		&CapturedPayload{
+			FunctionName: functionName,
+			RequestID:    "request-3",
+			Timestamp:    time.Now(),
+			Event:        json.RawMessage(`{"message":"hello"}`),
+			Response:     json.RawMessage(`{"message":"hello"}`),
+		})
+	defer os.RemoveAll(differing)
+	replayErr = Replay("MyStack", lambdaAWSInfos, differing, "", false, logger)
+	if replayErr == nil {
+		t.Fatalf("Expected replay error for differing response")
+	}
+
+	// Filtered out
+	replayErr = Replay("MyStack", lambdaAWSInfos, differing, "unknownFunction", false, logger)
+	if replayErr != nil {
+		t.Fatalf("Unexpected replay error for filtered payloads: %s", replayErr)
+	}
+}
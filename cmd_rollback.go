@@ -0,0 +1,298 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// provisionRecord is the record of a provisioned build. Records are saved to
+// the artifact bucket so that the `rollback` command can redeploy the
+// build's template and code without rebuilding.
+type provisionRecord struct {
+	BuildID     string            `json:"buildID"`
+	Time        time.Time         `json:"time"`
+	TemplateURL string            `json:"templateURL"`
+	Parameters  map[string]string `json:"parameters"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// provisionRecordKeyPrefix returns the S3 key prefix of the service's records
+func provisionRecordKeyPrefix(serviceName string) string {
+	return fmt.Sprintf("%s/builds/", serviceName)
+}
+
+// provisionRecordKey returns the S3 key of the build's record
+func provisionRecordKey(serviceName string, buildID string) string {
+	return fmt.Sprintf("%s%s.json", provisionRecordKeyPrefix(serviceName), buildID)
+}
+
+// saveProvisionRecord uploads the record to the artifact bucket
+func saveProvisionRecord(awsSession *session.Session,
+	s3Bucket string,
+	serviceName string,
+	record *provisionRecord) error {
+	recordBytes, recordBytesErr := json.Marshal(record)
+	if recordBytesErr != nil {
+		return recordBytesErr
+	}
+	_, putErr := s3.New(awsSession).PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s3Bucket),
+		Key:         aws.String(provisionRecordKey(serviceName, record.BuildID)),
+		Body:        bytes.NewReader(recordBytes),
+		ContentType: aws.String("application/json"),
+	})
+	return putErr
+}
+
+// provisionRecords returns the service's records in the artifact bucket,
+// newest first
+func provisionRecords(awsSession *session.Session,
+	s3Bucket string,
+	serviceName string,
+	logger *zerolog.Logger) ([]*provisionRecord, error) {
+
+	s3Svc := s3.New(awsSession)
+	records := []*provisionRecord{}
+	var getErr error
+	listErr := s3Svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Bucket),
+		Prefix: aws.String(provisionRecordKeyPrefix(serviceName)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, eachObject := range page.Contents {
+			if !strings.HasSuffix(*eachObject.Key, ".json") {
+				continue
+			}
+			getOutput, getOutputErr := s3Svc.GetObject(&s3.GetObjectInput{
+				Bucket: aws.String(s3Bucket),
+				Key:    eachObject.Key,
+			})
+			if getOutputErr != nil {
+				getErr = getOutputErr
+				return false
+			}
+			var record provisionRecord
+			decodeErr := json.NewDecoder(getOutput.Body).Decode(&record)
+			getOutput.Body.Close()
+			if decodeErr != nil {
+				logger.Warn().
+					Err(decodeErr).
+					Str("Key", *eachObject.Key).
+					Msg("Failed to read build record")
+				continue
+			}
+			records = append(records, &record)
+		}
+		return true
+	})
+	if listErr != nil {
+		return nil, errors.Wrapf(listErr, "Failed to list build records in bucket: %s", s3Bucket)
+	}
+	if getErr != nil {
+		return nil, errors.Wrapf(getErr, "Failed to get build record")
+	}
+	sortProvisionRecords(records)
+	return records, nil
+}
+
+func sortProvisionRecords(records []*provisionRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+}
+
+// provisionedBuildID returns the BuildID output of the provisioned stack
+func provisionedBuildID(serviceName string,
+	awsSession *session.Session,
+	logger *zerolog.Logger) (string, error) {
+	stackExists, stackExistsErr := spartaCF.StackExists(serviceName, awsSession, logger)
+	if stackExistsErr != nil || !stackExists {
+		return "", stackExistsErr
+	}
+	describeStackOutput, describeStackOutputErr := cloudformation.New(awsSession).DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if describeStackOutputErr != nil {
+		return "", describeStackOutputErr
+	}
+	for _, eachStack := range describeStackOutput.Stacks {
+		for _, eachOutput := range eachStack.Outputs {
+			if aws.StringValue(eachOutput.OutputKey) == StackOutputBuildID {
+				return aws.StringValue(eachOutput.OutputValue), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// s3ObjectExists returns an error if the S3 object version doesn't exist
+func s3ObjectExists(s3Svc *s3.S3, s3Bucket string, key string, version string) error {
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(key),
+	}
+	if version != "" {
+		headInput.VersionId = aws.String(version)
+	}
+	_, headErr := s3Svc.HeadObject(headInput)
+	if headErr != nil {
+		return errors.Wrapf(headErr, "Failed to find artifact s3://%s/%s (version: %s)",
+			s3Bucket,
+			key,
+			version)
+	}
+	return nil
+}
+
+// Rollback redeploys the template and code of a previously provisioned
+// build without rebuilding. Builds are recorded in the S3 bucket by each
+// successful provision. If buildID is empty, the recorded builds are
+// listed instead.
+func Rollback(serviceName string,
+	s3Bucket string,
+	buildID string,
+	noop bool,
+	logger *zerolog.Logger) error {
+
+	awsSession := spartaAWS.NewSession(logger)
+	records, recordsErr := provisionRecords(awsSession, s3Bucket, serviceName, logger)
+	if recordsErr != nil {
+		return recordsErr
+	}
+	currentBuildID, currentBuildIDErr := provisionedBuildID(serviceName, awsSession, logger)
+	if currentBuildIDErr != nil {
+		return currentBuildIDErr
+	}
+
+	if buildID == "" {
+		logSectionHeader("Builds", dividerLength, logger)
+		for _, eachRecord := range records {
+			logger.Info().
+				Str("Time", eachRecord.Time.Format(time.RFC3339)).
+				Bool("Provisioned", eachRecord.BuildID == currentBuildID).
+				Msg(eachRecord.BuildID)
+		}
+		if len(records) == 0 {
+			logger.Info().
+				Str("Bucket", s3Bucket).
+				Msg("No builds found")
+		}
+		return nil
+	}
+
+	var record *provisionRecord
+	for _, eachRecord := range records {
+		if eachRecord.BuildID == buildID {
+			record = eachRecord
+			break
+		}
+	}
+	if record == nil {
+		return errors.Errorf("Failed to find build %s in bucket %s. Run `rollback` without a BuildID to list builds",
+			buildID,
+			s3Bucket)
+	}
+	if record.BuildID == currentBuildID {
+		logger.Info().
+			Str("BuildID", buildID).
+			Msg("Build is already provisioned")
+		return nil
+	}
+
+	// Make sure the artifacts were retained
+	s3Svc := s3.New(awsSession)
+	templateURL := newS3UploadURL(record.TemplateURL)
+	if templateURL == nil {
+		return errors.Errorf("Invalid template URL: %s", record.TemplateURL)
+	}
+	artifactChecks := [][]string{
+		{templateURL.path, templateURL.version},
+		{record.Parameters[StackParamS3CodeKeyName], record.Parameters[StackParamS3CodeVersion]},
+		{record.Parameters[StackParamS3SiteArchiveKey], record.Parameters[StackParamS3SiteArchiveVersion]},
+	}
+	for _, eachCheck := range artifactChecks {
+		if eachCheck[0] == "" {
+			continue
+		}
+		if eachCheck[1] == "" {
+			return errors.Errorf("Build %s artifact s3://%s/%s isn't versioned. Rollback requires a bucket with versioning enabled",
+				buildID,
+				s3Bucket,
+				eachCheck[0])
+		}
+		existsErr := s3ObjectExists(s3Svc, s3Bucket, eachCheck[0], eachCheck[1])
+		if existsErr != nil {
+			return existsErr
+		}
+	}
+	getInput := &s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(templateURL.path),
+	}
+	if templateURL.version != "" {
+		getInput.VersionId = aws.String(templateURL.version)
+	}
+	getOutput, getOutputErr := s3Svc.GetObject(getInput)
+	if getOutputErr != nil {
+		return errors.Wrapf(getOutputErr, "Failed to get template: %s", record.TemplateURL)
+	}
+	defer getOutput.Body.Close()
+	templateBytes, templateBytesErr := ioutil.ReadAll(getOutput.Body)
+	if templateBytesErr != nil {
+		return templateBytesErr
+	}
+	cfTemplate := gocf.NewTemplate()
+	unmarshalErr := json.Unmarshal(templateBytes, cfTemplate)
+	if unmarshalErr != nil {
+		return errors.Wrapf(unmarshalErr, "Failed to unmarshal template: %s", record.TemplateURL)
+	}
+
+	logger.Info().
+		Str("BuildID", buildID).
+		Str("ProvisionedBuildID", currentBuildID).
+		Str("Time", record.Time.Format(time.RFC3339)).
+		Str("TemplateURL", record.TemplateURL).
+		Msg("Rolling back service")
+	if noop {
+		logger.Info().
+			Msg(noopMessage("CloudFormation Stack update"))
+		return nil
+	}
+	startTime := time.Now()
+	stack, stackErr := spartaCF.ConvergeStackState(serviceName,
+		cfTemplate,
+		record.TemplateURL,
+		record.Parameters,
+		record.Tags,
+		startTime,
+		maximumStackOperationTimeout(cfTemplate, logger),
+		awsSession,
+		"▬",
+		dividerLength,
+		logger)
+	if stackErr != nil {
+		return stackErr
+	}
+	logger.Info().
+		Str("StackName", *stack.StackName).
+		Str("BuildID", buildID).
+		Str("Duration", time.Since(startTime).String()).
+		Msg("Stack rolled back")
+	return nil
+}
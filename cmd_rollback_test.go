@@ -0,0 +1,29 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProvisionRecords(t *testing.T) {
+	if provisionRecordKey("MyService", "abc123") != "MyService/builds/abc123.json" {
+		t.Fatalf("Unexpected record key: %s", provisionRecordKey("MyService", "abc123"))
+	}
+	now := time.Now()
+	records := []*provisionRecord{
+		{BuildID: "first", Time: now.Add(-2 * time.Hour)},
+		{BuildID: "latest", Time: now},
+		{BuildID: "second", Time: now.Add(-time.Hour)},
+	}
+	sortProvisionRecords(records)
+	if records[0].BuildID != "latest" ||
+		records[1].BuildID != "second" ||
+		records[2].BuildID != "first" {
+		t.Fatalf("Expected records sorted newest first: %s, %s, %s",
+			records[0].BuildID,
+			records[1].BuildID,
+			records[2].BuildID)
+	}
+}
@@ -3,17 +3,30 @@
 package sparta
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/sts"
 	spartaAWS "github.com/mweagle/Sparta/aws"
+	spartaCF "github.com/mweagle/Sparta/aws/cloudformation"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
 )
 
+// statusReportEventCount is the number of recent stack events included
+// in the status report
+const statusReportEventCount = 20
+
 func logSectionHeader(text string,
 	dividerWidth int,
 	logger *zerolog.Logger) {
@@ -23,6 +36,30 @@ func logSectionHeader(text string,
 	logger.Info().Msgf("%s%s", outputHeader, suffix)
 }
 
+// statusRedactor returns a function that redacts the AWS account ID
+// if redact is true
+func statusRedactor(awsSession *session.Session, redact bool) (func(string) string, error) {
+	redactor := func(stringValue string) string {
+		return stringValue
+	}
+	if redact {
+		input := &sts.GetCallerIdentityInput{}
+		stsSvc := sts.New(awsSession)
+		identityResponse, identityResponseErr := stsSvc.GetCallerIdentity(input)
+		if identityResponseErr != nil {
+			return nil, identityResponseErr
+		}
+		redactedValue := strings.Repeat("*", len(*identityResponse.Account))
+		redactor = func(stringValue string) string {
+			return strings.Replace(stringValue,
+				*identityResponse.Account,
+				redactedValue,
+				-1)
+		}
+	}
+	return redactor, nil
+}
+
 // Status produces a status report for the given stack
 func Status(serviceName string,
 	serviceDescription string,
@@ -51,23 +88,9 @@ func Status(serviceName string,
 	}
 
 	// What's the current accountID?
-	redactor := func(stringValue string) string {
-		return stringValue
-	}
-	if redact {
-		input := &sts.GetCallerIdentityInput{}
-		stsSvc := sts.New(awsSession)
-		identityResponse, identityResponseErr := stsSvc.GetCallerIdentity(input)
-		if identityResponseErr != nil {
-			return identityResponseErr
-		}
-		redactedValue := strings.Repeat("*", len(*identityResponse.Account))
-		redactor = func(stringValue string) string {
-			return strings.Replace(stringValue,
-				*identityResponse.Account,
-				redactedValue,
-				-1)
-		}
+	redactor, redactorErr := statusRedactor(awsSession, redact)
+	if redactorErr != nil {
+		return redactorErr
 	}
 
 	// Report on what's up with the stack...
@@ -118,3 +141,340 @@ func Status(serviceName string,
 	}
 	return nil
 }
+
+// StatusReportStack is the stack summary of the status report
+type StatusReportStack struct {
+	Name            string     `json:"name" yaml:"name"`
+	ID              string     `json:"id" yaml:"id"`
+	Description     string     `json:"description,omitempty" yaml:"description,omitempty"`
+	Status          string     `json:"status" yaml:"status"`
+	StatusReason    string     `json:"statusReason,omitempty" yaml:"statusReason,omitempty"`
+	CreationTime    time.Time  `json:"creationTime" yaml:"creationTime"`
+	LastUpdatedTime *time.Time `json:"lastUpdatedTime,omitempty" yaml:"lastUpdatedTime,omitempty"`
+}
+
+// StatusReportOutput is a stack output of the status report
+type StatusReportOutput struct {
+	Key         string `json:"key" yaml:"key"`
+	Value       string `json:"value" yaml:"value"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	ExportName  string `json:"exportName,omitempty" yaml:"exportName,omitempty"`
+}
+
+// StatusReportEventSource is an event source of a function in the status
+// report. Type is either the event source mapping service or the principal
+// of the lambda permission.
+type StatusReportEventSource struct {
+	Type   string `json:"type" yaml:"type"`
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	State  string `json:"state,omitempty" yaml:"state,omitempty"`
+}
+
+// StatusReportFunction is the configuration of a provisioned function in
+// the status report
+type StatusReportFunction struct {
+	Name         string                    `json:"name" yaml:"name"`
+	FunctionName string                    `json:"functionName" yaml:"functionName"`
+	ARN          string                    `json:"arn" yaml:"arn"`
+	Runtime      string                    `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	MemorySize   int64                     `json:"memorySize" yaml:"memorySize"`
+	Timeout      int64                     `json:"timeout" yaml:"timeout"`
+	LastModified string                    `json:"lastModified" yaml:"lastModified"`
+	CodeSha256   string                    `json:"codeSha256" yaml:"codeSha256"`
+	CodeSize     int64                     `json:"codeSize" yaml:"codeSize"`
+	EventSources []StatusReportEventSource `json:"eventSources,omitempty" yaml:"eventSources,omitempty"`
+}
+
+// StatusReportAPIEndpoint is an API Gateway endpoint in the status report
+type StatusReportAPIEndpoint struct {
+	Method   string `json:"method" yaml:"method"`
+	Path     string `json:"path" yaml:"path"`
+	URL      string `json:"url,omitempty" yaml:"url,omitempty"`
+	Function string `json:"function" yaml:"function"`
+}
+
+// StatusReportStackEvent is a recent stack event in the status report
+type StatusReportStackEvent struct {
+	Time              time.Time `json:"time" yaml:"time"`
+	LogicalResourceID string    `json:"logicalResourceId" yaml:"logicalResourceId"`
+	ResourceType      string    `json:"resourceType" yaml:"resourceType"`
+	Status            string    `json:"status" yaml:"status"`
+	Reason            string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// StatusReport is the machine readable status of a provisioned service
+// that's produced by the `status` and `describe` commands for the json
+// and yaml formats
+type StatusReport struct {
+	Stack        StatusReportStack         `json:"stack" yaml:"stack"`
+	Parameters   map[string]string         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Tags         map[string]string         `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Outputs      []StatusReportOutput      `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	Functions    []StatusReportFunction    `json:"functions" yaml:"functions"`
+	APIEndpoints []StatusReportAPIEndpoint `json:"apiEndpoints,omitempty" yaml:"apiEndpoints,omitempty"`
+	Events       []StatusReportStackEvent  `json:"events,omitempty" yaml:"events,omitempty"`
+}
+
+// statusReportAPIEndpoints returns the API Gateway endpoints. The URLs are
+// relative to the API Gateway URL stack output.
+func statusReportAPIEndpoints(api APIGateway, apiURL string) []StatusReportAPIEndpoint {
+	endpoints := []StatusReportAPIEndpoint{}
+	typedAPI, typedAPIOk := api.(*API)
+	if !typedAPIOk || typedAPI == nil {
+		return endpoints
+	}
+	for _, eachResource := range typedAPI.resources {
+		for eachMethodName := range eachResource.Methods {
+			endpoint := StatusReportAPIEndpoint{
+				Method:   eachMethodName,
+				Path:     eachResource.pathPart,
+				Function: eachResource.parentLambda.lambdaFunctionName(),
+			}
+			if apiURL != "" {
+				endpoint.URL = strings.TrimSuffix(apiURL, "/") + eachResource.pathPart
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// statusReportPermissionSources returns the event sources granted by the
+// function's resource policy
+func statusReportPermissionSources(policy string) ([]StatusReportEventSource, error) {
+	var resourcePolicy struct {
+		Statement []struct {
+			Principal map[string]interface{}
+			Condition map[string]map[string]interface{}
+		}
+	}
+	unmarshalErr := json.Unmarshal([]byte(policy), &resourcePolicy)
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	sources := []StatusReportEventSource{}
+	for _, eachStatement := range resourcePolicy.Statement {
+		principal, _ := eachStatement.Principal["Service"].(string)
+		if principal == "" {
+			continue
+		}
+		source := ""
+		for _, eachCondition := range eachStatement.Condition {
+			sourceArn, sourceArnOk := eachCondition["AWS:SourceArn"].(string)
+			if sourceArnOk {
+				source = sourceArn
+			}
+		}
+		sources = append(sources, StatusReportEventSource{
+			Type:   principal,
+			Source: source,
+		})
+	}
+	return sources, nil
+}
+
+func statusReportFunction(lambdaSvc *lambda.Lambda,
+	name string,
+	functionName string) (*StatusReportFunction, error) {
+	configuration, configurationErr := lambdaSvc.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(functionName),
+	})
+	if configurationErr != nil {
+		return nil, configurationErr
+	}
+	function := &StatusReportFunction{
+		Name:         name,
+		FunctionName: functionName,
+		ARN:          aws.StringValue(configuration.FunctionArn),
+		Runtime:      aws.StringValue(configuration.Runtime),
+		MemorySize:   aws.Int64Value(configuration.MemorySize),
+		Timeout:      aws.Int64Value(configuration.Timeout),
+		LastModified: aws.StringValue(configuration.LastModified),
+		CodeSha256:   aws.StringValue(configuration.CodeSha256),
+		CodeSize:     aws.Int64Value(configuration.CodeSize),
+		EventSources: []StatusReportEventSource{},
+	}
+	mappingsErr := lambdaSvc.ListEventSourceMappingsPages(&lambda.ListEventSourceMappingsInput{
+		FunctionName: aws.String(functionName),
+	}, func(page *lambda.ListEventSourceMappingsOutput, lastPage bool) bool {
+		for _, eachMapping := range page.EventSourceMappings {
+			sourceArn := aws.StringValue(eachMapping.EventSourceArn)
+			sourceType := "EventSourceMapping"
+			arnParts := strings.Split(sourceArn, ":")
+			if len(arnParts) > 2 {
+				sourceType = arnParts[2]
+			}
+			function.EventSources = append(function.EventSources, StatusReportEventSource{
+				Type:   sourceType,
+				Source: sourceArn,
+				State:  aws.StringValue(eachMapping.State),
+			})
+		}
+		return true
+	})
+	if mappingsErr != nil {
+		return nil, mappingsErr
+	}
+	policy, policyErr := lambdaSvc.GetPolicy(&lambda.GetPolicyInput{
+		FunctionName: aws.String(functionName),
+	})
+	if policyErr != nil {
+		awsErr, awsErrOk := policyErr.(awserr.Error)
+		if !awsErrOk || awsErr.Code() != lambda.ErrCodeResourceNotFoundException {
+			return nil, policyErr
+		}
+	} else {
+		permissionSources, permissionSourcesErr := statusReportPermissionSources(aws.StringValue(policy.Policy))
+		if permissionSourcesErr != nil {
+			return nil, permissionSourcesErr
+		}
+		function.EventSources = append(function.EventSources, permissionSources...)
+	}
+	return function, nil
+}
+
+// NewStatusReport returns the machine readable status of the provisioned
+// service
+func NewStatusReport(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	logger *zerolog.Logger) (*StatusReport, error) {
+
+	awsSession := spartaAWS.NewSession(logger)
+	cfSvc := cloudformation.New(awsSession)
+	describeStacksResponse, describeStacksResponseErr := cfSvc.DescribeStacks(&cloudformation.DescribeStacksInput{
+		StackName: aws.String(serviceName),
+	})
+	if describeStacksResponseErr != nil {
+		return nil, describeStacksResponseErr
+	}
+	if len(describeStacksResponse.Stacks) != 1 {
+		return nil, errors.Errorf("Expected 1 stack for %s. Count: %d",
+			serviceName,
+			len(describeStacksResponse.Stacks))
+	}
+	stackInfo := describeStacksResponse.Stacks[0]
+	report := &StatusReport{
+		Stack: StatusReportStack{
+			Name:            aws.StringValue(stackInfo.StackName),
+			ID:              aws.StringValue(stackInfo.StackId),
+			Description:     aws.StringValue(stackInfo.Description),
+			Status:          aws.StringValue(stackInfo.StackStatus),
+			StatusReason:    aws.StringValue(stackInfo.StackStatusReason),
+			CreationTime:    aws.TimeValue(stackInfo.CreationTime).UTC(),
+			LastUpdatedTime: stackInfo.LastUpdatedTime,
+		},
+		Parameters:   make(map[string]string),
+		Tags:         make(map[string]string),
+		Outputs:      []StatusReportOutput{},
+		Functions:    []StatusReportFunction{},
+		APIEndpoints: []StatusReportAPIEndpoint{},
+		Events:       []StatusReportStackEvent{},
+	}
+	for _, eachParam := range stackInfo.Parameters {
+		report.Parameters[aws.StringValue(eachParam.ParameterKey)] = aws.StringValue(eachParam.ParameterValue)
+	}
+	for _, eachTag := range stackInfo.Tags {
+		report.Tags[aws.StringValue(eachTag.Key)] = aws.StringValue(eachTag.Value)
+	}
+	apiURL := ""
+	for _, eachOutput := range stackInfo.Outputs {
+		report.Outputs = append(report.Outputs, StatusReportOutput{
+			Key:         aws.StringValue(eachOutput.OutputKey),
+			Value:       aws.StringValue(eachOutput.OutputValue),
+			Description: aws.StringValue(eachOutput.Description),
+			ExportName:  aws.StringValue(eachOutput.ExportName),
+		})
+		if aws.StringValue(eachOutput.OutputKey) == OutputAPIGatewayURL {
+			apiURL = aws.StringValue(eachOutput.OutputValue)
+		}
+	}
+	report.APIEndpoints = statusReportAPIEndpoints(api, apiURL)
+
+	// Functions
+	stackResources, stackResourcesErr := spartaCF.StackResources(serviceName, awsSession)
+	if stackResourcesErr != nil {
+		return nil, stackResourcesErr
+	}
+	lambdaSvc := lambda.New(awsSession)
+	for _, eachFunction := range logsFunctions(stackResources, lambdaAWSInfos, nil) {
+		functionName := strings.TrimPrefix(eachFunction.logGroupName, "/aws/lambda/")
+		function, functionErr := statusReportFunction(lambdaSvc, eachFunction.name, functionName)
+		if functionErr != nil {
+			return nil, errors.Wrapf(functionErr, "Failed to describe function: %s", functionName)
+		}
+		report.Functions = append(report.Functions, *function)
+	}
+
+	// Recent events
+	stackEvents, stackEventsErr := cfSvc.DescribeStackEvents(&cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(serviceName),
+	})
+	if stackEventsErr != nil {
+		return nil, stackEventsErr
+	}
+	for _, eachEvent := range stackEvents.StackEvents {
+		if len(report.Events) >= statusReportEventCount {
+			break
+		}
+		report.Events = append(report.Events, StatusReportStackEvent{
+			Time:              aws.TimeValue(eachEvent.Timestamp).UTC(),
+			LogicalResourceID: aws.StringValue(eachEvent.LogicalResourceId),
+			ResourceType:      aws.StringValue(eachEvent.ResourceType),
+			Status:            aws.StringValue(eachEvent.ResourceStatus),
+			Reason:            aws.StringValue(eachEvent.ResourceStatusReason),
+		})
+	}
+	return report, nil
+}
+
+// marshalStatusReport returns the report in the json or yaml format
+func marshalStatusReport(report *StatusReport, format string) ([]byte, error) {
+	switch format {
+	case StatusFormatJSON:
+		return json.MarshalIndent(report, "", "  ")
+	case StatusFormatYAML:
+		return yaml.Marshal(report)
+	default:
+		return nil, errors.Errorf("Unsupported status report format: %s", format)
+	}
+}
+
+// WriteStatusReport writes the machine readable status report of the
+// provisioned service to the writer in the json or yaml format. If redact
+// is true, the AWS account ID is redacted.
+func WriteStatusReport(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	redact bool,
+	format string,
+	writer io.Writer,
+	logger *zerolog.Logger) error {
+
+	report, reportErr := NewStatusReport(serviceName, lambdaAWSInfos, api, logger)
+	if reportErr != nil {
+		return reportErr
+	}
+	reportBytes, reportBytesErr := marshalStatusReport(report, format)
+	if reportBytesErr != nil {
+		return reportBytesErr
+	}
+	redactor, redactorErr := statusRedactor(spartaAWS.NewSession(logger), redact)
+	if redactorErr != nil {
+		return redactorErr
+	}
+	_, writeErr := io.WriteString(writer, redactor(string(reportBytes)))
+	if writeErr != nil {
+		return writeErr
+	}
+	if format == StatusFormatJSON {
+		_, writeErr = io.WriteString(writer, "\n")
+	}
+	return writeErr
+}
@@ -1,7 +1,10 @@
+// +build !lambdabinary
+
 package sparta
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,3 +19,47 @@ func TestStatus(t *testing.T) {
 		t.Fatalf("Failed to error for non-existent stack")
 	}
 }
+
+func TestStatusReportFormat(t *testing.T) {
+	policy := `{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Effect": "Allow",
+			"Principal": {"Service": "s3.amazonaws.com"},
+			"Action": "lambda:InvokeFunction",
+			"Condition": {"ArnLike": {"AWS:SourceArn": "arn:aws:s3:::my-bucket"}}
+		}]
+	}`
+	sources, sourcesErr := statusReportPermissionSources(policy)
+	if sourcesErr != nil ||
+		len(sources) != 1 ||
+		sources[0].Type != "s3.amazonaws.com" ||
+		sources[0].Source != "arn:aws:s3:::my-bucket" {
+		t.Fatalf("Unexpected permission sources: %#v (%v)", sources, sourcesErr)
+	}
+	report := &StatusReport{
+		Stack: StatusReportStack{
+			Name:   "MyStack",
+			Status: "UPDATE_COMPLETE",
+		},
+		Functions: []StatusReportFunction{
+			{
+				Name:         "helloWorld",
+				MemorySize:   128,
+				EventSources: sources,
+			},
+		},
+	}
+	for _, eachFormat := range []string{StatusFormatJSON, StatusFormatYAML} {
+		reportBytes, reportBytesErr := marshalStatusReport(report, eachFormat)
+		if reportBytesErr != nil ||
+			!strings.Contains(string(reportBytes), "memorySize") ||
+			!strings.Contains(string(reportBytes), "arn:aws:s3:::my-bucket") {
+			t.Fatalf("Unexpected %s report: %s (%v)", eachFormat, reportBytes, reportBytesErr)
+		}
+	}
+	_, reportBytesErr := marshalStatusReport(report, StatusFormatHTML)
+	if reportBytesErr == nil {
+		t.Fatalf("Expected error for unsupported format")
+	}
+}
@@ -26,6 +26,10 @@ var (
 	// SpartaTagBuildTagsKey is the keyname used in the CloudFormation Output
 	// that stores the optional user-supplied golang build tags
 	SpartaTagBuildTagsKey = spartaTagName("buildTags")
+
+	// SpartaTagStageKey is the keyname used in the CloudFormation stack tags
+	// that stores the optional --stage name
+	SpartaTagStageKey = spartaTagName("stage")
 )
 
 const (
@@ -43,6 +47,9 @@ const (
 	MetadataParamCodeArchivePath = "CodeArchivePath"
 	// MetadataParamS3SiteArchivePath is the intemediate local path to the S3 site contents
 	MetadataParamS3SiteArchivePath = "S3SiteArtifactPath"
+	// MetadataParamNestedTemplates is the map of nested stack logical IDs to
+	// the intermediate local path of each nested stack template
+	MetadataParamNestedTemplates = "NestedTemplates"
 
 	// Metadata params for OCI builds
 	//
@@ -71,6 +78,8 @@ const (
 	StackOutputBuildTime = "TemplateCreationTime"
 	// StackOutputBuildID is the Output tag that holds the build id
 	StackOutputBuildID = "BuildID"
+	// StackOutputStage is the Output tag that holds the optional stage name
+	StackOutputStage = "Stage"
 )
 
 func showOptionalAWSUsageInfo(err error, logger *zerolog.Logger) {
@@ -0,0 +1,7 @@
+/*Package generator creates new Sparta services from project templates. Each
+template includes a main.go that uses the archetype, archetype/rest and
+decorator packages, a magefile.go wired to the Sparta magefile package, example
+tests that use the Sparta testing package and sample event JSON files for the
+`explore` command. The generator is exposed by the `init` command.
+*/
+package generator
@@ -0,0 +1,198 @@
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// TemplateRESTAPI is an API Gateway REST service built with the
+	// archetype/rest package
+	TemplateRESTAPI = "rest"
+	// TemplateS3Reactor is an S3 event reactor built with the archetype
+	// package
+	TemplateS3Reactor = "s3"
+	// TemplateSQSWorker is an SQS queue consumer
+	TemplateSQSWorker = "sqs"
+	// TemplateStepFunction is a Step Functions workflow of Lambda tasks
+	TemplateStepFunction = "step"
+	// TemplateS3Site is a static S3 site with a REST API
+	TemplateS3Site = "s3site"
+)
+
+// DefaultGoVersion is the go directive of the generated go.mod file
+const DefaultGoVersion = "1.15"
+
+// reServiceName is the set of valid service names. The service name is
+// used as the CloudFormation stack name.
+var reServiceName = regexp.MustCompile(`^[a-zA-Z][-a-zA-Z0-9]*$`)
+
+// Options are the settings for a new service
+type Options struct {
+	// ServiceName is the name of the service and CloudFormation stack
+	ServiceName string
+	// Template is the name of the project template
+	Template string
+	// ModulePath is the Go module path. Defaults to the lowercase
+	// ServiceName
+	ModulePath string
+	// OutputDirectory is the directory for the new project. Defaults to
+	// the lowercase ServiceName
+	OutputDirectory string
+	// SpartaVersion is the Sparta module version to require. v2 and later
+	// versions are required with the +incompatible suffix.
+	SpartaVersion string
+	// GoVersion is the go directive of the go.mod file. Defaults to
+	// DefaultGoVersion
+	GoVersion string
+}
+
+// templateData is the data supplied to each project file template
+type templateData struct {
+	ServiceName   string
+	ResourceName  string
+	ModulePath    string
+	SpartaVersion string
+	GoVersion     string
+	Template      string
+}
+
+// projectFile is a file in a project template
+type projectFile struct {
+	path    string
+	content string
+}
+
+// Templates returns the sorted names of the project templates
+func Templates() []string {
+	names := make([]string, 0, len(projectTemplates))
+	for eachName := range projectTemplates {
+		names = append(names, eachName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceName returns the lowercase, DNS compatible version of the
+// service name that's used for the module path and AWS resource names
+func resourceName(serviceName string) string {
+	return strings.ToLower(serviceName)
+}
+
+// renderFiles returns the rendered project files for the template
+func renderFiles(options *Options) (map[string][]byte, error) {
+	templateFiles, templateFilesExists := projectTemplates[options.Template]
+	if !templateFilesExists {
+		return nil, errors.Errorf("Unsupported template: %s. Supported: %s",
+			options.Template,
+			strings.Join(Templates(), ", "))
+	}
+	if !reServiceName.MatchString(options.ServiceName) {
+		return nil, errors.Errorf("Invalid service name: %s. Service names must start with a letter and only include letters, numbers and hyphens",
+			options.ServiceName)
+	}
+	data := &templateData{
+		ServiceName:   options.ServiceName,
+		ResourceName:  resourceName(options.ServiceName),
+		ModulePath:    options.ModulePath,
+		SpartaVersion: options.SpartaVersion,
+		GoVersion:     options.GoVersion,
+		Template:      options.Template,
+	}
+	if data.ModulePath == "" {
+		data.ModulePath = data.ResourceName
+	}
+	if data.GoVersion == "" {
+		data.GoVersion = DefaultGoVersion
+	}
+	if data.SpartaVersion != "" && !strings.HasPrefix(data.SpartaVersion, "v") {
+		data.SpartaVersion = "v" + data.SpartaVersion
+	}
+	// The Sparta module path doesn't have a major version suffix, so v2+
+	// releases are required as +incompatible versions
+	if data.SpartaVersion != "" && !semver.IsValid(data.SpartaVersion) {
+		return nil, errors.Errorf("Invalid Sparta version: %s", options.SpartaVersion)
+	}
+	switch semver.Major(data.SpartaVersion) {
+	case "", "v0", "v1":
+		// NOP
+	default:
+		if semver.Build(data.SpartaVersion) == "" {
+			data.SpartaVersion += "+incompatible"
+		}
+	}
+	files := append(append([]projectFile{}, commonFiles...), templateFiles...)
+	rendered := make(map[string][]byte, len(files))
+	for _, eachFile := range files {
+		// Use alternate delimiters so that the templates can include Go
+		// and JSON source
+		fileTemplate, fileTemplateErr := template.New(eachFile.path).
+			Delims("[[", "]]").
+			Parse(eachFile.content)
+		if fileTemplateErr != nil {
+			return nil, errors.Wrapf(fileTemplateErr, "Failed to parse template: %s", eachFile.path)
+		}
+		var output bytes.Buffer
+		executeErr := fileTemplate.Execute(&output, data)
+		if executeErr != nil {
+			return nil, errors.Wrapf(executeErr, "Failed to render template: %s", eachFile.path)
+		}
+		rendered[eachFile.path] = output.Bytes()
+	}
+	return rendered, nil
+}
+
+// Generate creates a new service from the project template and returns the
+// paths of the created files. Existing files are never overwritten.
+func Generate(options *Options, logger *zerolog.Logger) ([]string, error) {
+	files, filesErr := renderFiles(options)
+	if filesErr != nil {
+		return nil, filesErr
+	}
+	outputDirectory := options.OutputDirectory
+	if outputDirectory == "" {
+		outputDirectory = resourceName(options.ServiceName)
+	}
+	paths := make([]string, 0, len(files))
+	for eachPath := range files {
+		paths = append(paths, eachPath)
+	}
+	sort.Strings(paths)
+
+	// Check everything before writing anything
+	for _, eachPath := range paths {
+		outputPath := filepath.Join(outputDirectory, filepath.FromSlash(eachPath))
+		_, statErr := os.Stat(outputPath)
+		if statErr == nil {
+			return nil, errors.Errorf("File already exists: %s", outputPath)
+		}
+	}
+	createdPaths := make([]string, 0, len(paths))
+	for _, eachPath := range paths {
+		outputPath := filepath.Join(outputDirectory, filepath.FromSlash(eachPath))
+		mkdirErr := os.MkdirAll(filepath.Dir(outputPath), os.ModePerm)
+		if mkdirErr != nil {
+			return nil, errors.Wrapf(mkdirErr, "Failed to create directory for: %s", outputPath)
+		}
+		/* #nosec */
+		writeErr := ioutil.WriteFile(outputPath, files[eachPath], 0644)
+		if writeErr != nil {
+			return nil, errors.Wrapf(writeErr, "Failed to write: %s", outputPath)
+		}
+		logger.Debug().
+			Str("Path", outputPath).
+			Msg("Created file")
+		createdPaths = append(createdPaths, outputPath)
+	}
+	return createdPaths, nil
+}
@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/mod/modfile"
+)
+
+func testLogger() *zerolog.Logger {
+	logger := zerolog.New(ioutil.Discard)
+	return &logger
+}
+
+func TestGenerateTemplates(t *testing.T) {
+	for _, eachTemplate := range Templates() {
+		outputDir, outputDirErr := ioutil.TempDir("", "sparta-generator")
+		if outputDirErr != nil {
+			t.Fatal(outputDirErr)
+		}
+		defer os.RemoveAll(outputDir)
+
+		createdPaths, generateErr := Generate(&Options{
+			ServiceName:     "MyService",
+			Template:        eachTemplate,
+			OutputDirectory: outputDir,
+			SpartaVersion:   "2.0.0",
+		}, testLogger())
+		if generateErr != nil {
+			t.Fatalf("Failed to generate template %s: %v", eachTemplate, generateErr)
+		}
+		fset := token.NewFileSet()
+		for _, eachPath := range createdPaths {
+			/* #nosec */
+			contents, readErr := ioutil.ReadFile(eachPath)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			switch filepath.Ext(eachPath) {
+			case ".go":
+				_, parseErr := parser.ParseFile(fset, eachPath, contents, parser.AllErrors)
+				if parseErr != nil {
+					t.Fatalf("Template %s produced invalid Go source: %v", eachTemplate, parseErr)
+				}
+			case ".json":
+				if !json.Valid(contents) {
+					t.Fatalf("Template %s produced invalid JSON: %s", eachTemplate, eachPath)
+				}
+			}
+		}
+		goModPath := filepath.Join(outputDir, "go.mod")
+		goMod, goModErr := ioutil.ReadFile(goModPath)
+		if goModErr != nil {
+			t.Fatal(goModErr)
+		}
+		modFile, modFileErr := modfile.Parse(goModPath, goMod, nil)
+		if modFileErr != nil {
+			t.Fatalf("Template %s produced invalid go.mod: %v", eachTemplate, modFileErr)
+		}
+		if modFile.Module.Mod.Path != "myservice" ||
+			len(modFile.Require) != 1 ||
+			modFile.Require[0].Mod.Path != "github.com/mweagle/Sparta" ||
+			modFile.Require[0].Mod.Version != "v2.0.0+incompatible" {
+			t.Fatalf("Unexpected go.mod for template %s:\n%s", eachTemplate, goMod)
+		}
+		t.Logf("Template %s created %d files", eachTemplate, len(createdPaths))
+	}
+}
+
+func TestGenerateExistingFiles(t *testing.T) {
+	outputDir, outputDirErr := ioutil.TempDir("", "sparta-generator")
+	if outputDirErr != nil {
+		t.Fatal(outputDirErr)
+	}
+	defer os.RemoveAll(outputDir)
+
+	mainPath := filepath.Join(outputDir, "main.go")
+	writeErr := ioutil.WriteFile(mainPath, []byte("package main\n"), 0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	_, generateErr := Generate(&Options{
+		ServiceName:     "MyService",
+		Template:        TemplateRESTAPI,
+		OutputDirectory: outputDir,
+	}, testLogger())
+	if generateErr == nil {
+		t.Fatalf("Expected error for existing file")
+	}
+	// Nothing else should have been written
+	_, statErr := os.Stat(filepath.Join(outputDir, "go.mod"))
+	if !os.IsNotExist(statErr) {
+		t.Fatalf("Expected go.mod to not be created")
+	}
+}
+
+func TestGenerateInvalidOptions(t *testing.T) {
+	invalidOptions := []*Options{
+		{
+			ServiceName: "MyService",
+			Template:    "unknown",
+		},
+		{
+			ServiceName: "My Service",
+			Template:    TemplateRESTAPI,
+		},
+		{
+			ServiceName: "",
+			Template:    TemplateRESTAPI,
+		},
+	}
+	for _, eachOptions := range invalidOptions {
+		_, renderErr := renderFiles(eachOptions)
+		if renderErr == nil {
+			t.Fatalf("Expected error for options: %#v", eachOptions)
+		}
+	}
+}
+
+func TestGenerateSpartaVersion(t *testing.T) {
+	expected := map[string]string{
+		"1.15.0":              "v1.15.0",
+		"v2.0.0":              "v2.0.0+incompatible",
+		"v2.0.0+incompatible": "v2.0.0+incompatible",
+	}
+	for eachVersion, eachRequire := range expected {
+		outputDir, outputDirErr := ioutil.TempDir("", "sparta-generator")
+		if outputDirErr != nil {
+			t.Fatal(outputDirErr)
+		}
+		defer os.RemoveAll(outputDir)
+		_, generateErr := Generate(&Options{
+			ServiceName:     "MyService",
+			Template:        Templates()[0],
+			OutputDirectory: outputDir,
+			SpartaVersion:   eachVersion,
+		}, testLogger())
+		if generateErr != nil {
+			t.Fatalf("Failed to generate version %s: %v", eachVersion, generateErr)
+		}
+		goModPath := filepath.Join(outputDir, "go.mod")
+		goMod, _ := ioutil.ReadFile(goModPath)
+		modFile, modFileErr := modfile.Parse(goModPath, goMod, nil)
+		if modFileErr != nil {
+			t.Fatalf("Version %s produced invalid go.mod: %v", eachVersion, modFileErr)
+		}
+		if len(modFile.Require) != 1 || modFile.Require[0].Mod.Version != eachRequire {
+			t.Fatalf("Expected version %s to require %s:\n%s", eachVersion, eachRequire, goMod)
+		}
+	}
+	_, invalidErr := Generate(&Options{
+		ServiceName:   "MyService",
+		Template:      Templates()[0],
+		SpartaVersion: "latest",
+	}, testLogger())
+	if invalidErr == nil {
+		t.Fatalf("Expected error for invalid Sparta version")
+	}
+}
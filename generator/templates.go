@@ -0,0 +1,963 @@
+package generator
+
+// Project templates are text/template sources that use [[ and ]] as the
+// action delimiters.
+
+// commonFiles are included in every project
+var commonFiles = []projectFile{
+	{
+		path: "go.mod",
+		content: `module [[.ModulePath]]
+
+go [[.GoVersion]]
+[[if .SpartaVersion]]
+require github.com/mweagle/Sparta [[.SpartaVersion]]
+[[end]]`,
+	},
+	{
+		path: ".gitignore",
+		content: `.sparta/
+graph.html
+`,
+	},
+	{
+		path: "magefile.go",
+		content: `// +build mage
+
+package main
+
+import (
+	"os"
+
+	spartaMage "github.com/mweagle/Sparta/magefile"
+)
+
+// s3Bucket returns the S3 bucket for the packaged artifacts
+func s3Bucket() string {
+	return os.Getenv("S3_BUCKET")
+}
+
+// Test runs the service tests
+func Test() error {
+	return spartaMage.Test()
+}
+
+// Build the service
+func Build() error {
+	return spartaMage.Build()
+}
+
+// Provision the service. Requires env.S3_BUCKET
+func Provision() error {
+	return spartaMage.Provision(s3Bucket())
+}
+
+// Describe the service by producing an HTML representation. Requires
+// env.S3_BUCKET
+func Describe() error {
+	return spartaMage.Describe(s3Bucket())
+}
+
+// Explore the provisioned service with the sample events
+func Explore() error {
+	return spartaMage.Explore()
+}
+
+// Status report if the stack has been provisioned
+func Status() error {
+	return spartaMage.Status()
+}
+
+// Delete the service, iff it exists
+func Delete() error {
+	return spartaMage.Delete()
+}
+
+// Version information
+func Version() error {
+	return spartaMage.Version()
+}
+`,
+	},
+	{
+		path: "README.md",
+		content: `# [[.ServiceName]]
+
+A [Sparta](https://gosparta.io) service created from the ` + "`[[.Template]]`" + ` template.
+
+## Usage
+
+Install the dependencies and run the tests:
+
+` + "```bash" + `
+go mod tidy
+go test ./...
+` + "```" + `
+
+Provision the service with [mage](https://magefile.org):
+
+` + "```bash" + `
+export S3_BUCKET=my-artifact-bucket
+mage provision
+` + "```" + `
+
+or with ` + "`go run`" + `:
+
+` + "```bash" + `
+go run main.go provision --s3Bucket $S3_BUCKET
+` + "```" + `
+
+The _events_ directory includes sample events that can be sent to the
+provisioned functions with ` + "`go run main.go explore`" + ` or
+` + "`go run main.go invoke --payload events/<name>.json`" + `.
+`,
+	},
+}
+
+// projectTemplates are the template specific files
+var projectTemplates = map[string][]projectFile{
+	TemplateRESTAPI: {
+		{
+			path:    "main.go",
+			content: restMainGo,
+		},
+		{
+			path:    "main_test.go",
+			content: restMainTestGo,
+		},
+		{
+			path:    "events/hello.json",
+			content: apiGatewayEventJSON,
+		},
+	},
+	TemplateS3Reactor: {
+		{
+			path:    "main.go",
+			content: s3MainGo,
+		},
+		{
+			path:    "main_test.go",
+			content: s3MainTestGo,
+		},
+		{
+			path:    "events/s3-put.json",
+			content: s3EventJSON,
+		},
+	},
+	TemplateSQSWorker: {
+		{
+			path:    "main.go",
+			content: sqsMainGo,
+		},
+		{
+			path:    "main_test.go",
+			content: sqsMainTestGo,
+		},
+		{
+			path:    "events/sqs.json",
+			content: sqsEventJSON,
+		},
+	},
+	TemplateStepFunction: {
+		{
+			path:    "main.go",
+			content: stepMainGo,
+		},
+		{
+			path:    "main_test.go",
+			content: stepMainTestGo,
+		},
+		{
+			path:    "events/order.json",
+			content: orderEventJSON,
+		},
+	},
+	TemplateS3Site: {
+		{
+			path:    "main.go",
+			content: s3SiteMainGo,
+		},
+		{
+			path:    "main_test.go",
+			content: restMainTestGo,
+		},
+		{
+			path:    "events/hello.json",
+			content: apiGatewayEventJSON,
+		},
+		{
+			path:    "site/index.html",
+			content: s3SiteIndexHTML,
+		},
+	},
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// REST API
+//
+
+const restMainGo = `package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/archetype/rest"
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	"github.com/mweagle/Sparta/decorator"
+	"github.com/rs/zerolog"
+)
+
+const (
+	serviceName        = "[[.ServiceName]]"
+	serviceDescription = "[[.ServiceName]] REST API"
+)
+
+// helloResource is the /hello REST resource
+type helloResource struct {
+}
+
+// Get returns a greeting for the optional name query parameter
+func (resource *helloResource) Get(ctx context.Context,
+	apigRequest spartaAWSEvents.APIGatewayRequest) (*spartaAPIGateway.Response, error) {
+	name := apigRequest.QueryParams["name"]
+	if name == "" {
+		name = "world"
+	}
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	if loggerOk {
+		logger.Info().
+			Str("Name", name).
+			Msg("Hello request")
+	}
+	return spartaAPIGateway.NewResponse(http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("Hello %s", name),
+	}), nil
+}
+
+// ResourceDefinition returns the handlers for the /hello resource
+func (resource *helloResource) ResourceDefinition() (rest.ResourceDefinition, error) {
+	return rest.ResourceDefinition{
+		URL: "/hello",
+		MethodHandlers: rest.MethodHandlerMap{
+			http.MethodGet: rest.NewMethodHandler(resource.Get, http.StatusOK).
+				StatusCodes(http.StatusInternalServerError),
+		},
+	}, nil
+}
+
+// service returns the service's Lambda functions, API and workflow hooks
+func service() ([]*sparta.LambdaAWSInfo, *sparta.API, *sparta.WorkflowHooks, error) {
+	api := sparta.NewAPIGateway(serviceName, sparta.NewStage("v1"))
+	api.CORSEnabled = true
+
+	lambdaFunctions, registerErr := rest.RegisterResource(api, &helloResource{})
+	if registerErr != nil {
+		return nil, nil, nil, registerErr
+	}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			decorator.DashboardDecorator(lambdaFunctions, 60),
+		},
+	}
+	return lambdaFunctions, api, workflowHooks, nil
+}
+
+func main() {
+	lambdaFunctions, api, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %s\n", serviceErr)
+		os.Exit(1)
+	}
+	err := sparta.MainEx(serviceName,
+		serviceDescription,
+		lambdaFunctions,
+		api,
+		nil,
+		workflowHooks,
+		false)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+const restMainTestGo = `package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+)
+
+func TestHelloResource(t *testing.T) {
+	request, requestErr := spartaAWSEvents.NewAPIGatewayMockRequest("hello",
+		http.MethodGet,
+		map[string]string{
+			"method.request.querystring.name": "Sparta",
+		},
+		nil)
+	if requestErr != nil {
+		t.Fatal(requestErr)
+	}
+	response, responseErr := (&helloResource{}).Get(context.Background(), *request)
+	if responseErr != nil || response.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %#v (%v)", response, responseErr)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	lambdaFunctions, api, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		t.Fatal(serviceErr)
+	}
+	spartaTesting.ProvisionEx(t,
+		lambdaFunctions,
+		api,
+		nil,
+		workflowHooks,
+		false,
+		nil)
+}
+`
+
+const apiGatewayEventJSON = `{
+  "method": "GET",
+  "headers": {
+    "Accept": "application/json"
+  },
+  "queryParams": {
+    "name": "Sparta"
+  },
+  "pathParams": {},
+  "context": {
+    "resourcePath": "/hello",
+    "stage": "v1"
+  },
+  "body": {}
+}
+`
+
+////////////////////////////////////////////////////////////////////////////////
+// S3 reactor
+//
+
+const s3MainGo = `package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/archetype"
+	"github.com/mweagle/Sparta/decorator"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/rs/zerolog"
+)
+
+const (
+	serviceName        = "[[.ServiceName]]"
+	serviceDescription = "[[.ServiceName]] S3 reactor"
+)
+
+// reactorBucketName returns the existing S3 bucket whose events are sent to
+// the reactor. Set env.S3_REACTOR_BUCKET to override the default.
+func reactorBucketName() string {
+	bucketName := os.Getenv("S3_REACTOR_BUCKET")
+	if bucketName == "" {
+		bucketName = "[[.ResourceName]]-uploads"
+	}
+	return bucketName
+}
+
+// onS3Event is called for every object that's created or removed
+func onS3Event(ctx context.Context, s3Event awsLambdaEvents.S3Event) (interface{}, error) {
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	for _, eachRecord := range s3Event.Records {
+		if loggerOk {
+			logger.Info().
+				Str("EventName", eachRecord.EventName).
+				Str("Bucket", eachRecord.S3.Bucket.Name).
+				Str("Key", eachRecord.S3.Object.Key).
+				Msg("S3 event")
+		}
+	}
+	return len(s3Event.Records), nil
+}
+
+// service returns the service's Lambda functions and workflow hooks
+func service() ([]*sparta.LambdaAWSInfo, *sparta.WorkflowHooks, error) {
+	reactorFn, reactorFnErr := archetype.NewS3Reactor(archetype.S3ReactorFunc(onS3Event),
+		gocf.String(reactorBucketName()),
+		nil)
+	if reactorFnErr != nil {
+		return nil, nil, reactorFnErr
+	}
+	lambdaFunctions := []*sparta.LambdaAWSInfo{reactorFn}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			decorator.DashboardDecorator(lambdaFunctions, 60),
+		},
+	}
+	return lambdaFunctions, workflowHooks, nil
+}
+
+func main() {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %s\n", serviceErr)
+		os.Exit(1)
+	}
+	err := sparta.MainEx(serviceName,
+		serviceDescription,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+const s3MainTestGo = `package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+)
+
+func TestOnS3Event(t *testing.T) {
+	eventBytes, eventBytesErr := ioutil.ReadFile("events/s3-put.json")
+	if eventBytesErr != nil {
+		t.Fatal(eventBytesErr)
+	}
+	var s3Event awsLambdaEvents.S3Event
+	unmarshalErr := json.Unmarshal(eventBytes, &s3Event)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	count, countErr := onS3Event(context.Background(), s3Event)
+	if countErr != nil || count != 1 {
+		t.Fatalf("Unexpected result: %v (%v)", count, countErr)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		t.Fatal(serviceErr)
+	}
+	spartaTesting.ProvisionEx(t,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false,
+		nil)
+}
+`
+
+const s3EventJSON = `{
+  "Records": [
+    {
+      "eventVersion": "2.1",
+      "eventSource": "aws:s3",
+      "awsRegion": "us-west-2",
+      "eventTime": "2021-01-01T00:00:00.000Z",
+      "eventName": "ObjectCreated:Put",
+      "s3": {
+        "s3SchemaVersion": "1.0",
+        "bucket": {
+          "name": "[[.ResourceName]]-uploads",
+          "arn": "arn:aws:s3:::[[.ResourceName]]-uploads"
+        },
+        "object": {
+          "key": "uploads/sample.json",
+          "size": 1024,
+          "eTag": "0123456789abcdef0123456789abcdef"
+        }
+      }
+    }
+  ]
+}
+`
+
+////////////////////////////////////////////////////////////////////////////////
+// SQS worker
+//
+
+const sqsMainGo = `package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/decorator"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/rs/zerolog"
+)
+
+const (
+	serviceName        = "[[.ServiceName]]"
+	serviceDescription = "[[.ServiceName]] SQS worker"
+
+	// workerQueueResourceName is the logical name of the worker queue
+	workerQueueResourceName = "WorkerQueue"
+)
+
+// processMessages is called with each batch of queue messages. Returning
+// an error makes the batch visible in the queue again.
+func processMessages(ctx context.Context, sqsEvent awsLambdaEvents.SQSEvent) error {
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	for _, eachMessage := range sqsEvent.Records {
+		if loggerOk {
+			logger.Info().
+				Str("MessageID", eachMessage.MessageId).
+				Str("Body", eachMessage.Body).
+				Msg("Processing message")
+		}
+	}
+	return nil
+}
+
+// workerQueueDecorator adds the worker queue to the template
+func workerQueueDecorator(ctx context.Context,
+	serviceName string,
+	template *gocf.Template,
+	lambdaFunctionCode *gocf.LambdaFunctionCode,
+	buildID string,
+	awsSession *session.Session,
+	noop bool,
+	logger *zerolog.Logger) (context.Context, error) {
+	template.AddResource(workerQueueResourceName, &gocf.SQSQueue{
+		VisibilityTimeout: gocf.Integer(60),
+	})
+	template.Outputs[workerQueueResourceName+"URL"] = &gocf.Output{
+		Description: "Worker queue URL",
+		Value:       gocf.Ref(workerQueueResourceName),
+	}
+	return ctx, nil
+}
+
+// service returns the service's Lambda functions and workflow hooks
+func service() ([]*sparta.LambdaAWSInfo, *sparta.WorkflowHooks, error) {
+	queueArn := gocf.GetAtt(workerQueueResourceName, "Arn")
+	workerFn, workerFnErr := sparta.NewAWSLambda(sparta.LambdaName(processMessages),
+		processMessages,
+		sparta.IAMRoleDefinition{
+			Privileges: []sparta.IAMRolePrivilege{{
+				Actions: []string{"sqs:ReceiveMessage",
+					"sqs:DeleteMessage",
+					"sqs:GetQueueAttributes"},
+				Resource: queueArn,
+			}},
+		})
+	if workerFnErr != nil {
+		return nil, nil, workerFnErr
+	}
+	workerFn.EventSourceMappings = append(workerFn.EventSourceMappings,
+		&sparta.EventSourceMapping{
+			EventSourceArn: queueArn,
+			BatchSize:      10,
+		})
+	lambdaFunctions := []*sparta.LambdaAWSInfo{workerFn}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			sparta.ServiceDecoratorHookFunc(workerQueueDecorator),
+			decorator.DashboardDecorator(lambdaFunctions, 60),
+		},
+	}
+	return lambdaFunctions, workflowHooks, nil
+}
+
+func main() {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %s\n", serviceErr)
+		os.Exit(1)
+	}
+	err := sparta.MainEx(serviceName,
+		serviceDescription,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+const sqsMainTestGo = `package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	awsLambdaEvents "github.com/aws/aws-lambda-go/events"
+	spartaTesting "github.com/mweagle/Sparta/testing"
+)
+
+func TestProcessMessages(t *testing.T) {
+	eventBytes, eventBytesErr := ioutil.ReadFile("events/sqs.json")
+	if eventBytesErr != nil {
+		t.Fatal(eventBytesErr)
+	}
+	var sqsEvent awsLambdaEvents.SQSEvent
+	unmarshalErr := json.Unmarshal(eventBytes, &sqsEvent)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	processErr := processMessages(context.Background(), sqsEvent)
+	if processErr != nil {
+		t.Fatal(processErr)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		t.Fatal(serviceErr)
+	}
+	spartaTesting.ProvisionEx(t,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false,
+		nil)
+}
+`
+
+const sqsEventJSON = `{
+  "Records": [
+    {
+      "messageId": "059f36b4-87a3-44ab-83d2-661975830a7d",
+      "receiptHandle": "AQEBwJnKyrHigUMZj6rYigCgxlaS3SLy0a",
+      "body": "{\"hello\":\"world\"}",
+      "attributes": {
+        "ApproximateReceiveCount": "1",
+        "SentTimestamp": "1609459200000"
+      },
+      "messageAttributes": {},
+      "md5OfBody": "49dfdd54b01cbcd2d2ab5e9e5ee6b9b9",
+      "eventSource": "aws:sqs",
+      "eventSourceARN": "arn:aws:sqs:us-west-2:123456789012:[[.ServiceName]]-WorkerQueue",
+      "awsRegion": "us-west-2"
+    }
+  ]
+}
+`
+
+////////////////////////////////////////////////////////////////////////////////
+// Step function workflow
+//
+
+const stepMainGo = `package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/aws/step"
+	"github.com/mweagle/Sparta/decorator"
+	"github.com/rs/zerolog"
+)
+
+const (
+	serviceName        = "[[.ServiceName]]"
+	serviceDescription = "[[.ServiceName]] Step Functions workflow"
+)
+
+// validateOrder is the first task of the workflow
+func validateOrder(ctx context.Context,
+	order map[string]interface{}) (map[string]interface{}, error) {
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	if loggerOk {
+		logger.Info().
+			Interface("Order", order).
+			Msg("Validating order")
+	}
+	if _, hasID := order["orderID"]; !hasID {
+		return nil, fmt.Errorf("order is missing the orderID")
+	}
+	order["validated"] = true
+	return order, nil
+}
+
+// processOrder is the final task of the workflow
+func processOrder(ctx context.Context,
+	order map[string]interface{}) (map[string]interface{}, error) {
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	if loggerOk {
+		logger.Info().
+			Interface("Order", order).
+			Msg("Processing order")
+	}
+	order["processed"] = true
+	return order, nil
+}
+
+// service returns the service's Lambda functions and the workflow hooks
+// that provision the state machine
+func service() ([]*sparta.LambdaAWSInfo, *sparta.WorkflowHooks, error) {
+	validateFn, validateFnErr := sparta.NewAWSLambda(sparta.LambdaName(validateOrder),
+		validateOrder,
+		sparta.IAMRoleDefinition{})
+	if validateFnErr != nil {
+		return nil, nil, validateFnErr
+	}
+	processFn, processFnErr := sparta.NewAWSLambda(sparta.LambdaName(processOrder),
+		processOrder,
+		sparta.IAMRoleDefinition{})
+	if processFnErr != nil {
+		return nil, nil, processFnErr
+	}
+
+	// validate -> wait -> process -> success
+	validateState := step.NewLambdaTaskState("validateOrder", validateFn)
+	waitState := step.NewWaitDelayState("waitForInventory", 5*time.Second)
+	processState := step.NewLambdaTaskState("processOrder", processFn)
+	successState := step.NewSuccessState("success")
+	validateState.Next(waitState)
+	waitState.Next(processState)
+	processState.Next(successState)
+	stateMachine := step.NewStateMachine(serviceName+"StateMachine", validateState)
+
+	lambdaFunctions := []*sparta.LambdaAWSInfo{validateFn, processFn}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			stateMachine.StateMachineDecorator(),
+			decorator.DashboardDecorator(lambdaFunctions, 60),
+		},
+	}
+	return lambdaFunctions, workflowHooks, nil
+}
+
+func main() {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %s\n", serviceErr)
+		os.Exit(1)
+	}
+	err := sparta.MainEx(serviceName,
+		serviceDescription,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+const stepMainTestGo = `package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	spartaTesting "github.com/mweagle/Sparta/testing"
+)
+
+func TestOrderTasks(t *testing.T) {
+	eventBytes, eventBytesErr := ioutil.ReadFile("events/order.json")
+	if eventBytesErr != nil {
+		t.Fatal(eventBytesErr)
+	}
+	var order map[string]interface{}
+	unmarshalErr := json.Unmarshal(eventBytes, &order)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	validated, validatedErr := validateOrder(context.Background(), order)
+	if validatedErr != nil {
+		t.Fatal(validatedErr)
+	}
+	processed, processedErr := processOrder(context.Background(), validated)
+	if processedErr != nil || processed["processed"] != true {
+		t.Fatalf("Unexpected result: %#v (%v)", processed, processedErr)
+	}
+	_, invalidErr := validateOrder(context.Background(), map[string]interface{}{})
+	if invalidErr == nil {
+		t.Fatalf("Expected error for order without an orderID")
+	}
+}
+
+func TestProvision(t *testing.T) {
+	lambdaFunctions, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		t.Fatal(serviceErr)
+	}
+	spartaTesting.ProvisionEx(t,
+		lambdaFunctions,
+		nil,
+		nil,
+		workflowHooks,
+		false,
+		nil)
+}
+`
+
+const orderEventJSON = `{
+  "orderID": "1234",
+  "sku": "SPARTA-HELMET",
+  "quantity": 2
+}
+`
+
+////////////////////////////////////////////////////////////////////////////////
+// Static S3 site
+//
+
+const s3SiteMainGo = `package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/archetype/rest"
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
+	spartaAWSEvents "github.com/mweagle/Sparta/aws/events"
+	"github.com/mweagle/Sparta/decorator"
+	"github.com/rs/zerolog"
+)
+
+const (
+	serviceName        = "[[.ServiceName]]"
+	serviceDescription = "[[.ServiceName]] static S3 site"
+)
+
+// helloResource is the /hello REST resource that's called by the site
+type helloResource struct {
+}
+
+// Get returns a greeting for the optional name query parameter
+func (resource *helloResource) Get(ctx context.Context,
+	apigRequest spartaAWSEvents.APIGatewayRequest) (*spartaAPIGateway.Response, error) {
+	name := apigRequest.QueryParams["name"]
+	if name == "" {
+		name = "world"
+	}
+	logger, loggerOk := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+	if loggerOk {
+		logger.Info().
+			Str("Name", name).
+			Msg("Hello request")
+	}
+	return spartaAPIGateway.NewResponse(http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("Hello %s", name),
+	}), nil
+}
+
+// ResourceDefinition returns the handlers for the /hello resource
+func (resource *helloResource) ResourceDefinition() (rest.ResourceDefinition, error) {
+	return rest.ResourceDefinition{
+		URL: "/hello",
+		MethodHandlers: rest.MethodHandlerMap{
+			http.MethodGet: rest.NewMethodHandler(resource.Get, http.StatusOK).
+				StatusCodes(http.StatusInternalServerError),
+		},
+	}, nil
+}
+
+// service returns the service's Lambda functions, API and workflow hooks
+func service() ([]*sparta.LambdaAWSInfo, *sparta.API, *sparta.WorkflowHooks, error) {
+	api := sparta.NewAPIGateway(serviceName, sparta.NewStage("v1"))
+	api.CORSEnabled = true
+
+	lambdaFunctions, registerErr := rest.RegisterResource(api, &helloResource{})
+	if registerErr != nil {
+		return nil, nil, nil, registerErr
+	}
+	workflowHooks := &sparta.WorkflowHooks{
+		ServiceDecorators: []sparta.ServiceDecoratorHookHandler{
+			decorator.DashboardDecorator(lambdaFunctions, 60),
+		},
+	}
+	return lambdaFunctions, api, workflowHooks, nil
+}
+
+func main() {
+	lambdaFunctions, api, workflowHooks, serviceErr := service()
+	if serviceErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %s\n", serviceErr)
+		os.Exit(1)
+	}
+	// The contents of ./site are published to the site bucket. The API
+	// URL is available to the site in the MANIFEST.json file.
+	site, siteErr := sparta.NewS3Site("./site")
+	if siteErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create site: %s\n", siteErr)
+		os.Exit(1)
+	}
+	err := sparta.MainEx(serviceName,
+		serviceDescription,
+		lambdaFunctions,
+		api,
+		site,
+		workflowHooks,
+		false)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+`
+
+const s3SiteIndexHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>[[.ServiceName]]</title>
+</head>
+<body>
+  <h1>[[.ServiceName]]</h1>
+  <p id="message"></p>
+  <script>
+    fetch("MANIFEST.json")
+      .then(function (response) { return response.json(); })
+      .then(function (discovery) {
+        var apiURL = discovery.APIGatewayURL.Value;
+        return fetch(apiURL + "/hello?name=Sparta");
+      })
+      .then(function (response) { return response.json(); })
+      .then(function (hello) {
+        document.getElementById("message").textContent = hello.message;
+      });
+  </script>
+</body>
+</html>
+`
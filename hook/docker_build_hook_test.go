@@ -58,6 +58,8 @@ func TestBuildUPXImage(t *testing.T) {
 		"",
 		"",
 		"",
+		"",
+		"",
 		&templateWriter,
 		workflowHooks,
 		logger)
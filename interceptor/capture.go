@@ -0,0 +1,164 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	sparta "github.com/mweagle/Sparta"
+	spartaAWS "github.com/mweagle/Sparta/aws"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// PayloadRedactedValue is the value that replaces redacted payload fields
+	PayloadRedactedValue = sparta.PayloadRedactedValue
+)
+
+// PayloadCaptureOptions are the options for the payload capture interceptor
+type PayloadCaptureOptions struct {
+	// S3Bucket is the name of the bucket that stores the captured payloads
+	S3Bucket string
+	// S3KeyPrefix is the key prefix for captured payloads. Payloads
+	// are stored at {S3KeyPrefix}/{functionName}/{requestID}.json
+	S3KeyPrefix string
+	// SampleRate is the fraction of invocations, in the range [0, 1], to capture
+	SampleRate float64
+	// RedactPaths are the JSONPath expressions (eg: `$.headers.Authorization`,
+	// `$.Records[*].body`, `$.detail['credit-card']`) of the event and
+	// response fields to redact
+	RedactPaths []string
+}
+
+// captureContextKey is the context key for the sampling decision
+type captureContextKey struct{}
+
+// payloadCaptureInterceptor is an implementation of sparta.LambdaEventInterceptors
+// that saves a sample of the events and responses to S3
+type payloadCaptureInterceptor struct {
+	options  PayloadCaptureOptions
+	redactor *sparta.PayloadRedactor
+}
+
+func (pci *payloadCaptureInterceptor) capture(ctx context.Context, msg json.RawMessage) error {
+	payload := &sparta.CapturedPayload{
+		FunctionName: os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		BuildID:      sparta.StampedBuildID,
+		Timestamp:    time.Now().UTC(),
+		RedactPaths:  pci.options.RedactPaths,
+	}
+	lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+	if lambdaContextOk {
+		payload.RequestID = lambdaContext.AwsRequestID
+	}
+	var redactErr error
+	payload.Event, redactErr = pci.redactor.Redact(msg)
+	if redactErr != nil {
+		return errors.Wrapf(redactErr, "Failed to redact event")
+	}
+	errValue, _ := ctx.Value(sparta.ContextKeyLambdaError).(error)
+	if errValue != nil {
+		payload.Error = errValue.Error()
+	} else {
+		responseBytes, responseBytesErr := json.Marshal(ctx.Value(sparta.ContextKeyLambdaResponse))
+		if responseBytesErr != nil {
+			return errors.Wrapf(responseBytesErr, "Failed to marshal response")
+		}
+		payload.Response, redactErr = pci.redactor.Redact(responseBytes)
+		if redactErr != nil {
+			return errors.Wrapf(redactErr, "Failed to redact response")
+		}
+	}
+	payloadBytes, payloadBytesErr := json.Marshal(payload)
+	if payloadBytesErr != nil {
+		return payloadBytesErr
+	}
+	awsSession, awsSessionOk := ctx.Value(sparta.ContextKeyAWSSession).(*session.Session)
+	if !awsSessionOk {
+		logger, _ := ctx.Value(sparta.ContextKeyLogger).(*zerolog.Logger)
+		awsSession = spartaAWS.NewSession(logger)
+	}
+	putObjectInput := &s3.PutObjectInput{
+		Bucket: aws.String(pci.options.S3Bucket),
+		Key: aws.String(sparta.CapturedPayloadKey(pci.options.S3KeyPrefix,
+			payload.FunctionName,
+			payload.RequestID)),
+		Body:        bytes.NewReader(payloadBytes),
+		ContentType: aws.String("application/json"),
+	}
+	_, putErr := s3.New(awsSession).PutObjectWithContext(ctx, putObjectInput)
+	return putErr
+}
+
+func (pci *payloadCaptureInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	if pci.options.SampleRate > 0 && rand.Float64() < pci.options.SampleRate {
+		ctx = context.WithValue(ctx, captureContextKey{}, true)
+	}
+	return ctx
+}
+
+func (pci *payloadCaptureInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pci *payloadCaptureInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pci *payloadCaptureInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pci *payloadCaptureInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pci *payloadCaptureInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	sampled, _ := ctx.Value(captureContextKey{}).(bool)
+	if !sampled {
+		return ctx
+	}
+	captureErr := pci.capture(ctx, msg)
+	if captureErr != nil {
+		logger, loggerOk := ctx.Value(sparta.ContextKeyRequestLogger).(*zerolog.Logger)
+		if loggerOk {
+			logger.Warn().
+				Err(captureErr).
+				Str("Bucket", pci.options.S3Bucket).
+				Msg("Failed to capture payload")
+		}
+	}
+	return ctx
+}
+
+// RegisterPayloadCaptureInterceptor saves a sample of the incoming events,
+// together with the function response or error, to S3 so that they can be
+// replayed with the `replay` command. The lambda function's IAM role
+// must have s3:PutObject access to the bucket. Invalid RedactPaths
+// expressions return an error.
+func RegisterPayloadCaptureInterceptor(handler *sparta.LambdaEventInterceptors,
+	options PayloadCaptureOptions) (*sparta.LambdaEventInterceptors, error) {
+	if options.S3Bucket == "" {
+		return nil, errors.New("PayloadCaptureOptions.S3Bucket must not be empty")
+	}
+	redactor, redactorErr := sparta.NewPayloadRedactor(options.RedactPaths)
+	if redactorErr != nil {
+		return nil, redactorErr
+	}
+	interceptor := &payloadCaptureInterceptor{
+		options:  options,
+		redactor: redactor,
+	}
+	if handler == nil {
+		handler = &sparta.LambdaEventInterceptors{}
+	}
+	return handler.Register(interceptor), nil
+}
@@ -0,0 +1,234 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmespath/go-jmespath"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/aws/accessor"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// IdempotencyStatusInProgress is the status of an idempotency record
+	// whose event is currently being handled
+	IdempotencyStatusInProgress = "INPROGRESS"
+
+	// IdempotencyStatusCompleted is the status of an idempotency record
+	// whose event was successfully handled
+	IdempotencyStatusCompleted = "COMPLETED"
+
+	// IdempotencyKeyPrefix is the prefix of all keys written to the
+	// idempotency store
+	IdempotencyKeyPrefix = "idempotency/"
+)
+
+// IdempotencyInProgressError is the error returned for a duplicate event
+// that is received while the original event is still being handled. Returning
+// an error ensures that queue based event sources retry the duplicate.
+type IdempotencyInProgressError struct {
+	// Key is the idempotency key of the event
+	Key string
+}
+
+// Error satisfies the error interface
+func (iie *IdempotencyInProgressError) Error() string {
+	return fmt.Sprintf("Event with idempotency key %s is already in progress", iie.Key)
+}
+
+// idempotencyRecord is the value persisted in the accessor store
+type idempotencyRecord struct {
+	Key      string          `json:"key"`
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// idempotencyContextKey is the context key used to thread the
+// idempotency key from the ShortCircuit to the Complete interceptor
+type idempotencyContextKey struct {
+	interceptor *idempotencyInterceptor
+}
+
+// idempotencyInterceptor is an implementation of sparta.LambdaEventInterceptors
+// that returns the stored result for duplicate events
+type idempotencyInterceptor struct {
+	store      accessor.ExpiringKeyValueAccessor
+	expression string
+	ttl        time.Duration
+}
+
+func (ii *idempotencyInterceptor) logger(ctx context.Context) *zerolog.Logger {
+	logger, loggerOk := ctx.Value(sparta.ContextKeyRequestLogger).(*zerolog.Logger)
+	if !loggerOk {
+		nopLogger := zerolog.Nop()
+		logger = &nopLogger
+	}
+	return logger
+}
+
+// idempotencyKey returns the key for the message or the empty string if the
+// expression doesn't select a value
+func (ii *idempotencyInterceptor) idempotencyKey(msg json.RawMessage) (string, error) {
+	var data interface{}
+	unmarshalErr := json.Unmarshal(msg, &data)
+	if unmarshalErr != nil {
+		return "", errors.Wrapf(unmarshalErr, "Failed to unmarshal event")
+	}
+	selected, selectedErr := jmespath.Search(ii.expression, data)
+	if selectedErr != nil {
+		return "", errors.Wrapf(selectedErr,
+			"Failed to evaluate idempotency expression: %s",
+			ii.expression)
+	}
+	if selected == nil {
+		return "", nil
+	}
+	selectedBytes, selectedBytesErr := json.Marshal(selected)
+	if selectedBytesErr != nil {
+		return "", selectedBytesErr
+	}
+	hash := sha256.Sum256(selectedBytes)
+	return IdempotencyKeyPrefix + hex.EncodeToString(hash[:]), nil
+}
+
+func (ii *idempotencyInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (ii *idempotencyInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (ii *idempotencyInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (ii *idempotencyInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (ii *idempotencyInterceptor) ShortCircuit(ctx context.Context,
+	msg json.RawMessage) (context.Context, interface{}, bool, error) {
+	logger := ii.logger(ctx)
+
+	key, keyErr := ii.idempotencyKey(msg)
+	if keyErr != nil || key == "" {
+		logger.Warn().
+			Err(keyErr).
+			Str("Expression", ii.expression).
+			Msg("Failed to compute idempotency key. Event will be handled.")
+		return ctx, nil, false, nil
+	}
+	// The in progress record shouldn't outlive the function invocation,
+	// otherwise a crashed invocation would block retries until the TTL.
+	expiry := time.Now().Add(ii.ttl)
+	deadline, deadlineOk := ctx.Deadline()
+	if deadlineOk && deadline.Before(expiry) {
+		expiry = deadline
+	}
+	inProgress := &idempotencyRecord{
+		Key:    key,
+		Status: IdempotencyStatusInProgress,
+	}
+	// The conditional create ensures that only one of several concurrent
+	// duplicate deliveries calls the handler
+	createErr := ii.store.CreateWithExpiry(ctx, key, inProgress, expiry)
+	if createErr == accessor.ErrKeyExists {
+		var existing idempotencyRecord
+		getErr := ii.store.Get(ctx, key, &existing)
+		if getErr == nil && existing.Status == IdempotencyStatusCompleted {
+			logger.Info().
+				Str("Key", key).
+				Msg("Returning stored response for duplicate event")
+			return ctx, existing.Response, true, nil
+		}
+		return ctx, nil, true, &IdempotencyInProgressError{Key: key}
+	}
+	if createErr != nil {
+		logger.Warn().
+			Err(createErr).
+			Str("Key", key).
+			Msg("Failed to save in progress idempotency record")
+		return ctx, nil, false, nil
+	}
+	ctx = context.WithValue(ctx, idempotencyContextKey{ii}, key)
+	return ctx, nil, false, nil
+}
+
+func (ii *idempotencyInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (ii *idempotencyInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	key, keyOk := ctx.Value(idempotencyContextKey{ii}).(string)
+	if !keyOk {
+		return ctx
+	}
+	logger := ii.logger(ctx)
+
+	// If there was an error, delete the in progress record so that
+	// the event can be retried
+	errValue, _ := ctx.Value(sparta.ContextKeyLambdaError).(error)
+	if errValue != nil {
+		deleteErr := ii.store.Delete(ctx, key)
+		if deleteErr != nil {
+			logger.Warn().
+				Err(deleteErr).
+				Str("Key", key).
+				Msg("Failed to delete idempotency record")
+		}
+		return ctx
+	}
+	responseBytes, responseBytesErr := json.Marshal(ctx.Value(sparta.ContextKeyLambdaResponse))
+	if responseBytesErr != nil {
+		logger.Warn().
+			Err(responseBytesErr).
+			Str("Key", key).
+			Msg("Failed to marshal response for idempotency record")
+		return ctx
+	}
+	completed := &idempotencyRecord{
+		Key:      key,
+		Status:   IdempotencyStatusCompleted,
+		Response: responseBytes,
+	}
+	putErr := ii.store.PutWithExpiry(ctx, key, completed, time.Now().Add(ii.ttl))
+	if putErr != nil {
+		logger.Warn().
+			Err(putErr).
+			Str("Key", key).
+			Msg("Failed to save completed idempotency record")
+	}
+	return ctx
+}
+
+// RegisterIdempotencyInterceptor returns the stored response for events
+// that were already handled within the ttl duration. The idempotency key is
+// the SHA256 hash of the event data selected by the JMESPath expression.
+// Events for which the expression doesn't select a value are always handled.
+// Records are saved in the store, which is typically an
+// *accessor.DynamoAccessor or *accessor.S3Accessor instance. The ttl must
+// be positive.
+func RegisterIdempotencyInterceptor(handler *sparta.LambdaEventInterceptors,
+	store accessor.ExpiringKeyValueAccessor,
+	expression string,
+	ttl time.Duration) (*sparta.LambdaEventInterceptors, error) {
+	if ttl <= 0 {
+		return nil, errors.Errorf("Idempotency ttl must be positive: %s", ttl)
+	}
+	interceptor := &idempotencyInterceptor{
+		store:      store,
+		expression: expression,
+		ttl:        ttl,
+	}
+	if handler == nil {
+		handler = &sparta.LambdaEventInterceptors{}
+	}
+	return handler.Register(interceptor), nil
+}
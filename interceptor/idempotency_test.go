@@ -0,0 +1,198 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/aws/accessor"
+)
+
+type memoryEntry struct {
+	data   []byte
+	expiry time.Time
+}
+
+// memoryAccessor is an in-memory accessor.ExpiringKeyValueAccessor
+type memoryAccessor struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func (ma *memoryAccessor) Delete(ctx context.Context, keyPath string) error {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	delete(ma.entries, keyPath)
+	return nil
+}
+func (ma *memoryAccessor) DeleteAll(ctx context.Context) error {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	ma.entries = make(map[string]*memoryEntry)
+	return nil
+}
+func (ma *memoryAccessor) Put(ctx context.Context, keyPath string, object interface{}) error {
+	return ma.PutWithExpiry(ctx, keyPath, object, time.Time{})
+}
+func (ma *memoryAccessor) PutWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+	data, dataErr := json.Marshal(object)
+	if dataErr != nil {
+		return dataErr
+	}
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	ma.entries[keyPath] = &memoryEntry{data: data, expiry: expiry}
+	return nil
+}
+func (ma *memoryAccessor) CreateWithExpiry(ctx context.Context,
+	keyPath string,
+	object interface{},
+	expiry time.Time) error {
+	data, dataErr := json.Marshal(object)
+	if dataErr != nil {
+		return dataErr
+	}
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	if ma.liveEntry(keyPath) != nil {
+		return accessor.ErrKeyExists
+	}
+	ma.entries[keyPath] = &memoryEntry{data: data, expiry: expiry}
+	return nil
+}
+func (ma *memoryAccessor) liveEntry(keyPath string) *memoryEntry {
+	entry, entryOk := ma.entries[keyPath]
+	if !entryOk || (!entry.expiry.IsZero() && !time.Now().Before(entry.expiry)) {
+		return nil
+	}
+	return entry
+}
+func (ma *memoryAccessor) Get(ctx context.Context, keyPath string, object interface{}) error {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+	entry := ma.liveEntry(keyPath)
+	if entry == nil {
+		return nil
+	}
+	return json.Unmarshal(entry.data, object)
+}
+func (ma *memoryAccessor) GetAll(ctx context.Context,
+	ctor accessor.NewObjectConstructor) ([]interface{}, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+// dispatch simulates the sparta dispatch workflow for a single event
+func dispatch(interceptor *idempotencyInterceptor,
+	msg string,
+	handler func() (interface{}, error)) (interface{}, bool, error) {
+	ctx, val, handled, err := interceptor.ShortCircuit(context.Background(),
+		json.RawMessage(msg))
+	if !handled {
+		val, err = handler()
+	}
+	ctx = context.WithValue(ctx, sparta.ContextKeyLambdaError, err)
+	ctx = context.WithValue(ctx, sparta.ContextKeyLambdaResponse, val)
+	interceptor.Complete(ctx, json.RawMessage(msg))
+	return val, handled, err
+}
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	store := &memoryAccessor{entries: make(map[string]*memoryEntry)}
+	interceptors, interceptorsErr := RegisterIdempotencyInterceptor(nil, store, "detail.orderID", time.Hour)
+	if interceptorsErr != nil || len(interceptors.ShortCircuit) != 1 {
+		t.Fatalf("Failed to register ShortCircuit interceptor")
+	}
+	interceptor := &idempotencyInterceptor{
+		store:      store,
+		expression: "detail.orderID",
+		ttl:        time.Hour,
+	}
+
+	callCount := 0
+	handler := func() (interface{}, error) {
+		callCount++
+		return map[string]int{"count": callCount}, nil
+	}
+	_, handled, _ := dispatch(interceptor, `{"detail":{"orderID":"42"}}`, handler)
+	if handled || callCount != 1 {
+		t.Fatalf("Expected first event to be handled by handler")
+	}
+	val, handled, err := dispatch(interceptor, `{"detail":{"orderID":"42"},"id":"other"}`, handler)
+	if err != nil || !handled || callCount != 1 {
+		t.Fatalf("Expected duplicate event to be short circuited. Error: %v", err)
+	}
+	if string(val.(json.RawMessage)) != `{"count":1}` {
+		t.Fatalf("Unexpected stored response: %s", val)
+	}
+
+	// Different key is handled
+	dispatch(interceptor, `{"detail":{"orderID":"43"}}`, handler)
+	if callCount != 2 {
+		t.Fatalf("Expected distinct event to be handled by handler")
+	}
+
+	// Errors delete the record so that the event can be retried
+	failingHandler := func() (interface{}, error) {
+		callCount++
+		return nil, fmt.Errorf("failed")
+	}
+	dispatch(interceptor, `{"detail":{"orderID":"44"}}`, failingHandler)
+	dispatch(interceptor, `{"detail":{"orderID":"44"}}`, handler)
+	if callCount != 4 {
+		t.Fatalf("Expected failed event to be retried")
+	}
+
+	// In progress events return an error
+	key, _ := interceptor.idempotencyKey(json.RawMessage(`{"detail":{"orderID":"45"}}`))
+	_ = store.PutWithExpiry(context.Background(),
+		key,
+		&idempotencyRecord{Key: key, Status: IdempotencyStatusInProgress},
+		time.Now().Add(time.Minute))
+	_, _, err = dispatch(interceptor, `{"detail":{"orderID":"45"}}`, handler)
+	if _, inProgressErr := err.(*IdempotencyInProgressError); !inProgressErr {
+		t.Fatalf("Expected IdempotencyInProgressError, got: %#v", err)
+	}
+}
+
+func TestIdempotencyInterceptorConcurrentDuplicates(t *testing.T) {
+	store := &memoryAccessor{entries: make(map[string]*memoryEntry)}
+	interceptor := &idempotencyInterceptor{
+		store:      store,
+		expression: "detail.orderID",
+		ttl:        time.Hour,
+	}
+	var callCount int32
+	handler := func() (interface{}, error) {
+		atomic.AddInt32(&callCount, 1)
+		time.Sleep(10 * time.Millisecond)
+		return "OK", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, handled, err := dispatch(interceptor, `{"detail":{"orderID":"42"}}`, handler)
+			_, inProgressErr := err.(*IdempotencyInProgressError)
+			if handled && err != nil && !inProgressErr {
+				t.Errorf("Unexpected duplicate error: %#v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if callCount != 1 {
+		t.Fatalf("Expected a single handler call for concurrent duplicates. Calls: %d", callCount)
+	}
+	_, invalidErr := RegisterIdempotencyInterceptor(nil, store, "detail.orderID", 0)
+	if invalidErr == nil {
+		t.Fatalf("Expected error for non-positive ttl")
+	}
+}
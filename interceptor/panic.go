@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	sparta "github.com/mweagle/Sparta"
+	spartaCloudWatch "github.com/mweagle/Sparta/aws/cloudwatch"
+)
+
+const (
+	// PanicMetricNamespace is the default CloudWatch namespace for the
+	// panic metric published by the panic interceptor
+	PanicMetricNamespace = "Sparta"
+
+	// PanicMetricName is the name of the metric published each time
+	// Sparta recovers from a lambda handler panic
+	PanicMetricName = "Panics"
+)
+
+// panicMetricInterceptor is an implementation of sparta.LambdaEventInterceptors
+// that publishes an embedded metric (EMF) for every sparta.PanicError that
+// is returned from the lambda handler.
+type panicMetricInterceptor struct {
+	namespace string
+}
+
+func (pmi *panicMetricInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pmi *panicMetricInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pmi *panicMetricInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pmi *panicMetricInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pmi *panicMetricInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (pmi *panicMetricInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	panicErr, panicErrOk := ctx.Value(sparta.ContextKeyLambdaError).(*sparta.PanicError)
+	if !panicErrOk {
+		return ctx
+	}
+	metric, metricErr := spartaCloudWatch.NewEmbeddedMetric()
+	if metricErr != nil {
+		return ctx
+	}
+	dimensions := map[string]string{
+		"functionName": os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+	}
+	directive := metric.NewMetricDirective(pmi.namespace, dimensions)
+	directive.Metrics[PanicMetricName] = spartaCloudWatch.MetricValue{
+		Unit:  spartaCloudWatch.UnitCount,
+		Value: 1,
+	}
+	properties := map[string]interface{}{
+		"panic": panicErr.Error(),
+	}
+	lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+	if lambdaContextOk {
+		properties["reqID"] = lambdaContext.AwsRequestID
+	}
+	metric.Publish(properties)
+	return ctx
+}
+
+// RegisterPanicMetricInterceptor publishes a CloudWatch embedded metric each
+// time Sparta recovers from a lambda handler panic. The metric is published
+// to the PanicMetricNamespace namespace if namespace is empty.
+func RegisterPanicMetricInterceptor(handler *sparta.LambdaEventInterceptors,
+	namespace string) *sparta.LambdaEventInterceptors {
+	if namespace == "" {
+		namespace = PanicMetricNamespace
+	}
+	interceptor := &panicMetricInterceptor{
+		namespace: namespace,
+	}
+	if handler == nil {
+		handler = &sparta.LambdaEventInterceptors{}
+	}
+	return handler.Register(interceptor)
+}
@@ -0,0 +1,80 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	sparta "github.com/mweagle/Sparta"
+)
+
+type panicMetricOutput struct {
+	AWS struct {
+		CloudWatchMetrics []struct {
+			Namespace string `json:"Namespace"`
+			Metrics   []struct {
+				Name string `json:"Name"`
+			} `json:"Metrics"`
+		} `json:"CloudWatchMetrics"`
+	} `json:"_aws"`
+	Panics float64 `json:"Panics"`
+	Panic  string  `json:"panic"`
+}
+
+// completeOutput returns the stdout output of the Complete interceptor for
+// the lambda error
+func completeOutput(t *testing.T,
+	interceptors *sparta.LambdaEventInterceptors,
+	lambdaErr error) []byte {
+	reader, writer, pipeErr := os.Pipe()
+	if pipeErr != nil {
+		t.Fatalf("Failed to create pipe: %s", pipeErr)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+	ctx := context.WithValue(context.Background(), sparta.ContextKeyLambdaError, lambdaErr)
+	interceptors.Complete[0].Interceptor(ctx, json.RawMessage(`{}`))
+	writer.Close()
+	output, outputErr := ioutil.ReadAll(reader)
+	if outputErr != nil {
+		t.Fatalf("Failed to read output: %s", outputErr)
+	}
+	return output
+}
+
+func TestPanicMetricInterceptor(t *testing.T) {
+	interceptors := RegisterPanicMetricInterceptor(nil, "TestNamespace")
+	if len(interceptors.Complete) != 1 {
+		t.Fatalf("Failed to register Complete interceptor")
+	}
+	output := completeOutput(t, interceptors, &sparta.PanicError{Value: "boom"})
+	var metric panicMetricOutput
+	unmarshalErr := json.Unmarshal(output, &metric)
+	if unmarshalErr != nil {
+		t.Fatalf("Failed to unmarshal metric: %s. Output: %s", unmarshalErr, string(output))
+	}
+	if len(metric.AWS.CloudWatchMetrics) != 1 ||
+		metric.AWS.CloudWatchMetrics[0].Namespace != "TestNamespace" ||
+		len(metric.AWS.CloudWatchMetrics[0].Metrics) != 1 ||
+		metric.AWS.CloudWatchMetrics[0].Metrics[0].Name != PanicMetricName ||
+		metric.Panics != 1 ||
+		metric.Panic != "Lambda handler panic: boom" {
+		t.Fatalf("Unexpected panic metric: %s", string(output))
+	}
+
+	// Errors that aren't panics don't publish the metric
+	output = completeOutput(t, interceptors, errors.New("failed"))
+	if len(output) != 0 {
+		t.Fatalf("Unexpected metric for error: %s", string(output))
+	}
+	output = completeOutput(t, interceptors, nil)
+	if len(output) != 0 {
+		t.Fatalf("Unexpected metric for success: %s", string(output))
+	}
+}
@@ -0,0 +1,419 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	awsLambdaContext "github.com/aws/aws-lambda-go/lambdacontext"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Trace context constants
+const (
+	// TraceParentKey is the W3C trace context header, message attribute
+	// and EventBridge detail key that carries the parent span
+	// Ref: https://www.w3.org/TR/trace-context/#traceparent-header
+	TraceParentKey = "traceparent"
+
+	// LogFieldTraceID is the request logger field for the trace ID
+	LogFieldTraceID = "traceID"
+
+	// LogFieldSpanID is the request logger field for the invocation span ID
+	LogFieldSpanID = "spanID"
+
+	// EnvVarOTLPEndpoint is the standard OpenTelemetry environment variable
+	// with the base OTLP/HTTP endpoint used if the interceptor endpoint is empty
+	EnvVarOTLPEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+	// DefaultOTLPEndpoint is the OTLP/HTTP traces endpoint of a collector
+	// running with the default configuration
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+	otlpTracesPath      = "/v1/traces"
+	otlpExportTimeout   = 2 * time.Second
+	traceContextVersion = "00"
+	traceFlagsSampled   = "01"
+)
+
+// OTLP span kinds and status codes
+// Ref: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindConsumer = 5
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+var reTraceParent = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// traceContextKey is the context key for the invocation span
+type traceContextKey struct{}
+
+// traceSpan is the span that represents a single invocation
+type traceSpan struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+	kind         int
+	trigger      string
+	start        time.Time
+}
+
+// Traceparent returns the W3C traceparent value for the current invocation
+// span, or the empty string if there is no span. Include it in outbound
+// requests and messages to propagate the trace to downstream services.
+func Traceparent(ctx context.Context) string {
+	span, spanOk := ctx.Value(traceContextKey{}).(*traceSpan)
+	if !spanOk {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s-%s",
+		traceContextVersion,
+		span.traceID,
+		span.spanID,
+		traceFlagsSampled)
+}
+
+func randomHexID(byteCount int) string {
+	idBytes := make([]byte, byteCount)
+	_, readErr := rand.Read(idBytes)
+	if readErr != nil {
+		// Fallback to something unique enough
+		return fmt.Sprintf("%0*x", byteCount*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(idBytes)
+}
+
+// parseTraceParent returns the trace and parent span IDs from a traceparent
+// value. Invalid values return empty strings.
+func parseTraceParent(traceparent string) (string, string) {
+	matches := reTraceParent.FindStringSubmatch(strings.TrimSpace(strings.ToLower(traceparent)))
+	if len(matches) != 5 ||
+		matches[1] == "ff" ||
+		matches[2] == strings.Repeat("0", 32) ||
+		matches[3] == strings.Repeat("0", 16) {
+		return "", ""
+	}
+	return matches[2], matches[3]
+}
+
+// traceCarrierEvent is the union of the event fields that may include
+// a traceparent value
+type traceCarrierEvent struct {
+	// API Gateway
+	Headers map[string]string `json:"headers"`
+	// SQS and SNS
+	Records []struct {
+		MessageAttributes map[string]struct {
+			StringValue string `json:"stringValue"`
+		} `json:"messageAttributes"`
+		SNS *struct {
+			MessageAttributes map[string]struct {
+				Value string `json:"Value"`
+			} `json:"MessageAttributes"`
+		} `json:"Sns"`
+	} `json:"Records"`
+	// EventBridge
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// extractTraceParent returns the traceparent value, span kind and trigger
+// for the event
+func extractTraceParent(msg json.RawMessage) (string, int, string) {
+	var event traceCarrierEvent
+	unmarshalErr := json.Unmarshal(msg, &event)
+	if unmarshalErr != nil {
+		return "", otlpSpanKindInternal, "other"
+	}
+	switch {
+	case event.Headers != nil:
+		for eachKey, eachValue := range event.Headers {
+			if strings.EqualFold(eachKey, TraceParentKey) {
+				return eachValue, otlpSpanKindServer, "http"
+			}
+		}
+		return "", otlpSpanKindServer, "http"
+	case len(event.Records) != 0:
+		record := event.Records[0]
+		if record.SNS != nil {
+			return record.SNS.MessageAttributes[TraceParentKey].Value,
+				otlpSpanKindConsumer,
+				"pubsub"
+		}
+		if record.MessageAttributes != nil {
+			return record.MessageAttributes[TraceParentKey].StringValue,
+				otlpSpanKindConsumer,
+				"pubsub"
+		}
+	case event.DetailType != "":
+		var detail map[string]interface{}
+		if json.Unmarshal(event.Detail, &detail) == nil {
+			traceparent, _ := detail[TraceParentKey].(string)
+			return traceparent, otlpSpanKindConsumer, "pubsub"
+		}
+		return "", otlpSpanKindConsumer, "pubsub"
+	}
+	return "", otlpSpanKindInternal, "other"
+}
+
+// OTLP/HTTP JSON encoding types.
+// Ref: https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#otlphttp
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportTraceServiceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttribute(key string, value string) otlpKeyValue {
+	return otlpKeyValue{
+		Key:   key,
+		Value: otlpAnyValue{StringValue: value},
+	}
+}
+
+// traceContextInterceptor is an implementation of sparta.LambdaEventInterceptors
+// that continues W3C trace context propagated through the event and exports
+// a span per invocation over OTLP/HTTP
+type traceContextInterceptor struct {
+	endpoint string
+	client   *http.Client
+}
+
+// export POSTs the span to the OTLP endpoint. The request is bounded by
+// otlpExportTimeout and the invocation deadline so that an unavailable
+// collector can't block the function past its deadline.
+func (tci *traceContextInterceptor) export(ctx context.Context, span *otlpSpan) error {
+	// The service name is resolved lazily since it's stamped into the
+	// binary and isn't available when the interceptor is registered
+	serviceName := sparta.OptionsGlobal.ServiceName
+	if serviceName == "" {
+		serviceName = span.Name
+	}
+	request := &otlpExportTraceServiceRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{
+					otlpAttribute("service.name", serviceName),
+					otlpAttribute("cloud.provider", "aws"),
+					otlpAttribute("cloud.region", os.Getenv("AWS_REGION")),
+				},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{
+					Name:    sparta.ProperName,
+					Version: sparta.SpartaVersion,
+				},
+				Spans: []otlpSpan{*span},
+			}},
+		}},
+	}
+	requestBody, requestBodyErr := json.Marshal(request)
+	if requestBodyErr != nil {
+		return requestBodyErr
+	}
+	exportCtx, exportCancel := context.WithTimeout(ctx, otlpExportTimeout)
+	defer exportCancel()
+	httpRequest, httpRequestErr := http.NewRequestWithContext(exportCtx,
+		http.MethodPost,
+		tci.endpoint,
+		bytes.NewReader(requestBody))
+	if httpRequestErr != nil {
+		return httpRequestErr
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	resp, respErr := tci.client.Do(httpRequest)
+	if respErr != nil {
+		return respErr
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("OTLP endpoint %s returned HTTP status %d",
+			tci.endpoint,
+			resp.StatusCode)
+	}
+	return nil
+}
+
+func (tci *traceContextInterceptor) Begin(ctx context.Context, msg json.RawMessage) context.Context {
+	traceparent, kind, trigger := extractTraceParent(msg)
+	traceID, parentSpanID := parseTraceParent(traceparent)
+	if traceID == "" {
+		traceID = randomHexID(16)
+	}
+	span := &traceSpan{
+		traceID:      traceID,
+		spanID:       randomHexID(8),
+		parentSpanID: parentSpanID,
+		kind:         kind,
+		trigger:      trigger,
+		start:        time.Now(),
+	}
+	return context.WithValue(ctx, traceContextKey{}, span)
+}
+
+func (tci *traceContextInterceptor) BeforeSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (tci *traceContextInterceptor) AfterSetup(ctx context.Context, msg json.RawMessage) context.Context {
+	span, spanOk := ctx.Value(traceContextKey{}).(*traceSpan)
+	if !spanOk {
+		return ctx
+	}
+	// Add the trace to the request logger so that log statements can
+	// be correlated with the trace
+	logger, loggerOk := ctx.Value(sparta.ContextKeyRequestLogger).(*zerolog.Logger)
+	if loggerOk {
+		tracedLogger := logger.With().
+			Str(LogFieldTraceID, span.traceID).
+			Str(LogFieldSpanID, span.spanID).
+			Logger()
+		ctx = context.WithValue(ctx, sparta.ContextKeyRequestLogger, &tracedLogger)
+	}
+	return ctx
+}
+
+func (tci *traceContextInterceptor) BeforeDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (tci *traceContextInterceptor) AfterDispatch(ctx context.Context, msg json.RawMessage) context.Context {
+	return ctx
+}
+
+func (tci *traceContextInterceptor) Complete(ctx context.Context, msg json.RawMessage) context.Context {
+	span, spanOk := ctx.Value(traceContextKey{}).(*traceSpan)
+	if !spanOk {
+		return ctx
+	}
+	name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if name == "" {
+		name = sparta.OptionsGlobal.ServiceName
+	}
+	exportSpan := &otlpSpan{
+		TraceID:           span.traceID,
+		SpanID:            span.spanID,
+		ParentSpanID:      span.parentSpanID,
+		Name:              name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: []otlpKeyValue{
+			otlpAttribute("faas.name", name),
+			otlpAttribute("faas.trigger", span.trigger),
+		},
+		Status: otlpStatus{
+			Code: otlpStatusCodeOK,
+		},
+	}
+	lambdaContext, lambdaContextOk := awsLambdaContext.FromContext(ctx)
+	if lambdaContextOk {
+		exportSpan.Attributes = append(exportSpan.Attributes,
+			otlpAttribute("faas.execution", lambdaContext.AwsRequestID),
+			otlpAttribute("faas.id", lambdaContext.InvokedFunctionArn))
+	}
+	errValue, _ := ctx.Value(sparta.ContextKeyLambdaError).(error)
+	if errValue != nil {
+		exportSpan.Status = otlpStatus{
+			Code:    otlpStatusCodeError,
+			Message: errValue.Error(),
+		}
+	}
+	exportErr := tci.export(ctx, exportSpan)
+	if exportErr != nil {
+		logger, loggerOk := ctx.Value(sparta.ContextKeyRequestLogger).(*zerolog.Logger)
+		if loggerOk {
+			logger.Warn().
+				Err(exportErr).
+				Str("Endpoint", tci.endpoint).
+				Msg("Failed to export trace span")
+		}
+	}
+	return ctx
+}
+
+// RegisterTraceContextInterceptor continues the W3C trace context
+// (https://www.w3.org/TR/trace-context/) carried in the traceparent API
+// Gateway header, SQS or SNS message attribute or EventBridge detail
+// property. Each invocation is exported as a span to the OTLP/HTTP traces
+// endpoint (eg: http://localhost:4318/v1/traces). If endpoint is empty, the
+// OTEL_EXPORTER_OTLP_ENDPOINT environment variable or DefaultOTLPEndpoint
+// is used. The trace and span IDs are added to the request logger.
+func RegisterTraceContextInterceptor(handler *sparta.LambdaEventInterceptors,
+	endpoint string) *sparta.LambdaEventInterceptors {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+		envEndpoint := os.Getenv(EnvVarOTLPEndpoint)
+		if envEndpoint != "" {
+			endpoint = strings.TrimRight(envEndpoint, "/") + otlpTracesPath
+		}
+	}
+	interceptor := &traceContextInterceptor{
+		endpoint: endpoint,
+		client:   &http.Client{},
+	}
+	if handler == nil {
+		handler = &sparta.LambdaEventInterceptors{}
+	}
+	return handler.Register(interceptor)
+}
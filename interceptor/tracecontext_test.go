@@ -0,0 +1,115 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sparta "github.com/mweagle/Sparta"
+	"github.com/rs/zerolog"
+)
+
+const (
+	testTraceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpanID = "00f067aa0ba902b7"
+	testTraceParent  = "00-" + testTraceID + "-" + testParentSpanID + "-01"
+)
+
+func TestExtractTraceParent(t *testing.T) {
+	events := map[string]string{
+		"API Gateway": `{"method":"GET","headers":{"TraceParent":"` + testTraceParent + `"}}`,
+		"SQS":         `{"Records":[{"eventSource":"aws:sqs","messageAttributes":{"traceparent":{"stringValue":"` + testTraceParent + `","dataType":"String"}}}]}`,
+		"SNS":         `{"Records":[{"EventSource":"aws:sns","Sns":{"MessageAttributes":{"traceparent":{"Type":"String","Value":"` + testTraceParent + `"}}}}]}`,
+		"EventBridge": `{"detail-type":"OrderCreated","source":"orders","detail":{"traceparent":"` + testTraceParent + `"}}`,
+	}
+	for eachName, eachEvent := range events {
+		traceparent, _, _ := extractTraceParent(json.RawMessage(eachEvent))
+		traceID, parentSpanID := parseTraceParent(traceparent)
+		if traceID != testTraceID || parentSpanID != testParentSpanID {
+			t.Fatalf("Failed to extract %s traceparent. Found: %s", eachName, traceparent)
+		}
+	}
+	traceparent, _, _ := extractTraceParent(json.RawMessage(`{"key":"value"}`))
+	if traceparent != "" {
+		t.Fatalf("Unexpected traceparent: %s", traceparent)
+	}
+}
+
+func TestTraceContextInterceptor(t *testing.T) {
+	exported := make(chan *otlpExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request otlpExportTraceServiceRequest
+		unmarshalErr := json.Unmarshal(body, &request)
+		if unmarshalErr != nil || r.URL.Path != otlpTracesPath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		exported <- &request
+	}))
+	defer collector.Close()
+
+	interceptors := RegisterTraceContextInterceptor(nil, collector.URL+otlpTracesPath)
+	msg := json.RawMessage(`{"headers":{"traceparent":"` + testTraceParent + `"}}`)
+
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	ctx := interceptors.Begin[0].Interceptor(context.Background(), msg)
+	ctx = context.WithValue(ctx, sparta.ContextKeyRequestLogger, &logger)
+	ctx = interceptors.AfterSetup[0].Interceptor(ctx, msg)
+	requestLogger, _ := ctx.Value(sparta.ContextKeyRequestLogger).(*zerolog.Logger)
+	requestLogger.Info().Msg("Hello")
+	if !bytes.Contains(logOutput.Bytes(), []byte(testTraceID)) {
+		t.Fatalf("Request logger doesn't include trace ID: %s", logOutput.String())
+	}
+	traceparent := Traceparent(ctx)
+	if traceID, _ := parseTraceParent(traceparent); traceID != testTraceID {
+		t.Fatalf("Unexpected propagated traceparent: %s", traceparent)
+	}
+	ctx = context.WithValue(ctx, sparta.ContextKeyLambdaError, errors.New("failed"))
+	interceptors.Complete[0].Interceptor(ctx, msg)
+
+	var request *otlpExportTraceServiceRequest
+	select {
+	case request = <-exported:
+	default:
+		t.Fatalf("Span wasn't exported")
+	}
+	span := request.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.TraceID != testTraceID ||
+		span.ParentSpanID != testParentSpanID ||
+		span.Kind != otlpSpanKindServer ||
+		span.Status.Code != otlpStatusCodeError {
+		t.Fatalf("Unexpected exported span: %#v", span)
+	}
+}
+
+func TestTraceContextExportDeadline(t *testing.T) {
+	release := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer collector.Close()
+	defer close(release)
+
+	interceptor := &traceContextInterceptor{
+		endpoint: collector.URL + otlpTracesPath,
+		client:   &http.Client{},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	exportErr := interceptor.export(ctx, &otlpSpan{TraceID: testTraceID})
+	if exportErr == nil {
+		t.Fatalf("Expected export to fail at the invocation deadline")
+	}
+	if time.Since(startTime) >= otlpExportTimeout {
+		t.Fatalf("Export didn't honor the invocation deadline: %s", time.Since(startTime))
+	}
+}
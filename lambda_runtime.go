@@ -0,0 +1,205 @@
+package sparta
+
+import (
+	"fmt"
+	"sort"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// providedRuntimeLauncher is the `bootstrap` executable for provided.al2
+// code packages that include binaries for more than one architecture. It
+// runs the binary named by the function's Handler property.
+const providedRuntimeLauncher = `#!/bin/sh
+exec "${LAMBDA_TASK_ROOT}/${_HANDLER}"
+`
+
+// LambdaFunctionResource is an AWS::Lambda::Function resource that includes
+// the Architectures property. Sparta uses it for functions that target
+// the arm64 architecture.
+type LambdaFunctionResource struct {
+	gocf.LambdaFunction
+	// Architectures is the instruction set architecture of the function
+	Architectures *gocf.StringListExpr `json:"Architectures,omitempty"`
+}
+
+// goArch returns the GOARCH value for the lambda architecture
+func (arch AWSLambdaArchitecture) goArch() string {
+	if arch == ArchitectureARM64 {
+		return "arm64"
+	}
+	return "amd64"
+}
+
+// lambdaBinaryName returns the name of the compiled binary for the GOARCH
+func lambdaBinaryName(goArch string) string {
+	return fmt.Sprintf("%s.lambda.%s", ProperName, goArch)
+}
+
+// lambdaPackage describes the runtime and the architectures of the
+// binaries in the service's code package
+type lambdaPackage struct {
+	runtime             AWSLambdaRuntimeName
+	defaultArchitecture AWSLambdaArchitecture
+	// The unique, sorted set of architectures to compile
+	architectures []AWSLambdaArchitecture
+	// Map of lambda function logical resource name to architecture
+	functionArchitectures map[string]AWSLambdaArchitecture
+}
+
+func validateArchitecture(runtime AWSLambdaRuntimeName, arch AWSLambdaArchitecture) error {
+	switch arch {
+	case ArchitectureX8664:
+		return nil
+	case ArchitectureARM64:
+		if runtime != ProvidedAL2LambdaRuntime {
+			return errors.Errorf("Architecture %s requires the %s runtime",
+				arch,
+				ProvidedAL2LambdaRuntime)
+		}
+		return nil
+	default:
+		return errors.Errorf("Unsupported lambda architecture: %s", arch)
+	}
+}
+
+// newLambdaPackage returns the lambdaPackage for the service runtime and
+// default architecture. Empty values use the go1.x runtime and the
+// x86_64 architecture. Lambda functions can override the architecture
+// with LambdaFunctionOptions.Architecture.
+func newLambdaPackage(runtime AWSLambdaRuntimeName,
+	architecture AWSLambdaArchitecture,
+	lambdaAWSInfos []*LambdaAWSInfo) (*lambdaPackage, error) {
+	if runtime == "" {
+		runtime = Go1LambdaRuntime
+	}
+	if architecture == "" {
+		architecture = ArchitectureX8664
+	}
+	switch runtime {
+	case Go1LambdaRuntime, ProvidedAL2LambdaRuntime:
+		// NOP
+	default:
+		return nil, errors.Errorf("Unsupported lambda runtime: %s", runtime)
+	}
+	archErr := validateArchitecture(runtime, architecture)
+	if archErr != nil {
+		return nil, archErr
+	}
+	pkg := &lambdaPackage{
+		runtime:               runtime,
+		defaultArchitecture:   architecture,
+		functionArchitectures: make(map[string]AWSLambdaArchitecture),
+	}
+	archSet := map[AWSLambdaArchitecture]bool{
+		architecture: true,
+	}
+	for _, eachLambda := range lambdaAWSInfos {
+		if eachLambda == nil ||
+			eachLambda.Options == nil ||
+			eachLambda.Options.Architecture == "" {
+			continue
+		}
+		lambdaArch := eachLambda.Options.Architecture
+		archErr = validateArchitecture(runtime, lambdaArch)
+		if archErr != nil {
+			return nil, errors.Wrapf(archErr,
+				"Invalid architecture for lambda function: %s",
+				eachLambda.lambdaFunctionName())
+		}
+		archSet[lambdaArch] = true
+		pkg.functionArchitectures[eachLambda.LogicalResourceName()] = lambdaArch
+	}
+	for eachArch := range archSet {
+		pkg.architectures = append(pkg.architectures, eachArch)
+	}
+	sort.Slice(pkg.architectures, func(i, j int) bool {
+		return pkg.architectures[i] < pkg.architectures[j]
+	})
+	return pkg, nil
+}
+
+// executableName returns the name of the executable in the code package
+// for the architecture. provided.al2 packages with a single architecture
+// use the binary as the `bootstrap` executable.
+func (lp *lambdaPackage) executableName(arch AWSLambdaArchitecture) string {
+	if lp.runtime == ProvidedAL2LambdaRuntime && len(lp.architectures) == 1 {
+		return ProvidedRuntimeBootstrapName
+	}
+	return lambdaBinaryName(arch.goArch())
+}
+
+// requiresLauncher returns true if the code package must include the
+// providedRuntimeLauncher `bootstrap` script
+func (lp *lambdaPackage) requiresLauncher() bool {
+	return lp.runtime == ProvidedAL2LambdaRuntime && len(lp.architectures) > 1
+}
+
+// codePackageFunctions calls fn with the AWS::Lambda::Function resources in
+// the template that run the code package
+func codePackageFunctions(template *gocf.Template,
+	lambdaFunctionCode *gocf.LambdaFunctionCode,
+	fn func(resourceName string, resource *gocf.Resource, lambdaResource *gocf.LambdaFunction)) {
+	for eachResourceName, eachResource := range template.Resources {
+		var lambdaResource *gocf.LambdaFunction
+		switch typedResource := eachResource.Properties.(type) {
+		case gocf.LambdaFunction:
+			lambdaResource = &typedResource
+		case *gocf.LambdaFunction:
+			lambdaResource = typedResource
+		default:
+			continue
+		}
+		if lambdaResource.Code != lambdaFunctionCode {
+			continue
+		}
+		fn(eachResourceName, eachResource, lambdaResource)
+	}
+}
+
+// architecture returns the architecture of the lambda function resource
+func (lp *lambdaPackage) architecture(resourceName string) AWSLambdaArchitecture {
+	arch, archExists := lp.functionArchitectures[resourceName]
+	if !archExists {
+		arch = lp.defaultArchitecture
+	}
+	return arch
+}
+
+// applyToTemplate sets the runtime and handler of the lambda functions in
+// the template that run the code package. The function resources remain
+// gocf.LambdaFunction values s.t. validation hooks can inspect them.
+func (lp *lambdaPackage) applyToTemplate(template *gocf.Template,
+	lambdaFunctionCode *gocf.LambdaFunctionCode) {
+	if lambdaFunctionCode.ImageURI != nil {
+		return
+	}
+	codePackageFunctions(template, lambdaFunctionCode,
+		func(resourceName string, resource *gocf.Resource, lambdaResource *gocf.LambdaFunction) {
+			lambdaResource.Runtime = gocf.String(string(lp.runtime))
+			lambdaResource.Handler = gocf.String(lp.executableName(lp.architecture(resourceName)))
+			if _, isValue := resource.Properties.(gocf.LambdaFunction); isValue {
+				resource.Properties = *lambdaResource
+			}
+		})
+}
+
+// applyArchitectures replaces the lambda functions that run the code
+// package and target a non-default architecture with LambdaFunctionResource
+// values. It's the last template change before the template is marshaled
+// because gocf.LambdaFunction doesn't support the Architectures property.
+func (lp *lambdaPackage) applyArchitectures(template *gocf.Template,
+	lambdaFunctionCode *gocf.LambdaFunctionCode) {
+	codePackageFunctions(template, lambdaFunctionCode,
+		func(resourceName string, resource *gocf.Resource, lambdaResource *gocf.LambdaFunction) {
+			arch := lp.architecture(resourceName)
+			if arch == ArchitectureX8664 {
+				return
+			}
+			resource.Properties = LambdaFunctionResource{
+				LambdaFunction: *lambdaResource,
+				Architectures:  gocf.StringList(gocf.String(string(arch))),
+			}
+		})
+}
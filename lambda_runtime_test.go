@@ -0,0 +1,160 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/rs/zerolog"
+)
+
+func TestLambdaPackageValidation(t *testing.T) {
+	armLambda, _ := NewAWSLambda("armLambda", userDefinedCustomResource1, IAMRoleDefinition{})
+	armLambda.Options.Architecture = ArchitectureARM64
+
+	// go1.x only supports x86_64
+	_, pkgErr := newLambdaPackage(Go1LambdaRuntime, ArchitectureARM64, nil)
+	if pkgErr == nil {
+		t.Fatalf("Expected go1.x arm64 package to fail")
+	}
+	_, pkgErr = newLambdaPackage("", "", []*LambdaAWSInfo{armLambda})
+	if pkgErr == nil {
+		t.Fatalf("Expected go1.x arm64 function to fail")
+	}
+	_, pkgErr = newLambdaPackage("python3.8", "", nil)
+	if pkgErr == nil {
+		t.Fatalf("Expected unsupported runtime to fail")
+	}
+
+	// Defaults
+	pkg, pkgErr := newLambdaPackage("", "", nil)
+	if pkgErr != nil {
+		t.Fatalf("Failed to create default package: %s", pkgErr)
+	}
+	if pkg.executableName(ArchitectureX8664) != SpartaBinaryName {
+		t.Fatalf("Unexpected go1.x executable: %s", pkg.executableName(ArchitectureX8664))
+	}
+
+	// Single architecture provided.al2 packages use the binary as bootstrap
+	pkg, pkgErr = newLambdaPackage(ProvidedAL2LambdaRuntime, ArchitectureARM64, nil)
+	if pkgErr != nil {
+		t.Fatalf("Failed to create provided.al2 package: %s", pkgErr)
+	}
+	if pkg.executableName(ArchitectureARM64) != ProvidedRuntimeBootstrapName ||
+		pkg.requiresLauncher() {
+		t.Fatalf("Expected single bootstrap executable: %#v", pkg)
+	}
+
+	// Mixed architectures use a launcher
+	pkg, pkgErr = newLambdaPackage(ProvidedAL2LambdaRuntime,
+		ArchitectureX8664,
+		[]*LambdaAWSInfo{armLambda})
+	if pkgErr != nil {
+		t.Fatalf("Failed to create mixed architecture package: %s", pkgErr)
+	}
+	if len(pkg.architectures) != 2 || !pkg.requiresLauncher() {
+		t.Fatalf("Expected mixed architecture package: %#v", pkg)
+	}
+	if pkg.executableName(ArchitectureARM64) != "Sparta.lambda.arm64" {
+		t.Fatalf("Unexpected arm64 executable: %s", pkg.executableName(ArchitectureARM64))
+	}
+}
+
+func TestLambdaPackageTemplate(t *testing.T) {
+	armLambda, _ := NewAWSLambda("armLambda", userDefinedCustomResource1, IAMRoleDefinition{})
+	armLambda.Options.Architecture = ArchitectureARM64
+	pkg, pkgErr := newLambdaPackage(ProvidedAL2LambdaRuntime,
+		ArchitectureX8664,
+		[]*LambdaAWSInfo{armLambda})
+	if pkgErr != nil {
+		t.Fatalf("Failed to create package: %s", pkgErr)
+	}
+	code := &gocf.LambdaFunctionCode{
+		S3Bucket: gocf.String("bucket"),
+		S3Key:    gocf.String("key"),
+	}
+	template := gocf.NewTemplate()
+	template.AddResource(armLambda.LogicalResourceName(), gocf.LambdaFunction{
+		Code:    code,
+		Runtime: gocf.String(string(Go1LambdaRuntime)),
+		Handler: gocf.String(SpartaBinaryName),
+	})
+	template.AddResource("CustomResourceHandler", gocf.LambdaFunction{
+		Code:    code,
+		Runtime: gocf.String(string(Go1LambdaRuntime)),
+		Handler: gocf.String(SpartaBinaryName),
+	})
+	template.AddResource("OtherFunction", gocf.LambdaFunction{
+		Code:    &gocf.LambdaFunctionCode{ZipFile: gocf.String("exports.handler = () => {}")},
+		Runtime: gocf.String("nodejs12.x"),
+		Handler: gocf.String("index.handler"),
+	})
+	pkg.applyToTemplate(template, code)
+
+	// Validation hooks see gocf.LambdaFunction values for every architecture
+	validated := false
+	validator := ServiceValidationHookFunc(func(ctx context.Context,
+		serviceName string,
+		template *gocf.Template,
+		lambdaFunctionCode *gocf.LambdaFunctionCode,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *zerolog.Logger) (context.Context, error) {
+		var armFunction *gocf.LambdaFunction
+		switch typedResource := template.Resources[armLambda.LogicalResourceName()].Properties.(type) {
+		case gocf.LambdaFunction:
+			armFunction = &typedResource
+		case *gocf.LambdaFunction:
+			armFunction = typedResource
+		default:
+			t.Fatalf("Unexpected arm64 function type for validator: %T", typedResource)
+		}
+		if armFunction.Handler.Literal != "Sparta.lambda.arm64" {
+			t.Fatalf("Unexpected arm64 function handler for validator: %#v", armFunction.Handler)
+		}
+		validated = true
+		return ctx, nil
+	})
+	logger := zerolog.New(ioutil.Discard)
+	validationErr := callValidationHooks([]ServiceValidationHookHandler{validator},
+		template,
+		code,
+		&userdata{serviceName: "RuntimeService"},
+		&buildContext{workflowHooksContext: context.Background()},
+		&logger)
+	if validationErr != nil || !validated {
+		t.Fatalf("Expected validator to inspect arm64 function: %v", validationErr)
+	}
+	if _, isLambdaFunction := template.Resources[armLambda.LogicalResourceName()].Properties.(gocf.LambdaFunction); !isLambdaFunction {
+		t.Fatalf("Expected gocf.LambdaFunction before architectures are applied")
+	}
+	pkg.applyArchitectures(template, code)
+
+	armResource, armResourceOk := template.Resources[armLambda.LogicalResourceName()].Properties.(LambdaFunctionResource)
+	if !armResourceOk {
+		t.Fatalf("Expected LambdaFunctionResource for arm64 function")
+	}
+	armJSON, _ := json.Marshal(armResource)
+	if !strings.Contains(string(armJSON), `"Architectures":["arm64"]`) ||
+		!strings.Contains(string(armJSON), `"Runtime":"provided.al2"`) ||
+		!strings.Contains(string(armJSON), `"Handler":"Sparta.lambda.arm64"`) {
+		t.Fatalf("Unexpected arm64 function: %s", string(armJSON))
+	}
+	customResource, customResourceOk := template.Resources["CustomResourceHandler"].Properties.(gocf.LambdaFunction)
+	if !customResourceOk ||
+		customResource.Handler.Literal != "Sparta.lambda.amd64" ||
+		customResource.Runtime.Literal != string(ProvidedAL2LambdaRuntime) {
+		t.Fatalf("Unexpected x86_64 function: %#v", customResource)
+	}
+	otherResource := template.Resources["OtherFunction"].Properties.(gocf.LambdaFunction)
+	if otherResource.Runtime.Literal != "nodejs12.x" {
+		t.Fatalf("Unexpected update to function with different code: %#v", otherResource)
+	}
+}
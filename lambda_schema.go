@@ -0,0 +1,157 @@
+package sparta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// SchemaTargetRequest is the SchemaValidationError target for events
+	SchemaTargetRequest = "request"
+	// SchemaTargetResponse is the SchemaValidationError target for responses
+	SchemaTargetResponse = "response"
+)
+
+// LambdaSchemas are the JSON Schema documents that describe the
+// contract of a lambda function. If the function is the target of an
+// API Gateway resource, the schemas describe the request and response
+// bodies and are also published as API Gateway Models.
+type LambdaSchemas struct {
+	// Request is the JSON Schema document that the incoming event
+	// must satisfy
+	Request string
+	// Response is the JSON Schema document that the function
+	// response must satisfy
+	Response string
+}
+
+// SchemaValidationError is the error returned when an event or a function
+// response doesn't satisfy the LambdaAWSInfo.Schemas JSON Schema
+type SchemaValidationError struct {
+	// Target is either SchemaTargetRequest or SchemaTargetResponse
+	Target string
+	// Errors are the individual validation failures
+	Errors []string
+}
+
+// Error satisfies the error interface
+func (sve *SchemaValidationError) Error() string {
+	return fmt.Sprintf("%s failed JSON Schema validation: %s",
+		sve.Target,
+		strings.Join(sve.Errors, "; "))
+}
+
+// lambdaSchemaValidator validates events and responses against the
+// compiled LambdaSchemas values
+type lambdaSchemaValidator struct {
+	request    *gojsonschema.Schema
+	response   *gojsonschema.Schema
+	apiGateway bool
+}
+
+func compileSchema(target string, schema string) (*gojsonschema.Schema, error) {
+	if schema == "" {
+		return nil, nil
+	}
+	compiled, compiledErr := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if compiledErr != nil {
+		return nil, errors.Wrapf(compiledErr, "Failed to compile %s JSON Schema", target)
+	}
+	return compiled, nil
+}
+
+// newLambdaSchemaValidator returns a validator for the lambda function or nil
+// if the function doesn't define any schemas
+func newLambdaSchemaValidator(info *LambdaAWSInfo) (*lambdaSchemaValidator, error) {
+	if info.Schemas == nil ||
+		(info.Schemas.Request == "" && info.Schemas.Response == "") {
+		return nil, nil
+	}
+	requestSchema, requestSchemaErr := compileSchema(SchemaTargetRequest, info.Schemas.Request)
+	if requestSchemaErr != nil {
+		return nil, requestSchemaErr
+	}
+	responseSchema, responseSchemaErr := compileSchema(SchemaTargetResponse, info.Schemas.Response)
+	if responseSchemaErr != nil {
+		return nil, responseSchemaErr
+	}
+	return &lambdaSchemaValidator{
+		request:    requestSchema,
+		response:   responseSchema,
+		apiGateway: info.apiGatewayTarget,
+	}, nil
+}
+
+func (lsv *lambdaSchemaValidator) validate(schema *gojsonschema.Schema,
+	target string,
+	document gojsonschema.JSONLoader) error {
+	result, resultErr := schema.Validate(document)
+	if resultErr != nil {
+		return &SchemaValidationError{
+			Target: target,
+			Errors: []string{resultErr.Error()},
+		}
+	}
+	if result.Valid() {
+		return nil
+	}
+	validationErr := &SchemaValidationError{
+		Target: target,
+	}
+	for _, eachError := range result.Errors() {
+		validationErr.Errors = append(validationErr.Errors, eachError.String())
+	}
+	return validationErr
+}
+
+// validateRequest validates the raw event. API Gateway functions validate
+// the request body and return a 400 error response.
+func (lsv *lambdaSchemaValidator) validateRequest(msg json.RawMessage) error {
+	if lsv == nil || lsv.request == nil {
+		return nil
+	}
+	var document gojsonschema.JSONLoader = gojsonschema.NewBytesLoader(msg)
+	if lsv.apiGateway {
+		var request APIGatewayLambdaJSONEvent
+		unmarshalErr := json.Unmarshal(msg, &request)
+		if unmarshalErr != nil {
+			return spartaAPIGateway.NewErrorResponse(http.StatusBadRequest, unmarshalErr)
+		}
+		body := []byte(request.Body)
+		if len(body) == 0 {
+			body = []byte("null")
+		}
+		document = gojsonschema.NewBytesLoader(body)
+	}
+	validationErr := lsv.validate(lsv.request, SchemaTargetRequest, document)
+	if validationErr != nil && lsv.apiGateway {
+		return spartaAPIGateway.NewErrorResponse(http.StatusBadRequest, validationErr)
+	}
+	return validationErr
+}
+
+// validateResponse validates the function response. API Gateway functions
+// validate the response body and return a 500 error response.
+func (lsv *lambdaSchemaValidator) validateResponse(val interface{}) error {
+	if lsv == nil || lsv.response == nil {
+		return nil
+	}
+	if lsv.apiGateway {
+		if apiResponse, apiResponseOk := val.(*spartaAPIGateway.Response); apiResponseOk {
+			val = apiResponse.Body
+		}
+	}
+	validationErr := lsv.validate(lsv.response,
+		SchemaTargetResponse,
+		gojsonschema.NewGoLoader(val))
+	if validationErr != nil && lsv.apiGateway {
+		return spartaAPIGateway.NewErrorResponse(http.StatusInternalServerError, validationErr)
+	}
+	return validationErr
+}
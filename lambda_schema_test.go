@@ -0,0 +1,124 @@
+package sparta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	spartaAPIGateway "github.com/mweagle/Sparta/aws/apigateway"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/rs/zerolog"
+)
+
+const testRequestSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"}
+	},
+	"required": ["name"]
+}`
+
+const testResponseSchema = `{
+	"type": "object",
+	"properties": {
+		"greeting": {"type": "string"}
+	},
+	"required": ["greeting"]
+}`
+
+type greetingEvent struct {
+	Name string `json:"name"`
+}
+
+func greetingLambda(ctx context.Context, event greetingEvent) (map[string]string, error) {
+	if event.Name == "nobody" {
+		return map[string]string{}, nil
+	}
+	return map[string]string{"greeting": "Hello " + event.Name}, nil
+}
+
+func schemaTappedHandler(t *testing.T, info *LambdaAWSInfo) func(context.Context, json.RawMessage) (interface{}, error) {
+	logger, _ := NewLogger(zerolog.Disabled.String())
+	validator, validatorErr := newLambdaSchemaValidator(info)
+	if validatorErr != nil {
+		t.Fatalf("Failed to create validator: %s", validatorErr)
+	}
+	return tappedHandler(info.handlerSymbol,
+		nil,
+		validator,
+		0,
+		logger).(func(context.Context, json.RawMessage) (interface{}, error))
+}
+
+func TestSchemaValidation(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("greeting", greetingLambda, IAMRoleDefinition{})
+	lambdaFn.Schemas = &LambdaSchemas{
+		Request:  testRequestSchema,
+		Response: testResponseSchema,
+	}
+	handler := schemaTappedHandler(t, lambdaFn)
+
+	_, err := handler(context.Background(), json.RawMessage(`{"name":"world"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error for valid event: %s", err)
+	}
+	_, err = handler(context.Background(), json.RawMessage(`{"name":42}`))
+	validationErr, validationErrOk := err.(*SchemaValidationError)
+	if !validationErrOk || validationErr.Target != SchemaTargetRequest {
+		t.Fatalf("Expected request *SchemaValidationError, got: %#v", err)
+	}
+	_, err = handler(context.Background(), json.RawMessage(`{"name":"nobody"}`))
+	validationErr, validationErrOk = err.(*SchemaValidationError)
+	if !validationErrOk || validationErr.Target != SchemaTargetResponse {
+		t.Fatalf("Expected response *SchemaValidationError, got: %#v", err)
+	}
+}
+
+func TestSchemaValidationAPIGateway(t *testing.T) {
+	lambdaFn, _ := NewAWSLambda("greeting", greetingLambda, IAMRoleDefinition{})
+	lambdaFn.Schemas = &LambdaSchemas{
+		Request: testRequestSchema,
+	}
+	api := NewAPIGateway("SchemaAPI", nil)
+	_, resourceErr := api.NewResource("/greeting", lambdaFn)
+	if resourceErr != nil {
+		t.Fatalf("Failed to create resource: %s", resourceErr)
+	}
+	handler := schemaTappedHandler(t, lambdaFn)
+	_, err := handler(context.Background(),
+		json.RawMessage(`{"method":"POST","body":{"name":false}}`))
+	apiErr, apiErrOk := err.(*spartaAPIGateway.Error)
+	if !apiErrOk || apiErr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 *apigateway.Error, got: %#v", err)
+	}
+}
+
+func TestSchemaModels(t *testing.T) {
+	template := gocf.NewTemplate()
+	modelRefs, modelRefsErr := apiGatewayModels(schemaModels(testRequestSchema, "request"),
+		gocf.String("restAPI"),
+		"TestModel",
+		template)
+	if modelRefsErr != nil {
+		t.Fatalf("Failed to create models: %s", modelRefsErr)
+	}
+	if len(modelRefs) != 1 || modelRefs["application/json"] == nil || len(template.Resources) != 1 {
+		t.Fatalf("Unexpected models: %#v", modelRefs)
+	}
+	// Functions without schemas don't publish models
+	emptyRefs, _ := apiGatewayModels(schemaModels("", "request"),
+		gocf.String("restAPI"),
+		"EmptyModel",
+		template)
+	if len(emptyRefs) != 0 || len(template.Resources) != 1 {
+		t.Fatalf("Unexpected models without a schema: %#v", emptyRefs)
+	}
+	_, invalidErr := apiGatewayModels(schemaModels("{", "request"),
+		gocf.String("restAPI"),
+		"TestModel",
+		template)
+	if invalidErr == nil {
+		t.Fatalf("Expected error for invalid JSON Schema")
+	}
+}
@@ -0,0 +1,161 @@
+package sparta
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PayloadRedactedValue is the value that replaces redacted payload fields
+	PayloadRedactedValue = "**REDACTED**"
+)
+
+var reRedactPathSegment = regexp.MustCompile(`^(?:\.([^.\[]+)|\[\*\]|\[(\d+)\]|\['([^']+)'\])`)
+
+// CapturedPayload is the document written to S3 for each sampled
+// invocation by the payload capture interceptor and read by the
+// `replay` command
+type CapturedPayload struct {
+	// FunctionName is the AWS Lambda function name
+	FunctionName string `json:"functionName"`
+	// RequestID is the AWS request ID of the invocation
+	RequestID string `json:"requestID"`
+	// BuildID is the BuildID of the binary that handled the event
+	BuildID string `json:"buildID,omitempty"`
+	// Timestamp is the UTC time the event was received
+	Timestamp time.Time `json:"timestamp"`
+	// Event is the (redacted) incoming event
+	Event json.RawMessage `json:"event"`
+	// Response is the (redacted) function response
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error is the function error message, if any
+	Error string `json:"error,omitempty"`
+	// RedactPaths are the JSONPath expressions that were redacted from
+	// the Event and Response. The replayed response is redacted with the
+	// same expressions before it's compared to the Response.
+	RedactPaths []string `json:"redactPaths,omitempty"`
+}
+
+// CapturedPayloadKey returns the S3 key for the captured payload of
+// the given function invocation
+func CapturedPayloadKey(keyPrefix string, functionName string, requestID string) string {
+	return path.Join(keyPrefix, functionName, requestID+".json")
+}
+
+// capturedPayloadInternalName returns the internal name of the lambda function
+// that handled the captured payload. Deployed function names are prefixed
+// with the stack name, which can't include the delimiter.
+func capturedPayloadInternalName(functionName string) string {
+	nameParts := strings.SplitN(functionName, functionNameDelimiter, 2)
+	return nameParts[len(nameParts)-1]
+}
+
+// redactPath is a parsed redaction JSONPath expression. Each segment
+// is either a property name, an array index or the "*" wildcard.
+type redactPath []string
+
+func parseRedactPath(expression string) (redactPath, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, errors.Errorf("JSONPath expression must start with $: %s", expression)
+	}
+	var segments redactPath
+	remaining := expression[1:]
+	for remaining != "" {
+		matches := reRedactPathSegment.FindStringSubmatch(remaining)
+		if matches == nil {
+			return nil, errors.Errorf("Unsupported JSONPath expression: %s", expression)
+		}
+		switch {
+		case matches[1] != "":
+			segments = append(segments, matches[1])
+		case matches[2] != "":
+			segments = append(segments, matches[2])
+		case matches[3] != "":
+			segments = append(segments, matches[3])
+		default:
+			segments = append(segments, "*")
+		}
+		remaining = remaining[len(matches[0]):]
+	}
+	if len(segments) == 0 {
+		return nil, errors.Errorf("JSONPath expression must select a field: %s", expression)
+	}
+	return segments, nil
+}
+
+// redact replaces the values selected by the path in the unmarshalled
+// JSON document
+func (rp redactPath) redact(document interface{}) {
+	if len(rp) == 0 {
+		return
+	}
+	segment := rp[0]
+	isLast := len(rp) == 1
+	switch typedDocument := document.(type) {
+	case map[string]interface{}:
+		for eachKey, eachValue := range typedDocument {
+			if segment != "*" && segment != eachKey {
+				continue
+			}
+			if isLast {
+				typedDocument[eachKey] = PayloadRedactedValue
+			} else {
+				rp[1:].redact(eachValue)
+			}
+		}
+	case []interface{}:
+		for eachIndex, eachValue := range typedDocument {
+			if segment != "*" && segment != strconv.Itoa(eachIndex) {
+				continue
+			}
+			if isLast {
+				typedDocument[eachIndex] = PayloadRedactedValue
+			} else {
+				rp[1:].redact(eachValue)
+			}
+		}
+	}
+}
+
+// PayloadRedactor replaces the JSON fields selected by a set of JSONPath
+// expressions (eg: `$.headers.Authorization`, `$.Records[*].body`,
+// `$.detail['credit-card']`) with PayloadRedactedValue
+type PayloadRedactor struct {
+	paths []redactPath
+}
+
+// NewPayloadRedactor returns a PayloadRedactor for the JSONPath expressions.
+// Unsupported expressions return an error.
+func NewPayloadRedactor(expressions []string) (*PayloadRedactor, error) {
+	redactor := &PayloadRedactor{}
+	for _, eachExpression := range expressions {
+		parsedPath, parsedPathErr := parseRedactPath(eachExpression)
+		if parsedPathErr != nil {
+			return nil, parsedPathErr
+		}
+		redactor.paths = append(redactor.paths, parsedPath)
+	}
+	return redactor, nil
+}
+
+// Redact returns the JSON data with the selected fields redacted
+func (pr *PayloadRedactor) Redact(data []byte) (json.RawMessage, error) {
+	if len(pr.paths) == 0 || len(data) == 0 {
+		return data, nil
+	}
+	var document interface{}
+	unmarshalErr := json.Unmarshal(data, &document)
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	for _, eachPath := range pr.paths {
+		eachPath.redact(document)
+	}
+	return json.Marshal(document)
+}
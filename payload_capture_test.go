@@ -0,0 +1,47 @@
+package sparta
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPayloadRedactor(t *testing.T) {
+	paths := []string{
+		"$.headers.Authorization",
+		"$.Records[*].body",
+		"$.detail['credit-card']",
+		"$.items[1]",
+	}
+	redactor, redactorErr := NewPayloadRedactor(paths)
+	if redactorErr != nil {
+		t.Fatalf("Failed to parse paths: %s", redactorErr)
+	}
+	event := `{
+		"headers": {"Authorization": "Bearer secret", "Accept": "*/*"},
+		"Records": [{"body": "secret1", "messageId": "1"}, {"body": "secret2", "messageId": "2"}],
+		"detail": {"credit-card": "4111111111111111"},
+		"items": ["a", "b", "c"]
+	}`
+	redacted, redactedErr := redactor.Redact([]byte(event))
+	if redactedErr != nil {
+		t.Fatalf("Failed to redact: %s", redactedErr)
+	}
+	expected := `{
+		"headers": {"Authorization": "**REDACTED**", "Accept": "*/*"},
+		"Records": [{"body": "**REDACTED**", "messageId": "1"}, {"body": "**REDACTED**", "messageId": "2"}],
+		"detail": {"credit-card": "**REDACTED**"},
+		"items": ["a", "**REDACTED**", "c"]
+	}`
+	var redactedDoc, expectedDoc interface{}
+	_ = json.Unmarshal(redacted, &redactedDoc)
+	_ = json.Unmarshal([]byte(expected), &expectedDoc)
+	redactedBytes, _ := json.Marshal(redactedDoc)
+	expectedBytes, _ := json.Marshal(expectedDoc)
+	if string(redactedBytes) != string(expectedBytes) {
+		t.Fatalf("Unexpected redacted payload: %s", string(redactedBytes))
+	}
+	_, invalidErr := NewPayloadRedactor([]string{"headers.Authorization"})
+	if invalidErr == nil {
+		t.Fatalf("Expected error for invalid JSONPath expression")
+	}
+}
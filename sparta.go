@@ -63,7 +63,11 @@ type optionsGlobalStruct struct {
 	Command            string          `validate:"-"`
 	BuildTags          string          `validate:"-"`
 	LinkerFlags        string          `validate:"-"` // no requirements
+	Runtime            string          `validate:"eq=go1.x|eq=provided.al2"`
+	Architecture       string          `validate:"eq=x86_64|eq=arm64"`
 	DisableColors      bool            `validate:"-"`
+	Stage              string          `validate:"-"`
+	ConfigFile         string          `validate:"-"`
 	startTime          time.Time
 }
 
@@ -272,6 +276,17 @@ type LambdaFunctionOptions struct {
 	Tags map[string]string
 	// Tracing options for XRay
 	TracingConfig *gocf.LambdaFunctionTracingConfig
+	// TimeoutGracePeriod is the duration before the function deadline
+	// at which the handler's context is canceled so that the Complete
+	// interceptors can run and logs, metrics and traces can be
+	// flushed. Defaults to DefaultTimeoutGracePeriod. Use a negative
+	// value to disable. The handler isn't stopped at the deadline: it
+	// keeps running until it returns or the execution environment is
+	// frozen, and the AfterDispatch interceptors aren't called.
+	TimeoutGracePeriod time.Duration
+	// Architecture is the optional instruction set architecture of the
+	// function. Defaults to the service architecture.
+	Architecture AWSLambdaArchitecture
 	// Additional params
 	ExtendedOptions *ExtendedOptions
 }
@@ -633,18 +648,47 @@ type NamedInterceptor struct {
 // InterceptorList is a list of NamedInterceptors
 type InterceptorList []*NamedInterceptor
 
+// ShortCircuitInterceptor is the type of an event interceptor that is able
+// to handle an event without the lambda handler being called. If handled
+// is true, the response and err values are used as the function result
+// and the handler is not invoked.
+type ShortCircuitInterceptor func(ctx context.Context,
+	msg json.RawMessage) (context.Context, interface{}, bool, error)
+
+// NamedShortCircuitInterceptor represents a named ShortCircuitInterceptor
+// that's invoked in the event path
+type NamedShortCircuitInterceptor struct {
+	Name        string
+	Interceptor ShortCircuitInterceptor
+}
+
+// ShortCircuitInterceptorList is a list of NamedShortCircuitInterceptors
+type ShortCircuitInterceptorList []*NamedShortCircuitInterceptor
+
 ////////////////////////////////////////////////////////////////////////////////
 // START - LambdaEventInterceptors
 
 // LambdaEventInterceptors is the struct that stores event handlers that tap into
-// the normal event dispatching workflow
+// the normal event dispatching workflow.
+//
+// If the handler doesn't return before the TimeoutGracePeriod deadline, or
+// the request is canceled, Sparta abandons the handler goroutine and only
+// the Complete interceptors are called. The AfterDispatch interceptors
+// are not called. Interceptors should therefore release resources in
+// Complete rather than AfterDispatch. The abandoned handler keeps running
+// until it returns or the Lambda execution environment is frozen.
 type LambdaEventInterceptors struct {
 	Begin          InterceptorList
 	BeforeSetup    InterceptorList
 	AfterSetup     InterceptorList
 	BeforeDispatch InterceptorList
-	AfterDispatch  InterceptorList
-	Complete       InterceptorList
+	// ShortCircuit interceptors are called, in order, after the BeforeDispatch
+	// interceptors. The first one that handles the event supplies the
+	// response and the lambda handler is not called. The AfterDispatch
+	// and Complete interceptors are called in either case.
+	ShortCircuit  ShortCircuitInterceptorList
+	AfterDispatch InterceptorList
+	Complete      InterceptorList
 }
 
 // Register is a convenience function to register a struct that
@@ -676,6 +720,17 @@ func (lei *LambdaEventInterceptors) Register(provider LambdaInterceptorProvider)
 	}
 	lei.BeforeDispatch = append(lei.BeforeDispatch, namedInterceptor(provider.BeforeDispatch))
 
+	shortCircuitProvider, shortCircuitProviderOk := provider.(LambdaShortCircuitInterceptorProvider)
+	if shortCircuitProviderOk {
+		if lei.ShortCircuit == nil {
+			lei.ShortCircuit = make(ShortCircuitInterceptorList, 0)
+		}
+		lei.ShortCircuit = append(lei.ShortCircuit, &NamedShortCircuitInterceptor{
+			Name:        fmt.Sprintf("%T", provider),
+			Interceptor: shortCircuitProvider.ShortCircuit,
+		})
+	}
+
 	if lei.AfterDispatch == nil {
 		lei.AfterDispatch = make(InterceptorList, 0)
 	}
@@ -699,6 +754,16 @@ type LambdaInterceptorProvider interface {
 	Complete(ctx context.Context, msg json.RawMessage) context.Context
 }
 
+// LambdaShortCircuitInterceptorProvider is the optional interface that a
+// LambdaInterceptorProvider can implement to handle an event without the
+// lambda handler being called. Use cases include rejecting unauthorized or
+// invalid requests and returning cached results. Providers that implement
+// this interface are added to the ShortCircuit list by Register.
+type LambdaShortCircuitInterceptorProvider interface {
+	ShortCircuit(ctx context.Context,
+		msg json.RawMessage) (context.Context, interface{}, bool, error)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // START - LambdaAWSInfo
 
@@ -757,6 +822,12 @@ type LambdaAWSInfo struct {
 	// interceptors
 	Interceptors *LambdaEventInterceptors
 
+	// Optional JSON Schemas used to validate the event and response
+	Schemas *LambdaSchemas
+
+	// Is this function the target of an API Gateway resource?
+	apiGatewayTarget bool
+
 	// Internal mutex to prevent race conditions when lazily updating lambda function name
 	rwMutex sync.Mutex
 }
@@ -1044,6 +1115,13 @@ func (info *LambdaAWSInfo) export(ctx context.Context,
 		iamRoleArnName = info.RoleDefinition.logicalName(serviceName, info.lambdaFunctionName())
 		dependsOn = append(dependsOn, info.RoleDefinition.logicalName(serviceName, info.lambdaFunctionName()))
 	}
+	// Ensure the optional JSON Schemas compile
+	_, validatorErr := newLambdaSchemaValidator(info)
+	if validatorErr != nil {
+		return ctx, errors.Wrapf(validatorErr,
+			"Invalid JSON Schema for lambda function: %s",
+			info.lambdaFunctionName())
+	}
 	lambdaDescription := info.Options.Description
 	if lambdaDescription == "" {
 		lambdaDescription = fmt.Sprintf("%s: %s", serviceName, info.lambdaFunctionName())
@@ -3,6 +3,7 @@ package sparta
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	_ "github.com/aws/aws-lambda-go/lambda"        // Force dep to resolve
 	_ "github.com/aws/aws-lambda-go/lambdacontext" // Force dep to resolve
@@ -29,6 +30,74 @@ type AWSLambdaRuntimeName string
 const (
 	// Go1LambdaRuntime is the Go version runtime used for the lambda function
 	Go1LambdaRuntime AWSLambdaRuntimeName = "go1.x"
+	// ProvidedAL2LambdaRuntime is the Amazon Linux 2 custom runtime. The
+	// binary is packaged as the `bootstrap` executable.
+	ProvidedAL2LambdaRuntime AWSLambdaRuntimeName = "provided.al2"
+)
+
+// AWSLambdaArchitecture is an alias for the lambda instruction set architecture
+type AWSLambdaArchitecture string
+
+const (
+	// ArchitectureX8664 is the x86_64 lambda architecture
+	ArchitectureX8664 AWSLambdaArchitecture = "x86_64"
+	// ArchitectureARM64 is the arm64 (Graviton) lambda architecture. It
+	// requires the ProvidedAL2LambdaRuntime runtime.
+	ArchitectureARM64 AWSLambdaArchitecture = "arm64"
+)
+
+const (
+	// ProvidedRuntimeBootstrapName is the name of the executable that
+	// the provided.al2 runtime runs
+	ProvidedRuntimeBootstrapName = "bootstrap"
+)
+
+const (
+	// InvocationTypeSync is the `invoke --type` value that waits for
+	// the function response
+	InvocationTypeSync = "sync"
+	// InvocationTypeAsync is the `invoke --type` value that queues the
+	// event for asynchronous invocation
+	InvocationTypeAsync = "async"
+	// InvocationTypeDryRun is the `invoke --type` value that validates
+	// the request parameters and permissions
+	InvocationTypeDryRun = "dryrun"
+)
+
+const (
+	// ExportFormatSAM is the `export` format that writes an AWS SAM
+	// template and samconfig.toml file
+	ExportFormatSAM = "sam"
+)
+
+const (
+	// GraphFormatMermaid is the `graph` format that writes a Mermaid flowchart
+	GraphFormatMermaid = "mermaid"
+	// GraphFormatDOT is the `graph` format that writes a Graphviz DOT graph
+	GraphFormatDOT = "dot"
+	// GraphFormatJSON is the `graph` format that writes the ServiceGraph
+	// nodes and edges as JSON
+	GraphFormatJSON = "json"
+)
+
+const (
+	// StatusFormatText is the `status --reportFormat` value that logs the report
+	StatusFormatText = "text"
+	// StatusFormatHTML is the `describe --reportFormat` value that produces an
+	// HTML report
+	StatusFormatHTML = "html"
+	// StatusFormatJSON is the `status` and `describe` --reportFormat value that
+	// writes the StatusReport as JSON
+	StatusFormatJSON = "json"
+	// StatusFormatYAML is the `status` and `describe` --reportFormat value that
+	// writes the StatusReport as YAML
+	StatusFormatYAML = "yaml"
+)
+
+const (
+	// DefaultTimeoutGracePeriod is the default duration reserved
+	// before the function deadline for an orderly exit
+	DefaultTimeoutGracePeriod = 500 * time.Millisecond
 )
 
 var (
@@ -108,6 +177,9 @@ const (
 	// ContextKeyAWSSession is the aws Session instance for this
 	// request
 	ContextKeyAWSSession
+	// ContextKeyShortCircuitInterceptor is the name of the ShortCircuit
+	// interceptor that handled the request, if any
+	ContextKeyShortCircuitInterceptor
 )
 
 const (
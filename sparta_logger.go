@@ -21,12 +21,12 @@ const (
 	colorBold = 1
 )
 
-func newRSLogger(logLevel zerolog.Level, outputFormat string, noColor bool) (*zerolog.Logger, error) {
+func newRSLogger(logLevel zerolog.Level, outputFormat string, noColor bool, output *os.File) (*zerolog.Logger, error) {
 	var loggerWriter io.Writer
 	switch outputFormat {
 	case "text", "txt":
 		consoleWriter := zerolog.ConsoleWriter{
-			Out:        colorable.NewColorableStdout(),
+			Out:        colorable.NewColorable(output),
 			TimeFormat: time.RFC822,
 		}
 		consoleWriter.FormatLevel = func(i interface{}) string {
@@ -71,7 +71,7 @@ func newRSLogger(logLevel zerolog.Level, outputFormat string, noColor bool) (*ze
 		}
 		loggerWriter = &consoleWriter
 	default:
-		loggerWriter = os.Stdout
+		loggerWriter = output
 	}
 	// Set it up and return it...
 	rsLogger := zerolog.New(loggerWriter).With().Timestamp().Logger().Level(logLevel)
@@ -87,6 +87,15 @@ func NewLogger(level string) (*zerolog.Logger, error) {
 
 // NewLoggerForOutput returns a new zerolog
 func NewLoggerForOutput(userLevel string, outputType string, disableColors bool) (*zerolog.Logger, error) {
+	return newLoggerForOutputFile(userLevel, outputType, disableColors, os.Stdout)
+}
+
+// newLoggerForOutputFile returns a new zerolog that writes to the given
+// file. Commands that write a report to stdout log to stderr instead.
+func newLoggerForOutputFile(userLevel string,
+	outputType string,
+	disableColors bool,
+	output *os.File) (*zerolog.Logger, error) {
 	// If there is an environment override, use that
 	envLogLevel := os.Getenv(envVarLogLevel)
 	if envLogLevel != "" {
@@ -96,5 +105,5 @@ func NewLoggerForOutput(userLevel string, outputType string, disableColors bool)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to parse logLevel: %s", userLevel)
 	}
-	return newRSLogger(logLevel, outputType, disableColors)
+	return newRSLogger(logLevel, outputType, disableColors, output)
 }
@@ -16,6 +16,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mweagle/Sparta/generator"
+	"github.com/mweagle/Sparta/validator/lint"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
@@ -99,6 +101,17 @@ var CommandLineOptions = struct {
 	Explore   *cobra.Command
 	Profile   *cobra.Command
 	Status    *cobra.Command
+	Replay    *cobra.Command
+	Diff      *cobra.Command
+	Logs      *cobra.Command
+	Invoke    *cobra.Command
+	Rollback  *cobra.Command
+	Export    *cobra.Command
+	Graph     *cobra.Command
+	Doctor    *cobra.Command
+	Init      *cobra.Command
+	Lint      *cobra.Command
+	Cost      *cobra.Command
 }{}
 
 /*============================================================================*/
@@ -160,9 +173,13 @@ type optionsProvisionStruct struct {
 	optionsBuildStruct
 	StackParams     []string
 	StackTags       []string
-	S3Bucket        string `validate:"required"`
-	PipelineTrigger string `validate:"-"`
-	InPlace         bool   `validate:"-"`
+	S3Bucket        string             `validate:"required_without=Targets"`
+	PipelineTrigger string             `validate:"-"`
+	InPlace         bool               `validate:"-"`
+	FromBuild       string             `validate:"-"`
+	Targets         []*ProvisionTarget `validate:"-"`
+	FailurePolicy   string             `validate:"omitempty,eq=failFast|eq=continue"`
+	Concurrency     int                `validate:"-"`
 	stackParams     map[string]string
 	stackTags       map[string]string
 }
@@ -196,6 +213,9 @@ func (ops *optionsProvisionStruct) parseParams() error {
 	ops.stackTags = map[string]string{
 		SpartaTagBuildIDKey: StampedBuildID,
 	}
+	if OptionsGlobal.Stage != "" {
+		ops.stackTags[SpartaTagStageKey] = OptionsGlobal.Stage
+	}
 	for _, eachPair := range ops.StackTags {
 		pairVals := splitter(eachPair)
 		ops.stackTags[pairVals[0]] = pairVals[1]
@@ -205,11 +225,30 @@ func (ops *optionsProvisionStruct) parseParams() error {
 
 var optionsProvision optionsProvisionStruct
 
+/*============================================================================*/
+// Delete options
+type optionsDeleteStruct struct {
+	S3Bucket string `validate:"-"`
+}
+
+var optionsDelete optionsDeleteStruct
+
+/*============================================================================*/
+// Execute options
+type optionsExecuteStruct struct {
+	Local   bool   `validate:"-"`
+	Address string `validate:"required_with=Local"`
+}
+
+var optionsExecute optionsExecuteStruct
+
 /*============================================================================*/
 // Describe options
 type optionsDescribeStruct struct {
-	OutputFile string `validate:"required"`
-	S3Bucket   string `validate:"required"`
+	OutputFile string `validate:"-"`
+	S3Bucket   string `validate:"-"`
+	Format     string `validate:"eq=html|eq=json|eq=yaml"`
+	Redact     bool   `validate:"-"`
 }
 
 var optionsDescribe optionsDescribeStruct
@@ -234,11 +273,120 @@ var optionsProfile optionsProfileStruct
 /*============================================================================*/
 // Status options
 type optionsStatusStruct struct {
-	Redact bool `validate:"-"`
+	Redact bool   `validate:"-"`
+	Format string `validate:"eq=text|eq=json|eq=yaml"`
 }
 
 var optionsStatus optionsStatusStruct
 
+/*============================================================================*/
+// Replay options
+type optionsReplayStruct struct {
+	Source   string `validate:"required"`
+	Function string `validate:"-"`
+	Remote   bool   `validate:"-"`
+}
+
+var optionsReplay optionsReplayStruct
+
+/*============================================================================*/
+// Diff options. The stack parameters, tags and S3 bucket are the same
+// as the provision options.
+type optionsDiffStruct struct {
+	optionsProvisionStruct
+}
+
+var optionsDiff optionsDiffStruct
+
+/*============================================================================*/
+// Logs options
+type optionsLogsStruct struct {
+	Functions []string `validate:"-"`
+	Since     string   `validate:"-"`
+	Until     string   `validate:"-"`
+	Filter    string   `validate:"-"`
+	RequestID string   `validate:"-"`
+	Query     string   `validate:"-"`
+}
+
+var optionsLogs optionsLogsStruct
+
+/*============================================================================*/
+// Invoke options
+type optionsInvokeStruct struct {
+	Payload string `validate:"-"`
+	Event   string `validate:"-"`
+	Type    string `validate:"eq=sync|eq=async|eq=dryrun"`
+}
+
+var optionsInvoke optionsInvokeStruct
+
+/*============================================================================*/
+// Rollback options
+type optionsRollbackStruct struct {
+	S3Bucket string `validate:"required"`
+	BuildID  string `validate:"-"`
+}
+
+var optionsRollback optionsRollbackStruct
+
+/*============================================================================*/
+// Export options
+type optionsExportStruct struct {
+	optionsBuildStruct
+	S3Bucket string `validate:"-"`
+}
+
+var optionsExport optionsExportStruct
+
+/*============================================================================*/
+// Graph options
+type optionsGraphStruct struct {
+	OutputFile string `validate:"-"`
+}
+
+var optionsGraph optionsGraphStruct
+
+/*============================================================================*/
+// Doctor options
+type optionsDoctorStruct struct {
+	S3Bucket string `validate:"-"`
+	Offline  bool   `validate:"-"`
+}
+
+var optionsDoctor optionsDoctorStruct
+
+/*============================================================================*/
+// Init options
+type optionsInitStruct struct {
+	ServiceName string `validate:"required"`
+	ModulePath  string `validate:"-"`
+	OutputDir   string `validate:"-"`
+}
+
+var optionsInit optionsInitStruct
+
+/*============================================================================*/
+// Lint options
+type optionsLintStruct struct {
+	optionsBuildStruct
+	Format     string `validate:"eq=text|eq=json|eq=sarif"`
+	FailOn     string `validate:"eq=error|eq=warning|eq=note|eq=none"`
+	ReportFile string `validate:"-"`
+}
+
+var optionsLint optionsLintStruct
+
+/*============================================================================*/
+// Cost options
+type optionsCostStruct struct {
+	optionsBuildStruct
+	UsageFile string `validate:"-"`
+	Format    string `validate:"eq=text|eq=json"`
+}
+
+var optionsCost optionsCostStruct
+
 /*============================================================================*/
 // Initialization
 // Initialize all the Cobra commands and their associated flags
@@ -280,6 +428,16 @@ func init() {
 		"",
 		"Go linker string definition flags (https://golang.org/cmd/link/)")
 
+	// Runtime and architecture of the lambda functions
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.Runtime,
+		"runtime",
+		string(Go1LambdaRuntime),
+		"Lambda runtime [go1.x, provided.al2]")
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.Architecture,
+		"architecture",
+		string(ArchitectureX8664),
+		"Default lambda architecture [x86_64, arm64]. The arm64 architecture requires the provided.al2 runtime")
+
 	// Support disabling log colors for CLI friendliness
 	CommandLineOptions.Root.PersistentFlags().BoolVarP(&OptionsGlobal.DisableColors,
 		"nocolor",
@@ -287,6 +445,17 @@ func init() {
 		false,
 		"Boolean flag to suppress colorized TTY output")
 
+	// Per-stage configuration file
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.Stage,
+		"stage",
+		"",
+		"Optional stage name whose configuration file section overrides the default section")
+	CommandLineOptions.Root.PersistentFlags().StringVar(&OptionsGlobal.ConfigFile,
+		"config",
+		"",
+		fmt.Sprintf("Optional configuration file. Defaults to the first of [%s] in the working directory",
+			strings.Join(StageConfigurationFiles, ", ")))
+
 	// Version
 	CommandLineOptions.Version = &cobra.Command{
 		Use:          "version",
@@ -357,6 +526,20 @@ func init() {
 		"c",
 		false,
 		"If the provision operation results in *only* function updates, bypass CloudFormation")
+	CommandLineOptions.Provision.Flags().StringVar(&optionsProvision.FromBuild,
+		"fromBuild",
+		"",
+		"Optional output directory of a previous build to provision without rebuilding")
+	CommandLineOptions.Provision.Flags().StringVar(&optionsProvision.FailurePolicy,
+		"failurePolicy",
+		ProvisionFailurePolicyFailFast,
+		fmt.Sprintf("Stage target failure policy. One of: [%s, %s]",
+			ProvisionFailurePolicyFailFast,
+			ProvisionFailurePolicyContinue))
+	CommandLineOptions.Provision.Flags().IntVar(&optionsProvision.Concurrency,
+		"concurrency",
+		4,
+		"Maximum number of stage targets to provision concurrently")
 	CommandLineOptions.Provision.Flags().StringVarP(&optionsProvision.OutputDir,
 		"outputDir",
 		"o",
@@ -370,11 +553,18 @@ func init() {
 
 	// Delete
 	CommandLineOptions.Delete = &cobra.Command{
-		Use:          "delete",
-		Short:        "Delete service",
-		Long:         `Ensure service is successfully deleted`,
+		Use:   "delete",
+		Short: "Delete service",
+		Long: `Ensure service is successfully deleted. If --stage is provided,
+the command waits for the stage's stack to be deleted and then deletes the
+stage's S3 artifacts and lambda function log groups.`,
 		SilenceUsage: true,
 	}
+	CommandLineOptions.Delete.Flags().StringVarP(&optionsDelete.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"Optional S3 Bucket with the --stage artifacts to delete")
 
 	// Execute
 	CommandLineOptions.Execute = &cobra.Command{
@@ -383,24 +573,42 @@ func init() {
 		Long:         `Start the application and begin handling events`,
 		SilenceUsage: true,
 	}
+	CommandLineOptions.Execute.Flags().BoolVarP(&optionsExecute.Local,
+		"local",
+		"",
+		false,
+		"Run a local AWS Lambda Runtime API emulator that dispatches to the registered functions")
+	CommandLineOptions.Execute.Flags().StringVarP(&optionsExecute.Address,
+		"address",
+		"a",
+		"127.0.0.1:9001",
+		"Address for the local AWS Lambda Runtime API emulator (requires --local)")
 
 	// Describe
 	CommandLineOptions.Describe = &cobra.Command{
 		Use:          "describe",
 		Short:        "Describe service",
-		Long:         `Produce an HTML report of the service`,
+		Long:         `Produce an HTML, JSON or YAML report of the service`,
 		SilenceUsage: true,
 	}
 	CommandLineOptions.Describe.Flags().StringVarP(&optionsDescribe.OutputFile,
 		"out",
 		"o",
 		"",
-		"Output file for HTML description")
+		"Output file for the description. Required for the html format, defaults to stdout otherwise")
 	CommandLineOptions.Describe.Flags().StringVarP(&optionsDescribe.S3Bucket,
 		"s3Bucket",
 		"s",
 		"",
 		"S3 Bucket to use for Lambda source")
+	CommandLineOptions.Describe.Flags().StringVar(&optionsDescribe.Format,
+		"reportFormat",
+		StatusFormatHTML,
+		"Description format (html|json|yaml)")
+	CommandLineOptions.Describe.Flags().BoolVarP(&optionsDescribe.Redact, "redact",
+		"r",
+		false,
+		"Redact AWS Account ID from the json or yaml report")
 
 	// Explore
 	CommandLineOptions.Explore = &cobra.Command{
@@ -444,6 +652,311 @@ func init() {
 		"r",
 		false,
 		"Redact AWS Account ID from report")
+	CommandLineOptions.Status.Flags().StringVar(&optionsStatus.Format,
+		"reportFormat",
+		StatusFormatText,
+		"Report format (text|json|yaml)")
+
+	// Replay
+	CommandLineOptions.Replay = &cobra.Command{
+		Use:   "replay",
+		Short: "Replay captured production events",
+		Long: `Replay the events saved by the payload capture interceptor against the local
+or provisioned lambda functions and compare the results`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Replay.Flags().StringVarP(&optionsReplay.Source,
+		"source",
+		"s",
+		"",
+		"Captured payloads location: local file, local directory or s3://bucket/prefix URL")
+	CommandLineOptions.Replay.Flags().StringVar(&optionsReplay.Function,
+		"function",
+		"",
+		"Only replay payloads captured for this function name")
+	CommandLineOptions.Replay.Flags().BoolVar(&optionsReplay.Remote,
+		"remote",
+		false,
+		"Replay payloads against the provisioned functions rather than locally")
+
+	// Diff
+	CommandLineOptions.Diff = &cobra.Command{
+		Use:   "diff",
+		Short: "Preview provisioning changes",
+		Long: `Build the service and report the changes that provisioning would apply to
+the provisioned stack. Exits with an error if the stack resources would change.`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Diff.Flags().StringArrayVarP(&optionsDiff.StackParams,
+		"param",
+		"m",
+		[]string{},
+		"List of params in A=B format")
+	CommandLineOptions.Diff.Flags().StringArrayVarP(&optionsDiff.StackTags,
+		"tag",
+		"g",
+		[]string{},
+		"List of Stack Tags in A=B format")
+	CommandLineOptions.Diff.Flags().StringVarP(&optionsDiff.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket to use for Lambda source")
+	CommandLineOptions.Diff.Flags().StringVarP(&optionsDiff.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Diff.Flags().StringVarP(&optionsDiff.OutputDir,
+		"outputDir",
+		"o",
+		ScratchDirectory,
+		"Optional output directory for artifacts")
+	CommandLineOptions.Diff.Flags().StringVarP(&optionsDiff.DockerFile,
+		"dockerFile",
+		"d",
+		"",
+		"Optional Dockerfile path")
+
+	// Logs
+	CommandLineOptions.Logs = &cobra.Command{
+		Use:   "logs",
+		Short: "Tail or query function logs",
+		Long: `Tail the CloudWatch logs of the provisioned lambda functions or run a
+CloudWatch Logs Insights query across the service's log groups`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Logs.Flags().StringArrayVar(&optionsLogs.Functions,
+		"function",
+		[]string{},
+		"Function name to include. May be repeated. Defaults to all functions")
+	CommandLineOptions.Logs.Flags().StringVar(&optionsLogs.Since,
+		"since",
+		"",
+		"Start time as a duration (eg: 15m) or RFC3339 timestamp. Defaults to now")
+	CommandLineOptions.Logs.Flags().StringVar(&optionsLogs.Until,
+		"until",
+		"",
+		"Optional end time as a duration (eg: 5m) or RFC3339 timestamp. Disables tailing")
+	CommandLineOptions.Logs.Flags().StringVar(&optionsLogs.Filter,
+		"filter",
+		"",
+		"Optional CloudWatch Logs filter pattern")
+	CommandLineOptions.Logs.Flags().StringVar(&optionsLogs.RequestID,
+		"requestID",
+		"",
+		"Only include log events for this request ID")
+	CommandLineOptions.Logs.Flags().StringVar(&optionsLogs.Query,
+		"query",
+		"",
+		"CloudWatch Logs Insights query or template name [errors, coldstarts, duration, memory]")
+
+	// Invoke
+	CommandLineOptions.Invoke = &cobra.Command{
+		Use:   "invoke <function>",
+		Short: "Invoke a provisioned function",
+		Long: `Invoke the provisioned lambda function with the Sparta function name
+and print the response. Returns an error if the function returns an error`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Invoke.Flags().StringVarP(&optionsInvoke.Payload,
+		"payload",
+		"p",
+		"",
+		"Path to the JSON event payload. Use - to read from stdin")
+	CommandLineOptions.Invoke.Flags().StringVarP(&optionsInvoke.Event,
+		"event",
+		"e",
+		"",
+		"Built-in event template [empty, apigateway, s3, sns, sqs, eventbridge, scheduled, dynamodb, kinesis]")
+	CommandLineOptions.Invoke.Flags().StringVar(&optionsInvoke.Type,
+		"type",
+		InvocationTypeSync,
+		"Invocation type [sync, async, dryrun]")
+
+	// Rollback
+	CommandLineOptions.Rollback = &cobra.Command{
+		Use:   "rollback",
+		Short: "Rollback to a previously provisioned build",
+		Long: `Redeploy the template and code of a previously provisioned BuildID
+without rebuilding. Lists the available builds if no BuildID is provided`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Rollback.Flags().StringVarP(&optionsRollback.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"S3 Bucket with the provisioned build artifacts")
+	CommandLineOptions.Rollback.Flags().StringVarP(&optionsRollback.BuildID,
+		"buildID",
+		"i",
+		"",
+		"BuildID to redeploy")
+
+	// Export
+	CommandLineOptions.Export = &cobra.Command{
+		Use:   "export <format>",
+		Short: "Export the service to another deployment format",
+		Long: `Build the service and export the CloudFormation template to another
+deployment format. The sam format writes an AWS SAM template.json and
+samconfig.toml file to the output directory`,
+		Args:         cobra.ExactValidArgs(1),
+		ValidArgs:    []string{ExportFormatSAM},
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"Optional S3 Bucket for the packaged artifacts")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.OutputDir,
+		"outputDir",
+		"o",
+		ScratchDirectory,
+		"Optional output directory for artifacts")
+	CommandLineOptions.Export.Flags().StringVarP(&optionsExport.DockerFile,
+		"dockerFile",
+		"d",
+		"",
+		"Optional Dockerfile path")
+
+	// Graph
+	CommandLineOptions.Graph = &cobra.Command{
+		Use:   "graph <format>",
+		Short: "Export the service topology",
+		Long: `Export the service topology of Lambda functions, event sources and
+APIs as a Mermaid flowchart, Graphviz DOT graph or JSON document`,
+		Args:         cobra.ExactValidArgs(1),
+		ValidArgs:    []string{GraphFormatMermaid, GraphFormatDOT, GraphFormatJSON},
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Graph.Flags().StringVarP(&optionsGraph.OutputFile,
+		"out",
+		"o",
+		"",
+		"Optional output file for the graph. Defaults to stdout")
+
+	// Doctor
+	CommandLineOptions.Doctor = &cobra.Command{
+		Use:   "doctor",
+		Short: "Validate the local and AWS environment",
+		Long: `Validate the Go toolchain, Docker, AWS region, credentials, IAM
+permissions and S3 bucket before provisioning the service`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Doctor.Flags().StringVarP(&optionsDoctor.S3Bucket,
+		"s3Bucket",
+		"s",
+		"",
+		"Optional S3 Bucket to check")
+	CommandLineOptions.Doctor.Flags().BoolVarP(&optionsDoctor.Offline,
+		"offline",
+		"",
+		false,
+		"Skip the AWS checks")
+
+	// Init
+	CommandLineOptions.Init = &cobra.Command{
+		Use:   "init <template>",
+		Short: "Create a new service from a project template",
+		Long: `Create a new service, including a magefile, tests and sample events,
+from a REST API, S3 reactor, SQS worker, step function or S3 site template`,
+		Args:         cobra.ExactValidArgs(1),
+		ValidArgs:    generator.Templates(),
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Init.Flags().StringVarP(&optionsInit.ServiceName,
+		"name",
+		"s",
+		"",
+		"Name of the new service")
+	CommandLineOptions.Init.Flags().StringVarP(&optionsInit.ModulePath,
+		"module",
+		"m",
+		"",
+		"Optional Go module path. Defaults to the lowercase service name")
+	CommandLineOptions.Init.Flags().StringVarP(&optionsInit.OutputDir,
+		"outputDir",
+		"o",
+		"",
+		"Optional output directory. Defaults to the lowercase service name")
+
+	// Lint
+	CommandLineOptions.Lint = &cobra.Command{
+		Use:   "lint",
+		Short: "Check the service template against the lint rules",
+		Long: `Build the service and check the CloudFormation template for
+wildcard IAM permissions, public S3 buckets, unencrypted queues and streams,
+missing log retention, unauthorized API methods and Lambda functions without
+failure destinations`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Lint.Flags().StringVarP(&optionsLint.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Lint.Flags().StringVarP(&optionsLint.OutputDir,
+		"outputDir",
+		"o",
+		ScratchDirectory,
+		"Optional output directory for artifacts")
+	CommandLineOptions.Lint.Flags().StringVarP(&optionsLint.DockerFile,
+		"dockerFile",
+		"d",
+		"",
+		"Optional Dockerfile path")
+	CommandLineOptions.Lint.Flags().StringVar(&optionsLint.Format,
+		"reportFormat",
+		lint.FormatText,
+		"Report format (text|json|sarif)")
+	CommandLineOptions.Lint.Flags().StringVar(&optionsLint.FailOn,
+		"failOn",
+		string(lint.SeverityError),
+		"Minimum finding severity that fails the command (error|warning|note|none)")
+	CommandLineOptions.Lint.Flags().StringVar(&optionsLint.ReportFile,
+		"reportFile",
+		"",
+		"Optional output file for the report. Defaults to stdout")
+
+	// Cost
+	CommandLineOptions.Cost = &cobra.Command{
+		Use:   "cost",
+		Short: "Estimate the monthly cost of the service",
+		Long: `Build the service and estimate the monthly cost of each resource in
+the CloudFormation template from a usage profile and the bundled price table`,
+		SilenceUsage: true,
+	}
+	CommandLineOptions.Cost.Flags().StringVarP(&optionsCost.BuildID,
+		"buildID",
+		"i",
+		"",
+		"Optional BuildID to use")
+	CommandLineOptions.Cost.Flags().StringVarP(&optionsCost.OutputDir,
+		"outputDir",
+		"o",
+		ScratchDirectory,
+		"Optional output directory for artifacts")
+	CommandLineOptions.Cost.Flags().StringVarP(&optionsCost.DockerFile,
+		"dockerFile",
+		"d",
+		"",
+		"Optional Dockerfile path")
+	CommandLineOptions.Cost.Flags().StringVarP(&optionsCost.UsageFile,
+		"usage",
+		"u",
+		"",
+		"Optional JSON or YAML usage profile")
+	CommandLineOptions.Cost.Flags().StringVar(&optionsCost.Format,
+		"reportFormat",
+		StatusFormatText,
+		"Report format (text|json)")
 }
 
 // CommandLineOptionsHook allows embedding applications the ability
@@ -525,6 +1038,17 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 		CommandLineOptions.Explore,
 		CommandLineOptions.Profile,
 		CommandLineOptions.Status,
+		CommandLineOptions.Replay,
+		CommandLineOptions.Diff,
+		CommandLineOptions.Logs,
+		CommandLineOptions.Invoke,
+		CommandLineOptions.Rollback,
+		CommandLineOptions.Export,
+		CommandLineOptions.Graph,
+		CommandLineOptions.Doctor,
+		CommandLineOptions.Init,
+		CommandLineOptions.Lint,
+		CommandLineOptions.Cost,
 	}
 	for _, eachCommand := range spartaCommands {
 		eachCommand.PreRunE = func(cmd *cobra.Command, args []string) error {
@@ -533,6 +1057,14 @@ func ParseOptions(handler CommandLineOptionsHook) error {
 				StampedBuildID = optionsBuild.BuildID
 			case CommandLineOptions.Provision:
 				StampedBuildID = optionsProvision.BuildID
+			case CommandLineOptions.Diff:
+				StampedBuildID = optionsDiff.BuildID
+			case CommandLineOptions.Export:
+				StampedBuildID = optionsExport.BuildID
+			case CommandLineOptions.Lint:
+				StampedBuildID = optionsLint.BuildID
+			case CommandLineOptions.Cost:
+				StampedBuildID = optionsCost.BuildID
 			default:
 				// NOP
 			}
@@ -99,6 +99,15 @@ func MainEx(serviceName string,
 	return CommandLineOptions.Root.Execute()
 }
 
+// ExecuteLocal is not available in the AWS Lambda binary
+func ExecuteLocal(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	address string,
+	logger *zerolog.Logger) error {
+	logger.Error().Msg("ExecuteLocal() not supported in AWS Lambda binary")
+	return errors.New("ExecuteLocal not supported for this binary")
+}
+
 // Delete is not available in the AWS Lambda binary
 func Delete(serviceName string, logger *zerolog.Logger) error {
 	logger.Error().Msg("Delete() not supported in AWS Lambda binary")
@@ -115,6 +124,8 @@ func Build(noop bool,
 	useCGO bool,
 	buildID string,
 	dockerFile string,
+	runtime AWSLambdaRuntimeName,
+	architecture AWSLambdaArchitecture,
 	outputDirectory string,
 	buildTags string,
 	linkerFlags string,
@@ -196,6 +207,122 @@ func Status(serviceName string,
 	return errors.New("Status not supported for this binary")
 }
 
+// Replay is the command that replays captured payloads against the
+// lambda functions
+func Replay(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	source string,
+	functionName string,
+	remote bool,
+	logger *zerolog.Logger) error {
+	return errors.New("Replay not supported for this binary")
+}
+
+// Diff is the command that reports the changes provisioning would apply
+// to the provisioned stack
+func Diff(noop bool,
+	templatePath string,
+	stackParamValues map[string]string,
+	stackTags map[string]string,
+	logger *zerolog.Logger) error {
+	return errors.New("Diff not supported for this binary")
+}
+
+// Logs is the command that tails or queries the lambda function logs
+func Logs(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionNames []string,
+	startTime time.Time,
+	endTime time.Time,
+	filterPattern string,
+	requestID string,
+	query string,
+	jsonFormat bool,
+	disableColors bool,
+	logger *zerolog.Logger) error {
+	return errors.New("Logs not supported for this binary")
+}
+
+// Invoke is the command that invokes a provisioned lambda function
+func Invoke(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	functionName string,
+	payload []byte,
+	invocationType string,
+	logger *zerolog.Logger) error {
+	return errors.New("Invoke not supported for this binary")
+}
+
+// Rollback is the command that redeploys a previously provisioned build
+func Rollback(serviceName string,
+	s3Bucket string,
+	buildID string,
+	noop bool,
+	logger *zerolog.Logger) error {
+	return errors.New("Rollback not supported for this binary")
+}
+
+// Export is the command that exports the service to another deployment format
+func Export(format string,
+	serviceName string,
+	templatePath string,
+	s3Bucket string,
+	outputDirectory string,
+	logger *zerolog.Logger) error {
+	return errors.New("Export not supported for this binary")
+}
+
+// Graph is the command that exports the service topology
+func Graph(serviceName string,
+	lambdaAWSInfos []*LambdaAWSInfo,
+	api APIGateway,
+	workflowHooks *WorkflowHooks,
+	format string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+	return errors.New("Graph not supported for this binary")
+}
+
+// Doctor is the command that validates the local and AWS environment
+func Doctor(serviceName string,
+	s3Bucket string,
+	offline bool,
+	useCGO bool,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+	return errors.New("Doctor not supported for this binary")
+}
+
+// Init is the command that creates a new service from a project template
+func Init(template string,
+	serviceName string,
+	modulePath string,
+	outputDirectory string,
+	logger *zerolog.Logger) error {
+	return errors.New("Init not supported for this binary")
+}
+
+// Lint is the command that evaluates the lint rules against the service's
+// CloudFormation template
+func Lint(serviceName string,
+	templatePath string,
+	format string,
+	failOn string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+	return errors.New("Lint not supported for this binary")
+}
+
+// Cost is the command that estimates the monthly cost of the service
+func Cost(serviceName string,
+	templatePath string,
+	usagePath string,
+	format string,
+	outputWriter io.Writer,
+	logger *zerolog.Logger) error {
+	return errors.New("Cost not supported for this binary")
+}
+
 func platformLogSysInfo(lambdaFunc string, logger *zerolog.Logger) {
 
 	// Setup the files and their respective log levels
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/mweagle/Sparta/validator/lint"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
@@ -68,11 +69,34 @@ func MainEx(serviceName string,
 	CommandLineOptions.Root.Long = serviceDescription
 	CommandLineOptions.Root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
 
-		// Save the ServiceName in case a custom command wants it
-		OptionsGlobal.ServiceName = serviceName
 		OptionsGlobal.ServiceDescription = serviceDescription
 		OptionsGlobal.startTime = time.Now()
 
+		// Configuration file values apply to the flags that weren't
+		// provided, so load it before validating the options. The init
+		// command scaffolds a new service and doesn't use it.
+		config := &StageConfiguration{}
+		if cmd != CommandLineOptions.Init {
+			loadedConfig, loadedConfigErr := LoadStageConfiguration(OptionsGlobal.ConfigFile, OptionsGlobal.Stage)
+			if loadedConfigErr != nil {
+				return loadedConfigErr
+			}
+			configFlagsErr := loadedConfig.applyFlags(cmd)
+			if configFlagsErr != nil {
+				return configFlagsErr
+			}
+			config = loadedConfig
+		}
+		stageConfiguration = config
+
+		// Stage scoped services provision each stage as an isolated copy
+		if OptionsGlobal.Stage != "" && config.Scoped {
+			serviceName = StageScopedServiceName(serviceName, OptionsGlobal.Stage)
+			applyAPIStage(api, OptionsGlobal.Stage)
+		}
+		// Save the ServiceName in case a custom command wants it
+		OptionsGlobal.ServiceName = serviceName
+
 		validateErr := validate.Struct(OptionsGlobal)
 		if nil != validateErr {
 			return validateErr
@@ -83,9 +107,22 @@ func MainEx(serviceName string,
 		disableColors := OptionsGlobal.DisableColors ||
 			isRunningInAWS() ||
 			OptionsGlobal.LogFormat == "json"
-		logger, loggerErr := NewLoggerForOutput(OptionsGlobal.LogLevel,
+		// Machine readable reports, function log events and invocation
+		// responses are written to stdout, so log to stderr
+		loggerOutput := os.Stdout
+		if cmd == CommandLineOptions.Logs ||
+			cmd == CommandLineOptions.Invoke ||
+			(cmd == CommandLineOptions.Status && optionsStatus.Format != StatusFormatText) ||
+			(cmd == CommandLineOptions.Describe && optionsDescribe.Format != StatusFormatHTML) ||
+			(cmd == CommandLineOptions.Graph && optionsGraph.OutputFile == "") ||
+			(cmd == CommandLineOptions.Lint && optionsLint.Format != lint.FormatText && optionsLint.ReportFile == "") ||
+			(cmd == CommandLineOptions.Cost && optionsCost.Format != StatusFormatText) {
+			loggerOutput = os.Stderr
+		}
+		logger, loggerErr := newLoggerForOutputFile(OptionsGlobal.LogLevel,
 			OptionsGlobal.LogFormat,
-			disableColors)
+			disableColors,
+			loggerOutput)
 		if nil != loggerErr {
 			return loggerErr
 		}
@@ -106,6 +143,16 @@ func MainEx(serviceName string,
 			Str("UTC", time.Now().UTC().Format(time.RFC3339)).
 			Msg(welcomeMessage)
 		logger.Info().Msg(headerDivider)
+
+		if config.Path != "" {
+			logger.Info().
+				Str("Path", config.Path).
+				Str("Stage", config.Stage).
+				Bool("StageDefined", config.StageDefined).
+				Bool("Scoped", config.Scoped).
+				Msg("Stage configuration")
+		}
+		config.applyFunctions(lambdaAWSInfos, logger)
 		return nil
 	}
 	CommandLineOptions.Root.PersistentPostRunE = func(cmd *cobra.Command, args []string) error {
@@ -125,6 +172,48 @@ func MainEx(serviceName string,
 
 	//////////////////////////////////////////////////////////////////////////////
 	// Build
+	// buildTemplate builds the service and writes the CloudFormation template to
+	// the outputDir. It returns the path of the template file.
+	buildTemplate := func(userBuildID string, dockerFile string, outputDir string) (string, error) {
+		buildID, buildIDErr := computeBuildID(userBuildID, OptionsGlobal.Logger)
+		if nil != buildIDErr {
+			return "", buildIDErr
+		}
+		// Save the BuildID
+		StampedBuildID = buildID
+
+		templateFile, templateFileErr := templateOutputFile(outputDir, serviceName)
+		if templateFileErr != nil {
+			return "", templateFileErr
+		}
+		buildErr := Build(OptionsGlobal.Noop,
+			serviceName,
+			serviceDescription,
+			lambdaAWSInfos,
+			api,
+			site,
+			useCGO,
+			buildID,
+			dockerFile,
+			AWSLambdaRuntimeName(OptionsGlobal.Runtime),
+			AWSLambdaArchitecture(OptionsGlobal.Architecture),
+			outputDir,
+			OptionsGlobal.BuildTags,
+			OptionsGlobal.LinkerFlags,
+			templateFile,
+			workflowHooks,
+			OptionsGlobal.Logger)
+		closeErr := templateFile.Close()
+		if closeErr != nil {
+			OptionsGlobal.Logger.Warn().
+				Err(closeErr).
+				Msg("Failed to close template file handle")
+		}
+		if buildErr != nil {
+			return "", buildErr
+		}
+		return templateFile.Name(), nil
+	}
 	CommandLineOptions.Build.PreRunE = func(cmd *cobra.Command, args []string) error {
 		validateErr := validate.Struct(optionsBuild)
 
@@ -141,42 +230,9 @@ func MainEx(serviceName string,
 				showOptionalAWSUsageInfo(provisionErr, OptionsGlobal.Logger)
 			}()
 
-			buildID, buildIDErr := computeBuildID(optionsProvision.BuildID, OptionsGlobal.Logger)
-			if nil != buildIDErr {
-				return buildIDErr
-			}
-
-			// Save the BuildID
-			StampedBuildID = buildID
-
-			// Ok, for this we're going some way to tell the Build Command
-			// where to write the output...I suppose we could just use a TeeWriter...
-			templateFile, templateFileErr := templateOutputFile(optionsProvision.OutputDir,
-				serviceName)
-			if templateFileErr != nil {
-				return templateFileErr
-			}
-			buildErr := Build(OptionsGlobal.Noop,
-				serviceName,
-				serviceDescription,
-				lambdaAWSInfos,
-				api,
-				site,
-				useCGO,
-				buildID,
+			_, buildErr := buildTemplate(optionsBuild.BuildID,
 				optionsBuild.DockerFile,
-				optionsBuild.OutputDir,
-				OptionsGlobal.BuildTags,
-				OptionsGlobal.LinkerFlags,
-				templateFile,
-				workflowHooks,
-				OptionsGlobal.Logger)
-			closeErr := templateFile.Close()
-			if closeErr != nil {
-				OptionsGlobal.Logger.Warn().
-					Err(closeErr).
-					Msg("Failed to close template file output")
-			}
+				optionsBuild.OutputDir)
 			return buildErr
 		}
 	}
@@ -185,6 +241,8 @@ func MainEx(serviceName string,
 	//////////////////////////////////////////////////////////////////////////////
 	// Provision
 	CommandLineOptions.Provision.PreRunE = func(cmd *cobra.Command, args []string) error {
+		// Stage targets replace the single region deployment
+		optionsProvision.Targets = CurrentStageConfiguration().Targets
 		validateErr := validate.Struct(optionsProvision)
 
 		OptionsGlobal.Logger.Debug().
@@ -200,44 +258,35 @@ func MainEx(serviceName string,
 				showOptionalAWSUsageInfo(provisionErr, OptionsGlobal.Logger)
 			}()
 
-			buildID, buildIDErr := computeBuildID(optionsProvision.BuildID, OptionsGlobal.Logger)
-			if nil != buildIDErr {
-				return buildIDErr
-			}
-			StampedBuildID = buildID
-
-			templateFile, templateFileErr := templateOutputFile(optionsProvision.OutputDir,
-				serviceName)
-			if templateFileErr != nil {
-				return templateFileErr
-			}
-
-			// TODO: Build, then Provision
-			buildErr := Build(OptionsGlobal.Noop,
-				serviceName,
-				serviceDescription,
-				lambdaAWSInfos,
-				api,
-				site,
-				useCGO,
-				buildID,
-				optionsProvision.DockerFile,
-				optionsProvision.OutputDir,
-				OptionsGlobal.BuildTags,
-				OptionsGlobal.LinkerFlags,
-				templateFile,
-				workflowHooks,
-				OptionsGlobal.Logger)
-
-			defer func() {
-				closeErr := templateFile.Close()
+			var templatePath string
+			var buildErr error
+			if optionsProvision.FromBuild != "" {
+				// Provision the artifacts from a previous build
+				if optionsProvision.BuildID != "" {
+					return errors.Errorf("--buildID can't be used with --fromBuild")
+				}
+				promotedFile, promotedFileErr := promotedTemplateOutputFile(optionsProvision.OutputDir,
+					serviceName)
+				if promotedFileErr != nil {
+					return promotedFileErr
+				}
+				StampedBuildID, buildErr = PromoteBuild(optionsProvision.FromBuild,
+					serviceName,
+					OptionsGlobal.Stage,
+					promotedFile,
+					OptionsGlobal.Logger)
+				closeErr := promotedFile.Close()
 				if closeErr != nil {
 					OptionsGlobal.Logger.Warn().
 						Err(closeErr).
 						Msg("Failed to close template file handle")
 				}
-			}()
-
+				templatePath = promotedFile.Name()
+			} else {
+				templatePath, buildErr = buildTemplate(optionsProvision.BuildID,
+					optionsProvision.DockerFile,
+					optionsProvision.OutputDir)
+			}
 			if buildErr != nil {
 				return buildErr
 			}
@@ -251,10 +300,25 @@ func MainEx(serviceName string,
 				Interface("params", optionsProvision.stackParams).
 				Msg("ParseParams")
 
+			// Multi-region and/or multi-account
+			if len(optionsProvision.Targets) != 0 {
+				if optionsProvision.PipelineTrigger != "" {
+					return errors.Errorf("--codePipelinePackage can't be used with stage targets")
+				}
+				return ProvisionTargets(OptionsGlobal.Noop,
+					templatePath,
+					optionsProvision.Targets,
+					optionsProvision.stackParams,
+					optionsProvision.stackTags,
+					optionsProvision.InPlace,
+					optionsProvision.FailurePolicy,
+					optionsProvision.Concurrency,
+					OptionsGlobal.Logger)
+			}
 			// We don't need to walk the params because we
 			// put values in the Metadata block for them all...
 			return Provision(OptionsGlobal.Noop,
-				templateFile.Name(),
+				templatePath,
 				optionsProvision.stackParams,
 				optionsProvision.stackTags,
 				optionsProvision.InPlace,
@@ -267,6 +331,9 @@ func MainEx(serviceName string,
 	//////////////////////////////////////////////////////////////////////////////
 	// Delete
 	CommandLineOptions.Delete.RunE = func(cmd *cobra.Command, args []string) error {
+		if CurrentStageConfiguration().Ephemeral() {
+			return DeleteStage(serviceName, optionsDelete.S3Bucket, OptionsGlobal.Logger)
+		}
 		return Delete(serviceName, OptionsGlobal.Logger)
 	}
 
@@ -276,9 +343,19 @@ func MainEx(serviceName string,
 	// Execute
 	if nil == CommandLineOptions.Execute.RunE {
 		CommandLineOptions.Execute.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsExecute)
+			if nil != validateErr {
+				return validateErr
+			}
 			// Ensure the discovery service is initialized
 			initializeDiscovery(OptionsGlobal.Logger)
 
+			if optionsExecute.Local {
+				return ExecuteLocal(serviceName,
+					lambdaAWSInfos,
+					optionsExecute.Address,
+					OptionsGlobal.Logger)
+			}
 			return Execute(serviceName,
 				lambdaAWSInfos,
 				OptionsGlobal.Logger)
@@ -294,6 +371,27 @@ func MainEx(serviceName string,
 			if nil != validateErr {
 				return errors.Wrapf(validateErr, "Failed to validate `describe` options")
 			}
+			if optionsDescribe.Format != StatusFormatHTML {
+				reportWriter := os.Stdout
+				if optionsDescribe.OutputFile != "" {
+					fileWriter, fileWriterErr := os.Create(optionsDescribe.OutputFile)
+					if fileWriterErr != nil {
+						return fileWriterErr
+					}
+					defer fileWriter.Close()
+					reportWriter = fileWriter
+				}
+				return WriteStatusReport(serviceName,
+					lambdaAWSInfos,
+					api,
+					optionsDescribe.Redact,
+					optionsDescribe.Format,
+					reportWriter,
+					OptionsGlobal.Logger)
+			}
+			if optionsDescribe.OutputFile == "" || optionsDescribe.S3Bucket == "" {
+				return errors.New("Failed to validate `describe` options: --out and --s3Bucket are required for the html format")
+			}
 			fileWriter, fileWriterErr := os.Create(optionsDescribe.OutputFile)
 			if fileWriterErr != nil {
 				return fileWriterErr
@@ -375,6 +473,15 @@ func MainEx(serviceName string,
 			if nil != validateErr {
 				return validateErr
 			}
+			if optionsStatus.Format != StatusFormatText {
+				return WriteStatusReport(serviceName,
+					lambdaAWSInfos,
+					api,
+					optionsStatus.Redact,
+					optionsStatus.Format,
+					os.Stdout,
+					OptionsGlobal.Logger)
+			}
 			return Status(serviceName,
 				serviceDescription,
 				optionsStatus.Redact,
@@ -383,6 +490,275 @@ func MainEx(serviceName string,
 	}
 	CommandLineOptions.Root.AddCommand(CommandLineOptions.Status)
 
+	//////////////////////////////////////////////////////////////////////////////
+	// Replay
+	if nil == CommandLineOptions.Replay.RunE {
+		CommandLineOptions.Replay.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsReplay)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Replay(serviceName,
+				lambdaAWSInfos,
+				optionsReplay.Source,
+				optionsReplay.Function,
+				optionsReplay.Remote,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Replay)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Diff
+	if nil == CommandLineOptions.Diff.RunE {
+		CommandLineOptions.Diff.RunE = func(cmd *cobra.Command, args []string) (diffErr error) {
+			defer func() {
+				showOptionalAWSUsageInfo(diffErr, OptionsGlobal.Logger)
+			}()
+			validateErr := validate.Struct(optionsDiff)
+			if nil != validateErr {
+				return validateErr
+			}
+			templatePath, buildErr := buildTemplate(optionsDiff.BuildID,
+				optionsDiff.DockerFile,
+				optionsDiff.OutputDir)
+			if buildErr != nil {
+				return buildErr
+			}
+			parseErr := optionsDiff.parseParams()
+			if parseErr != nil {
+				return parseErr
+			}
+			return Diff(OptionsGlobal.Noop,
+				templatePath,
+				optionsDiff.stackParams,
+				optionsDiff.stackTags,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Diff)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Logs
+	if nil == CommandLineOptions.Logs.RunE {
+		CommandLineOptions.Logs.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsLogs)
+			if nil != validateErr {
+				return validateErr
+			}
+			now := time.Now()
+			startTime, startTimeErr := parseLogsTime(optionsLogs.Since, now)
+			if startTimeErr != nil {
+				return startTimeErr
+			}
+			endTime, endTimeErr := parseLogsTime(optionsLogs.Until, now)
+			if endTimeErr != nil {
+				return endTimeErr
+			}
+			jsonFormat := OptionsGlobal.LogFormat == "json"
+			return Logs(serviceName,
+				lambdaAWSInfos,
+				optionsLogs.Functions,
+				startTime,
+				endTime,
+				optionsLogs.Filter,
+				optionsLogs.RequestID,
+				optionsLogs.Query,
+				jsonFormat,
+				OptionsGlobal.DisableColors || jsonFormat,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Logs)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Invoke
+	if nil == CommandLineOptions.Invoke.RunE {
+		CommandLineOptions.Invoke.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsInvoke)
+			if nil != validateErr {
+				return validateErr
+			}
+			payload, payloadErr := invokePayload(optionsInvoke.Payload,
+				optionsInvoke.Event,
+				os.Stdin)
+			if payloadErr != nil {
+				return payloadErr
+			}
+			return Invoke(serviceName,
+				lambdaAWSInfos,
+				args[0],
+				payload,
+				optionsInvoke.Type,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Invoke)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Rollback
+	if nil == CommandLineOptions.Rollback.RunE {
+		CommandLineOptions.Rollback.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsRollback)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Rollback(serviceName,
+				optionsRollback.S3Bucket,
+				optionsRollback.BuildID,
+				OptionsGlobal.Noop,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Rollback)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Export
+	if nil == CommandLineOptions.Export.RunE {
+		CommandLineOptions.Export.RunE = func(cmd *cobra.Command, args []string) (exportErr error) {
+			defer func() {
+				showOptionalAWSUsageInfo(exportErr, OptionsGlobal.Logger)
+			}()
+			validateErr := validate.Struct(optionsExport)
+			if nil != validateErr {
+				return validateErr
+			}
+			templatePath, buildErr := buildTemplate(optionsExport.BuildID,
+				optionsExport.DockerFile,
+				optionsExport.OutputDir)
+			if buildErr != nil {
+				return buildErr
+			}
+			return Export(args[0],
+				serviceName,
+				templatePath,
+				optionsExport.S3Bucket,
+				optionsExport.OutputDir,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Export)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Graph
+	if nil == CommandLineOptions.Graph.RunE {
+		CommandLineOptions.Graph.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsGraph)
+			if nil != validateErr {
+				return validateErr
+			}
+			graphWriter := os.Stdout
+			if optionsGraph.OutputFile != "" {
+				fileWriter, fileWriterErr := os.Create(optionsGraph.OutputFile)
+				if fileWriterErr != nil {
+					return fileWriterErr
+				}
+				defer fileWriter.Close()
+				graphWriter = fileWriter
+			}
+			return Graph(serviceName,
+				lambdaAWSInfos,
+				api,
+				workflowHooks,
+				args[0],
+				graphWriter,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Graph)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Doctor
+	if nil == CommandLineOptions.Doctor.RunE {
+		CommandLineOptions.Doctor.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsDoctor)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Doctor(serviceName,
+				optionsDoctor.S3Bucket,
+				optionsDoctor.Offline,
+				useCGO,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Doctor)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Init
+	if nil == CommandLineOptions.Init.RunE {
+		CommandLineOptions.Init.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsInit)
+			if nil != validateErr {
+				return validateErr
+			}
+			return Init(args[0],
+				optionsInit.ServiceName,
+				optionsInit.ModulePath,
+				optionsInit.OutputDir,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Init)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Lint
+	if nil == CommandLineOptions.Lint.RunE {
+		CommandLineOptions.Lint.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsLint)
+			if nil != validateErr {
+				return validateErr
+			}
+			templatePath, buildErr := buildTemplate(optionsLint.BuildID,
+				optionsLint.DockerFile,
+				optionsLint.OutputDir)
+			if buildErr != nil {
+				return buildErr
+			}
+			reportWriter := os.Stdout
+			if optionsLint.ReportFile != "" {
+				fileWriter, fileWriterErr := os.Create(optionsLint.ReportFile)
+				if fileWriterErr != nil {
+					return fileWriterErr
+				}
+				defer fileWriter.Close()
+				reportWriter = fileWriter
+			}
+			return Lint(serviceName,
+				templatePath,
+				optionsLint.Format,
+				optionsLint.FailOn,
+				reportWriter,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Lint)
+
+	//////////////////////////////////////////////////////////////////////////////
+	// Cost
+	if nil == CommandLineOptions.Cost.RunE {
+		CommandLineOptions.Cost.RunE = func(cmd *cobra.Command, args []string) error {
+			validateErr := validate.Struct(optionsCost)
+			if nil != validateErr {
+				return validateErr
+			}
+			templatePath, buildErr := buildTemplate(optionsCost.BuildID,
+				optionsCost.DockerFile,
+				optionsCost.OutputDir)
+			if buildErr != nil {
+				return buildErr
+			}
+			return Cost(serviceName,
+				templatePath,
+				optionsCost.UsageFile,
+				optionsCost.Format,
+				os.Stdout,
+				OptionsGlobal.Logger)
+		}
+	}
+	CommandLineOptions.Root.AddCommand(CommandLineOptions.Cost)
+
 	// Run it!
 	executedCmd, executeErr := CommandLineOptions.Root.ExecuteC()
 	if executeErr != nil {
@@ -0,0 +1,430 @@
+package sparta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// StageConfigurationFiles are the configuration files, in priority order,
+// that are loaded from the working directory if the --config flag
+// isn't provided
+var StageConfigurationFiles = []string{"sparta.yaml", "sparta.yml", "sparta.toml"}
+
+// reStageConfigurationEnv matches ${VAR} and ${VAR:-default} references
+var reStageConfigurationEnv = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// reStageNameInvalid matches the characters that aren't valid in a
+// CloudFormation stack name
+var reStageNameInvalid = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// stageConfiguration is the configuration loaded for this invocation
+var stageConfiguration *StageConfiguration
+
+// StageStringMap is a map of string values that accepts any scalar
+// configuration value (eg, `Port: 8080`)
+type StageStringMap map[string]string
+
+// UnmarshalJSON stringifies the scalar values
+func (ssm *StageStringMap) UnmarshalJSON(data []byte) error {
+	var rawValues map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(&rawValues)
+	if decodeErr != nil {
+		return decodeErr
+	}
+	values := make(StageStringMap, len(rawValues))
+	for eachKey, eachValue := range rawValues {
+		switch typedValue := eachValue.(type) {
+		case map[string]interface{}, []interface{}:
+			return errors.Errorf("value for key %s must be a scalar", eachKey)
+		case nil:
+			values[eachKey] = ""
+		default:
+			values[eachKey] = fmt.Sprintf("%v", typedValue)
+		}
+	}
+	*ssm = values
+	return nil
+}
+
+// StageFunctionConfiguration are the per-stage overrides for a lambda
+// function's LambdaFunctionOptions
+type StageFunctionConfiguration struct {
+	MemorySize                   int64          `json:"memorySize,omitempty"`
+	Timeout                      int64          `json:"timeout,omitempty"`
+	ReservedConcurrentExecutions int64          `json:"reservedConcurrentExecutions,omitempty"`
+	Architecture                 string         `json:"architecture,omitempty"`
+	Environment                  StageStringMap `json:"environment,omitempty"`
+	Tags                         StageStringMap `json:"tags,omitempty"`
+}
+
+const (
+	// ProvisionFailurePolicyFailFast stops starting new target provisions
+	// after the first failure. Target provisions in progress complete.
+	ProvisionFailurePolicyFailFast = "failFast"
+	// ProvisionFailurePolicyContinue provisions every target regardless of
+	// failures
+	ProvisionFailurePolicyContinue = "continue"
+)
+
+// ProvisionTarget is a region and, optionally, an account to provision the
+// service to. The artifacts are uploaded to the target's S3Bucket, which
+// must be in the target region. If RoleArn is defined the target is
+// provisioned with the assumed role's credentials.
+type ProvisionTarget struct {
+	Name       string         `json:"name,omitempty"`
+	Region     string         `json:"region"`
+	S3Bucket   string         `json:"s3Bucket"`
+	RoleArn    string         `json:"roleArn,omitempty"`
+	ExternalID string         `json:"externalId,omitempty"`
+	Params     StageStringMap `json:"params,omitempty"`
+	Tags       StageStringMap `json:"tags,omitempty"`
+}
+
+// StageConfiguration is the resolved configuration for a stage. It's the
+// `default` section of the configuration file merged with the
+// `stages.<name>` section for the --stage value. Command line flags take
+// precedence over configuration values.
+type StageConfiguration struct {
+	// Stage is the name of the selected stage, if any
+	Stage string `json:"-"`
+	// StageDefined is true if the configuration file has a section for the
+	// stage. Ephemeral stages (eg, alice or pr-123) typically only use the
+	// default section.
+	StageDefined bool `json:"-"`
+	// Path is the configuration file, if any
+	Path string `json:"-"`
+	// Scoped opts in to stage scoped stack, API and artifact names (see
+	// StageScopedServiceName). Stages that aren't defined in the
+	// configuration file are only valid if the default section sets it.
+	Scoped bool `json:"scoped,omitempty"`
+	// Provision options
+	S3Bucket string         `json:"s3Bucket,omitempty"`
+	Params   StageStringMap `json:"params,omitempty"`
+	Tags     StageStringMap `json:"tags,omitempty"`
+	InPlace  *bool          `json:"inPlace,omitempty"`
+	// Targets are the regions and accounts to provision to. If empty, the
+	// service is provisioned to the default region and account.
+	Targets       []*ProvisionTarget `json:"targets,omitempty"`
+	FailurePolicy string             `json:"failurePolicy,omitempty"`
+	Concurrency   int                `json:"concurrency,omitempty"`
+	// Build options
+	OutputDir  string `json:"outputDir,omitempty"`
+	DockerFile string `json:"dockerFile,omitempty"`
+	// Global options
+	BuildTags    string `json:"buildTags,omitempty"`
+	LinkerFlags  string `json:"ldflags,omitempty"`
+	Runtime      string `json:"runtime,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	LogLevel     string `json:"level,omitempty"`
+	// Functions are the LambdaFunctionOptions overrides, keyed by the Go
+	// function name (eg, main.helloWorld)
+	Functions map[string]*StageFunctionConfiguration `json:"functions,omitempty"`
+	// Values are arbitrary values (alarm thresholds, feature flags, ...)
+	// for use by decorators and hooks
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// Value returns the value for the dot-separated key path in Values
+func (config *StageConfiguration) Value(keyPath string) (interface{}, bool) {
+	var value interface{} = config.Values
+	for _, eachKey := range strings.Split(keyPath, ".") {
+		table, tableOk := value.(map[string]interface{})
+		if !tableOk {
+			return nil, false
+		}
+		value, tableOk = table[eachKey]
+		if !tableOk {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// StringValue returns the string value for the key path or the
+// defaultValue if it's not defined
+func (config *StageConfiguration) StringValue(keyPath string, defaultValue string) string {
+	value, valueExists := config.Value(keyPath)
+	if !valueExists || value == nil {
+		return defaultValue
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Float64Value returns the numeric value for the key path or the
+// defaultValue if it's not defined or isn't a number
+func (config *StageConfiguration) Float64Value(keyPath string, defaultValue float64) float64 {
+	value, valueExists := config.Value(keyPath)
+	if !valueExists {
+		return defaultValue
+	}
+	floatValue, floatValueOk := value.(float64)
+	if !floatValueOk {
+		return defaultValue
+	}
+	return floatValue
+}
+
+// Ephemeral returns true if the stage is a stage scoped copy of the service
+// that isn't defined in the configuration file (eg, alice or pr-123).
+// Deleting an ephemeral stage also deletes its artifacts and log groups.
+func (config *StageConfiguration) Ephemeral() bool {
+	return config.Stage != "" && config.Scoped && !config.StageDefined
+}
+
+// CurrentStageConfiguration returns the stage configuration for this
+// invocation. It's available to decorators and workflow hooks at build
+// time. The returned value is empty if there is no configuration file.
+func CurrentStageConfiguration() *StageConfiguration {
+	if stageConfiguration == nil {
+		return &StageConfiguration{}
+	}
+	return stageConfiguration
+}
+
+// StageScopedServiceName returns the service name for the given stage. The
+// stage scoped name is used as the CloudFormation stack name, the lambda
+// function name prefix and the S3 artifact key prefix s.t. each stage
+// (eg, prod, alice or pr-123) is an isolated copy of the service.
+func StageScopedServiceName(serviceName string, stage string) string {
+	stageName := strings.Trim(reStageNameInvalid.ReplaceAllString(stage, "-"), "-")
+	if stageName == "" {
+		return serviceName
+	}
+	return fmt.Sprintf("%s-%s", serviceName, stageName)
+}
+
+// stageConfigurationPath returns the user supplied configuration path or
+// the first of the StageConfigurationFiles in the working directory
+func stageConfigurationPath(userPath string) string {
+	if userPath != "" {
+		return userPath
+	}
+	for _, eachFile := range StageConfigurationFiles {
+		_, statErr := os.Stat(eachFile)
+		if statErr == nil {
+			return eachFile
+		}
+	}
+	return ""
+}
+
+// mergeStageConfigurationValues returns the base map with the override
+// values merged in. Maps are merged and all other values replaced.
+func mergeStageConfigurationValues(base map[string]interface{},
+	override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for eachKey, eachValue := range base {
+		merged[eachKey] = eachValue
+	}
+	for eachKey, eachValue := range override {
+		baseMap, baseMapOk := merged[eachKey].(map[string]interface{})
+		overrideMap, overrideMapOk := eachValue.(map[string]interface{})
+		if baseMapOk && overrideMapOk {
+			merged[eachKey] = mergeStageConfigurationValues(baseMap, overrideMap)
+		} else {
+			merged[eachKey] = eachValue
+		}
+	}
+	return merged
+}
+
+// expandStageConfigurationEnv replaces ${VAR} and ${VAR:-default}
+// references in string values with the environment variable value
+func expandStageConfigurationEnv(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case string:
+		var expandErr error
+		expanded := reStageConfigurationEnv.ReplaceAllStringFunc(typedValue, func(match string) string {
+			submatches := reStageConfigurationEnv.FindStringSubmatch(match)
+			envValue, envValueExists := os.LookupEnv(submatches[1])
+			if envValueExists && envValue != "" {
+				return envValue
+			}
+			if submatches[2] != "" {
+				return submatches[3]
+			}
+			if !envValueExists && expandErr == nil {
+				expandErr = errors.Errorf("environment variable %s is not defined", submatches[1])
+			}
+			return envValue
+		})
+		return expanded, expandErr
+	case map[string]interface{}:
+		expandedMap := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			expandedValue, expandedValueErr := expandStageConfigurationEnv(eachValue)
+			if expandedValueErr != nil {
+				return nil, expandedValueErr
+			}
+			expandedMap[eachKey] = expandedValue
+		}
+		return expandedMap, nil
+	case []interface{}:
+		expandedSlice := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			expandedValue, expandedValueErr := expandStageConfigurationEnv(eachValue)
+			if expandedValueErr != nil {
+				return nil, expandedValueErr
+			}
+			expandedSlice[eachIndex] = expandedValue
+		}
+		return expandedSlice, nil
+	}
+	return value, nil
+}
+
+// normalizeTOMLValue returns the decoded TOML value with arrays of tables
+// converted to []interface{} values, as they're decoded from YAML
+func normalizeTOMLValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		normalizedMap := make(map[string]interface{}, len(typedValue))
+		for eachKey, eachValue := range typedValue {
+			normalizedMap[eachKey] = normalizeTOMLValue(eachValue)
+		}
+		return normalizedMap
+	case []map[string]interface{}:
+		normalizedSlice := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			normalizedSlice[eachIndex] = normalizeTOMLValue(eachValue)
+		}
+		return normalizedSlice
+	case []interface{}:
+		normalizedSlice := make([]interface{}, len(typedValue))
+		for eachIndex, eachValue := range typedValue {
+			normalizedSlice[eachIndex] = normalizeTOMLValue(eachValue)
+		}
+		return normalizedSlice
+	}
+	return value
+}
+
+// ParseStageConfiguration parses the YAML or TOML (if the path has a .toml
+// extension) configuration and returns the configuration for the given
+// stage. An empty stage returns the default section. A stage that isn't
+// defined in the stages section is an error unless the default section
+// opts in to stage scoped names, in which case the default section is
+// returned.
+func ParseStageConfiguration(path string, data []byte, stage string) (*StageConfiguration, error) {
+	var rawConfig map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		_, tomlErr := toml.Decode(string(data), &rawConfig)
+		if tomlErr != nil {
+			return nil, errors.Wrapf(tomlErr, "Failed to parse configuration: %s", path)
+		}
+		// Arrays of tables are decoded as []map[string]interface{}
+		normalized, _ := normalizeTOMLValue(rawConfig).(map[string]interface{})
+		rawConfig = normalized
+	} else {
+		yamlErr := yaml.Unmarshal(data, &rawConfig)
+		if yamlErr != nil {
+			return nil, errors.Wrapf(yamlErr, "Failed to parse configuration: %s", path)
+		}
+	}
+	sectionMap := func(value interface{}, name string) (map[string]interface{}, error) {
+		if value == nil {
+			return map[string]interface{}{}, nil
+		}
+		section, sectionOk := value.(map[string]interface{})
+		if !sectionOk {
+			return nil, errors.Errorf("Configuration section %s in %s must be a map", name, path)
+		}
+		return section, nil
+	}
+	var defaultSection map[string]interface{}
+	var stagesSection map[string]interface{}
+	for eachKey, eachValue := range rawConfig {
+		var sectionErr error
+		switch eachKey {
+		case "default":
+			defaultSection, sectionErr = sectionMap(eachValue, eachKey)
+		case "stages":
+			stagesSection, sectionErr = sectionMap(eachValue, eachKey)
+		default:
+			sectionErr = errors.Errorf("Unsupported configuration section %s in %s. Valid sections: default, stages",
+				eachKey,
+				path)
+		}
+		if sectionErr != nil {
+			return nil, sectionErr
+		}
+	}
+	resolved := mergeStageConfigurationValues(defaultSection, nil)
+	stageDefined := false
+	if stage != "" {
+		stageValue, stageExists := stagesSection[stage]
+		if stageExists {
+			stageSection, stageSectionErr := sectionMap(stageValue, "stages."+stage)
+			if stageSectionErr != nil {
+				return nil, stageSectionErr
+			}
+			resolved = mergeStageConfigurationValues(resolved, stageSection)
+		}
+		stageDefined = stageExists
+	}
+	// Only the selected stage is expanded s.t. other stages can reference
+	// variables that aren't defined in this environment
+	expanded, expandedErr := expandStageConfigurationEnv(resolved)
+	if expandedErr != nil {
+		return nil, errors.Wrapf(expandedErr, "Failed to expand configuration: %s", path)
+	}
+	jsonBytes, jsonBytesErr := json.Marshal(expanded)
+	if jsonBytesErr != nil {
+		return nil, errors.Wrapf(jsonBytesErr, "Failed to marshal configuration: %s", path)
+	}
+	config := &StageConfiguration{
+		Stage:        stage,
+		StageDefined: stageDefined,
+		Path:         path,
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	decodeErr := decoder.Decode(config)
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "Invalid configuration: %s", path)
+	}
+	if stage != "" && !stageDefined && !config.Scoped {
+		stageNames := make([]string, 0, len(stagesSection))
+		for eachStage := range stagesSection {
+			stageNames = append(stageNames, eachStage)
+		}
+		sort.Strings(stageNames)
+		return nil, errors.Errorf("Stage %s is not defined in %s. Defined stages: [%s]. Set `scoped: true` in the default section to allow ephemeral stages",
+			stage,
+			path,
+			strings.Join(stageNames, ", "))
+	}
+	return config, nil
+}
+
+// LoadStageConfiguration loads the configuration file for the given stage.
+// If path is empty the first of the StageConfigurationFiles in the working
+// directory is used. If there is no configuration file an empty
+// configuration is returned.
+func LoadStageConfiguration(path string, stage string) (*StageConfiguration, error) {
+	configPath := stageConfigurationPath(path)
+	if configPath == "" {
+		return &StageConfiguration{
+			Stage: stage,
+		}, nil
+	}
+	/* #nosec */
+	data, dataErr := ioutil.ReadFile(configPath)
+	if dataErr != nil {
+		return nil, errors.Wrapf(dataErr, "Failed to read configuration: %s", configPath)
+	}
+	return ParseStageConfiguration(configPath, data, stage)
+}
@@ -0,0 +1,186 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+// stageSliceValue is the subset of the pflag.SliceValue interface used
+// to merge the param and tag flags
+type stageSliceValue interface {
+	Append(string) error
+	GetSlice() []string
+}
+
+// stageAPIStageName returns the API Gateway stage name for the stage,
+// which may only include alphanumeric and underscore characters
+func stageAPIStageName(stage string) string {
+	return strings.Trim(sanitizedName(stage), "_")
+}
+
+// applyAPIStage scopes the API Gateway name to the stage s.t. each
+// stage's API can be found by name, and sets the API Gateway stage name
+// to the stage name s.t. each stage's endpoint includes it
+func applyAPIStage(api APIGateway, stage string) {
+	apiStageName := stageAPIStageName(stage)
+	if apiStageName == "" {
+		return
+	}
+	switch typedAPI := api.(type) {
+	case *API:
+		if typedAPI == nil {
+			return
+		}
+		typedAPI.name = StageScopedServiceName(typedAPI.name, stage)
+		if typedAPI.stage != nil {
+			typedAPI.stage.name = apiStageName
+		}
+	case *APIV2:
+		if typedAPI == nil {
+			return
+		}
+		typedAPI.name = StageScopedServiceName(typedAPI.name, stage)
+		if typedAPI.stage != nil {
+			typedAPI.stage.name = apiStageName
+		}
+	}
+}
+
+// stageFlagPairs returns the sorted KEY=VALUE pairs for the map
+func stageFlagPairs(values StageStringMap) []string {
+	pairs := make([]string, 0, len(values))
+	for eachKey, eachValue := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", eachKey, eachValue))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// applyFlags sets the command's flags that weren't provided on the command
+// line to the configuration values. The param and tag flags are merged by
+// key s.t. command line pairs take precedence.
+func (config *StageConfiguration) applyFlags(cmd *cobra.Command) error {
+	scalarFlags := map[string]string{
+		"s3Bucket":      config.S3Bucket,
+		"outputDir":     config.OutputDir,
+		"dockerFile":    config.DockerFile,
+		"tags":          config.BuildTags,
+		"ldflags":       config.LinkerFlags,
+		"runtime":       config.Runtime,
+		"architecture":  config.Architecture,
+		"level":         config.LogLevel,
+		"failurePolicy": config.FailurePolicy,
+	}
+	if config.InPlace != nil {
+		scalarFlags["inplace"] = strconv.FormatBool(*config.InPlace)
+	}
+	if config.Concurrency != 0 {
+		scalarFlags["concurrency"] = strconv.Itoa(config.Concurrency)
+	}
+	flags := cmd.Flags()
+	for eachName, eachValue := range scalarFlags {
+		flag := flags.Lookup(eachName)
+		if eachValue == "" || flag == nil || flag.Changed {
+			continue
+		}
+		setErr := flags.Set(eachName, eachValue)
+		if setErr != nil {
+			return errors.Wrapf(setErr, "Invalid %s value in configuration: %s", eachName, config.Path)
+		}
+	}
+	pairFlags := map[string]StageStringMap{
+		"param": config.Params,
+		"tag":   config.Tags,
+	}
+	for eachName, eachValues := range pairFlags {
+		flag := flags.Lookup(eachName)
+		if len(eachValues) == 0 || flag == nil {
+			continue
+		}
+		sliceValue, sliceValueOk := flag.Value.(stageSliceValue)
+		if !sliceValueOk {
+			continue
+		}
+		existingKeys := make(map[string]bool)
+		for _, eachPair := range sliceValue.GetSlice() {
+			existingKeys[strings.SplitN(eachPair, "=", 2)[0]] = true
+		}
+		for _, eachPair := range stageFlagPairs(eachValues) {
+			if existingKeys[strings.SplitN(eachPair, "=", 2)[0]] {
+				continue
+			}
+			appendErr := sliceValue.Append(eachPair)
+			if appendErr != nil {
+				return errors.Wrapf(appendErr, "Invalid %s value in configuration: %s", eachName, config.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// applyFunctions applies the function overrides to the matching
+// lambda functions' options
+func (config *StageConfiguration) applyFunctions(lambdaAWSInfos []*LambdaAWSInfo,
+	logger *zerolog.Logger) {
+	if len(config.Functions) == 0 {
+		return
+	}
+	matched := make(map[string]bool)
+	for _, eachLambda := range lambdaAWSInfos {
+		functionName := eachLambda.lambdaFunctionName()
+		functionConfig, functionConfigExists := config.Functions[functionName]
+		if !functionConfigExists {
+			continue
+		}
+		matched[functionName] = true
+		if eachLambda.Options == nil {
+			eachLambda.Options = defaultLambdaFunctionOptions()
+		}
+		options := eachLambda.Options
+		if functionConfig.MemorySize != 0 {
+			options.MemorySize = functionConfig.MemorySize
+		}
+		if functionConfig.Timeout != 0 {
+			options.Timeout = functionConfig.Timeout
+		}
+		if functionConfig.ReservedConcurrentExecutions != 0 {
+			options.ReservedConcurrentExecutions = functionConfig.ReservedConcurrentExecutions
+		}
+		if functionConfig.Architecture != "" {
+			options.Architecture = AWSLambdaArchitecture(functionConfig.Architecture)
+		}
+		if len(functionConfig.Environment) != 0 && options.Environment == nil {
+			options.Environment = make(map[string]*gocf.StringExpr)
+		}
+		for eachKey, eachValue := range functionConfig.Environment {
+			options.Environment[eachKey] = gocf.String(eachValue)
+		}
+		if len(functionConfig.Tags) != 0 && options.Tags == nil {
+			options.Tags = make(map[string]string)
+		}
+		for eachKey, eachValue := range functionConfig.Tags {
+			options.Tags[eachKey] = eachValue
+		}
+		logger.Debug().
+			Str("Function", functionName).
+			Interface("Overrides", functionConfig).
+			Msg("Applied stage configuration")
+	}
+	for eachName := range config.Functions {
+		if !matched[eachName] {
+			logger.Warn().
+				Str("Function", eachName).
+				Str("Path", config.Path).
+				Msg("Stage configuration function doesn't match a lambda function")
+		}
+	}
+}
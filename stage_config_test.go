@@ -0,0 +1,295 @@
+// +build !lambdabinary
+
+package sparta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+const stageConfigTestYAML = `
+default:
+  s3Bucket: ${SPARTA_STAGE_TEST_BUCKET:-default-bucket}
+  params:
+    LogLevel: info
+    Port: 8080
+  tags:
+    team: platform
+  functions:
+    main.helloWorld:
+      memorySize: 256
+      environment:
+        MODE: default
+  values:
+    alarms:
+      errorThreshold: 5
+stages:
+  prod:
+    s3Bucket: prod-${SPARTA_STAGE_TEST_SUFFIX}
+    inPlace: true
+    params:
+      LogLevel: warn
+    functions:
+      main.helloWorld:
+        timeout: 30
+        environment:
+          MODE: prod
+    values:
+      alarms:
+        errorThreshold: 1
+  dev:
+    s3Bucket: ${SPARTA_STAGE_TEST_UNDEFINED}
+`
+
+const stageConfigTestTOML = `
+# Shared values
+[default]
+s3Bucket = "${SPARTA_STAGE_TEST_BUCKET:-default-bucket}"
+params = { LogLevel = "info", Port = 8080 }
+tags.team = "platform"
+
+[default.functions."main.helloWorld"]
+memorySize = 256
+environment = { MODE = "default" }
+
+[default.values.alarms]
+errorThreshold = 5
+
+[stages.prod]
+s3Bucket = "prod-${SPARTA_STAGE_TEST_SUFFIX}"
+inPlace = true # Update in place
+params.LogLevel = "warn"
+values.alarms.errorThreshold = 1
+
+[stages.prod.functions."main.helloWorld"]
+timeout = 30
+environment = { MODE = "prod" }
+
+[stages.dev]
+s3Bucket = '${SPARTA_STAGE_TEST_UNDEFINED}'
+`
+
+const stageConfigTestTargetsTOML = `
+[default.values]
+banner = """
+Hello
+World
+"""
+
+[[stages.prod.targets]]
+region = "us-east-1"
+s3Bucket = "us-artifacts"
+
+[[stages.prod.targets]]
+region = "eu-west-1"
+s3Bucket = "eu-artifacts"
+params = { Port = 8080 }
+`
+
+func TestStageConfiguration(t *testing.T) {
+	os.Setenv("SPARTA_STAGE_TEST_SUFFIX", "artifacts")
+	defer os.Unsetenv("SPARTA_STAGE_TEST_SUFFIX")
+
+	inPlace := true
+	expectedProd := &StageConfiguration{
+		Stage:        "prod",
+		StageDefined: true,
+		S3Bucket:     "prod-artifacts",
+		Params:       StageStringMap{"LogLevel": "warn", "Port": "8080"},
+		Tags:         StageStringMap{"team": "platform"},
+		InPlace:      &inPlace,
+		Functions: map[string]*StageFunctionConfiguration{
+			"main.helloWorld": {
+				MemorySize:  256,
+				Timeout:     30,
+				Environment: StageStringMap{"MODE": "prod"},
+			},
+		},
+		Values: map[string]interface{}{
+			"alarms": map[string]interface{}{"errorThreshold": float64(1)},
+		},
+	}
+	for _, eachPath := range []string{"sparta.yaml", "sparta.toml"} {
+		data := stageConfigTestYAML
+		if strings.HasSuffix(eachPath, ".toml") {
+			data = stageConfigTestTOML
+		}
+		defaultConfig, defaultConfigErr := ParseStageConfiguration(eachPath, []byte(data), "")
+		if defaultConfigErr != nil {
+			t.Fatal(defaultConfigErr)
+		}
+		if defaultConfig.S3Bucket != "default-bucket" ||
+			defaultConfig.InPlace != nil ||
+			defaultConfig.Float64Value("alarms.errorThreshold", 0) != 5 {
+			t.Fatalf("Unexpected %s default configuration: %#v", eachPath, defaultConfig)
+		}
+
+		prodConfig, prodConfigErr := ParseStageConfiguration(eachPath, []byte(data), "prod")
+		if prodConfigErr != nil {
+			t.Fatal(prodConfigErr)
+		}
+		expectedProd.Path = eachPath
+		if !reflect.DeepEqual(expectedProd, prodConfig) {
+			t.Fatalf("Unexpected %s prod configuration: %#v", eachPath, prodConfig)
+		}
+		if prodConfig.StringValue("alarms.missing", "none") != "none" {
+			t.Fatalf("Expected default value for missing key")
+		}
+
+		_, devConfigErr := ParseStageConfiguration(eachPath, []byte(data), "dev")
+		if devConfigErr == nil || !strings.Contains(devConfigErr.Error(), "SPARTA_STAGE_TEST_UNDEFINED") {
+			t.Fatalf("Expected undefined environment variable error. Found: %v", devConfigErr)
+		}
+		_, undefinedConfigErr := ParseStageConfiguration(eachPath, []byte(data), "pr-123")
+		if undefinedConfigErr == nil || !strings.Contains(undefinedConfigErr.Error(), "not defined") {
+			t.Fatalf("Expected %s undefined stage error. Found: %v", eachPath, undefinedConfigErr)
+		}
+	}
+	// Stage scoped services allow ephemeral stages
+	ephemeralConfig, ephemeralConfigErr := ParseStageConfiguration("sparta.yaml",
+		[]byte("default:\n  scoped: true\n  s3Bucket: default-bucket\nstages:\n  prod:\n    s3Bucket: prod-bucket\n"),
+		"pr-123")
+	if ephemeralConfigErr != nil {
+		t.Fatal(ephemeralConfigErr)
+	}
+	if !ephemeralConfig.Ephemeral() || ephemeralConfig.S3Bucket != "default-bucket" {
+		t.Fatalf("Expected default section for ephemeral stage: %#v", ephemeralConfig)
+	}
+	if expectedProd.Ephemeral() {
+		t.Fatalf("Expected defined stage to not be ephemeral")
+	}
+	_, unknownKeyErr := ParseStageConfiguration("sparta.yaml", []byte("default:\n  bucket: typo\n"), "")
+	if unknownKeyErr == nil {
+		t.Fatalf("Expected error for unknown configuration key")
+	}
+	_, tomlErr := ParseStageConfiguration("sparta.toml", []byte("[default]\ns3Bucket = unquoted\n"), "")
+	if tomlErr == nil {
+		t.Fatalf("Expected error for invalid TOML value")
+	}
+	targetsConfig, targetsConfigErr := ParseStageConfiguration("sparta.toml",
+		[]byte(stageConfigTestTargetsTOML),
+		"prod")
+	if targetsConfigErr != nil {
+		t.Fatal(targetsConfigErr)
+	}
+	if len(targetsConfig.Targets) != 2 ||
+		targetsConfig.Targets[0].S3Bucket != "us-artifacts" ||
+		targetsConfig.Targets[1].Params["Port"] != "8080" ||
+		targetsConfig.Values["banner"] != "Hello\nWorld\n" {
+		t.Fatalf("Unexpected TOML targets configuration: %#v", targetsConfig)
+	}
+}
+
+func TestLoadStageConfiguration(t *testing.T) {
+	configDir, configDirErr := ioutil.TempDir("", "sparta-stage")
+	if configDirErr != nil {
+		t.Fatal(configDirErr)
+	}
+	defer os.RemoveAll(configDir)
+
+	_, missingErr := LoadStageConfiguration(filepath.Join(configDir, "sparta.yaml"), "")
+	if missingErr == nil {
+		t.Fatalf("Expected error for missing configuration file")
+	}
+	configPath := filepath.Join(configDir, "sparta.yaml")
+	writeErr := ioutil.WriteFile(configPath, []byte(stageConfigTestYAML), 0644)
+	if writeErr != nil {
+		t.Fatal(writeErr)
+	}
+	config, configErr := LoadStageConfiguration(configPath, "")
+	if configErr != nil {
+		t.Fatal(configErr)
+	}
+	if config.Path != configPath || config.S3Bucket != "default-bucket" {
+		t.Fatalf("Unexpected configuration: %#v", config)
+	}
+}
+
+func TestStageConfigurationApply(t *testing.T) {
+	var options optionsProvisionStruct
+	cmd := &cobra.Command{Use: "provision"}
+	cmd.Flags().StringArrayVarP(&options.StackParams, "param", "m", []string{}, "")
+	cmd.Flags().StringArrayVarP(&options.StackTags, "tag", "g", []string{}, "")
+	cmd.Flags().StringVarP(&options.S3Bucket, "s3Bucket", "s", "", "")
+	cmd.Flags().StringVarP(&options.OutputDir, "outputDir", "o", ScratchDirectory, "")
+	cmd.Flags().BoolVarP(&options.InPlace, "inplace", "c", false, "")
+	parseErr := cmd.Flags().Parse([]string{"--s3Bucket", "cli-bucket", "--param", "LogLevel=debug"})
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	inPlace := true
+	config := &StageConfiguration{
+		S3Bucket:  "config-bucket",
+		OutputDir: "stage-output",
+		InPlace:   &inPlace,
+		Params:    StageStringMap{"LogLevel": "warn", "Port": "8080"},
+		Tags:      StageStringMap{"team": "platform"},
+		Functions: map[string]*StageFunctionConfiguration{
+			"stageLambda": {
+				MemorySize:  512,
+				Environment: StageStringMap{"MODE": "prod"},
+			},
+		},
+	}
+	applyErr := config.applyFlags(cmd)
+	if applyErr != nil {
+		t.Fatal(applyErr)
+	}
+	if options.S3Bucket != "cli-bucket" ||
+		options.OutputDir != "stage-output" ||
+		!options.InPlace ||
+		!reflect.DeepEqual(options.StackParams, []string{"LogLevel=debug", "Port=8080"}) ||
+		!reflect.DeepEqual(options.StackTags, []string{"team=platform"}) {
+		t.Fatalf("Unexpected options: %#v", options)
+	}
+
+	lambdaFn, _ := NewAWSLambda("stageLambda", userDefinedCustomResource1, IAMRoleDefinition{})
+	logger := zerolog.New(ioutil.Discard)
+	config.applyFunctions([]*LambdaAWSInfo{lambdaFn}, &logger)
+	if lambdaFn.Options.MemorySize != 512 ||
+		lambdaFn.Options.Timeout != 3 ||
+		!reflect.DeepEqual(lambdaFn.Options.Environment["MODE"], gocf.String("prod")) {
+		t.Fatalf("Unexpected lambda options: %#v", lambdaFn.Options)
+	}
+}
+
+func TestStageScopedServiceName(t *testing.T) {
+	expected := map[string]string{
+		"":          "MyService",
+		"prod":      "MyService-prod",
+		"pr-123":    "MyService-pr-123",
+		"alice.doe": "MyService-alice-doe",
+		"--":        "MyService",
+	}
+	for eachStage, eachName := range expected {
+		if StageScopedServiceName("MyService", eachStage) != eachName {
+			t.Fatalf("Expected stage %s name %s. Found: %s",
+				eachStage,
+				eachName,
+				StageScopedServiceName("MyService", eachStage))
+		}
+	}
+	if stageArtifactsPrefix("MyService-pr-1") != "MyService-pr-1/" ||
+		stageLogGroupPrefix("MyService-pr-1") != "/aws/lambda/MyService-pr-1_" {
+		t.Fatalf("Unexpected stage cleanup prefixes")
+	}
+
+	api := NewAPIGateway("StageAPI", NewStage("v1"))
+	applyAPIStage(api, "pr-123")
+	stageV2, _ := NewAPIV2Stage("v1")
+	apiV2, _ := NewAPIV2(Websocket, "StageAPIV2", "$request.body.message", stageV2)
+	applyAPIStage(apiV2, "pr-123")
+	if api.name != "StageAPI-pr-123" || api.stage.name != "pr_123" ||
+		apiV2.name != "StageAPIV2-pr-123" || apiV2.stage.name != "pr_123" {
+		t.Fatalf("Unexpected stage APIs: %#v, %#v", api, apiV2)
+	}
+	applyAPIStage(nil, "pr-123")
+}
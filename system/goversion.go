@@ -74,7 +74,9 @@ func GoPath() string {
 	return gopath
 }
 
-// BuildGoBinary is a helper to build a go binary with the given options
+// BuildGoBinary is a helper to build a linux go binary with the given options.
+// The binary targets the SPARTA_GOARCH environment variable architecture, if
+// defined, and amd64 otherwise.
 func BuildGoBinary(serviceName string,
 	executableOutput string,
 	useCGO bool,
@@ -83,6 +85,37 @@ func BuildGoBinary(serviceName string,
 	linkFlags string,
 	noop bool,
 	logger *zerolog.Logger) error {
+	return BuildGoBinaryForArchitecture(serviceName,
+		executableOutput,
+		"",
+		useCGO,
+		buildID,
+		userSuppliedBuildTags,
+		linkFlags,
+		noop,
+		logger)
+}
+
+// BuildGoBinaryForArchitecture is an extended version of BuildGoBinary that
+// cross compiles the linux binary for the goArch value (eg: amd64, arm64).
+// If goArch is empty, the SPARTA_GOARCH environment variable is used, and
+// then amd64.
+func BuildGoBinaryForArchitecture(serviceName string,
+	executableOutput string,
+	goArch string,
+	useCGO bool,
+	buildID string,
+	userSuppliedBuildTags string,
+	linkFlags string,
+	noop bool,
+	logger *zerolog.Logger) error {
+
+	if goArch == "" {
+		goArch = os.Getenv("SPARTA_GOARCH")
+	}
+	if goArch == "" {
+		goArch = "amd64"
+	}
 
 	// Before we do anything, let's make sure there's a `main` package in this directory.
 	ensureMainPackageErr := ensureMainEntrypoint(logger)
@@ -181,10 +214,6 @@ func BuildGoBinary(serviceName string,
 		if goosTarget == "" {
 			goosTarget = "linux"
 		}
-		goArch := os.Getenv("SPARTA_GOARCH")
-		if goArch == "" {
-			goArch = "amd64"
-		}
 		spartaEnvVars := []string{
 			// "-e",
 			// fmt.Sprintf("GOPATH=%s", containerGoPath),
@@ -263,9 +292,10 @@ func BuildGoBinary(serviceName string,
 		buildArgs = append(buildArgs, ".")
 		cmd = exec.Command("go", buildArgs...)
 		cmd.Env = os.Environ()
-		cmd.Env = append(cmd.Env, "GOOS=linux", "GOARCH=amd64")
+		cmd.Env = append(cmd.Env, "GOOS=linux", fmt.Sprintf("GOARCH=%s", goArch))
 		logger.Info().
 			Str("Path", executableOutput).
+			Str("GOARCH", goArch).
 			Msg("Building `go` binary ")
 		cmdError = RunOSCommand(cmd, logger)
 	}
@@ -158,6 +158,8 @@ func testProvisionEx(t *testing.T,
 		false,
 		"testBuildID",
 		"",
+		"",
+		"",
 		fullPath,
 		"",
 		"",
@@ -72,6 +72,8 @@ func ProvisionEx(t *testing.T,
 		"",
 		"",
 		"",
+		"",
+		"",
 		&templateWriter,
 		workflowHooks,
 		logger)
@@ -0,0 +1,329 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Severity is the severity of a rule. The values are the SARIF result
+// levels.
+type Severity string
+
+const (
+	// SeverityError findings should prevent the service from being
+	// provisioned
+	SeverityError Severity = "error"
+	// SeverityWarning findings should be reviewed
+	SeverityWarning Severity = "warning"
+	// SeverityNote findings are informational
+	SeverityNote Severity = "note"
+	// SeverityNone is the threshold that never fails
+	SeverityNone Severity = "none"
+)
+
+// severityRank orders the severities from least to most severe
+var severityRank = map[Severity]int{
+	SeverityNote:    1,
+	SeverityWarning: 2,
+	SeverityError:   3,
+}
+
+const (
+	// FormatText is a human readable table
+	FormatText = "text"
+	// FormatJSON is a JSON document
+	FormatJSON = "json"
+	// FormatSARIF is a SARIF 2.1.0 log
+	FormatSARIF = "sarif"
+)
+
+// SuppressionMetadataKey is the resource Metadata key whose value is the
+// list of rule IDs that should not be reported for the resource
+const SuppressionMetadataKey = "SpartaLintSuppressions"
+
+// Resource is a template resource in its JSON representation
+type Resource struct {
+	LogicalID  string
+	Type       string
+	Properties map[string]interface{}
+	Metadata   map[string]interface{}
+}
+
+// Suppressed returns true if the resource Metadata suppresses the rule
+func (resource *Resource) Suppressed(ruleID string) bool {
+	switch typedValue := resource.Metadata[SuppressionMetadataKey].(type) {
+	case string:
+		return typedValue == ruleID
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			if eachValue == ruleID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Template is the JSON representation of a CloudFormation template that's
+// evaluated by the rules
+type Template struct {
+	Resources map[string]*Resource
+}
+
+// ResourcesOfType returns the template resources of the given type, sorted
+// by logical ID
+func (template *Template) ResourcesOfType(resourceType string) []*Resource {
+	resources := make([]*Resource, 0)
+	for _, eachResource := range template.Resources {
+		if eachResource.Type == resourceType {
+			resources = append(resources, eachResource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].LogicalID < resources[j].LogicalID
+	})
+	return resources
+}
+
+// ParseTemplate returns the Template for the JSON CloudFormation template
+func ParseTemplate(templateBytes []byte) (*Template, error) {
+	var rawTemplate struct {
+		Resources map[string]struct {
+			Type       string                 `json:"Type"`
+			Properties map[string]interface{} `json:"Properties"`
+			Metadata   map[string]interface{} `json:"Metadata"`
+		} `json:"Resources"`
+	}
+	unmarshalErr := json.Unmarshal(templateBytes, &rawTemplate)
+	if unmarshalErr != nil {
+		return nil, errors.Wrapf(unmarshalErr, "Failed to parse template")
+	}
+	template := &Template{
+		Resources: make(map[string]*Resource, len(rawTemplate.Resources)),
+	}
+	for eachName, eachResource := range rawTemplate.Resources {
+		resource := &Resource{
+			LogicalID:  eachName,
+			Type:       eachResource.Type,
+			Properties: eachResource.Properties,
+			Metadata:   eachResource.Metadata,
+		}
+		if resource.Properties == nil {
+			resource.Properties = make(map[string]interface{})
+		}
+		if resource.Metadata == nil {
+			resource.Metadata = make(map[string]interface{})
+		}
+		template.Resources[eachName] = resource
+	}
+	return template, nil
+}
+
+// NewTemplate returns the Template for the materialized gocf.Template
+func NewTemplate(cfTemplate *gocf.Template) (*Template, error) {
+	templateBytes, templateBytesErr := json.Marshal(cfTemplate)
+	if templateBytesErr != nil {
+		return nil, errors.Wrapf(templateBytesErr, "Failed to marshal template")
+	}
+	return ParseTemplate(templateBytes)
+}
+
+// Suppress adds the rule IDs to the resource's suppression Metadata so that
+// they aren't reported for the resource
+func Suppress(resource *gocf.Resource, ruleIDs ...string) {
+	if resource.Metadata == nil {
+		resource.Metadata = make(map[string]interface{})
+	}
+	suppressions := make([]interface{}, 0)
+	switch typedValue := resource.Metadata[SuppressionMetadataKey].(type) {
+	case string:
+		suppressions = append(suppressions, typedValue)
+	case []interface{}:
+		suppressions = append(suppressions, typedValue...)
+	case []string:
+		for _, eachValue := range typedValue {
+			suppressions = append(suppressions, eachValue)
+		}
+	}
+	for _, eachRuleID := range ruleIDs {
+		suppressions = append(suppressions, eachRuleID)
+	}
+	resource.Metadata[SuppressionMetadataKey] = suppressions
+}
+
+// RuleFunc returns the messages for each problem with the resource. The
+// template is provided for rules that depend on other resources.
+type RuleFunc func(resource *Resource, template *Template) []string
+
+// Rule is a check that's applied to every template resource of the
+// ResourceTypes
+type Rule struct {
+	// ID is the stable rule identifier used for suppressions
+	ID string
+	// Description of what the rule checks
+	Description string
+	// Severity of the rule's findings
+	Severity Severity
+	// ResourceTypes are the CloudFormation resource types the rule
+	// applies to
+	ResourceTypes []string
+	// Check is the rule implementation
+	Check RuleFunc
+}
+
+// Finding is a rule violation for a resource
+type Finding struct {
+	RuleID       string   `json:"ruleId"`
+	Severity     Severity `json:"severity"`
+	Resource     string   `json:"resource"`
+	ResourceType string   `json:"resourceType"`
+	Message      string   `json:"message"`
+}
+
+// Report is the result of linting a template
+type Report struct {
+	// Rules are the rules that were evaluated
+	Rules []*Rule `json:"-"`
+	// Findings are the unsuppressed rule violations, from most to least
+	// severe
+	Findings []*Finding `json:"findings"`
+	// Suppressed are the rule violations suppressed by resource Metadata
+	Suppressed []*Finding `json:"suppressed"`
+}
+
+// Count returns the number of findings with the given severity
+func (report *Report) Count(severity Severity) int {
+	count := 0
+	for _, eachFinding := range report.Findings {
+		if eachFinding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed returns true if there is a finding at least as severe as the
+// threshold. The SeverityNone threshold never fails.
+func (report *Report) Failed(threshold Severity) bool {
+	thresholdRank, thresholdRankExists := severityRank[threshold]
+	if !thresholdRankExists {
+		return false
+	}
+	for _, eachFinding := range report.Findings {
+		if severityRank[eachFinding.Severity] >= thresholdRank {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary returns the finding counts
+func (report *Report) Summary() string {
+	return fmt.Sprintf("%d error(s), %d warning(s), %d note(s), %d suppressed",
+		report.Count(SeverityError),
+		report.Count(SeverityWarning),
+		report.Count(SeverityNote),
+		len(report.Suppressed))
+}
+
+// Write writes the report to the writer in the text, json or sarif format
+func (report *Report) Write(format string, writer io.Writer) error {
+	switch format {
+	case FormatText:
+		return report.writeText(writer)
+	case FormatJSON:
+		return writeJSON(report, writer)
+	case FormatSARIF:
+		return writeJSON(newSARIFLog(report), writer)
+	default:
+		return errors.Errorf("Unsupported lint format: %s", format)
+	}
+}
+
+func (report *Report) writeText(writer io.Writer) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "SEVERITY\tRULE\tRESOURCE\tMESSAGE")
+	for _, eachFinding := range report.Findings {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n",
+			strings.ToUpper(string(eachFinding.Severity)),
+			eachFinding.RuleID,
+			eachFinding.Resource,
+			eachFinding.Message)
+	}
+	flushErr := tabWriter.Flush()
+	if flushErr != nil {
+		return flushErr
+	}
+	_, writeErr := fmt.Fprintln(writer, report.Summary())
+	return writeErr
+}
+
+func writeJSON(value interface{}, writer io.Writer) error {
+	jsonBytes, jsonBytesErr := json.MarshalIndent(value, "", "  ")
+	if jsonBytesErr != nil {
+		return errors.Wrapf(jsonBytesErr, "Failed to marshal lint report")
+	}
+	_, writeErr := fmt.Fprintf(writer, "%s\n", jsonBytes)
+	return writeErr
+}
+
+// sortFindings orders the findings from most to least severe, then by
+// resource and rule
+func sortFindings(findings []*Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		lhs, rhs := findings[i], findings[j]
+		if lhs.Severity != rhs.Severity {
+			return severityRank[lhs.Severity] > severityRank[rhs.Severity]
+		}
+		if lhs.Resource != rhs.Resource {
+			return lhs.Resource < rhs.Resource
+		}
+		if lhs.RuleID != rhs.RuleID {
+			return lhs.RuleID < rhs.RuleID
+		}
+		return lhs.Message < rhs.Message
+	})
+}
+
+// Lint evaluates the rules against every template resource. If no rules
+// are provided, the DefaultRules are used.
+func Lint(template *Template, rules ...*Rule) *Report {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	report := &Report{
+		Rules:      rules,
+		Findings:   make([]*Finding, 0),
+		Suppressed: make([]*Finding, 0),
+	}
+	for _, eachRule := range rules {
+		for _, eachResourceType := range eachRule.ResourceTypes {
+			for _, eachResource := range template.ResourcesOfType(eachResourceType) {
+				for _, eachMessage := range eachRule.Check(eachResource, template) {
+					finding := &Finding{
+						RuleID:       eachRule.ID,
+						Severity:     eachRule.Severity,
+						Resource:     eachResource.LogicalID,
+						ResourceType: eachResource.Type,
+						Message:      eachMessage,
+					}
+					if eachResource.Suppressed(eachRule.ID) {
+						report.Suppressed = append(report.Suppressed, finding)
+					} else {
+						report.Findings = append(report.Findings, finding)
+					}
+				}
+			}
+		}
+	}
+	sortFindings(report.Findings)
+	sortFindings(report.Suppressed)
+	return report
+}
@@ -0,0 +1,208 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	gocf "github.com/mweagle/go-cloudformation"
+)
+
+const lintTestTemplate = `{
+  "Resources": {
+    "HelloLambda": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {"FunctionName": "hello", "Handler": "Sparta.lambda.amd64"}
+    },
+    "RetainedLambda": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {
+        "Handler": "Sparta.lambda.amd64",
+        "DeadLetterConfig": {"TargetArn": {"Fn::GetAtt": ["Queue", "Arn"]}}
+      }
+    },
+    "RetainedLambdaLogGroup": {
+      "Type": "AWS::Logs::LogGroup",
+      "Properties": {
+        "LogGroupName": {"Fn::Join": ["", ["/aws/lambda/", {"Ref": "RetainedLambda"}]]},
+        "RetentionInDays": 14
+      }
+    },
+    "HelloLambdaRole": {
+      "Type": "AWS::IAM::Role",
+      "Properties": {
+        "Policies": [{
+          "PolicyName": "Hello",
+          "PolicyDocument": {
+            "Statement": [
+              {"Effect": "Allow", "Action": "s3:*", "Resource": {"Fn::GetAtt": ["Bucket", "Arn"]}},
+              {"Effect": "Allow", "Action": ["xray:PutTraceSegments", "cloudwatch:PutMetricData"], "Resource": "*"},
+              {"Effect": "Allow", "Action": ["dynamodb:GetItem"], "Resource": "*"},
+              {"Effect": "Deny", "Action": "*", "Resource": "*"}
+            ]
+          }
+        }]
+      }
+    },
+    "Bucket": {
+      "Type": "AWS::S3::Bucket",
+      "Properties": {"AccessControl": "PublicRead"},
+      "Metadata": {"SpartaLintSuppressions": ["S3PublicBucket"]}
+    },
+    "BucketPolicy": {
+      "Type": "AWS::S3::BucketPolicy",
+      "Properties": {
+        "Bucket": {"Ref": "Bucket"},
+        "PolicyDocument": {
+          "Statement": [{"Effect": "Allow", "Principal": {"AWS": "*"}, "Action": "s3:GetObject", "Resource": "*"}]
+        }
+      }
+    },
+    "Queue": {"Type": "AWS::SQS::Queue"},
+    "EncryptedQueue": {"Type": "AWS::SQS::Queue", "Properties": {"SqsManagedSseEnabled": true}},
+    "Topic": {"Type": "AWS::SNS::Topic"},
+    "Stream": {"Type": "AWS::Kinesis::Stream", "Properties": {"StreamEncryption": {"EncryptionType": "KMS"}}},
+    "HelloMethod": {
+      "Type": "AWS::ApiGateway::Method",
+      "Properties": {"HttpMethod": "GET", "AuthorizationType": "NONE"}
+    },
+    "HelloOptionsMethod": {
+      "Type": "AWS::ApiGateway::Method",
+      "Properties": {"HttpMethod": "OPTIONS", "AuthorizationType": "NONE"}
+    },
+    "HelloAuthorizedMethod": {
+      "Type": "AWS::ApiGateway::Method",
+      "Properties": {"HttpMethod": "POST", "AuthorizationType": "AWS_IAM"}
+    }
+  }
+}`
+
+func lintTestReport(t *testing.T) *Report {
+	template, templateErr := ParseTemplate([]byte(lintTestTemplate))
+	if templateErr != nil {
+		t.Fatal(templateErr)
+	}
+	return Lint(template)
+}
+
+func TestLint(t *testing.T) {
+	report := lintTestReport(t)
+	expected := map[string]string{
+		RuleIAMWildcardAction + "/HelloLambdaRole":            "Policy allows wildcard action: s3:*",
+		RuleIAMWildcardResource + "/HelloLambdaRole":          "Policy allows actions on all resources: dynamodb:GetItem",
+		RuleLambdaFailureDestination + "/HelloLambda":         "",
+		RuleLambdaLogRetention + "/HelloLambda":               "",
+		RuleS3PublicBucket + "/BucketPolicy":                  "Bucket policy allows s3:GetObject to any principal",
+		RuleSQSQueueEncryption + "/Queue":                     "",
+		RuleSNSTopicEncryption + "/Topic":                     "",
+		RuleAPIMethodAuthorization + "/HelloMethod":           "",
+		RuleLambdaFailureDestination + "/RetainedLambda":      "-",
+		RuleLambdaLogRetention + "/RetainedLambda":            "-",
+		RuleSQSQueueEncryption + "/EncryptedQueue":            "-",
+		RuleKinesisStreamEncryption + "/Stream":               "-",
+		RuleAPIMethodAuthorization + "/HelloOptionsMethod":    "-",
+		RuleAPIMethodAuthorization + "/HelloAuthorizedMethod": "-",
+	}
+	findings := make(map[string]*Finding)
+	for _, eachFinding := range report.Findings {
+		findings[eachFinding.RuleID+"/"+eachFinding.Resource] = eachFinding
+	}
+	for eachKey, eachMessage := range expected {
+		finding, findingExists := findings[eachKey]
+		switch eachMessage {
+		case "-":
+			if findingExists {
+				t.Fatalf("Unexpected finding: %#v", finding)
+			}
+		case "":
+			if !findingExists {
+				t.Fatalf("Expected finding: %s", eachKey)
+			}
+		default:
+			if !findingExists || finding.Message != eachMessage {
+				t.Fatalf("Expected finding %s with message: %s. Found: %#v", eachKey, eachMessage, finding)
+			}
+		}
+	}
+	if len(report.Suppressed) != 1 ||
+		report.Suppressed[0].RuleID != RuleS3PublicBucket ||
+		report.Suppressed[0].Resource != "Bucket" {
+		t.Fatalf("Expected suppressed S3PublicBucket finding. Found: %#v", report.Suppressed)
+	}
+	// Most severe first
+	if report.Findings[0].Severity != SeverityError {
+		t.Fatalf("Expected error findings first. Found: %#v", report.Findings[0])
+	}
+	if !report.Failed(SeverityError) || !report.Failed(SeverityNote) || report.Failed(SeverityNone) {
+		t.Fatalf("Unexpected report failure status: %s", report.Summary())
+	}
+}
+
+func TestLintSuppress(t *testing.T) {
+	cfTemplate := gocf.NewTemplate()
+	topic := cfTemplate.AddResource("Topic", &gocf.SNSTopic{})
+	Suppress(topic, RuleSNSTopicEncryption)
+
+	template, templateErr := NewTemplate(cfTemplate)
+	if templateErr != nil {
+		t.Fatal(templateErr)
+	}
+	report := Lint(template)
+	if len(report.Findings) != 0 || len(report.Suppressed) != 1 {
+		t.Fatalf("Expected suppressed finding. Found: %#v", report)
+	}
+}
+
+func TestLintFormats(t *testing.T) {
+	report := lintTestReport(t)
+
+	var textOutput bytes.Buffer
+	textErr := report.Write(FormatText, &textOutput)
+	if textErr != nil {
+		t.Fatal(textErr)
+	}
+	if !strings.Contains(textOutput.String(), report.Summary()) {
+		t.Fatalf("Expected text summary. Found: %s", textOutput.String())
+	}
+
+	var jsonOutput bytes.Buffer
+	jsonErr := report.Write(FormatJSON, &jsonOutput)
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+	var jsonReport Report
+	unmarshalErr := json.Unmarshal(jsonOutput.Bytes(), &jsonReport)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	if len(jsonReport.Findings) != len(report.Findings) {
+		t.Fatalf("Expected %d JSON findings. Found: %d", len(report.Findings), len(jsonReport.Findings))
+	}
+
+	var sarifOutput bytes.Buffer
+	sarifErr := report.Write(FormatSARIF, &sarifOutput)
+	if sarifErr != nil {
+		t.Fatal(sarifErr)
+	}
+	var sarif sarifLog
+	unmarshalErr = json.Unmarshal(sarifOutput.Bytes(), &sarif)
+	if unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	if sarif.Version != sarifVersion ||
+		len(sarif.Runs) != 1 ||
+		len(sarif.Runs[0].Tool.Driver.Rules) != len(DefaultRules()) ||
+		len(sarif.Runs[0].Results) != len(report.Findings)+len(report.Suppressed) {
+		t.Fatalf("Unexpected SARIF log: %s", sarifOutput.String())
+	}
+	for _, eachResult := range sarif.Runs[0].Results {
+		if sarif.Runs[0].Tool.Driver.Rules[eachResult.RuleIndex].ID != eachResult.RuleID {
+			t.Fatalf("Invalid SARIF rule index: %#v", eachResult)
+		}
+	}
+
+	if report.Write("xml", &textOutput) == nil {
+		t.Fatalf("Expected error for unsupported format")
+	}
+}
@@ -0,0 +1,367 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Built-in rule IDs
+const (
+	// RuleIAMWildcardAction flags IAM policies that allow every action of
+	// a service
+	RuleIAMWildcardAction = "IAMWildcardAction"
+	// RuleIAMWildcardResource flags IAM policies that allow actions on
+	// every resource
+	RuleIAMWildcardResource = "IAMWildcardResource"
+	// RuleLambdaFailureDestination flags Lambda functions without a dead
+	// letter queue or on-failure destination
+	RuleLambdaFailureDestination = "LambdaFailureDestination"
+	// RuleLambdaLogRetention flags Lambda functions without a log group
+	// retention policy
+	RuleLambdaLogRetention = "LambdaLogRetention"
+	// RuleS3PublicBucket flags publicly accessible S3 buckets
+	RuleS3PublicBucket = "S3PublicBucket"
+	// RuleSNSTopicEncryption flags unencrypted SNS topics
+	RuleSNSTopicEncryption = "SNSTopicEncryption"
+	// RuleSQSQueueEncryption flags unencrypted SQS queues
+	RuleSQSQueueEncryption = "SQSQueueEncryption"
+	// RuleKinesisStreamEncryption flags unencrypted Kinesis streams
+	RuleKinesisStreamEncryption = "KinesisStreamEncryption"
+	// RuleAPIMethodAuthorization flags API methods that don't require
+	// authorization or an API key
+	RuleAPIMethodAuthorization = "APIMethodAuthorization"
+)
+
+// wildcardResourceActions are actions that don't support resource-level
+// permissions and so are always granted on all resources. Sparta grants
+// these to every Lambda function role.
+var wildcardResourceActions = map[string]bool{
+	"cloudwatch:putmetricdata":      true,
+	"ec2:createnetworkinterface":    true,
+	"ec2:deletenetworkinterface":    true,
+	"ec2:describenetworkinterfaces": true,
+	"xray:puttelemetryrecords":      true,
+	"xray:puttracesegments":         true,
+	"xray:getsamplingrules":         true,
+	"xray:getsamplingtargets":       true,
+}
+
+// publicBucketACLs are the canned S3 ACLs that grant public access
+var publicBucketACLs = map[string]bool{
+	"AuthenticatedRead": true,
+	"PublicRead":        true,
+	"PublicReadWrite":   true,
+}
+
+// DefaultRules returns the built-in rules
+func DefaultRules() []*Rule {
+	return []*Rule{
+		{
+			ID:          RuleIAMWildcardAction,
+			Description: "IAM policy allows all actions of a service",
+			Severity:    SeverityError,
+			ResourceTypes: []string{"AWS::IAM::Role",
+				"AWS::IAM::Policy",
+				"AWS::IAM::ManagedPolicy"},
+			Check: checkIAMWildcardAction,
+		},
+		{
+			ID:          RuleIAMWildcardResource,
+			Description: "IAM policy allows actions on all resources",
+			Severity:    SeverityWarning,
+			ResourceTypes: []string{"AWS::IAM::Role",
+				"AWS::IAM::Policy",
+				"AWS::IAM::ManagedPolicy"},
+			Check: checkIAMWildcardResource,
+		},
+		{
+			ID:            RuleLambdaFailureDestination,
+			Description:   "Lambda function doesn't have a dead letter queue or on-failure destination for asynchronous invocations",
+			Severity:      SeverityNote,
+			ResourceTypes: []string{"AWS::Lambda::Function"},
+			Check:         checkLambdaFailureDestination,
+		},
+		{
+			ID:            RuleLambdaLogRetention,
+			Description:   "Lambda function log group doesn't have a retention policy",
+			Severity:      SeverityWarning,
+			ResourceTypes: []string{"AWS::Lambda::Function"},
+			Check:         checkLambdaLogRetention,
+		},
+		{
+			ID:          RuleS3PublicBucket,
+			Description: "S3 bucket is publicly accessible",
+			Severity:    SeverityError,
+			ResourceTypes: []string{"AWS::S3::Bucket",
+				"AWS::S3::BucketPolicy"},
+			Check: checkS3PublicBucket,
+		},
+		{
+			ID:            RuleSNSTopicEncryption,
+			Description:   "SNS topic isn't encrypted at rest",
+			Severity:      SeverityWarning,
+			ResourceTypes: []string{"AWS::SNS::Topic"},
+			Check:         checkPropertiesExist("Topic isn't encrypted. Set the KmsMasterKeyId property", "KmsMasterKeyId"),
+		},
+		{
+			ID:            RuleSQSQueueEncryption,
+			Description:   "SQS queue isn't encrypted at rest",
+			Severity:      SeverityWarning,
+			ResourceTypes: []string{"AWS::SQS::Queue"},
+			Check:         checkSQSQueueEncryption,
+		},
+		{
+			ID:            RuleKinesisStreamEncryption,
+			Description:   "Kinesis stream isn't encrypted at rest",
+			Severity:      SeverityWarning,
+			ResourceTypes: []string{"AWS::Kinesis::Stream"},
+			Check:         checkPropertiesExist("Stream isn't encrypted. Set the StreamEncryption property", "StreamEncryption"),
+		},
+		{
+			ID:          RuleAPIMethodAuthorization,
+			Description: "API method doesn't require authorization or an API key",
+			Severity:    SeverityWarning,
+			ResourceTypes: []string{"AWS::ApiGateway::Method",
+				"AWS::ApiGatewayV2::Route"},
+			Check: checkAPIMethodAuthorization,
+		},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Helpers
+//
+
+// asList returns the value as a list. CloudFormation accepts a single
+// value in place of a list for many properties.
+func asList(value interface{}) []interface{} {
+	switch typedValue := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return typedValue
+	default:
+		return []interface{}{typedValue}
+	}
+}
+
+// asMap returns the value as a JSON object, or nil
+func asMap(value interface{}) map[string]interface{} {
+	typedValue, _ := value.(map[string]interface{})
+	return typedValue
+}
+
+// isTrue returns true for a JSON true or "true" value
+func isTrue(value interface{}) bool {
+	switch typedValue := value.(type) {
+	case bool:
+		return typedValue
+	case string:
+		return strings.EqualFold(typedValue, "true")
+	}
+	return false
+}
+
+// refersTo returns true if the value includes a Ref or Fn::GetAtt to the
+// logical resource
+func refersTo(value interface{}, logicalID string) bool {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if typedValue["Ref"] == logicalID {
+			return true
+		}
+		getAtt := asList(typedValue["Fn::GetAtt"])
+		if len(getAtt) != 0 && getAtt[0] == logicalID {
+			return true
+		}
+		for _, eachValue := range typedValue {
+			if refersTo(eachValue, logicalID) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, eachValue := range typedValue {
+			if refersTo(eachValue, logicalID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyStatements returns the Allow statements of the IAM resource
+func policyStatements(resource *Resource) []map[string]interface{} {
+	documents := make([]interface{}, 0)
+	if resource.Type == "AWS::IAM::Role" {
+		for _, eachPolicy := range asList(resource.Properties["Policies"]) {
+			documents = append(documents, asMap(eachPolicy)["PolicyDocument"])
+		}
+	} else {
+		documents = append(documents, resource.Properties["PolicyDocument"])
+	}
+	statements := make([]map[string]interface{}, 0)
+	for _, eachDocument := range documents {
+		for _, eachStatement := range asList(asMap(eachDocument)["Statement"]) {
+			statement := asMap(eachStatement)
+			if statement != nil && statement["Effect"] == "Allow" {
+				statements = append(statements, statement)
+			}
+		}
+	}
+	return statements
+}
+
+// stringValues returns the literal string values
+func stringValues(value interface{}) []string {
+	values := make([]string, 0)
+	for _, eachValue := range asList(value) {
+		if stringValue, isString := eachValue.(string); isString {
+			values = append(values, stringValue)
+		}
+	}
+	return values
+}
+
+// uniqueMessages returns the sorted, unique messages
+func uniqueMessages(messages map[string]bool) []string {
+	sorted := make([]string, 0, len(messages))
+	for eachMessage := range messages {
+		sorted = append(sorted, eachMessage)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// checkPropertiesExist returns a RuleFunc that reports the message if none
+// of the properties are defined
+func checkPropertiesExist(message string, propertyNames ...string) RuleFunc {
+	return func(resource *Resource, template *Template) []string {
+		for _, eachName := range propertyNames {
+			if resource.Properties[eachName] != nil {
+				return nil
+			}
+		}
+		return []string{message}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Rules
+//
+
+func checkIAMWildcardAction(resource *Resource, template *Template) []string {
+	messages := make(map[string]bool)
+	for _, eachStatement := range policyStatements(resource) {
+		for _, eachAction := range stringValues(eachStatement["Action"]) {
+			if eachAction == "*" || strings.HasSuffix(eachAction, ":*") {
+				messages[fmt.Sprintf("Policy allows wildcard action: %s", eachAction)] = true
+			}
+		}
+	}
+	return uniqueMessages(messages)
+}
+
+func checkIAMWildcardResource(resource *Resource, template *Template) []string {
+	messages := make(map[string]bool)
+	for _, eachStatement := range policyStatements(resource) {
+		isWildcard := false
+		for _, eachResource := range stringValues(eachStatement["Resource"]) {
+			isWildcard = isWildcard || eachResource == "*"
+		}
+		if !isWildcard {
+			continue
+		}
+		actions := make([]string, 0)
+		for _, eachAction := range stringValues(eachStatement["Action"]) {
+			if !wildcardResourceActions[strings.ToLower(eachAction)] {
+				actions = append(actions, eachAction)
+			}
+		}
+		if len(actions) != 0 {
+			sort.Strings(actions)
+			messages[fmt.Sprintf("Policy allows actions on all resources: %s",
+				strings.Join(actions, ", "))] = true
+		}
+	}
+	return uniqueMessages(messages)
+}
+
+func checkLambdaFailureDestination(resource *Resource, template *Template) []string {
+	if asMap(resource.Properties["DeadLetterConfig"])["TargetArn"] != nil {
+		return nil
+	}
+	for _, eachConfig := range template.ResourcesOfType("AWS::Lambda::EventInvokeConfig") {
+		if !refersTo(eachConfig.Properties["FunctionName"], resource.LogicalID) {
+			continue
+		}
+		onFailure := asMap(asMap(eachConfig.Properties["DestinationConfig"])["OnFailure"])
+		if onFailure["Destination"] != nil {
+			return nil
+		}
+	}
+	return []string{"Function doesn't have a DeadLetterConfig or an EventInvokeConfig OnFailure destination"}
+}
+
+func checkLambdaLogRetention(resource *Resource, template *Template) []string {
+	functionName, _ := resource.Properties["FunctionName"].(string)
+	for _, eachLogGroup := range template.ResourcesOfType("AWS::Logs::LogGroup") {
+		if eachLogGroup.Properties["RetentionInDays"] == nil {
+			continue
+		}
+		logGroupName := eachLogGroup.Properties["LogGroupName"]
+		if refersTo(logGroupName, resource.LogicalID) ||
+			(functionName != "" && logGroupName == "/aws/lambda/"+functionName) {
+			return nil
+		}
+	}
+	return []string{"Function log group never expires. Add an AWS::Logs::LogGroup with RetentionInDays"}
+}
+
+func checkS3PublicBucket(resource *Resource, template *Template) []string {
+	if resource.Type == "AWS::S3::Bucket" {
+		accessControl, _ := resource.Properties["AccessControl"].(string)
+		if publicBucketACLs[accessControl] {
+			return []string{fmt.Sprintf("Bucket grants public access with the %s ACL", accessControl)}
+		}
+		return nil
+	}
+	messages := make(map[string]bool)
+	for _, eachStatement := range policyStatements(resource) {
+		if eachStatement["Condition"] != nil {
+			continue
+		}
+		principals := stringValues(eachStatement["Principal"])
+		if principalMap := asMap(eachStatement["Principal"]); principalMap != nil {
+			principals = stringValues(principalMap["AWS"])
+		}
+		for _, eachPrincipal := range principals {
+			if eachPrincipal == "*" {
+				messages[fmt.Sprintf("Bucket policy allows %s to any principal",
+					strings.Join(stringValues(eachStatement["Action"]), ", "))] = true
+			}
+		}
+	}
+	return uniqueMessages(messages)
+}
+
+func checkSQSQueueEncryption(resource *Resource, template *Template) []string {
+	if resource.Properties["KmsMasterKeyId"] != nil ||
+		isTrue(resource.Properties["SqsManagedSseEnabled"]) {
+		return nil
+	}
+	return []string{"Queue isn't encrypted. Set the KmsMasterKeyId or SqsManagedSseEnabled property"}
+}
+
+func checkAPIMethodAuthorization(resource *Resource, template *Template) []string {
+	if resource.Type == "AWS::ApiGateway::Method" &&
+		strings.EqualFold(fmt.Sprintf("%v", resource.Properties["HttpMethod"]), "OPTIONS") {
+		return nil
+	}
+	authorizationType := resource.Properties["AuthorizationType"]
+	if (authorizationType != nil && authorizationType != "NONE") ||
+		isTrue(resource.Properties["ApiKeyRequired"]) {
+		return nil
+	}
+	return []string{"Method doesn't require authorization or an API key"}
+}
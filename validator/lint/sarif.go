@@ -0,0 +1,125 @@
+package lint
+
+// SARIF 2.1.0 log types. Only the properties used by the report are
+// included. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRuleConfiguration struct {
+	Level Severity `json:"level"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []*sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+type sarifResult struct {
+	RuleID       string              `json:"ruleId"`
+	RuleIndex    int                 `json:"ruleIndex"`
+	Level        Severity            `json:"level"`
+	Message      sarifMessage        `json:"message"`
+	Locations    []*sarifLocation    `json:"locations"`
+	Suppressions []*sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+// newSARIFLog returns the SARIF log for the report. Suppressed findings
+// are included as results with an inSource suppression.
+func newSARIFLog(report *Report) *sarifLog {
+	run := &sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           "Sparta",
+				InformationURI: "https://gosparta.io",
+				Rules:          make([]*sarifRule, 0, len(report.Rules)),
+			},
+		},
+		Results: make([]*sarifResult, 0, len(report.Findings)+len(report.Suppressed)),
+	}
+	ruleIndex := make(map[string]int, len(report.Rules))
+	for index, eachRule := range report.Rules {
+		ruleIndex[eachRule.ID] = index
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, &sarifRule{
+			ID:               eachRule.ID,
+			ShortDescription: sarifMessage{Text: eachRule.Description},
+			DefaultConfiguration: sarifRuleConfiguration{
+				Level: eachRule.Severity,
+			},
+		})
+	}
+	newResult := func(finding *Finding) *sarifResult {
+		return &sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: ruleIndex[finding.RuleID],
+			Level:     finding.Severity,
+			Message:   sarifMessage{Text: finding.Message},
+			Locations: []*sarifLocation{
+				{
+					LogicalLocations: []*sarifLogicalLocation{
+						{
+							Name:               finding.Resource,
+							FullyQualifiedName: "Resources." + finding.Resource,
+							Kind:               "resource",
+						},
+					},
+				},
+			},
+		}
+	}
+	for _, eachFinding := range report.Findings {
+		run.Results = append(run.Results, newResult(eachFinding))
+	}
+	for _, eachFinding := range report.Suppressed {
+		result := newResult(eachFinding)
+		result.Suppressions = []*sarifSuppression{{Kind: "inSource"}}
+		run.Results = append(run.Results, result)
+	}
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []*sarifRun{run},
+	}
+}
@@ -0,0 +1,63 @@
+package validator
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	sparta "github.com/mweagle/Sparta"
+	"github.com/mweagle/Sparta/validator/lint"
+	gocf "github.com/mweagle/go-cloudformation"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Linter is a validator that evaluates the lint rules against the
+// materialized template. It runs offline. Every finding is logged and
+// provisioning fails if there is a finding at least as severe as failOn.
+// If no rules are provided, the lint.DefaultRules are used.
+func Linter(failOn lint.Severity, rules ...*lint.Rule) sparta.ServiceValidationHookHandler {
+
+	linter := func(ctx context.Context,
+		serviceName string,
+		template *gocf.Template,
+		lambdaFunctionCode *gocf.LambdaFunctionCode,
+		buildID string,
+		awsSession *session.Session,
+		noop bool,
+		logger *zerolog.Logger) (context.Context, error) {
+
+		lintTemplate, lintTemplateErr := lint.NewTemplate(template)
+		if lintTemplateErr != nil {
+			return ctx, lintTemplateErr
+		}
+		report := lint.Lint(lintTemplate, rules...)
+		for _, eachFinding := range report.Findings {
+			var loggerEntry *zerolog.Event
+			switch eachFinding.Severity {
+			case lint.SeverityError:
+				loggerEntry = logger.Error()
+			case lint.SeverityWarning:
+				loggerEntry = logger.Warn()
+			default:
+				loggerEntry = logger.Info()
+			}
+			loggerEntry.
+				Str("Rule", eachFinding.RuleID).
+				Str("Resource", eachFinding.Resource).
+				Str("Type", eachFinding.ResourceType).
+				Msg(eachFinding.Message)
+		}
+		logger.Info().
+			Int("Errors", report.Count(lint.SeverityError)).
+			Int("Warnings", report.Count(lint.SeverityWarning)).
+			Int("Notes", report.Count(lint.SeverityNote)).
+			Int("Suppressed", len(report.Suppressed)).
+			Msg("Template lint complete")
+
+		if report.Failed(failOn) {
+			return ctx, errors.Errorf("Template failed lint rules: %s", report.Summary())
+		}
+		return ctx, nil
+	}
+	return sparta.ServiceValidationHookFunc(linter)
+}